@@ -0,0 +1,193 @@
+package accesslog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"literary-lions/clientip"
+	"literary-lions/config"
+	"literary-lions/logging"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Supported output formats
+const (
+	FormatCombined = "combined"
+	FormatJSON     = "json"
+)
+
+// Logger writes one line per HTTP request in the configured format
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+}
+
+// New creates an access logger writing to out in the given format
+func New(out io.Writer, format string) *Logger {
+	if format != FormatJSON {
+		format = FormatCombined
+	}
+	return &Logger{out: out, format: format}
+}
+
+// NewFromConfig creates an access logger writing to cfg.File, rotated by
+// size, or to stdout when no file is set
+func NewFromConfig(cfg config.AccessLog) (*Logger, error) {
+	var out io.Writer = os.Stdout
+
+	if cfg.File != "" {
+		file, err := NewRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+
+	return New(out, cfg.Format), nil
+}
+
+// entry holds the fields recorded for a single request
+type entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserID     int       `json:"user_id,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// requestInfo is attached to the request context so handlers can report
+// details (such as the authenticated user) back to the access log
+type requestInfo struct {
+	userID int
+}
+
+type contextKey struct{}
+
+// SetUserID records the authenticated user for the request's access log line
+func SetUserID(r *http.Request, userID int) {
+	if info, ok := r.Context().Value(contextKey{}).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
+
+// Middleware logs every request passing through next
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		info := &requestInfo{}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, info))
+
+		// Create a custom ResponseWriter to capture status code and size
+		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next.ServeHTTP(ww, r)
+
+		l.write(entry{
+			Time:       start,
+			RequestID:  logging.RequestID(r.Context()),
+			RemoteAddr: clientip.FromRequest(r),
+			UserID:     info.userID,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     ww.statusCode,
+			Bytes:      ww.bytes,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		})
+	})
+}
+
+func (l *Logger) write(e entry) {
+	var line []byte
+
+	if l.format == FormatJSON {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		line = append(data, '\n')
+	} else {
+		line = []byte(formatCombined(e))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// formatCombined renders an entry in the Apache combined log format,
+// followed by the request ID and duration
+func formatCombined(e entry) string {
+	user := "-"
+	if e.UserID != 0 {
+		user = strconv.Itoa(e.UserID)
+	}
+
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+
+	requestID := e.RequestID
+	if requestID == "" {
+		requestID = "-"
+	}
+
+	return fmt.Sprintf("%s - %s [%s] %q %d %s %q %q %s %.3fms\n",
+		e.RemoteAddr, user, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+e.Path+" "+e.Proto, e.Status, size,
+		orDash(e.Referer), orDash(e.UserAgent), requestID, e.DurationMS)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// responseWriter wraps http.ResponseWriter to capture status code and bytes written
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers (such as pprof) flush through the wrapper
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// assets holds the page templates and static files, so the binary runs
+// from any working directory
+//
+//go:embed templates/*.html static
+var assets embed.FS
+
+// assetFS returns the templates or static directory, embedded or, when
+// fromDisk is set, read live from the working directory for development
+func assetFS(dir string, fromDisk bool) fs.FS {
+	if fromDisk {
+		return os.DirFS(dir)
+	}
+
+	sub, err := fs.Sub(assets, dir)
+	if err != nil {
+		// Only possible for a directory that is not embedded
+		panic(err)
+	}
+	return sub
+}
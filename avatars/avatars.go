@@ -0,0 +1,104 @@
+// Package avatars turns uploaded profile pictures into square JPEGs of a
+// standard size and keeps them on disk or in S3-compatible object storage.
+package avatars
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels bounds the dimensions of uploaded images, since a small file can
+// declare a huge image that would take a lot of memory to decode
+const maxPixels = 40_000_000
+
+// acceptedTypes are the content types that can be uploaded, sniffed from the
+// file's first bytes rather than trusted from the client
+var acceptedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Errors returned by Process for images that cannot be used
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooManyPixels   = errors.New("image dimensions too large")
+	ErrInvalidImage    = errors.New("invalid image")
+)
+
+// Process reads an uploaded image, crops it to a centred square and scales it
+// to size×size pixels. It returns the result as a JPEG.
+func Process(r io.Reader, size int) ([]byte, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	if !acceptedTypes[http.DetectContentType(head)] {
+		return nil, ErrUnsupportedType
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	// Crop the largest centred square
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	// JPEG has no transparency, so transparent areas become white
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, xdraw.Over, nil)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode profile picture: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// Hash returns a short content hash of a processed avatar, used in its URL so
+// browsers fetch a new picture as soon as it changes
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// URL returns the stable URL of a user's avatar, versioned by its hash
+func URL(userID int, hash string) string {
+	return fmt.Sprintf("/avatars/%d?v=%s", userID, hash)
+}
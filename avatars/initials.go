@@ -0,0 +1,44 @@
+package avatars
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Initials draws the default avatar of a member without a profile picture,
+// as an SVG: the initials of their username on a circle whose color is
+// derived from it, so each member always gets the same one. Usernames are
+// split into words at "_", "-" and ".", and up to two initials are shown.
+func Initials(username string) []byte {
+	sum := sha256.Sum256([]byte(username))
+	hue := binary.BigEndian.Uint16(sum[:2]) % 360
+
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64" viewBox="0 0 64 64">`+
+		`<circle cx="32" cy="32" r="32" fill="hsl(%d, 55%%, 45%%)"/>`+
+		`<text x="32" y="32" dy=".35em" text-anchor="middle" font-family="sans-serif" font-size="26" font-weight="bold" fill="#fff">%s</text>`+
+		`</svg>`, hue, html.EscapeString(initials(username))))
+}
+
+// initials returns the uppercased first letters of the first and last words
+// of a username, or "?" if it has none
+func initials(username string) string {
+	words := strings.FieldsFunc(username, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || unicode.IsSpace(r)
+	})
+	if len(words) == 0 {
+		return "?"
+	}
+
+	first, _ := utf8.DecodeRuneInString(words[0])
+	letters := string(unicode.ToUpper(first))
+	if len(words) > 1 {
+		last, _ := utf8.DecodeRuneInString(words[len(words)-1])
+		letters += string(unicode.ToUpper(last))
+	}
+	return letters
+}
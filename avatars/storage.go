@@ -0,0 +1,91 @@
+package avatars
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"literary-lions/config"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrNotFound is returned by Storage.Get when a user has no stored avatar
+var ErrNotFound = errors.New("avatar not found")
+
+// Storage keeps processed avatars by user ID
+type Storage interface {
+	Put(ctx context.Context, userID int, data []byte) error
+	Get(ctx context.Context, userID int) ([]byte, error)
+	Delete(ctx context.Context, userID int) error
+}
+
+// NewFromConfig creates the storage configured in cfg
+func NewFromConfig(cfg config.Avatars) (Storage, error) {
+	switch cfg.Storage {
+	case "disk":
+		return NewDiskStorage(cfg.Dir)
+	case "s3":
+		return NewS3Storage(cfg.S3), nil
+	default:
+		return nil, fmt.Errorf("unknown avatar storage %q", cfg.Storage)
+	}
+}
+
+// objectName is the file or object name an avatar is stored under
+func objectName(userID int) string {
+	return strconv.Itoa(userID) + ".jpg"
+}
+
+// DiskStorage keeps avatars as files in a directory
+type DiskStorage struct {
+	dir string
+}
+
+// NewDiskStorage creates storage in dir, creating the directory if needed
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create avatar directory: %v", err)
+	}
+	return &DiskStorage{dir: dir}, nil
+}
+
+// Put writes the avatar to a temporary file first and renames it into place,
+// so a picture being served is never half-written
+func (s *DiskStorage) Put(ctx context.Context, userID int, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// CreateTemp makes the file private; let a web server in front read it
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, objectName(userID)))
+}
+
+func (s *DiskStorage) Get(ctx context.Context, userID int) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, objectName(userID)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *DiskStorage) Delete(ctx context.Context, userID int) error {
+	err := os.Remove(filepath.Join(s.dir, objectName(userID)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxEntries bounds the number of cached values. When the cache is full,
+// expired entries are purged and, if that is not enough, new values are
+// simply not stored.
+const maxEntries = 1024
+
+// Cache is a small concurrency-safe key/value cache whose entries expire
+// after a fixed TTL. A nil *Cache is valid and caches nothing, so callers
+// can disable caching without extra checks.
+type Cache struct {
+	mu    sync.RWMutex
+	ttl   time.Duration
+	items map[string]item
+}
+
+type item struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// New creates a cache whose entries live for ttl. It returns nil (caching
+// disabled) when ttl is not positive.
+func New(ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &Cache{
+		ttl:   ttl,
+		items: make(map[string]item),
+	}
+}
+
+// Get returns the value stored under key if it exists and hasn't expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.RLock()
+	it, ok := c.items[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(it.expiresAt) {
+		return nil, false
+	}
+	return it.value, true
+}
+
+// Set stores value under key for the cache's TTL
+func (c *Cache) Set(key string, value interface{}) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, exists := c.items[key]; !exists && len(c.items) >= maxEntries {
+		for k, it := range c.items {
+			if now.After(it.expiresAt) {
+				delete(c.items, k)
+			}
+		}
+		if len(c.items) >= maxEntries {
+			return
+		}
+	}
+
+	c.items[key] = item{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// Delete removes key from the cache
+func (c *Cache) Delete(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+}
+
+// DeletePrefix removes every key starting with prefix
+func (c *Cache) DeletePrefix(prefix string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	for k := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.items, k)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Clear removes all entries
+func (c *Cache) Clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.items = make(map[string]item)
+	c.mu.Unlock()
+}
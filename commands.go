@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"literary-lions/config"
+	"literary-lions/database"
+	"os"
+	"strconv"
+)
+
+// runCommand handles command-line subcommands. It returns false when no
+// subcommand was given and the server should start normally.
+func runCommand(ctx context.Context, db *database.DB, cfg *config.Config, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "migrate":
+		if err := runMigrate(ctx, db, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			os.Exit(1)
+		}
+	case "seed":
+		if err := runSeed(ctx, db, cfg.Admin, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "seed:", err)
+			os.Exit(1)
+		}
+	case "dump":
+		if err := runDump(ctx, db, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "dump:", err)
+			os.Exit(1)
+		}
+	case "restore":
+		if err := runRestore(ctx, db, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "restore:", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		fmt.Fprintln(os.Stderr, "usage: literary-lions [flags] [migrate up|down [n]|status] [seed [flags]] [dump [-o file]] [restore [-i file]]")
+		os.Exit(2)
+	}
+
+	return true
+}
+
+// runMigrate applies, rolls back, or lists schema migrations
+func runMigrate(ctx context.Context, db *database.DB, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		if err := db.Migrate(ctx); err != nil {
+			return err
+		}
+		fmt.Println("All migrations applied")
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+			steps = n
+		}
+		if err := db.MigrateDown(ctx, steps); err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", steps)
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				fmt.Printf("[x] %04d_%s (applied %s)\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("[ ] %04d_%s\n", s.Version, s.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action %q (expected up, down or status)", action)
+	}
+
+	return nil
+}
+
+// runSeed fills the database with fake data for local development
+func runSeed(ctx context.Context, db *database.DB, admin config.Admin, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	opts := database.SeedOptions{}
+	flags.IntVar(&opts.Users, "users", 50, "number of users to create")
+	flags.IntVar(&opts.Posts, "posts", 200, "number of posts to create")
+	flags.IntVar(&opts.Comments, "comments", 1000, "number of comments to create")
+	flags.IntVar(&opts.Likes, "likes", 2000, "number of post and comment votes to create")
+	flags.Int64Var(&opts.Seed, "seed", 1, "random seed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := db.InitDB(ctx, admin); err != nil {
+		return err
+	}
+
+	if err := db.SeedDemoData(ctx, opts); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %d users, %d posts, %d comments and up to %d votes (password for all users: \"password\")\n",
+		opts.Users, opts.Posts, opts.Comments, opts.Likes)
+	return nil
+}
+
+// runDump writes all forum data to a portable JSON archive
+func runDump(ctx context.Context, db *database.DB, args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	output := flags.String("o", "", "write the archive to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return db.Dump(ctx, os.Stdout)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := db.Dump(ctx, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runRestore replaces all forum data with the contents of an archive
+func runRestore(ctx context.Context, db *database.DB, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := flags.String("i", "", "read the archive from this file instead of stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if err := db.Migrate(ctx); err != nil {
+		return err
+	}
+
+	if err := db.Restore(ctx, in); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Archive restored")
+	return nil
+}
@@ -0,0 +1,724 @@
+// Package config loads the forum's settings. Values start from built-in
+// defaults and are overridden, in order, by an optional YAML or TOML file,
+// environment variables and command-line flags. The result is validated
+// before the server starts.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"literary-lions/clientip"
+	"literary-lions/features"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the forum
+type Config struct {
+	Server    Server    `yaml:"server" toml:"server"`
+	Log       Log       `yaml:"log" toml:"log"`
+	TLS       TLS       `yaml:"tls" toml:"tls"`
+	Database  Database  `yaml:"database" toml:"database"`
+	Sessions  Sessions  `yaml:"sessions" toml:"sessions"`
+	Admin     Admin     `yaml:"admin" toml:"admin"`
+	Cache     Cache     `yaml:"cache" toml:"cache"`
+	Backup    Backup    `yaml:"backup" toml:"backup"`
+	AccessLog AccessLog `yaml:"access_log" toml:"access_log"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+
+	ErrorReporting ErrorReporting `yaml:"error_reporting" toml:"error_reporting"`
+	Avatars        Avatars        `yaml:"avatars" toml:"avatars"`
+	OpenLibrary    OpenLibrary    `yaml:"open_library" toml:"open_library"`
+	ImageProxy     ImageProxy     `yaml:"image_proxy" toml:"image_proxy"`
+	Scanner        Scanner        `yaml:"scanner" toml:"scanner"`
+	BookCards      BookCards      `yaml:"book_cards" toml:"book_cards"`
+	Spam           Spam           `yaml:"spam" toml:"spam"`
+	Mail           Mail           `yaml:"mail" toml:"mail"`
+	Content        Content        `yaml:"content" toml:"content"`
+	Cooldown       Cooldown       `yaml:"cooldown" toml:"cooldown"`
+	Trust          Trust          `yaml:"trust" toml:"trust"`
+	Retention      Retention      `yaml:"retention" toml:"retention"`
+
+	// Features fixes feature flags on or off by name, overriding what admins
+	// set in the admin panel
+	Features map[string]bool `yaml:"features" toml:"features"`
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port            int           `yaml:"port" toml:"port"`
+	Env             string        `yaml:"env" toml:"env"`                         // "production" disables development test routes
+	Debug           bool          `yaml:"debug" toml:"debug"`                     // exposes /debug/pprof/ to admins
+	TemplateReload  bool          `yaml:"template_reload" toml:"template_reload"` // serve templates and static files from disk
+	Compression     bool          `yaml:"compression" toml:"compression"`         // brotli/gzip for text responses
+	RequestTimeout  time.Duration `yaml:"request_timeout" toml:"request_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+
+	// Connection limits, so slow or idle clients cannot tie up connections
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+
+	// BaseURL is the forum's public address, such as https://forum.example.com,
+	// used for links in emails. When empty links use the address of the
+	// request that sends them.
+	BaseURL string `yaml:"base_url" toml:"base_url"`
+
+	// Reverse proxies (IPs or CIDR ranges) whose X-Forwarded-For and
+	// X-Real-IP headers are believed when working out client addresses
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+// Log configures the application log. Access log lines are configured
+// separately in AccessLog.
+type Log struct {
+	Level  string `yaml:"level" toml:"level"`   // "debug", "info", "warn" or "error"
+	Format string `yaml:"format" toml:"format"` // "text" or "json"
+}
+
+// TLS serves the forum over HTTPS, either with certificate files or with
+// certificates obtained from Let's Encrypt for Domains. It is off when
+// neither is set.
+type TLS struct {
+	CertFile     string   `yaml:"cert_file" toml:"cert_file"`
+	KeyFile      string   `yaml:"key_file" toml:"key_file"`
+	Domains      []string `yaml:"domains" toml:"domains"`             // domains to get Let's Encrypt certificates for
+	CacheDir     string   `yaml:"cache_dir" toml:"cache_dir"`         // where Let's Encrypt certificates are stored
+	Email        string   `yaml:"email" toml:"email"`                 // contact address for Let's Encrypt
+	RedirectPort int      `yaml:"redirect_port" toml:"redirect_port"` // plain HTTP port redirecting to HTTPS; 0 disables
+}
+
+// Enabled reports whether the server should use HTTPS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || len(t.Domains) > 0
+}
+
+// Autocert reports whether certificates come from Let's Encrypt
+func (t TLS) Autocert() bool {
+	return len(t.Domains) > 0
+}
+
+// Database configures the database connection and its background jobs
+type Database struct {
+	Driver              string        `yaml:"driver" toml:"driver"` // "sqlite3" or "postgres"
+	URL                 string        `yaml:"url" toml:"url"`       // SQLite file path or PostgreSQL DSN
+	SQLite              SQLite        `yaml:"sqlite" toml:"sqlite"`
+	Pool                Pool          `yaml:"pool" toml:"pool"`
+	SlowQueryThreshold  time.Duration `yaml:"slow_query_threshold" toml:"slow_query_threshold"` // 0 disables slow query logging
+	MaintenanceInterval time.Duration `yaml:"maintenance_interval" toml:"maintenance_interval"` // 0 disables maintenance
+	ArchiveAfterMonths  int           `yaml:"archive_after_months" toml:"archive_after_months"` // 0 disables archiving
+	PublishInterval     time.Duration `yaml:"publish_interval" toml:"publish_interval"`         // how often scheduled posts that are due get published
+}
+
+// SQLite holds the pragmas applied to every SQLite connection
+type SQLite struct {
+	JournalMode string `yaml:"journal_mode" toml:"journal_mode"`
+	BusyTimeout int    `yaml:"busy_timeout" toml:"busy_timeout"` // milliseconds
+	Synchronous string `yaml:"synchronous" toml:"synchronous"`
+	ForeignKeys bool   `yaml:"foreign_keys" toml:"foreign_keys"`
+	AutoVacuum  string `yaml:"auto_vacuum" toml:"auto_vacuum"`
+}
+
+// Pool sizes the connection pool. Zero values use the database's defaults.
+type Pool struct {
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"` // negative keeps none
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+}
+
+// Sessions configures login sessions
+type Sessions struct {
+	Store           string        `yaml:"store" toml:"store"` // "database" or "redis"
+	RedisURL        string        `yaml:"redis_url" toml:"redis_url"`
+	Lifetime        time.Duration `yaml:"lifetime" toml:"lifetime"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" toml:"cleanup_interval"`
+}
+
+// Admin holds the credentials of the admin account created on first start
+type Admin struct {
+	Username string `yaml:"username" toml:"username"`
+	Email    string `yaml:"email" toml:"email"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// Cache configures the in-memory read cache
+type Cache struct {
+	TTL time.Duration `yaml:"ttl" toml:"ttl"` // 0 disables caching
+}
+
+// Backup configures periodic SQLite snapshots
+type Backup struct {
+	Dir      string        `yaml:"dir" toml:"dir"` // backups are off when empty
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+	Retain   int           `yaml:"retain" toml:"retain"`
+}
+
+// AccessLog configures the HTTP access log
+type AccessLog struct {
+	Format     string `yaml:"format" toml:"format"` // "combined" or "json"
+	File       string `yaml:"file" toml:"file"`     // stdout when empty
+	MaxSizeMB  int    `yaml:"max_size_mb" toml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups" toml:"max_backups"`
+}
+
+// Avatars configures uploaded profile pictures
+type Avatars struct {
+	Storage     string `yaml:"storage" toml:"storage"` // "disk" or "s3"
+	Dir         string `yaml:"dir" toml:"dir"`         // directory used with disk storage
+	S3          S3     `yaml:"s3" toml:"s3"`
+	MaxUploadMB int    `yaml:"max_upload_mb" toml:"max_upload_mb"`
+	Size        int    `yaml:"size" toml:"size"` // width and height of stored pictures, in pixels
+}
+
+// S3 locates a bucket in S3 or an S3-compatible service such as MinIO
+type S3 struct {
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"` // AWS S3 in Region when empty
+	Region          string `yaml:"region" toml:"region"`
+	Bucket          string `yaml:"bucket" toml:"bucket"`
+	Prefix          string `yaml:"prefix" toml:"prefix"` // prepended to object names
+	AccessKeyID     string `yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" toml:"secret_access_key"`
+}
+
+// OpenLibrary configures book lookups in the Open Library catalogue, used
+// when members set the book they're reading
+type OpenLibrary struct {
+	URL     string        `yaml:"url" toml:"url"`
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// ImageProxy serves images from other sites, such as book covers and
+// profile pictures stored elsewhere, through the forum's own origin
+type ImageProxy struct {
+	Enabled   bool          `yaml:"enabled" toml:"enabled"`
+	Key       string        `yaml:"key" toml:"key"`                 // signs proxied image URLs; random on each start when empty
+	MaxSizeMB int           `yaml:"max_size_mb" toml:"max_size_mb"` // largest image fetched
+	MaxWidth  int           `yaml:"max_width" toml:"max_width"`     // widest image served, in pixels; wider ones are scaled down
+	Timeout   time.Duration `yaml:"timeout" toml:"timeout"`         // how long fetching an image may take
+	CacheTTL  time.Duration `yaml:"cache_ttl" toml:"cache_ttl"`     // how long fetched images are kept in memory
+}
+
+// Scanner checks uploaded files, such as profile pictures and Goodreads
+// exports, for viruses and malware. Uploads are not scanned when
+// ClamdAddress is empty.
+type Scanner struct {
+	ClamdAddress  string        `yaml:"clamd_address" toml:"clamd_address"`   // host:port, tcp://host:port or unix:///path of a ClamAV daemon
+	Timeout       time.Duration `yaml:"timeout" toml:"timeout"`               // how long scanning a file may take
+	FailClosed    bool          `yaml:"fail_closed" toml:"fail_closed"`       // refuse uploads when they cannot be scanned, rather than let them through
+	QuarantineDir string        `yaml:"quarantine_dir" toml:"quarantine_dir"` // where flagged files are kept for review; discarded when empty
+}
+
+// BookCards configures the cards shown under posts for the books they link
+// to on Open Library, Goodreads and publishers' sites
+type BookCards struct {
+	Publishers []string      `yaml:"publishers" toml:"publishers"`   // publishers' domains whose book pages get a card
+	Timeout    time.Duration `yaml:"timeout" toml:"timeout"`         // how long fetching a book page may take
+	RetryAfter time.Duration `yaml:"retry_after" toml:"retry_after"` // how long until a link no book was found for is tried again
+}
+
+// Spam configures the checks new posts and comments go through. Those that
+// look like spam are held for a moderator instead of being published.
+// Members count as new for spam checks as long as they do for cooldowns.
+type Spam struct {
+	MaxLinks           int           `yaml:"max_links" toml:"max_links"`                         // most links a post or comment may have
+	NewAccountMaxLinks int           `yaml:"new_account_max_links" toml:"new_account_max_links"` // most links new members' posts and comments may have
+	DuplicateWindow    time.Duration `yaml:"duplicate_window" toml:"duplicate_window"`           // how long posting the same text again is held; 0 to allow it
+	AkismetKey         string        `yaml:"akismet_key" toml:"akismet_key"`                     // API key of an Akismet-compatible service; not used when empty
+	AkismetURL         string        `yaml:"akismet_url" toml:"akismet_url"`                     // address of its API
+	Timeout            time.Duration `yaml:"timeout" toml:"timeout"`                             // how long asking it may take
+}
+
+// Mail configures the SMTP server email is sent through, such as address
+// change confirmations. Without a host, emails are written to the log.
+type Mail struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"` // no authentication when empty
+	Password string `yaml:"password" toml:"password"`
+	From     string `yaml:"from" toml:"from"` // sender address, optionally with a name
+}
+
+// ErrorReporting forwards panics and server errors to a Sentry-compatible
+// error tracking service. It is off when DSN is empty.
+type ErrorReporting struct {
+	DSN     string `yaml:"dsn" toml:"dsn"`         // https://<key>@<host>/<project>
+	Release string `yaml:"release" toml:"release"` // version reported with events
+}
+
+// Content limits the length of what members write, in characters
+type Content struct {
+	Title     Length `yaml:"title" toml:"title"`         // post titles
+	Post      Length `yaml:"post" toml:"post"`           // post text
+	Comment   Length `yaml:"comment" toml:"comment"`     // comments and replies
+	Signature Length `yaml:"signature" toml:"signature"` // profile signatures, which may also be left empty
+}
+
+// Cooldown is the least time members must wait between two of their posts
+// and between two of their comments. Accounts younger than NewAccountAge
+// wait the longer NewPost and NewComment instead. A zero interval leaves
+// that kind of contribution unthrottled; admins never wait.
+type Cooldown struct {
+	Post          time.Duration `yaml:"post" toml:"post"`
+	Comment       time.Duration `yaml:"comment" toml:"comment"`
+	NewAccountAge time.Duration `yaml:"new_account_age" toml:"new_account_age"`
+	NewPost       time.Duration `yaml:"new_post" toml:"new_post"`
+	NewComment    time.Duration `yaml:"new_comment" toml:"new_comment"`
+}
+
+// Trust sets when members are promoted from new to member and from member
+// to regular: their account must be old enough and they must have written
+// enough posts and comments. New members can't post links or upload
+// profile pictures; regulars skip cooldowns and get the regular post rate
+// limit. Levels are recomputed every Interval.
+type Trust struct {
+	MemberAge            time.Duration `yaml:"member_age" toml:"member_age"`
+	MemberContributions  int           `yaml:"member_contributions" toml:"member_contributions"`
+	RegularAge           time.Duration `yaml:"regular_age" toml:"regular_age"`
+	RegularContributions int           `yaml:"regular_contributions" toml:"regular_contributions"`
+	Interval             time.Duration `yaml:"interval" toml:"interval"`
+}
+
+// Retention sets how long data that is no longer needed is kept before it
+// is purged for good, every Interval. Expired email change confirmations
+// are always purged. With DryRun what would be purged is only logged.
+type Retention struct {
+	Interval  time.Duration `yaml:"interval" toml:"interval"`     // 0 disables purging
+	TrashDays int           `yaml:"trash_days" toml:"trash_days"` // trashed posts and comments; 0 keeps them
+	DraftDays int           `yaml:"draft_days" toml:"draft_days"` // unpublished review drafts; 0 keeps them
+	DryRun    bool          `yaml:"dry_run" toml:"dry_run"`
+}
+
+// Length is the shortest and longest a text may be, in characters
+type Length struct {
+	Min int `yaml:"min" toml:"min"`
+	Max int `yaml:"max" toml:"max"`
+}
+
+// RateLimit limits how often one user, or one address when logged out, may
+// use each group of routes
+type RateLimit struct {
+	Enabled bool  `yaml:"enabled" toml:"enabled"`
+	Auth    Limit `yaml:"auth" toml:"auth"`       // logging in and registering
+	Post    Limit `yaml:"post" toml:"post"`       // creating, editing and liking posts and comments
+	Regular Limit `yaml:"regular" toml:"regular"` // the same for members trusted as regulars
+	Search  Limit `yaml:"search" toml:"search"`   // search suggestions API
+	Static  Limit `yaml:"static" toml:"static"`   // static files, limited by address only
+}
+
+// Limit is a token bucket: Requests tokens are added every Per, and up to
+// Burst can be saved up. A Requests of 0 leaves the routes unlimited.
+type Limit struct {
+	Requests int           `yaml:"requests" toml:"requests"`
+	Per      time.Duration `yaml:"per" toml:"per"`
+	Burst    int           `yaml:"burst" toml:"burst"`
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:            8080,
+			Compression:     true,
+			RequestTimeout:  30 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       60 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		TLS: TLS{
+			CacheDir:     "certs",
+			RedirectPort: 80,
+		},
+		Database: Database{
+			Driver: "sqlite3",
+			URL:    "forum.db",
+			SQLite: SQLite{
+				JournalMode: "WAL",
+				BusyTimeout: 5000,
+				Synchronous: "NORMAL",
+				ForeignKeys: true,
+				AutoVacuum:  "INCREMENTAL",
+			},
+			SlowQueryThreshold:  200 * time.Millisecond,
+			MaintenanceInterval: 24 * time.Hour,
+			PublishInterval:     time.Minute,
+		},
+		Sessions: Sessions{
+			Store:           "database",
+			RedisURL:        "redis://localhost:6379/0",
+			Lifetime:        24 * time.Hour,
+			CleanupInterval: time.Hour,
+		},
+		Admin: Admin{
+			Username: "admin",
+			Email:    "admin@admin.com",
+			Password: "admin",
+		},
+		Cache: Cache{
+			TTL: 30 * time.Second,
+		},
+		Backup: Backup{
+			Interval: 24 * time.Hour,
+			Retain:   7,
+		},
+		AccessLog: AccessLog{
+			Format:     "combined",
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		Avatars: Avatars{
+			Storage:     "disk",
+			Dir:         "uploads/avatars",
+			S3:          S3{Region: "us-east-1", Prefix: "avatars/"},
+			MaxUploadMB: 5,
+			Size:        256,
+		},
+		OpenLibrary: OpenLibrary{
+			URL:     "https://openlibrary.org",
+			Timeout: 5 * time.Second,
+		},
+		ImageProxy: ImageProxy{
+			Enabled:   true,
+			MaxSizeMB: 5,
+			MaxWidth:  1024,
+			Timeout:   10 * time.Second,
+			CacheTTL:  time.Hour,
+		},
+		Scanner: Scanner{
+			Timeout: 30 * time.Second,
+		},
+		BookCards: BookCards{
+			Publishers: []string{
+				"penguinrandomhouse.com", "harpercollins.com", "us.macmillan.com", "simonandschuster.com",
+				"hachettebookgroup.com", "bloomsbury.com", "panmacmillan.com", "faber.co.uk",
+			},
+			Timeout:    10 * time.Second,
+			RetryAfter: 24 * time.Hour,
+		},
+		Spam: Spam{
+			MaxLinks:           10,
+			NewAccountMaxLinks: 2,
+			DuplicateWindow:    24 * time.Hour,
+			AkismetURL:         "https://rest.akismet.com/1.1",
+			Timeout:            5 * time.Second,
+		},
+		Mail: Mail{
+			Port: 587,
+			From: "Literary Lions <noreply@localhost>",
+		},
+		Content: Content{
+			Title:     Length{Min: 1, Max: 200},
+			Post:      Length{Min: 1, Max: 20000},
+			Comment:   Length{Min: 1, Max: 5000},
+			Signature: Length{Min: 0, Max: 500},
+		},
+		Cooldown: Cooldown{
+			Post:          2 * time.Minute,
+			Comment:       15 * time.Second,
+			NewAccountAge: 24 * time.Hour,
+			NewPost:       10 * time.Minute,
+			NewComment:    time.Minute,
+		},
+		Trust: Trust{
+			MemberAge:            24 * time.Hour,
+			MemberContributions:  3,
+			RegularAge:           30 * 24 * time.Hour,
+			RegularContributions: 50,
+			Interval:             time.Hour,
+		},
+		Retention: Retention{
+			Interval:  24 * time.Hour,
+			TrashDays: 90,
+			DraftDays: 365,
+		},
+		RateLimit: RateLimit{
+			Enabled: true,
+			Auth:    Limit{Requests: 10, Per: time.Minute, Burst: 5},
+			Post:    Limit{Requests: 30, Per: time.Minute, Burst: 10},
+			Regular: Limit{Requests: 90, Per: time.Minute, Burst: 30},
+			Search:  Limit{Requests: 120, Per: time.Minute, Burst: 20},
+			Static:  Limit{Requests: 600, Per: time.Minute, Burst: 200},
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the file named by the
+// -config flag or CONFIG_FILE, the environment and the flags in args, and
+// validates it. It returns the arguments left after the flags, such as a
+// subcommand.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("literary-lions", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	port := flags.Int("port", 0, "HTTP port to listen on")
+	driver := flags.String("database-driver", "", "database backend: sqlite3 or postgres")
+	dbURL := flags.String("database-url", "", "SQLite file path or PostgreSQL DSN")
+	env := flags.String("env", "", `environment name; "production" disables test routes`)
+	debug := flags.Bool("debug", false, "expose /debug/pprof/ to admins")
+	logLevel := flags.String("log-level", "", "minimum log level: debug, info, warn or error")
+	templateReload := flags.Bool("template-reload", false, "serve templates and static files from disk, re-reading them on every request")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, nil, err
+	}
+
+	// Only flags given on the command line override earlier sources
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Server.Port = *port
+		case "database-driver":
+			cfg.Database.Driver = *driver
+		case "database-url":
+			cfg.Database.URL = *dbURL
+		case "env":
+			cfg.Server.Env = *env
+		case "debug":
+			cfg.Server.Debug = *debug
+		case "log-level":
+			cfg.Log.Level = *logLevel
+		case "template-reload":
+			cfg.Server.TemplateReload = *templateReload
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, flags.Args(), nil
+}
+
+// loadFile overrides settings with those in a YAML (.yaml, .yml) or TOML
+// (.toml) file. Unknown keys are rejected so typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open config file: %v", err)
+		}
+		defer f.Close()
+
+		decoder := yaml.NewDecoder(f)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	case ".toml":
+		meta, err := toml.DecodeFile(path, c)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown setting %q in %s", undecoded[0].String(), path)
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.RequestTimeout > 0, "server.request_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout >= c.Server.RequestTimeout, "server.write_timeout must be at least server.request_timeout")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.MaxHeaderBytes >= 4096, "server.max_header_bytes must be at least 4096")
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := clientip.ParseNetwork(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: %v", err))
+		}
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json, got %q", c.Log.Format)
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	check(c.TLS.CertFile == "" || len(c.TLS.Domains) == 0, "tls.domains cannot be combined with tls.cert_file")
+	check(!c.TLS.Autocert() || c.TLS.CacheDir != "", "tls.cache_dir is required with tls.domains")
+	check(c.TLS.RedirectPort >= 0 && c.TLS.RedirectPort <= 65535, "tls.redirect_port must be between 0 and 65535, got %d", c.TLS.RedirectPort)
+	check(!c.TLS.Enabled() || c.TLS.RedirectPort != c.Server.Port, "tls.redirect_port must differ from server.port")
+
+	switch strings.ToLower(c.Database.Driver) {
+	case "", "sqlite", "sqlite3", "postgres", "postgresql", "pgx":
+	default:
+		errs = append(errs, fmt.Errorf("database.driver must be sqlite3 or postgres, got %q", c.Database.Driver))
+	}
+	check(c.Database.URL != "", "database.url is required")
+	check(c.Database.SQLite.BusyTimeout >= 0, "database.sqlite.busy_timeout must not be negative")
+	check(c.Database.Pool.MaxOpenConns >= 0, "database.pool.max_open_conns must not be negative")
+	check(c.Database.Pool.ConnMaxLifetime >= 0, "database.pool.conn_max_lifetime must not be negative")
+	check(c.Database.Pool.ConnMaxIdleTime >= 0, "database.pool.conn_max_idle_time must not be negative")
+	check(c.Database.SlowQueryThreshold >= 0, "database.slow_query_threshold must not be negative")
+	check(c.Database.MaintenanceInterval >= 0, "database.maintenance_interval must not be negative")
+	check(c.Database.ArchiveAfterMonths >= 0, "database.archive_after_months must not be negative")
+	check(c.Database.PublishInterval > 0, "database.publish_interval must be positive")
+
+	check(c.Sessions.Store == "database" || c.Sessions.Store == "redis", "sessions.store must be database or redis, got %q", c.Sessions.Store)
+	check(c.Sessions.Store != "redis" || c.Sessions.RedisURL != "", "sessions.redis_url is required when sessions.store is redis")
+	check(c.Sessions.Lifetime > 0, "sessions.lifetime must be positive")
+	check(c.Sessions.CleanupInterval > 0, "sessions.cleanup_interval must be positive")
+
+	check(c.Admin.Username != "", "admin.username is required")
+	check(strings.Contains(c.Admin.Email, "@"), "admin.email must be an email address")
+	check(c.Admin.Password != "", "admin.password is required")
+
+	check(c.Cache.TTL >= 0, "cache.ttl must not be negative")
+
+	check(c.Backup.Interval > 0, "backup.interval must be positive")
+	check(c.Backup.Retain > 0, "backup.retain must be positive")
+
+	check(c.AccessLog.Format == "combined" || c.AccessLog.Format == "json", "access_log.format must be combined or json, got %q", c.AccessLog.Format)
+	check(c.AccessLog.MaxSizeMB > 0, "access_log.max_size_mb must be positive")
+	check(c.AccessLog.MaxBackups > 0, "access_log.max_backups must be positive")
+
+	for _, group := range []struct {
+		name  string
+		limit Limit
+	}{
+		{"auth", c.RateLimit.Auth},
+		{"post", c.RateLimit.Post},
+		{"regular", c.RateLimit.Regular},
+		{"search", c.RateLimit.Search},
+		{"static", c.RateLimit.Static},
+	} {
+		name, limit := group.name, group.limit
+		check(limit.Requests >= 0, "rate_limit.%s.requests must not be negative", name)
+		check(limit.Requests == 0 || limit.Per > 0, "rate_limit.%s.per must be positive", name)
+		check(limit.Requests == 0 || limit.Burst > 0, "rate_limit.%s.burst must be positive", name)
+	}
+
+	for _, field := range []struct {
+		name     string
+		length   Length
+		required bool
+	}{
+		{"title", c.Content.Title, true},
+		{"post", c.Content.Post, true},
+		{"comment", c.Content.Comment, true},
+		{"signature", c.Content.Signature, false},
+	} {
+		name, length := field.name, field.length
+		check(length.Min >= 0, "content.%s.min must not be negative", name)
+		check(!field.required || length.Min > 0, "content.%s.min must be at least 1", name)
+		check(length.Max > 0 && length.Max >= length.Min, "content.%s.max must be positive and at least content.%s.min", name, name)
+	}
+
+	check(c.Cooldown.Post >= 0 && c.Cooldown.Comment >= 0, "cooldown.post and cooldown.comment must not be negative")
+	check(c.Cooldown.NewAccountAge >= 0, "cooldown.new_account_age must not be negative")
+	check(c.Cooldown.NewPost >= 0 && c.Cooldown.NewComment >= 0, "cooldown.new_post and cooldown.new_comment must not be negative")
+
+	check(c.Trust.MemberAge >= 0 && c.Trust.MemberContributions >= 0, "trust.member_age and trust.member_contributions must not be negative")
+	check(c.Trust.RegularAge >= c.Trust.MemberAge, "trust.regular_age must be at least trust.member_age")
+	check(c.Trust.RegularContributions >= c.Trust.MemberContributions, "trust.regular_contributions must be at least trust.member_contributions")
+	check(c.Trust.Interval > 0, "trust.interval must be positive")
+
+	check(c.Retention.Interval >= 0, "retention.interval must not be negative")
+	check(c.Retention.TrashDays >= 0 && c.Retention.DraftDays >= 0, "retention.trash_days and retention.draft_days must not be negative")
+
+	check(c.Avatars.Storage == "disk" || c.Avatars.Storage == "s3", "avatars.storage must be disk or s3, got %q", c.Avatars.Storage)
+	check(c.Avatars.Storage != "disk" || c.Avatars.Dir != "", "avatars.dir is required with disk storage")
+	if c.Avatars.Storage == "s3" {
+		check(c.Avatars.S3.Bucket != "", "avatars.s3.bucket is required with s3 storage")
+		check(c.Avatars.S3.Region != "", "avatars.s3.region is required with s3 storage")
+		check(c.Avatars.S3.AccessKeyID != "" && c.Avatars.S3.SecretAccessKey != "", "avatars.s3.access_key_id and avatars.s3.secret_access_key are required with s3 storage")
+	}
+	check(c.Avatars.MaxUploadMB > 0, "avatars.max_upload_mb must be positive")
+	check(c.Avatars.Size >= 32 && c.Avatars.Size <= 1024, "avatars.size must be between 32 and 1024, got %d", c.Avatars.Size)
+
+	if u, err := url.Parse(c.OpenLibrary.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("open_library.url must be an http or https URL, got %q", c.OpenLibrary.URL))
+	}
+	check(c.OpenLibrary.Timeout > 0, "open_library.timeout must be positive")
+
+	check(c.ImageProxy.MaxSizeMB > 0, "image_proxy.max_size_mb must be positive")
+	check(c.ImageProxy.MaxWidth >= 32 && c.ImageProxy.MaxWidth <= 4096, "image_proxy.max_width must be between 32 and 4096, got %d", c.ImageProxy.MaxWidth)
+	check(c.ImageProxy.Timeout > 0, "image_proxy.timeout must be positive")
+	check(c.ImageProxy.CacheTTL >= 0, "image_proxy.cache_ttl must not be negative")
+
+	check(c.Scanner.Timeout > 0, "scanner.timeout must be positive")
+	check(!c.Scanner.FailClosed || c.Scanner.ClamdAddress != "", "scanner.clamd_address is required with scanner.fail_closed")
+
+	for _, domain := range c.BookCards.Publishers {
+		check(domain != "" && !strings.ContainsAny(domain, "/: "), "book_cards.publishers must be domain names, got %q", domain)
+	}
+	check(c.BookCards.Timeout > 0, "book_cards.timeout must be positive")
+	check(c.BookCards.RetryAfter > 0, "book_cards.retry_after must be positive")
+
+	check(c.Spam.MaxLinks > 0, "spam.max_links must be positive")
+	check(c.Spam.NewAccountMaxLinks >= 0 && c.Spam.NewAccountMaxLinks <= c.Spam.MaxLinks, "spam.new_account_max_links must be between 0 and spam.max_links")
+	check(c.Spam.DuplicateWindow >= 0, "spam.duplicate_window must not be negative")
+	if c.Spam.AkismetKey != "" {
+		u, err := url.Parse(c.Spam.AkismetURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "spam.akismet_url must be an http or https URL, got %q", c.Spam.AkismetURL)
+		check(c.Spam.Timeout > 0, "spam.timeout must be positive")
+	}
+
+	if c.Server.BaseURL != "" {
+		u, err := url.Parse(c.Server.BaseURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "server.base_url must be an http or https URL, got %q", c.Server.BaseURL)
+	}
+	check(c.Mail.Host == "" || c.Server.BaseURL != "", "server.base_url is required with mail.host, for links in emails")
+	check(c.Mail.Port > 0 && c.Mail.Port <= 65535, "mail.port must be between 1 and 65535, got %d", c.Mail.Port)
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		errs = append(errs, fmt.Errorf("mail.from must be an email address, got %q", c.Mail.From))
+	}
+
+	if c.ErrorReporting.DSN != "" {
+		u, err := url.Parse(c.ErrorReporting.DSN)
+		check(err == nil && u.Host != "" && u.User.Username() != "", "error_reporting.dsn must look like https://<key>@<host>/<project>")
+	}
+
+	for name := range c.Features {
+		check(features.IsKnown(name), "features: unknown feature flag %q", name)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
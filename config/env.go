@@ -0,0 +1,328 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv overrides settings with the environment variables that are set.
+// A variable that is set but cannot be parsed is an error rather than being
+// silently ignored.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	e := envReader{lookup: lookup}
+
+	e.int("PORT", &c.Server.Port)
+	e.string("ENV", &c.Server.Env)
+	e.bool("DEBUG", &c.Server.Debug)
+	e.bool("TEMPLATE_RELOAD", &c.Server.TemplateReload)
+	e.bool("COMPRESSION", &c.Server.Compression)
+	e.duration("REQUEST_TIMEOUT", &c.Server.RequestTimeout)
+	e.duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	e.duration("READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	e.duration("READ_TIMEOUT", &c.Server.ReadTimeout)
+	e.duration("WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	e.duration("IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	e.int("MAX_HEADER_BYTES", &c.Server.MaxHeaderBytes)
+	e.list("TRUSTED_PROXIES", &c.Server.TrustedProxies)
+	e.string("BASE_URL", &c.Server.BaseURL)
+
+	e.string("LOG_LEVEL", &c.Log.Level)
+	e.string("LOG_FORMAT", &c.Log.Format)
+
+	e.string("TLS_CERT_FILE", &c.TLS.CertFile)
+	e.string("TLS_KEY_FILE", &c.TLS.KeyFile)
+	e.list("TLS_DOMAINS", &c.TLS.Domains)
+	e.string("TLS_CACHE_DIR", &c.TLS.CacheDir)
+	e.string("TLS_EMAIL", &c.TLS.Email)
+	e.int("TLS_REDIRECT_PORT", &c.TLS.RedirectPort)
+
+	e.string("DATABASE_DRIVER", &c.Database.Driver)
+	e.string("DATABASE_URL", &c.Database.URL)
+	e.string("SQLITE_JOURNAL_MODE", &c.Database.SQLite.JournalMode)
+	e.int("SQLITE_BUSY_TIMEOUT", &c.Database.SQLite.BusyTimeout)
+	e.string("SQLITE_SYNCHRONOUS", &c.Database.SQLite.Synchronous)
+	e.bool("SQLITE_FOREIGN_KEYS", &c.Database.SQLite.ForeignKeys)
+	e.string("SQLITE_AUTO_VACUUM", &c.Database.SQLite.AutoVacuum)
+	e.int("DB_MAX_OPEN_CONNS", &c.Database.Pool.MaxOpenConns)
+	e.int("DB_MAX_IDLE_CONNS", &c.Database.Pool.MaxIdleConns)
+	e.duration("DB_CONN_MAX_LIFETIME", &c.Database.Pool.ConnMaxLifetime)
+	e.duration("DB_CONN_MAX_IDLE_TIME", &c.Database.Pool.ConnMaxIdleTime)
+	e.duration("SLOW_QUERY_THRESHOLD", &c.Database.SlowQueryThreshold)
+	e.duration("MAINTENANCE_INTERVAL", &c.Database.MaintenanceInterval)
+	e.int("ARCHIVE_AFTER_MONTHS", &c.Database.ArchiveAfterMonths)
+	e.duration("PUBLISH_INTERVAL", &c.Database.PublishInterval)
+
+	e.string("SESSION_STORE", &c.Sessions.Store)
+	e.string("REDIS_URL", &c.Sessions.RedisURL)
+	e.duration("SESSION_LIFETIME", &c.Sessions.Lifetime)
+	e.duration("SESSION_CLEANUP_INTERVAL", &c.Sessions.CleanupInterval)
+
+	e.string("ADMIN_USERNAME", &c.Admin.Username)
+	e.string("ADMIN_EMAIL", &c.Admin.Email)
+	e.string("ADMIN_PASSWORD", &c.Admin.Password)
+
+	e.duration("CACHE_TTL", &c.Cache.TTL)
+
+	e.string("BACKUP_DIR", &c.Backup.Dir)
+	e.duration("BACKUP_INTERVAL", &c.Backup.Interval)
+	e.int("BACKUP_RETAIN", &c.Backup.Retain)
+
+	e.string("ACCESS_LOG_FORMAT", &c.AccessLog.Format)
+	e.string("ACCESS_LOG_FILE", &c.AccessLog.File)
+	e.int("ACCESS_LOG_MAX_SIZE_MB", &c.AccessLog.MaxSizeMB)
+	e.int("ACCESS_LOG_MAX_BACKUPS", &c.AccessLog.MaxBackups)
+
+	e.bool("RATE_LIMIT", &c.RateLimit.Enabled)
+	e.limit("RATE_LIMIT_AUTH", &c.RateLimit.Auth)
+	e.limit("RATE_LIMIT_POST", &c.RateLimit.Post)
+	e.limit("RATE_LIMIT_REGULAR", &c.RateLimit.Regular)
+	e.limit("RATE_LIMIT_SEARCH", &c.RateLimit.Search)
+	e.limit("RATE_LIMIT_STATIC", &c.RateLimit.Static)
+
+	e.flags("FEATURES", &c.Features)
+
+	e.string("AVATAR_STORAGE", &c.Avatars.Storage)
+	e.string("AVATAR_DIR", &c.Avatars.Dir)
+	e.int("AVATAR_MAX_UPLOAD_MB", &c.Avatars.MaxUploadMB)
+	e.int("AVATAR_SIZE", &c.Avatars.Size)
+	e.string("AVATAR_S3_ENDPOINT", &c.Avatars.S3.Endpoint)
+	e.string("AVATAR_S3_REGION", &c.Avatars.S3.Region)
+	e.string("AVATAR_S3_BUCKET", &c.Avatars.S3.Bucket)
+	e.string("AVATAR_S3_PREFIX", &c.Avatars.S3.Prefix)
+	e.string("AVATAR_S3_ACCESS_KEY_ID", &c.Avatars.S3.AccessKeyID)
+	e.string("AVATAR_S3_SECRET_ACCESS_KEY", &c.Avatars.S3.SecretAccessKey)
+
+	e.string("OPEN_LIBRARY_URL", &c.OpenLibrary.URL)
+	e.duration("OPEN_LIBRARY_TIMEOUT", &c.OpenLibrary.Timeout)
+
+	e.bool("IMAGE_PROXY", &c.ImageProxy.Enabled)
+	e.string("IMAGE_PROXY_KEY", &c.ImageProxy.Key)
+	e.int("IMAGE_PROXY_MAX_MB", &c.ImageProxy.MaxSizeMB)
+	e.int("IMAGE_PROXY_MAX_WIDTH", &c.ImageProxy.MaxWidth)
+	e.duration("IMAGE_PROXY_TIMEOUT", &c.ImageProxy.Timeout)
+	e.duration("IMAGE_PROXY_CACHE_TTL", &c.ImageProxy.CacheTTL)
+
+	e.string("CLAMD_ADDRESS", &c.Scanner.ClamdAddress)
+	e.duration("SCAN_TIMEOUT", &c.Scanner.Timeout)
+	e.bool("SCAN_FAIL_CLOSED", &c.Scanner.FailClosed)
+	e.string("QUARANTINE_DIR", &c.Scanner.QuarantineDir)
+
+	e.list("BOOK_CARD_PUBLISHERS", &c.BookCards.Publishers)
+	e.duration("BOOK_CARD_TIMEOUT", &c.BookCards.Timeout)
+	e.duration("BOOK_CARD_RETRY_AFTER", &c.BookCards.RetryAfter)
+
+	e.int("SPAM_MAX_LINKS", &c.Spam.MaxLinks)
+	e.int("SPAM_NEW_ACCOUNT_MAX_LINKS", &c.Spam.NewAccountMaxLinks)
+	e.duration("SPAM_DUPLICATE_WINDOW", &c.Spam.DuplicateWindow)
+	e.string("AKISMET_KEY", &c.Spam.AkismetKey)
+	e.string("AKISMET_URL", &c.Spam.AkismetURL)
+	e.duration("SPAM_TIMEOUT", &c.Spam.Timeout)
+
+	e.string("MAIL_HOST", &c.Mail.Host)
+	e.int("MAIL_PORT", &c.Mail.Port)
+	e.string("MAIL_USERNAME", &c.Mail.Username)
+	e.string("MAIL_PASSWORD", &c.Mail.Password)
+	e.string("MAIL_FROM", &c.Mail.From)
+
+	e.length("TITLE_LENGTH", &c.Content.Title)
+	e.length("POST_LENGTH", &c.Content.Post)
+	e.length("COMMENT_LENGTH", &c.Content.Comment)
+	e.length("SIGNATURE_LENGTH", &c.Content.Signature)
+
+	e.duration("POST_COOLDOWN", &c.Cooldown.Post)
+	e.duration("COMMENT_COOLDOWN", &c.Cooldown.Comment)
+	e.duration("NEW_ACCOUNT_AGE", &c.Cooldown.NewAccountAge)
+	e.duration("NEW_ACCOUNT_POST_COOLDOWN", &c.Cooldown.NewPost)
+	e.duration("NEW_ACCOUNT_COMMENT_COOLDOWN", &c.Cooldown.NewComment)
+
+	e.duration("TRUST_MEMBER_AGE", &c.Trust.MemberAge)
+	e.int("TRUST_MEMBER_CONTRIBUTIONS", &c.Trust.MemberContributions)
+	e.duration("TRUST_REGULAR_AGE", &c.Trust.RegularAge)
+	e.int("TRUST_REGULAR_CONTRIBUTIONS", &c.Trust.RegularContributions)
+	e.duration("TRUST_INTERVAL", &c.Trust.Interval)
+
+	e.duration("RETENTION_INTERVAL", &c.Retention.Interval)
+	e.int("RETENTION_TRASH_DAYS", &c.Retention.TrashDays)
+	e.int("RETENTION_DRAFT_DAYS", &c.Retention.DraftDays)
+	e.bool("RETENTION_DRY_RUN", &c.Retention.DryRun)
+
+	e.string("ERROR_REPORTING_DSN", &c.ErrorReporting.DSN)
+	e.string("ERROR_REPORTING_RELEASE", &c.ErrorReporting.Release)
+
+	return e.err
+}
+
+// envReader parses environment variables into settings, remembering the
+// first value that fails to parse
+type envReader struct {
+	lookup func(string) (string, bool)
+	err    error
+}
+
+// get returns the trimmed value of a variable that is set and not empty
+func (e *envReader) get(name string) (string, bool) {
+	value, ok := e.lookup(name)
+	value = strings.TrimSpace(value)
+	return value, ok && value != ""
+}
+
+func (e *envReader) fail(name, value string, err error) {
+	if e.err == nil {
+		e.err = fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+}
+
+func (e *envReader) string(name string, dst *string) {
+	if value, ok := e.get(name); ok {
+		*dst = value
+	}
+}
+
+func (e *envReader) int(name string, dst *int) {
+	if value, ok := e.get(name); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			e.fail(name, value, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+// list reads a comma-separated list, ignoring empty items
+func (e *envReader) list(name string, dst *[]string) {
+	if value, ok := e.get(name); ok {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+	}
+}
+
+func (e *envReader) bool(name string, dst *bool) {
+	if value, ok := e.get(name); ok {
+		b, err := parseBool(value)
+		if err != nil {
+			e.fail(name, value, err)
+			return
+		}
+		*dst = b
+	}
+}
+
+// parseBool also accepts "on" and "off", as used for SQLite pragmas, and
+// "yes" and "no"
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	default:
+		return strconv.ParseBool(value)
+	}
+}
+
+func (e *envReader) duration(name string, dst *time.Duration) {
+	if value, ok := e.get(name); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.fail(name, value, err)
+			return
+		}
+		*dst = d
+	}
+}
+
+// limit reads a rate limit written as "requests/per" or
+// "requests/per/burst", such as "10/1m" or "10/1m/5". Without a burst the
+// current one is kept.
+func (e *envReader) limit(name string, dst *Limit) {
+	if value, ok := e.get(name); ok {
+		parts := strings.Split(value, "/")
+		if len(parts) != 2 && len(parts) != 3 {
+			e.fail(name, value, fmt.Errorf("want requests/per or requests/per/burst"))
+			return
+		}
+
+		limit := *dst
+		var err error
+		if limit.Requests, err = strconv.Atoi(parts[0]); err != nil {
+			e.fail(name, value, err)
+			return
+		}
+		if limit.Per, err = time.ParseDuration(parts[1]); err != nil {
+			e.fail(name, value, err)
+			return
+		}
+		if len(parts) == 3 {
+			if limit.Burst, err = strconv.Atoi(parts[2]); err != nil {
+				e.fail(name, value, err)
+				return
+			}
+		}
+		*dst = limit
+	}
+}
+
+// length reads a length limit written as "min/max", such as "10/5000", or
+// as just "max", which keeps the current minimum
+func (e *envReader) length(name string, dst *Length) {
+	if value, ok := e.get(name); ok {
+		parts := strings.Split(value, "/")
+		if len(parts) > 2 {
+			e.fail(name, value, fmt.Errorf("want min/max or max"))
+			return
+		}
+
+		length := *dst
+		var err error
+		if len(parts) == 2 {
+			if length.Min, err = strconv.Atoi(parts[0]); err != nil {
+				e.fail(name, value, err)
+				return
+			}
+		}
+		if length.Max, err = strconv.Atoi(parts[len(parts)-1]); err != nil {
+			e.fail(name, value, err)
+			return
+		}
+		*dst = length
+	}
+}
+
+// flags reads a comma-separated list of name=value feature flags, such as
+// "goodreads_import=off,search_suggestions=on", over the ones already set
+func (e *envReader) flags(name string, dst *map[string]bool) {
+	if value, ok := e.get(name); ok {
+		flags := make(map[string]bool, len(*dst))
+		for k, v := range *dst {
+			flags[k] = v
+		}
+
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			flag, state, found := strings.Cut(item, "=")
+			if !found {
+				e.fail(name, value, fmt.Errorf("want name=on or name=off"))
+				return
+			}
+
+			enabled, err := parseBool(strings.TrimSpace(state))
+			if err != nil {
+				e.fail(name, value, fmt.Errorf("flag %s: want on or off", strings.TrimSpace(flag)))
+				return
+			}
+			flags[strings.TrimSpace(flag)] = enabled
+		}
+		*dst = flags
+	}
+}
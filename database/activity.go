@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"literary-lions/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of activity on a user's timeline
+const (
+	ActivityPost    = "post"
+	ActivityComment = "comment"
+)
+
+// ActivityPageQuery selects one page of a user's activity timeline
+type ActivityPageQuery struct {
+	UserID int
+	Cursor string // NextCursor of the previous page; empty for the first page
+	Limit  int    // page size; defaults to DefaultPageSize
+}
+
+// activityCursor marks the last entry of a timeline page. Posts and comments
+// have separate IDs, so the kind is needed to order entries created in the
+// same second.
+type activityCursor struct {
+	CreatedAt time.Time
+	Kind      string
+	ID        int
+}
+
+func encodeActivityCursor(a models.Activity) string {
+	raw := a.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + a.Kind + "|" + strconv.Itoa(a.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeActivityCursor(cursor string) (*activityCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || (parts[1] != ActivityPost && parts[1] != ActivityComment) {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &activityCursor{Kind: parts[1]}
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID, err = strconv.Atoi(parts[2]); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// GetUserActivity returns one page of a user's posts and comments, newest
+// first, along with the cursor for the next page. The cursor is empty when
+// there is no more activity.
+func (db *DB) GetUserActivity(ctx context.Context, q ActivityPageQuery) ([]models.Activity, string, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	query := `
+		SELECT kind, id, post_id, post_title, content, created_at FROM (
+			SELECT 'post' AS kind, p.id, p.id AS post_id, p.title AS post_title, p.content, p.created_at
+			FROM posts p
+			WHERE p.user_id = ? AND p.deleted_at IS NULL AND ` + inNamedCategory + `
+			UNION ALL
+			SELECT 'comment' AS kind, c.id, c.post_id, p.title AS post_title, c.content, c.created_at
+			FROM comments c
+			JOIN posts p ON c.post_id = p.id
+			WHERE c.user_id = ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL AND ` + inNamedCategory + `
+		) activity`
+	args := []interface{}{q.UserID, q.UserID}
+
+	if q.Cursor != "" {
+		cursor, err := decodeActivityCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		createdAt := db.dialect.timeArg(cursor.CreatedAt)
+		query += `
+		WHERE created_at < ?
+			OR (created_at = ? AND (kind < ? OR (kind = ? AND id < ?)))`
+		args = append(args, createdAt, createdAt, cursor.Kind, cursor.Kind, cursor.ID)
+	}
+	query += "\n\t\tORDER BY created_at DESC, kind DESC, id DESC\n\t\tLIMIT ?"
+
+	// Fetch one extra row to find out whether another page follows
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var activity []models.Activity
+	for rows.Next() {
+		var a models.Activity
+		if err := rows.Scan(&a.Kind, &a.ID, &a.PostID, &a.PostTitle, &a.Content, &a.CreatedAt); err != nil {
+			return nil, "", err
+		}
+		activity = append(activity, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(activity) > limit {
+		activity = activity[:limit]
+		next = encodeActivityCursor(activity[limit-1])
+	}
+	return activity, next, nil
+}
+
+// GetLastContributions returns when a user last wrote a post and a comment,
+// zero if they never did. Deleted ones count too, so deleting a post does
+// not let its author post again sooner.
+func (db *DB) GetLastContributions(ctx context.Context, userID int) (lastPost, lastComment time.Time, err error) {
+	// Ordering rather than MAX keeps the column's type, which SQLite loses
+	// in aggregates
+	for _, last := range []struct {
+		dest  *time.Time
+		query string
+	}{
+		{&lastPost, "SELECT created_at FROM posts WHERE user_id = ? ORDER BY created_at DESC LIMIT 1"},
+		{&lastComment, "SELECT created_at FROM comments WHERE user_id = ? ORDER BY created_at DESC LIMIT 1"},
+	} {
+		err = db.QueryRowContext(ctx, last.query, userID).Scan(last.dest)
+		if err != nil && err != sql.ErrNoRows {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	return lastPost, lastComment, nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Threads without new comments for a while can be archived. Archived posts
+// drop out of the home page, category listings and the feed API, and their
+// partial indexes, but stay readable at their own URL, in search and on
+// profiles. They no longer accept comments or votes.
+
+// ErrArchived is returned when writing to an archived thread
+var ErrArchived = errors.New("thread is archived")
+
+// SetArchiveAfter makes the maintenance job archive threads that have had no
+// new comments for the given number of months. Zero turns archiving off. It
+// should be called before the database is shared between goroutines.
+func (db *DB) SetArchiveAfter(months int) {
+	db.archiveAfterMonths = months
+}
+
+// ArchiveInactivePosts archives live posts created before cutoff that have
+// had no comments since, and returns how many were archived
+func (db *DB) ArchiveInactivePosts(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `
+		UPDATE posts SET archived_at = ?
+		WHERE deleted_at IS NULL AND archived_at IS NULL AND created_at < ?
+		AND NOT EXISTS (
+			SELECT 1 FROM comments c
+			WHERE c.post_id = posts.id AND c.created_at >= ?
+		)
+	`
+	before := db.dialect.timeArg(cutoff)
+	result, err := db.ExecContext(ctx, query, db.dialect.timeArg(time.Now()), before, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// checkPostWritable returns ErrArchived if the post has been archived
+func (db *DB) checkPostWritable(ctx context.Context, postID int) error {
+	var archived bool
+	err := db.QueryRowContext(ctx, "SELECT archived_at IS NOT NULL FROM posts WHERE id = ?", postID).Scan(&archived)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return ErrArchived
+	}
+	return nil
+}
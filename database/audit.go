@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"literary-lions/models"
+)
+
+// AuditLogSize is how many of the latest audit log entries the admin page
+// shows
+const AuditLogSize = 200
+
+// AddAuditEntry records an action in the audit log and sets its ID
+func (db *DB) AddAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	id, err := db.insert(ctx, "INSERT INTO audit_log (actor_id, action, target_user_id, details) VALUES (?, ?, ?, ?)",
+		entry.ActorID, entry.Action, entry.TargetUserID, entry.Details)
+	if err != nil {
+		return err
+	}
+	entry.ID = id
+	return nil
+}
+
+// GetAuditLog returns the latest limit audit log entries, newest first, with
+// the names of the members involved
+func (db *DB) GetAuditLog(ctx context.Context, limit int) ([]models.AuditEntry, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT a.id, a.actor_id, COALESCE(actor.username, ''), a.action,
+		       a.target_user_id, COALESCE(target.username, ''), a.details, a.created_at
+		FROM audit_log a
+		LEFT JOIN users actor ON actor.id = a.actor_id
+		LEFT JOIN users target ON target.id = a.target_user_id
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetUserID, &e.TargetName, &e.Details, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backup file names look like forum-20060102-150405.db
+const (
+	backupPrefix     = "forum-"
+	backupSuffix     = ".db"
+	backupTimeFormat = "20060102-150405"
+)
+
+// Backup writes a consistent snapshot of a SQLite database into dir using
+// VACUUM INTO and returns the snapshot's path. PostgreSQL deployments should
+// use pg_dump instead.
+func (db *DB) Backup(ctx context.Context, dir string) (string, error) {
+	if db.dialect != dialectSQLite {
+		return "", fmt.Errorf("backups are only supported for SQLite databases")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format(backupTimeFormat)+backupSuffix)
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return "", fmt.Errorf("failed to write backup: %v", err)
+	}
+
+	return path, nil
+}
+
+// pruneBackups deletes all but the newest keep snapshots in dir
+func pruneBackups(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, name)
+		}
+	}
+
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// Timestamped names sort oldest first
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BackupScheduler periodically snapshots the database and keeps the most
+// recent snapshots
+type BackupScheduler struct {
+	db       *DB
+	dir      string
+	interval time.Duration
+	retain   int
+
+	mu          sync.RWMutex
+	lastSuccess time.Time
+}
+
+// NewBackupScheduler creates a scheduler writing a snapshot into dir every
+// interval and keeping the newest retain snapshots
+func NewBackupScheduler(db *DB, dir string, interval time.Duration, retain int) *BackupScheduler {
+	return &BackupScheduler{
+		db:       db,
+		dir:      dir,
+		interval: interval,
+		retain:   retain,
+	}
+}
+
+// Run takes a backup immediately and then every interval until ctx is done
+func (s *BackupScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.backup(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backup takes one snapshot and prunes old ones
+func (s *BackupScheduler) backup(ctx context.Context) {
+	path, err := s.db.Backup(ctx, s.dir)
+	if err != nil {
+		slog.ErrorContext(ctx, "database backup failed", "err", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.lastSuccess = time.Now()
+	s.mu.Unlock()
+	slog.InfoContext(ctx, "database backed up", "path", path)
+
+	if err := pruneBackups(s.dir, s.retain); err != nil {
+		slog.ErrorContext(ctx, "failed to prune old backups", "dir", s.dir, "err", err)
+	}
+}
+
+// LastSuccess returns when the last backup succeeded, or the zero time if
+// none has yet
+func (s *BackupScheduler) LastSuccess() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastSuccess
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"literary-lions/models"
+)
+
+// BlockUser records that blocker has blocked blocked. Blocking someone twice
+// has no further effect.
+func (db *DB) BlockUser(ctx context.Context, blockerID, blockedID int) error {
+	query := `
+		INSERT INTO blocks (blocker_id, blocked_id) VALUES (?, ?)
+		ON CONFLICT (blocker_id, blocked_id) DO NOTHING
+	`
+	_, err := db.ExecContext(ctx, query, blockerID, blockedID)
+	return err
+}
+
+// UnblockUser removes a block
+func (db *DB) UnblockUser(ctx context.Context, blockerID, blockedID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	return err
+}
+
+// GetBlockedUserIDs returns the IDs of the users blockerID has blocked
+func (db *DB) GetBlockedUserIDs(ctx context.Context, blockerID int) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT blocked_id FROM blocks WHERE blocker_id = ?", blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		blocked[id] = true
+	}
+	return blocked, rows.Err()
+}
+
+// GetBlockedUsers returns the users blockerID has blocked, by username
+func (db *DB) GetBlockedUsers(ctx context.Context, blockerID int) ([]models.User, error) {
+	query := `
+		SELECT u.id, u.username
+		FROM blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY u.username
+	`
+	rows, err := db.QueryContext(ctx, query, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// IsBlockedEitherWay reports whether either user has blocked the other
+func (db *DB) IsBlockedEitherWay(ctx context.Context, userID, otherID int) (bool, error) {
+	query := `
+		SELECT COUNT(*) FROM blocks
+		WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)
+	`
+	var count int
+	err := db.QueryRowContext(ctx, query, userID, otherID, otherID, userID).Scan(&count)
+	return count > 0, err
+}
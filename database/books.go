@@ -0,0 +1,322 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"literary-lions/models"
+	"strings"
+)
+
+// FindOrCreateBook looks up a book by its identifiers and creates it if it
+// doesn't exist yet. The book's ID is set on return.
+func (db *DB) FindOrCreateBook(ctx context.Context, book *models.Book) error {
+	var id int
+	var err error
+
+	// Prefer the most specific identifier available
+	switch {
+	case book.ISBN13 != "":
+		err = db.QueryRowContext(ctx, "SELECT id FROM books WHERE isbn13 = ?", book.ISBN13).Scan(&id)
+	case book.ISBN != "":
+		err = db.QueryRowContext(ctx, "SELECT id FROM books WHERE isbn = ?", book.ISBN).Scan(&id)
+	case book.GoodreadsID != "":
+		err = db.QueryRowContext(ctx, "SELECT id FROM books WHERE goodreads_id = ?", book.GoodreadsID).Scan(&id)
+	default:
+		err = db.QueryRowContext(ctx, "SELECT id FROM books WHERE title = ? AND author = ?", book.Title, book.Author).Scan(&id)
+	}
+
+	if err == nil {
+		book.ID = id
+		// Books added before a lookup found their cover get it now
+		if book.CoverURL != "" {
+			_, err = db.ExecContext(ctx, "UPDATE books SET cover_url = ? WHERE id = ? AND (cover_url = '' OR cover_url IS NULL)", book.CoverURL, id)
+		}
+		return err
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	query := "INSERT INTO books (title, author, isbn, isbn13, goodreads_id, published_year, cover_url) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	newID, err := db.insert(ctx, query, book.Title, book.Author, book.ISBN, book.ISBN13, book.GoodreadsID, book.PublishedYear, book.CoverURL)
+	if err != nil {
+		return err
+	}
+
+	book.ID = newID
+	return nil
+}
+
+// GetBookByID gets a book
+func (db *DB) GetBookByID(ctx context.Context, id int) (*models.Book, error) {
+	query := `
+		SELECT id, title, author, COALESCE(isbn, ''), COALESCE(isbn13, ''), COALESCE(goodreads_id, ''),
+			COALESCE(published_year, 0), COALESCE(cover_url, ''), created_at
+		FROM books
+		WHERE id = ?
+	`
+	var book models.Book
+	err := db.QueryRowContext(ctx, query, id).Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.ISBN13,
+		&book.GoodreadsID, &book.PublishedYear, &book.CoverURL, &book.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// GetBookRating gets the average of the ratings members gave a book on their
+// shelves, and how many rated it. The average is 0 when nobody did.
+func (db *DB) GetBookRating(ctx context.Context, bookID int) (float64, int, error) {
+	var average float64
+	var count int
+	query := "SELECT COALESCE(AVG(rating), 0), COUNT(*) FROM user_books WHERE book_id = ? AND rating > 0"
+	err := db.QueryRowContext(ctx, query, bookID).Scan(&average, &count)
+	return average, count, err
+}
+
+// GetPostsByBook gets the posts about a book, newest first. Posts by
+// suspended users are left out unless showSuspended is set.
+func (db *DB) GetPostsByBook(ctx context.Context, bookID int, showSuspended bool) ([]models.Post, error) {
+	query := `
+		SELECT
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous,
+			p.created_at, p.updated_at,
+			p.likes_count, p.dislikes_count, p.comments_count
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		JOIN categories c ON p.category_id = c.id
+		WHERE p.deleted_at IS NULL AND p.book_id = ?`
+	if !showSuspended {
+		query += " AND u.status = 'active'"
+	}
+	query += "\n\t\tORDER BY p.created_at DESC"
+	return db.executePostsWithArgs(ctx, query, bookID)
+}
+
+// SaveShelfEntry adds a book to a user's shelf or updates the existing entry
+func (db *DB) SaveShelfEntry(ctx context.Context, entry *models.ShelfEntry) error {
+	var existingID int
+	query := "SELECT id FROM user_books WHERE user_id = ? AND book_id = ?"
+	err := db.QueryRowContext(ctx, query, entry.UserID, entry.BookID).Scan(&existingID)
+
+	if err == sql.ErrNoRows {
+		// Not shelved yet, insert new entry
+		query = "INSERT INTO user_books (user_id, book_id, shelf, rating, date_read) VALUES (?, ?, ?, ?, ?)"
+		id, err := db.insert(ctx, query, entry.UserID, entry.BookID, entry.Shelf, entry.Rating, entry.DateRead)
+		if err != nil {
+			return err
+		}
+
+		entry.ID = id
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Already shelved, update it
+	query = "UPDATE user_books SET shelf = ?, rating = ?, date_read = ? WHERE id = ?"
+	_, err = db.ExecContext(ctx, query, entry.Shelf, entry.Rating, entry.DateRead, existingID)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = existingID
+	return nil
+}
+
+// GetShelfEntriesByUser gets all books on a user's shelves
+func (db *DB) GetShelfEntriesByUser(ctx context.Context, userID int) ([]models.ShelfEntry, error) {
+	query := `
+		SELECT ub.id, ub.user_id, ub.book_id, ub.shelf, ub.rating, ub.date_read, b.title, b.author, ub.created_at
+		FROM user_books ub
+		JOIN books b ON ub.book_id = b.id
+		WHERE ub.user_id = ?
+		ORDER BY ub.created_at DESC
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.ShelfEntry
+	for rows.Next() {
+		var entry models.ShelfEntry
+		err := rows.Scan(&entry.ID, &entry.UserID, &entry.BookID, &entry.Shelf, &entry.Rating,
+			&entry.DateRead, &entry.BookTitle, &entry.BookAuthor, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// CreateReviewDraft stores an unpublished review for a book
+func (db *DB) CreateReviewDraft(ctx context.Context, draft *models.ReviewDraft) error {
+	query := "INSERT INTO review_drafts (user_id, book_id, title, content) VALUES (?, ?, ?, ?)"
+	id, err := db.insert(ctx, query, draft.UserID, draft.BookID, draft.Title, draft.Content)
+	if err != nil {
+		return err
+	}
+
+	draft.ID = id
+	return nil
+}
+
+// HasReviewed reports whether the user has a review draft for the book, or
+// a post about it that is not in the trash
+func (db *DB) HasReviewed(ctx context.Context, userID, bookID int) (bool, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM review_drafts WHERE user_id = ? AND book_id = ?)
+		     + (SELECT COUNT(*) FROM posts WHERE user_id = ? AND book_id = ? AND deleted_at IS NULL)
+	`
+	var count int
+	err := db.QueryRowContext(ctx, query, userID, bookID, userID, bookID).Scan(&count)
+	return count > 0, err
+}
+
+// MoveShelfEntry moves a book on a user's shelves to another shelf, keeping
+// its rating. Returns sql.ErrNoRows if the user hasn't shelved the book.
+func (db *DB) MoveShelfEntry(ctx context.Context, userID, bookID int, shelf string) error {
+	query := "UPDATE user_books SET shelf = ? WHERE user_id = ? AND book_id = ?"
+	result, err := db.ExecContext(ctx, query, shelf, userID, bookID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RemoveShelfEntry takes a book off a user's shelves. Returns sql.ErrNoRows
+// if the user hasn't shelved the book.
+func (db *DB) RemoveShelfEntry(ctx context.Context, userID, bookID int) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM user_books WHERE user_id = ? AND book_id = ?", userID, bookID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetCurrentlyReading sets the book a user is reading now. A bookID of 0
+// clears it.
+func (db *DB) SetCurrentlyReading(ctx context.Context, userID, bookID int) error {
+	var book interface{}
+	if bookID != 0 {
+		book = bookID
+	}
+	_, err := db.ExecContext(ctx, "UPDATE users SET currently_reading_book_id = ? WHERE id = ?", book, userID)
+	return err
+}
+
+// GetCurrentlyReading gets the books the given users are reading now, keyed
+// by user ID. Users who aren't reading anything are left out.
+func (db *DB) GetCurrentlyReading(ctx context.Context, userIDs []int) (map[int]models.Book, error) {
+	books := make(map[int]models.Book)
+	if len(userIDs) == 0 {
+		return books, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(userIDs)), ", ")
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	query := `
+		SELECT u.id, b.id, b.title, b.author, b.isbn, b.isbn13, b.published_year
+		FROM users u
+		JOIN books b ON b.id = u.currently_reading_book_id
+		WHERE u.id IN (` + placeholders + `)
+	`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		var book models.Book
+		if err := rows.Scan(&userID, &book.ID, &book.Title, &book.Author, &book.ISBN, &book.ISBN13, &book.PublishedYear); err != nil {
+			return nil, err
+		}
+		books[userID] = book
+	}
+	return books, rows.Err()
+}
+
+// GetBookLinks gets the links among urls that have been looked up, keyed by
+// URL, with the books found at them
+func (db *DB) GetBookLinks(ctx context.Context, urls []string) (map[string]models.BookLink, error) {
+	links := make(map[string]models.BookLink)
+	if len(urls) == 0 {
+		return links, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(urls)), ", ")
+	args := make([]interface{}, len(urls))
+	for i, url := range urls {
+		args[i] = url
+	}
+	query := `
+		SELECT l.url, l.checked_at, b.id, b.title, b.author, COALESCE(b.isbn, ''), COALESCE(b.isbn13, ''),
+			COALESCE(b.goodreads_id, ''), COALESCE(b.published_year, 0), COALESCE(b.cover_url, '')
+		FROM book_links l
+		LEFT JOIN books b ON b.id = l.book_id
+		WHERE l.url IN (` + placeholders + `)
+	`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link models.BookLink
+		var id sql.NullInt64
+		var title, author, isbn, isbn13, goodreadsID, coverURL sql.NullString
+		var year sql.NullInt64
+		if err := rows.Scan(&link.URL, &link.CheckedAt, &id, &title, &author, &isbn, &isbn13,
+			&goodreadsID, &year, &coverURL); err != nil {
+			return nil, err
+		}
+		if id.Valid {
+			link.Book = &models.Book{
+				ID:            int(id.Int64),
+				Title:         title.String,
+				Author:        author.String,
+				ISBN:          isbn.String,
+				ISBN13:        isbn13.String,
+				GoodreadsID:   goodreadsID.String,
+				PublishedYear: int(year.Int64),
+				CoverURL:      coverURL.String,
+			}
+		}
+		links[link.URL] = link
+	}
+	return links, rows.Err()
+}
+
+// SaveBookLink records that url was looked up and the book found there, or
+// that none was when bookID is 0
+func (db *DB) SaveBookLink(ctx context.Context, url string, bookID int) error {
+	var book interface{}
+	if bookID > 0 {
+		book = bookID
+	}
+	query := `
+		INSERT INTO book_links (url, book_id, checked_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (url) DO UPDATE SET book_id = excluded.book_id, checked_at = excluded.checked_at
+	`
+	_, err := db.ExecContext(ctx, query, url, book)
+	return err
+}
@@ -0,0 +1,345 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"literary-lions/cache"
+	"literary-lions/models"
+	"time"
+)
+
+// Cache key prefixes used by CachedStore
+const (
+	cacheKeyCategories    = "categories"
+	cacheKeyPosts         = "posts:"
+	cacheKeyLeaderboard   = "leaderboard:"
+	cacheKeyCategoryStats = "categorystats:"
+	cacheKeySiteStats     = "sitestats"
+)
+
+// CachedStore wraps a Store and caches hot, rarely-changing reads: the
+// category list and the public post listings shown on the home page. Writes
+// that can change those results invalidate the affected entries. Leaderboards,
+// category statistics and the site statistics are also cached but only refreshed when their
+// entries expire, since their aggregate queries are expensive and they don't
+// need to be up to the minute.
+type CachedStore struct {
+	Store
+	cache *cache.Cache
+}
+
+// NewCachedStore wraps store with a cache. With a nil cache every call goes
+// straight to store.
+func NewCachedStore(store Store, c *cache.Cache) *CachedStore {
+	return &CachedStore{Store: store, cache: c}
+}
+
+// GetAllCategories returns the cached category tree. Callers mustn't
+// change the subcategories, which are shared with the cache.
+func (s *CachedStore) GetAllCategories(ctx context.Context) ([]models.Category, error) {
+	if v, ok := s.cache.Get(cacheKeyCategories); ok {
+		return append([]models.Category(nil), v.([]models.Category)...), nil
+	}
+
+	categories, err := s.Store.GetAllCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(cacheKeyCategories, categories)
+	return append([]models.Category(nil), categories...), nil
+}
+
+// GetCategoryByID looks the category up in the cached category list
+func (s *CachedStore) GetCategoryByID(ctx context.Context, id int) (*models.Category, error) {
+	if v, ok := s.cache.Get(cacheKeyCategories); ok {
+		for _, category := range models.FlattenCategories(v.([]models.Category)) {
+			if category.ID == id {
+				return &category, nil
+			}
+		}
+	}
+	return s.Store.GetCategoryByID(ctx, id)
+}
+
+// CreateCategory adds a category and invalidates the cached list
+func (s *CachedStore) CreateCategory(ctx context.Context, category *models.Category) error {
+	err := s.Store.CreateCategory(ctx, category)
+	if err == nil {
+		s.cache.Delete(cacheKeyCategories)
+	}
+	return err
+}
+
+// UpdateCategory changes a category and invalidates the cached list, and
+// the cached listings, which include the posts of subcategories
+func (s *CachedStore) UpdateCategory(ctx context.Context, category *models.Category) error {
+	err := s.Store.UpdateCategory(ctx, category)
+	if err == nil {
+		s.cache.Delete(cacheKeyCategories)
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// GetPostsWithSuspendedFilterAndSorting returns the cached post listing
+func (s *CachedStore) GetPostsWithSuspendedFilterAndSorting(ctx context.Context, showSuspended bool, sortBy, sortOrder string) ([]models.Post, error) {
+	key := fmt.Sprintf("%sall:%t:%s:%s", cacheKeyPosts, showSuspended, sortBy, sortOrder)
+	return s.cachedPosts(key, func() ([]models.Post, error) {
+		return s.Store.GetPostsWithSuspendedFilterAndSorting(ctx, showSuspended, sortBy, sortOrder)
+	})
+}
+
+// GetPostsByCategoryWithSorting returns the cached post listing for a category
+func (s *CachedStore) GetPostsByCategoryWithSorting(ctx context.Context, categoryID int, sortBy, sortOrder string) ([]models.Post, error) {
+	key := fmt.Sprintf("%scategory:%d:%s:%s", cacheKeyPosts, categoryID, sortBy, sortOrder)
+	return s.cachedPosts(key, func() ([]models.Post, error) {
+		return s.Store.GetPostsByCategoryWithSorting(ctx, categoryID, sortBy, sortOrder)
+	})
+}
+
+// GetLeaderboard returns the cached leaderboard for a window
+func (s *CachedStore) GetLeaderboard(ctx context.Context, window string) (*models.Leaderboard, error) {
+	key := cacheKeyLeaderboard + window
+	if v, ok := s.cache.Get(key); ok {
+		board := *v.(*models.Leaderboard)
+		return &board, nil
+	}
+
+	board, err := s.Store.GetLeaderboard(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, board)
+	copied := *board
+	return &copied, nil
+}
+
+// GetCategoryStats returns the cached statistics of a category
+func (s *CachedStore) GetCategoryStats(ctx context.Context, categoryID int) (*models.CategoryStats, error) {
+	key := fmt.Sprintf("%s%d", cacheKeyCategoryStats, categoryID)
+	if v, ok := s.cache.Get(key); ok {
+		stats := *v.(*models.CategoryStats)
+		return &stats, nil
+	}
+
+	stats, err := s.Store.GetCategoryStats(ctx, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, stats)
+	copied := *stats
+	return &copied, nil
+}
+
+// GetSiteStats returns the cached site statistics
+func (s *CachedStore) GetSiteStats(ctx context.Context) (*models.SiteStats, error) {
+	if v, ok := s.cache.Get(cacheKeySiteStats); ok {
+		stats := *v.(*models.SiteStats)
+		return &stats, nil
+	}
+
+	stats, err := s.Store.GetSiteStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(cacheKeySiteStats, stats)
+	copied := *stats
+	return &copied, nil
+}
+
+// cachedPosts returns a copy of the posts cached under key, loading and
+// caching them on a miss
+func (s *CachedStore) cachedPosts(key string, load func() ([]models.Post, error)) ([]models.Post, error) {
+	if v, ok := s.cache.Get(key); ok {
+		return append([]models.Post(nil), v.([]models.Post)...), nil
+	}
+
+	posts, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(key, posts)
+	return append([]models.Post(nil), posts...), nil
+}
+
+// invalidatePosts drops all cached post listings
+func (s *CachedStore) invalidatePosts() {
+	s.cache.DeletePrefix(cacheKeyPosts)
+}
+
+// CreatePost creates a post and invalidates cached listings
+func (s *CachedStore) CreatePost(ctx context.Context, post *models.Post) error {
+	err := s.Store.CreatePost(ctx, post)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// PublishDuePosts publishes scheduled posts that are due and invalidates
+// cached listings if any were
+func (s *CachedStore) PublishDuePosts(ctx context.Context, now time.Time) (int, error) {
+	published, err := s.Store.PublishDuePosts(ctx, now)
+	if published > 0 {
+		s.invalidatePosts()
+	}
+	return published, err
+}
+
+// UpdatePost edits a post and invalidates cached listings, which show its title
+func (s *CachedStore) UpdatePost(ctx context.Context, postID int, title, content string, loadedUpdatedAt, now time.Time) error {
+	err := s.Store.UpdatePost(ctx, postID, title, content, loadedUpdatedAt, now)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// CreateComment creates a comment and invalidates cached listings, which
+// include comment counts
+func (s *CachedStore) CreateComment(ctx context.Context, comment *models.Comment) error {
+	err := s.Store.CreateComment(ctx, comment)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// LikePost records a vote and invalidates cached listings, which include
+// like counts
+func (s *CachedStore) LikePost(ctx context.Context, userID, postID int, isLike bool) error {
+	err := s.Store.LikePost(ctx, userID, postID, isLike)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// DeleteUser deletes a user and invalidates cached listings
+func (s *CachedStore) DeleteUser(ctx context.Context, userID int) error {
+	err := s.Store.DeleteUser(ctx, userID)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// ChangeUsername renames a user and invalidates cached listings, which show
+// their name
+func (s *CachedStore) ChangeUsername(ctx context.Context, userID int, newUsername string) error {
+	err := s.Store.ChangeUsername(ctx, userID, newUsername)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// SuspendUser suspends a user and invalidates cached listings
+func (s *CachedStore) SuspendUser(ctx context.Context, userID int, reason string) error {
+	err := s.Store.SuspendUser(ctx, userID, reason)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// UnsuspendUser unsuspends a user and invalidates cached listings
+func (s *CachedStore) UnsuspendUser(ctx context.Context, userID int) error {
+	err := s.Store.UnsuspendUser(ctx, userID)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// DeactivateUser deactivates a user and invalidates cached listings
+func (s *CachedStore) DeactivateUser(ctx context.Context, userID int) error {
+	err := s.Store.DeactivateUser(ctx, userID)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// ReactivateUser reactivates a user and invalidates cached listings
+func (s *CachedStore) ReactivateUser(ctx context.Context, userID int) error {
+	err := s.Store.ReactivateUser(ctx, userID)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// TrashPost trashes a post and invalidates cached listings
+func (s *CachedStore) TrashPost(ctx context.Context, postID, deletedBy int, reason string) error {
+	err := s.Store.TrashPost(ctx, postID, deletedBy, reason)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// MergePost merges a thread into another and invalidates cached listings
+func (s *CachedStore) MergePost(ctx context.Context, sourceID, targetID, mergedBy int, now time.Time) (int, error) {
+	commentID, err := s.Store.MergePost(ctx, sourceID, targetID, mergedBy, now)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return commentID, err
+}
+
+// RestorePost restores a post and invalidates cached listings
+func (s *CachedStore) RestorePost(ctx context.Context, postID int) error {
+	err := s.Store.RestorePost(ctx, postID)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// TrashComment trashes a comment and invalidates cached listings, which
+// include comment counts
+func (s *CachedStore) TrashComment(ctx context.Context, commentID, deletedBy int, reason string) error {
+	err := s.Store.TrashComment(ctx, commentID, deletedBy, reason)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// RestoreComment restores a comment and invalidates cached listings
+func (s *CachedStore) RestoreComment(ctx context.Context, commentID int) error {
+	err := s.Store.RestoreComment(ctx, commentID)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return err
+}
+
+// TrashUserContent trashes a user's posts and comments and invalidates
+// cached listings
+func (s *CachedStore) TrashUserContent(ctx context.Context, userID, deletedBy int, reason string, since, until time.Time) (UserContentReport, error) {
+	report, err := s.Store.TrashUserContent(ctx, userID, deletedBy, reason, since, until)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return report, err
+}
+
+// PurgeUserContent deletes a user's posts and comments and invalidates
+// cached listings
+func (s *CachedStore) PurgeUserContent(ctx context.Context, userID, deletedBy int, reason string, since, until time.Time) (UserContentReport, error) {
+	report, err := s.Store.PurgeUserContent(ctx, userID, deletedBy, reason, since, until)
+	if err == nil {
+		s.invalidatePosts()
+	}
+	return report, err
+}
+
+// Ensure *CachedStore implements Store
+var _ Store = (*CachedStore)(nil)
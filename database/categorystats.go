@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"literary-lions/models"
+	"time"
+)
+
+const (
+	// CategoryActivityDays is how many days of activity category statistics
+	// count, up to and including today
+	CategoryActivityDays = 30
+
+	// CategoryTopMembers is how many of a category's most active members
+	// its statistics list
+	CategoryTopMembers = 5
+)
+
+// categoryContributions selects every live post and comment in a category,
+// given as its argument, and its subcategories as (user_id, created_at,
+// category_id)
+const categoryContributions = `
+	SELECT p.user_id, p.created_at, p.category_id
+	FROM posts p
+	WHERE p.deleted_at IS NULL AND ` + inCategoryTree + `
+	UNION ALL
+	SELECT c.user_id, c.created_at, p.category_id
+	FROM comments c
+	JOIN posts p ON p.id = c.post_id
+	WHERE c.deleted_at IS NULL AND p.deleted_at IS NULL AND ` + inCategoryTree
+
+// GetCategoryStats summarizes the activity in a category and its
+// subcategories: how many posts and comments they hold, who wrote the most
+// of them and how many were written on each recent day (in UTC)
+func (db *DB) GetCategoryStats(ctx context.Context, categoryID int) (*models.CategoryStats, error) {
+	stats := &models.CategoryStats{CategoryID: categoryID}
+
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM posts p WHERE p.deleted_at IS NULL AND `+inCategoryTree, categoryID).Scan(&stats.Posts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count posts: %v", err)
+	}
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		WHERE c.deleted_at IS NULL AND p.deleted_at IS NULL AND `+inCategoryTree, categoryID).Scan(&stats.Comments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count comments: %v", err)
+	}
+
+	// Contributions to anonymous categories don't count, or they would name
+	// their authors
+	stats.TopMembers, err = db.leaderboardEntries(ctx, `
+		SELECT u.id, u.username, COUNT(*) AS score
+		FROM (`+categoryContributions+`) a
+		JOIN users u ON u.id = a.user_id
+		WHERE u.status = 'active' AND a.category_id NOT IN (SELECT id FROM categories WHERE anonymous = TRUE)
+		GROUP BY u.id, u.username
+		ORDER BY score DESC, u.username
+		LIMIT ?
+	`, categoryID, categoryID, CategoryTopMembers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank members: %v", err)
+	}
+
+	// Count each day's posts and comments here rather than in SQL, whose
+	// date functions differ between dialects
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(CategoryActivityDays - 1))
+	rows, err := db.QueryContext(ctx, `SELECT a.created_at FROM (`+categoryContributions+`) a WHERE a.created_at >= ?`,
+		categoryID, categoryID, db.dialect.timeArg(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch activity: %v", err)
+	}
+	defer rows.Close()
+
+	stats.Daily = make([]int, CategoryActivityDays)
+	for rows.Next() {
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err != nil {
+			return nil, err
+		}
+		day := int(createdAt.UTC().Sub(since).Hours() / 24)
+		if day >= 0 && day < CategoryActivityDays {
+			stats.Daily[day]++
+		}
+	}
+	return stats, rows.Err()
+}
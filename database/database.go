@@ -1,145 +1,246 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"literary-lions/auth"
+	"literary-lions/config"
 	"literary-lions/models"
+	"net/url"
+	"strings"
 	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
 	*sql.DB
+	dialect            dialect
+	stmts              *stmtCache
+	slowQuery          time.Duration
+	archiveAfterMonths int
 }
 
-// NewDB creates a new database connection
-func NewDB(dataSourceName string) (*DB, error) {
-	db, err := sql.Open("sqlite3", dataSourceName)
+// SQLitePragmas holds the pragmas applied to every SQLite connection
+type SQLitePragmas struct {
+	JournalMode string // e.g. "WAL" or "DELETE"
+	BusyTimeout int    // milliseconds to wait on a locked database
+	ForeignKeys bool
+	Synchronous string // e.g. "NORMAL" or "FULL"
+	AutoVacuum  string // "NONE", "FULL" or "INCREMENTAL"; only takes effect for new databases
+}
+
+// DefaultSQLitePragmas returns pragmas suited to concurrent web traffic
+func DefaultSQLitePragmas() SQLitePragmas {
+	return SQLitePragmas{
+		JournalMode: "WAL",
+		BusyTimeout: 5000,
+		ForeignKeys: true,
+		Synchronous: "NORMAL",
+		AutoVacuum:  "INCREMENTAL",
+	}
+}
+
+// dsn appends the pragmas to a SQLite data source name as driver parameters,
+// so they apply to every pooled connection. Parameters already present in the
+// DSN take precedence.
+func (p SQLitePragmas) dsn(dataSourceName string) string {
+	params := url.Values{}
+	if p.JournalMode != "" {
+		params.Set("_journal_mode", p.JournalMode)
+	}
+	if p.BusyTimeout > 0 {
+		params.Set("_busy_timeout", fmt.Sprint(p.BusyTimeout))
+	}
+	if p.ForeignKeys {
+		params.Set("_foreign_keys", "on")
+	} else {
+		params.Set("_foreign_keys", "off")
+	}
+	if p.Synchronous != "" {
+		params.Set("_synchronous", p.Synchronous)
+	}
+	if p.AutoVacuum != "" {
+		params.Set("_auto_vacuum", strings.ToLower(p.AutoVacuum))
+	}
+
+	base, existing, _ := strings.Cut(dataSourceName, "?")
+	if existingParams, err := url.ParseQuery(existing); err == nil {
+		for key, values := range existingParams {
+			params[key] = values
+		}
+	}
+
+	return base + "?" + params.Encode()
+}
+
+// PoolConfig sizes the connection pool. Zero values fall back to defaults
+// for the database in use; a negative MaxIdleConns keeps no idle connections.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// withDefaults fills unset fields. SQLite allows a single writer at a time,
+// so one connection avoids "database is locked" errors under concurrent
+// writes; PostgreSQL gets a bounded pool whose connections are recycled.
+func (p PoolConfig) withDefaults(d dialect) PoolConfig {
+	if d == dialectSQLite {
+		if p.MaxOpenConns == 0 {
+			p.MaxOpenConns = 1
+		}
+		if p.MaxIdleConns == 0 {
+			p.MaxIdleConns = p.MaxOpenConns
+		}
+		return p
+	}
+
+	if p.MaxOpenConns == 0 {
+		p.MaxOpenConns = 25
+	}
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = p.MaxOpenConns
+	}
+	if p.ConnMaxLifetime == 0 {
+		p.ConnMaxLifetime = 30 * time.Minute
+	}
+	if p.ConnMaxIdleTime == 0 {
+		p.ConnMaxIdleTime = 5 * time.Minute
+	}
+	return p
+}
+
+// NewDB creates a new database connection. The driver is "sqlite3" (the
+// default when empty) or "postgres"; a postgres:// DSN also selects PostgreSQL.
+// The pragmas are only used for SQLite.
+func NewDB(driver, dataSourceName string, pragmas SQLitePragmas, pool PoolConfig) (*DB, error) {
+	d, err := parseDialect(driver, dataSourceName)
 	if err != nil {
 		return nil, err
 	}
 
+	if d == dialectSQLite {
+		dataSourceName = pragmas.dsn(dataSourceName)
+	}
+
+	db, err := sql.Open(string(d), dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	pool = pool.withDefaults(d)
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
 
-	return &DB{db}, nil
-}
-
-// InitDB initializes the database with required tables
-func (db *DB) InitDB() error {
-	// CREATE queries for all tables
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT UNIQUE NOT NULL,
-			email TEXT UNIQUE NOT NULL,
-			password TEXT NOT NULL,
-			profile_picture TEXT DEFAULT '',
-			signature TEXT DEFAULT '',
-			role TEXT DEFAULT 'user',
-			status TEXT DEFAULT 'active',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS categories (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT UNIQUE NOT NULL,
-			description TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS posts (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			title TEXT NOT NULL,
-			content TEXT NOT NULL,
-			user_id INTEGER NOT NULL,
-			category_id INTEGER NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(user_id) REFERENCES users(id),
-			FOREIGN KEY(category_id) REFERENCES categories(id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS comments (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			content TEXT NOT NULL,
-			user_id INTEGER NOT NULL,
-			post_id INTEGER NOT NULL,
-			parent_id INTEGER,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(user_id) REFERENCES users(id),
-			FOREIGN KEY(post_id) REFERENCES posts(id),
-			FOREIGN KEY(parent_id) REFERENCES comments(id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS sessions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			uuid TEXT UNIQUE NOT NULL,
-			expires_at DATETIME NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(user_id) REFERENCES users(id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS post_likes (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			post_id INTEGER NOT NULL,
-			is_like BOOLEAN NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(user_id) REFERENCES users(id),
-			FOREIGN KEY(post_id) REFERENCES posts(id),
-			UNIQUE(user_id, post_id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS comment_likes (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			comment_id INTEGER NOT NULL,
-			is_like BOOLEAN NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(user_id) REFERENCES users(id),
-			FOREIGN KEY(comment_id) REFERENCES comments(id),
-			UNIQUE(user_id, comment_id)
-		)`,
-	}
-
-	for _, query := range queries {
-		if _, err := db.Exec(query); err != nil {
-			return fmt.Errorf("error creating table: %v", err)
-		}
+	return &DB{DB: db, dialect: d, stmts: newStmtCache()}, nil
+}
+
+// Open connects to the database described by cfg and applies its slow query
+// and archiving settings
+func Open(cfg config.Database) (*DB, error) {
+	pragmas := SQLitePragmas{
+		JournalMode: cfg.SQLite.JournalMode,
+		BusyTimeout: cfg.SQLite.BusyTimeout,
+		ForeignKeys: cfg.SQLite.ForeignKeys,
+		Synchronous: cfg.SQLite.Synchronous,
+		AutoVacuum:  cfg.SQLite.AutoVacuum,
+	}
+	pool := PoolConfig{
+		MaxOpenConns:    cfg.Pool.MaxOpenConns,
+		MaxIdleConns:    cfg.Pool.MaxIdleConns,
+		ConnMaxLifetime: cfg.Pool.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Pool.ConnMaxIdleTime,
 	}
 
-	// Add migration for existing databases
-	if err := db.migrateUserTable(); err != nil {
-		return fmt.Errorf("error migrating user table: %v", err)
+	db, err := NewDB(cfg.Driver, cfg.URL, pragmas, pool)
+	if err != nil {
+		return nil, err
 	}
+	db.SetSlowQueryThreshold(cfg.SlowQueryThreshold)
+	db.SetArchiveAfter(cfg.ArchiveAfterMonths)
+	return db, nil
+}
 
-	// Add migration for comments table
-	if err := db.migrateCommentsTable(); err != nil {
-		return fmt.Errorf("error migrating comments table: %v", err)
+// Close releases cached prepared statements and closes the database
+func (db *DB) Close() error {
+	db.stmts.close()
+	return db.DB.Close()
+}
+
+// InitDB initializes the database schema and default data, creating the
+// admin account with the given credentials if it does not exist yet
+func (db *DB) InitDB(ctx context.Context, admin config.Admin) error {
+	// Apply pending schema migrations
+	if err := db.Migrate(ctx); err != nil {
+		return fmt.Errorf("error migrating database: %v", err)
 	}
 
 	// Create admin user if it doesn't exist
-	if err := db.createAdminUser(); err != nil {
+	if err := db.createAdminUser(ctx, admin); err != nil {
 		return fmt.Errorf("error creating admin user: %v", err)
 	}
 
 	// Update existing admin user email if needed
-	if err := db.updateAdminEmail(); err != nil {
+	if err := db.updateAdminEmail(ctx, admin); err != nil {
 		return fmt.Errorf("error updating admin email: %v", err)
 	}
 
 	// Insert default categories
-	if err := db.insertDefaultCategories(); err != nil {
+	if err := db.insertDefaultCategories(ctx); err != nil {
 		return fmt.Errorf("error inserting default categories: %v", err)
 	}
 
 	return nil
 }
 
+// upgradeLegacySchema adds columns that SQLite databases created before
+// versioned migrations may be missing, so they match the initial migration.
+// It does nothing for new databases.
+func (db *DB) upgradeLegacySchema(ctx context.Context) error {
+	if db.dialect != dialectSQLite {
+		return nil
+	}
+
+	usersExists, err := db.tableExists(ctx, "users")
+	if err != nil {
+		return err
+	}
+
+	commentsExists, err := db.tableExists(ctx, "comments")
+	if err != nil {
+		return err
+	}
+
+	if !usersExists || !commentsExists {
+		return nil
+	}
+
+	if err := db.migrateUserTable(ctx); err != nil {
+		return fmt.Errorf("error migrating user table: %v", err)
+	}
+
+	if err := db.migrateCommentsTable(ctx); err != nil {
+		return fmt.Errorf("error migrating comments table: %v", err)
+	}
+
+	return nil
+}
+
 // migrateUserTable adds new columns to existing user tables
-func (db *DB) migrateUserTable() error {
+func (db *DB) migrateUserTable(ctx context.Context) error {
 	// Check if profile_picture column exists
 	var columnExists int
-	err := db.QueryRow(`
+	err := db.QueryRowContext(ctx, `
 		SELECT COUNT(*) 
 		FROM pragma_table_info('users') 
 		WHERE name='profile_picture'
@@ -151,14 +252,14 @@ func (db *DB) migrateUserTable() error {
 
 	if columnExists == 0 {
 		// Add profile_picture column
-		_, err = db.Exec("ALTER TABLE users ADD COLUMN profile_picture TEXT DEFAULT ''")
+		_, err = db.ExecContext(ctx, "ALTER TABLE users ADD COLUMN profile_picture TEXT DEFAULT ''")
 		if err != nil {
 			return err
 		}
 	}
 
 	// Check if signature column exists
-	err = db.QueryRow(`
+	err = db.QueryRowContext(ctx, `
 		SELECT COUNT(*) 
 		FROM pragma_table_info('users') 
 		WHERE name='signature'
@@ -170,14 +271,14 @@ func (db *DB) migrateUserTable() error {
 
 	if columnExists == 0 {
 		// Add signature column
-		_, err = db.Exec("ALTER TABLE users ADD COLUMN signature TEXT DEFAULT ''")
+		_, err = db.ExecContext(ctx, "ALTER TABLE users ADD COLUMN signature TEXT DEFAULT ''")
 		if err != nil {
 			return err
 		}
 	}
 
 	// Check if role column exists
-	err = db.QueryRow(`
+	err = db.QueryRowContext(ctx, `
 		SELECT COUNT(*) 
 		FROM pragma_table_info('users') 
 		WHERE name='role'
@@ -189,14 +290,14 @@ func (db *DB) migrateUserTable() error {
 
 	if columnExists == 0 {
 		// Add role column
-		_, err = db.Exec("ALTER TABLE users ADD COLUMN role TEXT DEFAULT 'user'")
+		_, err = db.ExecContext(ctx, "ALTER TABLE users ADD COLUMN role TEXT DEFAULT 'user'")
 		if err != nil {
 			return err
 		}
 	}
 
 	// Check if status column exists
-	err = db.QueryRow(`
+	err = db.QueryRowContext(ctx, `
 		SELECT COUNT(*) 
 		FROM pragma_table_info('users') 
 		WHERE name='status'
@@ -208,7 +309,7 @@ func (db *DB) migrateUserTable() error {
 
 	if columnExists == 0 {
 		// Add status column
-		_, err = db.Exec("ALTER TABLE users ADD COLUMN status TEXT DEFAULT 'active'")
+		_, err = db.ExecContext(ctx, "ALTER TABLE users ADD COLUMN status TEXT DEFAULT 'active'")
 		if err != nil {
 			return err
 		}
@@ -218,10 +319,10 @@ func (db *DB) migrateUserTable() error {
 }
 
 // migrateCommentsTable adds new columns to existing comments tables
-func (db *DB) migrateCommentsTable() error {
+func (db *DB) migrateCommentsTable(ctx context.Context) error {
 	// Check if parent_id column exists
 	var columnExists int
-	err := db.QueryRow(`
+	err := db.QueryRowContext(ctx, `
 		SELECT COUNT(*) 
 		FROM pragma_table_info('comments') 
 		WHERE name='parent_id'
@@ -233,7 +334,7 @@ func (db *DB) migrateCommentsTable() error {
 
 	if columnExists == 0 {
 		// Add parent_id column
-		_, err = db.Exec("ALTER TABLE comments ADD COLUMN parent_id INTEGER REFERENCES comments(id)")
+		_, err = db.ExecContext(ctx, "ALTER TABLE comments ADD COLUMN parent_id INTEGER REFERENCES comments(id)")
 		if err != nil {
 			return err
 		}
@@ -243,10 +344,10 @@ func (db *DB) migrateCommentsTable() error {
 }
 
 // createAdminUser creates the admin user if it doesn't exist
-func (db *DB) createAdminUser() error {
+func (db *DB) createAdminUser(ctx context.Context, admin config.Admin) error {
 	// Check if admin user already exists
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ? OR email = ?", "admin", "admin@admin.com").Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = ? OR email = ?", admin.Username, admin.Email).Scan(&count)
 	if err != nil {
 		return err
 	}
@@ -256,14 +357,14 @@ func (db *DB) createAdminUser() error {
 	}
 
 	// Hash the admin password
-	hashedPassword, err := auth.HashPassword("admin")
+	hashedPassword, err := auth.HashPassword(admin.Password)
 	if err != nil {
 		return fmt.Errorf("failed to hash admin password: %v", err)
 	}
 
 	// Create admin user
 	query := "INSERT INTO users (username, email, password, role, status) VALUES (?, ?, ?, ?, ?)"
-	_, err = db.Exec(query, "admin", "admin@admin.com", hashedPassword, "admin", "active")
+	_, err = db.ExecContext(ctx, query, admin.Username, admin.Email, hashedPassword, "admin", "active")
 	if err != nil {
 		return err
 	}
@@ -272,17 +373,17 @@ func (db *DB) createAdminUser() error {
 }
 
 // updateAdminEmail updates the admin user's email if it's still using the old format
-func (db *DB) updateAdminEmail() error {
+func (db *DB) updateAdminEmail(ctx context.Context, admin config.Admin) error {
 	// Check if admin user exists with old email format
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ? AND email = ?", "admin", "admin").Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = ? AND email = ?", admin.Username, admin.Username).Scan(&count)
 	if err != nil {
 		return err
 	}
 
 	if count > 0 {
 		// Update the admin user's email
-		_, err = db.Exec("UPDATE users SET email = ? WHERE username = ? AND email = ?", "admin@admin.com", "admin", "admin")
+		_, err = db.ExecContext(ctx, "UPDATE users SET email = ? WHERE username = ? AND email = ?", admin.Email, admin.Username, admin.Username)
 		if err != nil {
 			return err
 		}
@@ -292,32 +393,35 @@ func (db *DB) updateAdminEmail() error {
 }
 
 // insertDefaultCategories adds default categories for the literary forum
-func (db *DB) insertDefaultCategories() error {
+func (db *DB) insertDefaultCategories(ctx context.Context) error {
 	categories := []struct {
 		name        string
 		description string
+		icon        string
+		color       string
 	}{
-		{"General Discussion", "General book-related discussions and recommendations"},
-		{"Fiction", "Discussions about fiction books and novels"},
-		{"Non-Fiction", "Non-fiction books, biographies, and educational content"},
-		{"Mystery & Thriller", "Mystery, thriller, and suspense novels"},
-		{"Romance", "Romance novels and love stories"},
-		{"Science Fiction & Fantasy", "Sci-fi, fantasy, and speculative fiction"},
-		{"Classics", "Classic literature and timeless works"},
-		{"Book Reviews", "Share and read book reviews"},
-		{"Author Discussions", "Discussions about specific authors"},
-		{"Book Club Picks", "Monthly book club selections and discussions"},
-	}
-
-	for _, cat := range categories {
+		{"General Discussion", "General book-related discussions and recommendations", "💬", "#3498db"},
+		{"Fiction", "Discussions about fiction books and novels", "📖", "#8e44ad"},
+		{"Non-Fiction", "Non-fiction books, biographies, and educational content", "🧠", "#16a085"},
+		{"Mystery & Thriller", "Mystery, thriller, and suspense novels", "🔍", "#2c3e50"},
+		{"Romance", "Romance novels and love stories", "💕", "#e84393"},
+		{"Science Fiction & Fantasy", "Sci-fi, fantasy, and speculative fiction", "🚀", "#6c5ce7"},
+		{"Classics", "Classic literature and timeless works", "🏛️", "#a0522d"},
+		{"Book Reviews", "Share and read book reviews", "⭐", "#f39c12"},
+		{"Author Discussions", "Discussions about specific authors", "✍️", "#27ae60"},
+		{"Book Club Picks", "Monthly book club selections and discussions", "📚", "#c0392b"},
+	}
+
+	for i, cat := range categories {
 		var count int
-		err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE name = ?", cat.name).Scan(&count)
+		err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM categories WHERE name = ?", cat.name).Scan(&count)
 		if err != nil {
 			return err
 		}
 
 		if count == 0 {
-			_, err := db.Exec("INSERT INTO categories (name, description) VALUES (?, ?)", cat.name, cat.description)
+			_, err := db.ExecContext(ctx, "INSERT INTO categories (name, description, icon, color, sort_order) VALUES (?, ?, ?, ?, ?)",
+				cat.name, cat.description, cat.icon, cat.color, i+1)
 			if err != nil {
 				return err
 			}
@@ -328,67 +432,74 @@ func (db *DB) insertDefaultCategories() error {
 }
 
 // User operations
-func (db *DB) CreateUser(user *models.User) error {
+func (db *DB) CreateUser(ctx context.Context, user *models.User) error {
 	query := "INSERT INTO users (username, email, password) VALUES (?, ?, ?)"
-	result, err := db.Exec(query, user.Username, user.Email, user.Password)
+	id, err := db.insert(ctx, query, user.Username, user.Email, user.Password)
 	if err != nil {
 		return err
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return err
-	}
-
-	user.ID = int(id)
+	user.ID = id
 	return nil
 }
 
-func (db *DB) GetUserByEmail(email string) (*models.User, error) {
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := &models.User{}
-	query := "SELECT id, username, email, password, profile_picture, signature, role, status, created_at FROM users WHERE email = ?"
-	err := db.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.ProfilePicture, &user.Signature, &user.Role, &user.Status, &user.CreatedAt)
+	query := "SELECT id, username, email, password, profile_picture, signature, bio, location, website, favorite_genres, favorite_book, role, status, trust_level, created_at FROM users WHERE email = ?"
+	err := db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.ProfilePicture, &user.Signature, &user.Bio, &user.Location, &user.Website, &user.FavoriteGenres, &user.FavoriteBook, &user.Role, &user.Status, &user.TrustLevel, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (db *DB) GetUserByID(id int) (*models.User, error) {
+func (db *DB) GetUserByID(ctx context.Context, id int) (*models.User, error) {
 	user := &models.User{}
-	query := "SELECT id, username, email, profile_picture, signature, role, status, created_at FROM users WHERE id = ?"
-	err := db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.Email, &user.ProfilePicture, &user.Signature, &user.Role, &user.Status, &user.CreatedAt)
+	query := `
+		SELECT u.id, u.username, u.email, u.profile_picture, u.signature, u.bio, u.location, u.website, u.favorite_genres, u.favorite_book, u.role, u.status, u.trust_level, u.created_at, COALESCE(p.timezone, 'UTC'), COALESCE(p.language, ''), COALESCE(p.theme, 'auto')
+		FROM users u
+		LEFT JOIN user_preferences p ON p.user_id = u.id
+		WHERE u.id = ?`
+	err := db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.ProfilePicture, &user.Signature, &user.Bio, &user.Location, &user.Website, &user.FavoriteGenres, &user.FavoriteBook, &user.Role, &user.Status, &user.TrustLevel, &user.CreatedAt, &user.Timezone, &user.Language, &user.Theme)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (db *DB) GetUserByUsername(username string) (*models.User, error) {
+func (db *DB) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	user := &models.User{}
-	query := "SELECT id, username, email, profile_picture, signature, role, status, created_at FROM users WHERE username = ?"
-	err := db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email, &user.ProfilePicture, &user.Signature, &user.Role, &user.Status, &user.CreatedAt)
+	query := "SELECT id, username, email, profile_picture, signature, bio, location, website, favorite_genres, favorite_book, role, status, trust_level, created_at FROM users WHERE username = ?"
+	err := db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.Email, &user.ProfilePicture, &user.Signature, &user.Bio, &user.Location, &user.Website, &user.FavoriteGenres, &user.FavoriteBook, &user.Role, &user.Status, &user.TrustLevel, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (db *DB) UpdateUserProfile(userID int, profilePicture, signature string) error {
-	query := "UPDATE users SET profile_picture = ?, signature = ? WHERE id = ?"
-	_, err := db.Exec(query, profilePicture, signature, userID)
+// UpdateUserProfile saves the fields users can edit on their profile
+func (db *DB) UpdateUserProfile(ctx context.Context, user *models.User) error {
+	query := `
+		UPDATE users
+		SET profile_picture = ?, signature = ?, bio = ?, location = ?, website = ?, favorite_genres = ?, favorite_book = ?
+		WHERE id = ?
+	`
+	_, err := db.ExecContext(ctx, query, user.ProfilePicture, user.Signature, user.Bio, user.Location,
+		user.Website, user.FavoriteGenres, user.FavoriteBook, user.ID)
 	return err
 }
 
-func (db *DB) CheckUserExists(email, username string) (bool, bool, error) {
+func (db *DB) CheckUserExists(ctx context.Context, email, username string) (bool, bool, error) {
 	var emailCount, usernameCount int
 
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&emailCount)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&emailCount)
 	if err != nil {
 		return false, false, err
 	}
 
-	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&usernameCount)
+	// Names members changed away from stay reserved for them
+	query := "SELECT (SELECT COUNT(*) FROM users WHERE username = ?) + (SELECT COUNT(*) FROM username_history WHERE username = ?)"
+	err = db.QueryRowContext(ctx, query, username, username).Scan(&usernameCount)
 	if err != nil {
 		return false, false, err
 	}
@@ -397,48 +508,61 @@ func (db *DB) CheckUserExists(email, username string) (bool, bool, error) {
 }
 
 // Session operations
-func (db *DB) CreateSession(session *models.Session) error {
-	query := "INSERT INTO sessions (user_id, uuid, expires_at) VALUES (?, ?, ?)"
-	result, err := db.Exec(query, session.UserID, session.UUID, session.ExpiresAt)
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
+func (db *DB) CreateSession(ctx context.Context, session *models.Session) error {
+	query := "INSERT INTO sessions (user_id, uuid, expires_at, impersonator_id) VALUES (?, ?, ?, ?)"
+	id, err := db.insert(ctx, query, session.UserID, session.UUID, session.ExpiresAt, session.ImpersonatorID)
 	if err != nil {
 		return err
 	}
 
-	session.ID = int(id)
+	session.ID = id
 	return nil
 }
 
-func (db *DB) GetSessionByUUID(uuid string) (*models.Session, error) {
+func (db *DB) GetSessionByUUID(ctx context.Context, uuid string) (*models.Session, error) {
 	session := &models.Session{}
-	query := "SELECT id, user_id, uuid, expires_at, created_at FROM sessions WHERE uuid = ? AND expires_at > ?"
-	err := db.QueryRow(query, uuid, time.Now()).Scan(&session.ID, &session.UserID, &session.UUID, &session.ExpiresAt, &session.CreatedAt)
+	query := "SELECT id, user_id, uuid, expires_at, created_at, impersonator_id FROM sessions WHERE uuid = ? AND expires_at > ?"
+	err := db.QueryRowContext(ctx, query, uuid, time.Now()).Scan(&session.ID, &session.UserID, &session.UUID, &session.ExpiresAt, &session.CreatedAt, &session.ImpersonatorID)
 	if err != nil {
 		return nil, err
 	}
 	return session, nil
 }
 
-func (db *DB) DeleteSession(uuid string) error {
+func (db *DB) DeleteSession(ctx context.Context, uuid string) error {
 	query := "DELETE FROM sessions WHERE uuid = ?"
-	_, err := db.Exec(query, uuid)
+	_, err := db.ExecContext(ctx, query, uuid)
 	return err
 }
 
-func (db *DB) CleanExpiredSessions() error {
+func (db *DB) CleanExpiredSessions(ctx context.Context) error {
 	query := "DELETE FROM sessions WHERE expires_at < ?"
-	_, err := db.Exec(query, time.Now())
+	_, err := db.ExecContext(ctx, query, time.Now())
 	return err
 }
 
 // Category operations
-func (db *DB) GetAllCategories() ([]models.Category, error) {
-	query := "SELECT id, name, description, created_at FROM categories ORDER BY name"
-	rows, err := db.Query(query)
+
+// inCategoryTree matches the posts in a category, given as its argument, or
+// any of its subcategories
+const inCategoryTree = `p.category_id IN (
+			WITH RECURSIVE tree(id) AS (
+				SELECT id FROM categories WHERE id = ?
+				UNION
+				SELECT sub.id FROM categories sub JOIN tree ON sub.parent_id = tree.id
+			)
+			SELECT id FROM tree
+		)`
+
+// inNamedCategory is a condition that leaves out posts p in anonymous
+// categories, for queries that would tie them to their authors
+const inNamedCategory = `p.category_id NOT IN (SELECT id FROM categories WHERE anonymous = TRUE)`
+
+// GetAllCategories returns the top-level categories, with their
+// subcategories in Children, each level in the order set by admins
+func (db *DB) GetAllCategories(ctx context.Context) ([]models.Category, error) {
+	query := "SELECT id, name, description, icon, color, sort_order, parent_id, anonymous, created_at FROM categories ORDER BY sort_order, name"
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -447,139 +571,185 @@ func (db *DB) GetAllCategories() ([]models.Category, error) {
 	var categories []models.Category
 	for rows.Next() {
 		var cat models.Category
-		err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.CreatedAt)
+		err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.Icon, &cat.Color, &cat.SortOrder, &cat.ParentID, &cat.Anonymous, &cat.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
 		categories = append(categories, cat)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return categories, nil
+	return categoryTree(categories, nil), nil
 }
 
-func (db *DB) GetCategoryByID(id int) (*models.Category, error) {
+// categoryTree builds the tree of the categories under parentID, nil for
+// the top level, keeping their order
+func categoryTree(categories []models.Category, parentID *int) []models.Category {
+	var level []models.Category
+	for _, cat := range categories {
+		if (parentID == nil && cat.ParentID == nil) || (parentID != nil && cat.ParentID != nil && *cat.ParentID == *parentID) {
+			cat.Children = categoryTree(categories, &cat.ID)
+			level = append(level, cat)
+		}
+	}
+	return level
+}
+
+func (db *DB) GetCategoryByID(ctx context.Context, id int) (*models.Category, error) {
 	cat := &models.Category{}
-	query := "SELECT id, name, description, created_at FROM categories WHERE id = ?"
-	err := db.QueryRow(query, id).Scan(&cat.ID, &cat.Name, &cat.Description, &cat.CreatedAt)
+	query := "SELECT id, name, description, icon, color, sort_order, parent_id, anonymous, created_at FROM categories WHERE id = ?"
+	err := db.QueryRowContext(ctx, query, id).Scan(&cat.ID, &cat.Name, &cat.Description, &cat.Icon, &cat.Color, &cat.SortOrder, &cat.ParentID, &cat.Anonymous, &cat.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return cat, nil
 }
 
-// Post operations
-func (db *DB) CreatePost(post *models.Post) error {
-	query := "INSERT INTO posts (title, content, user_id, category_id) VALUES (?, ?, ?, ?)"
-	result, err := db.Exec(query, post.Title, post.Content, post.UserID, post.CategoryID)
+// CreateCategory adds a category, listed after the existing ones, and sets
+// its ID
+func (db *DB) CreateCategory(ctx context.Context, category *models.Category) error {
+	query := `INSERT INTO categories (name, description, parent_id, anonymous, sort_order)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(sort_order), 0) + 1 FROM categories))`
+	id, err := db.insert(ctx, query, category.Name, category.Description, category.ParentID, category.Anonymous)
+	if err != nil {
+		return err
+	}
+	category.ID = id
+	return nil
+}
+
+// UpdateCategory saves a category's icon, color, position, parent and
+// whether it is anonymous. Returns sql.ErrNoRows if there is no such
+// category.
+func (db *DB) UpdateCategory(ctx context.Context, category *models.Category) error {
+	result, err := db.ExecContext(ctx, "UPDATE categories SET icon = ?, color = ?, sort_order = ?, parent_id = ?, anonymous = ? WHERE id = ?",
+		category.Icon, category.Color, category.SortOrder, category.ParentID, category.Anonymous, category.ID)
 	if err != nil {
 		return err
 	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
 
-	id, err := result.LastInsertId()
+// Post operations
+func (db *DB) CreatePost(ctx context.Context, post *models.Post) error {
+	query := "INSERT INTO posts (title, content, user_id, category_id, book_id) VALUES (?, ?, ?, ?, ?)"
+	id, err := db.insert(ctx, query, post.Title, post.Content, post.UserID, post.CategoryID, post.BookID)
 	if err != nil {
 		return err
 	}
 
-	post.ID = int(id)
+	post.ID = id
 	return nil
 }
 
-func (db *DB) GetAllPosts() ([]models.Post, error) {
+func (db *DB) GetAllPosts(ctx context.Context) ([]models.Post, error) {
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
+		WHERE p.deleted_at IS NULL AND p.archived_at IS NULL
 		ORDER BY p.created_at DESC
 	`
-	return db.executePosts(query)
+	return db.executePosts(ctx, query)
 }
 
-func (db *DB) GetPostsByCategory(categoryID int) ([]models.Post, error) {
+func (db *DB) GetPostsByCategory(ctx context.Context, categoryID int) ([]models.Post, error) {
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE p.category_id = ?
+		WHERE p.deleted_at IS NULL AND p.archived_at IS NULL AND ` + inCategoryTree + `
 		ORDER BY p.created_at DESC
 	`
-	return db.executePostsWithArgs(query, categoryID)
+	return db.executePostsWithArgs(ctx, query, categoryID)
 }
 
-func (db *DB) GetPostsByUser(userID int) ([]models.Post, error) {
+func (db *DB) GetPostsByUser(ctx context.Context, userID int) ([]models.Post, error) {
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE p.user_id = ?
+		WHERE p.deleted_at IS NULL AND p.user_id = ? AND c.anonymous = FALSE
 		ORDER BY p.created_at DESC
 	`
-	return db.executePostsWithArgs(query, userID)
+	return db.executePostsWithArgs(ctx, query, userID)
 }
 
-func (db *DB) GetLikedPostsByUser(userID int) ([]models.Post, error) {
+func (db *DB) GetLikedPostsByUser(ctx context.Context, userID int) ([]models.Post, error) {
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE EXISTS (
+		WHERE p.deleted_at IS NULL AND EXISTS (
 			SELECT 1 FROM post_likes pl 
-			WHERE pl.post_id = p.id AND pl.user_id = ? AND pl.is_like = 1
+			WHERE pl.post_id = p.id AND pl.user_id = ? AND pl.is_like = TRUE
 		)
 		ORDER BY p.created_at DESC
 	`
-	return db.executePostsWithArgs(query, userID)
+	return db.executePostsWithArgs(ctx, query, userID)
 }
-func (db *DB) GetPostByID(id int) (*models.Post, error) {
+func (db *DB) GetPostByID(ctx context.Context, id int) (*models.Post, error) {
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count, p.archived_at,
+			p.book_id, COALESCE(b.title, ''), p.followers_count, p.bookmarks_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE p.id = ?
+		LEFT JOIN books b ON p.book_id = b.id
+		WHERE p.deleted_at IS NULL AND p.id = ?
 	`
-	row := db.QueryRow(query, id)
+	row := db.QueryRowContext(ctx, query, id)
 
 	var post models.Post
 	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &post.CategoryID,
-		&post.Username, &post.CategoryName, &post.CreatedAt, &post.UpdatedAt,
-		&post.LikesCount, &post.DislikesCount, &post.CommentsCount)
+		&post.Username, &post.CategoryName, &post.Anonymous, &post.CreatedAt, &post.UpdatedAt,
+		&post.LikesCount, &post.DislikesCount, &post.CommentsCount, &post.ArchivedAt,
+		&post.BookID, &post.BookTitle, &post.Followers, &post.Bookmarks)
 	if err != nil {
 		return nil, err
 	}
 
 	return &post, nil
 }
-func (db *DB) executePosts(query string) ([]models.Post, error) {
-	rows, err := db.Query(query)
+
+// hideAuthor replaces the author of a post in an anonymous category, scanned
+// into AuthorHidden, with models.AnonymousName, so listings never give away
+// who wrote it
+func hideAuthor(post *models.Post) {
+	if post.AuthorHidden {
+		post.UserID = 0
+		post.Username = models.AnonymousName
+	}
+}
+
+func (db *DB) executePosts(ctx context.Context, query string) ([]models.Post, error) {
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -589,19 +759,20 @@ func (db *DB) executePosts(query string) ([]models.Post, error) {
 	for rows.Next() {
 		var post models.Post
 		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &post.CategoryID,
-			&post.Username, &post.CategoryName, &post.CreatedAt, &post.UpdatedAt,
+			&post.Username, &post.CategoryName, &post.AuthorHidden, &post.CreatedAt, &post.UpdatedAt,
 			&post.LikesCount, &post.DislikesCount, &post.CommentsCount)
 		if err != nil {
 			return nil, err
 		}
+		hideAuthor(&post)
 		posts = append(posts, post)
 	}
 
 	return posts, nil
 }
 
-func (db *DB) executePostsWithArgs(query string, args ...interface{}) ([]models.Post, error) {
-	rows, err := db.Query(query, args...)
+func (db *DB) executePostsWithArgs(ctx context.Context, query string, args ...interface{}) ([]models.Post, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -611,11 +782,12 @@ func (db *DB) executePostsWithArgs(query string, args ...interface{}) ([]models.
 	for rows.Next() {
 		var post models.Post
 		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &post.CategoryID,
-			&post.Username, &post.CategoryName, &post.CreatedAt, &post.UpdatedAt,
+			&post.Username, &post.CategoryName, &post.AuthorHidden, &post.CreatedAt, &post.UpdatedAt,
 			&post.LikesCount, &post.DislikesCount, &post.CommentsCount)
 		if err != nil {
 			return nil, err
 		}
+		hideAuthor(&post)
 		posts = append(posts, post)
 	}
 
@@ -635,6 +807,8 @@ func (db *DB) buildOrderClause(sortBy, sortOrder string) string {
 		orderBy += "comments_count"
 	case "title":
 		orderBy += "p.title"
+	case "top":
+		orderBy += "likes_count + comments_count"
 	default:
 		orderBy += "p.created_at"
 	}
@@ -649,140 +823,250 @@ func (db *DB) buildOrderClause(sortBy, sortOrder string) string {
 }
 
 // GetPostsWithSorting gets all posts with specified sorting
-func (db *DB) GetPostsWithSorting(sortBy, sortOrder string) ([]models.Post, error) {
+func (db *DB) GetPostsWithSorting(ctx context.Context, sortBy, sortOrder string) ([]models.Post, error) {
 	orderClause := db.buildOrderClause(sortBy, sortOrder)
 
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
+		WHERE p.deleted_at IS NULL AND p.archived_at IS NULL
 		` + orderClause
 
-	return db.executePosts(query)
+	return db.executePosts(ctx, query)
 }
 
-// GetPostsByCategoryWithSorting gets posts by category with specified sorting
-func (db *DB) GetPostsByCategoryWithSorting(categoryID int, sortBy, sortOrder string) ([]models.Post, error) {
+// GetPostsByCategoryWithSorting gets posts by category, including its
+// subcategories, with specified sorting
+func (db *DB) GetPostsByCategoryWithSorting(ctx context.Context, categoryID int, sortBy, sortOrder string) ([]models.Post, error) {
 	orderClause := db.buildOrderClause(sortBy, sortOrder)
 
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE p.category_id = ?
+		WHERE p.deleted_at IS NULL AND p.archived_at IS NULL AND ` + inCategoryTree + `
 		` + orderClause
 
-	return db.executePostsWithArgs(query, categoryID)
+	return db.executePostsWithArgs(ctx, query, categoryID)
 }
 
 // GetPostsByUserWithSorting gets posts by user with specified sorting
-func (db *DB) GetPostsByUserWithSorting(userID int, sortBy, sortOrder string) ([]models.Post, error) {
+func (db *DB) GetPostsByUserWithSorting(ctx context.Context, userID int, sortBy, sortOrder string) ([]models.Post, error) {
 	orderClause := db.buildOrderClause(sortBy, sortOrder)
 
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE p.user_id = ?
+		WHERE p.deleted_at IS NULL AND p.user_id = ?
 		` + orderClause
 
-	return db.executePostsWithArgs(query, userID)
+	return db.executePostsWithArgs(ctx, query, userID)
 }
 
 // GetLikedPostsByUserWithSorting gets liked posts by user with specified sorting
-func (db *DB) GetLikedPostsByUserWithSorting(userID int, sortBy, sortOrder string) ([]models.Post, error) {
+func (db *DB) GetLikedPostsByUserWithSorting(ctx context.Context, userID int, sortBy, sortOrder string) ([]models.Post, error) {
 	orderClause := db.buildOrderClause(sortBy, sortOrder)
 
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE EXISTS (
+		WHERE p.deleted_at IS NULL AND EXISTS (
 			SELECT 1 FROM post_likes pl 
-			WHERE pl.post_id = p.id AND pl.user_id = ? AND pl.is_like = 1
+			WHERE pl.post_id = p.id AND pl.user_id = ? AND pl.is_like = TRUE
 		)
 		` + orderClause
 
-	return db.executePostsWithArgs(query, userID)
+	return db.executePostsWithArgs(ctx, query, userID)
 }
 
 // GetPostsWithSuspendedFilterAndSorting gets posts with suspended filter and sorting
-func (db *DB) GetPostsWithSuspendedFilterAndSorting(showSuspended bool, sortBy, sortOrder string) ([]models.Post, error) {
+func (db *DB) GetPostsWithSuspendedFilterAndSorting(ctx context.Context, showSuspended bool, sortBy, sortOrder string) ([]models.Post, error) {
 	orderClause := db.buildOrderClause(sortBy, sortOrder)
 
 	baseQuery := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		JOIN categories c ON p.category_id = c.id`
+		JOIN categories c ON p.category_id = c.id
+		WHERE p.deleted_at IS NULL AND p.archived_at IS NULL`
 
 	if !showSuspended {
-		baseQuery += " WHERE u.status = 'active'"
+		baseQuery += " AND u.status = 'active'"
 	}
 
 	query := baseQuery + " " + orderClause
-	return db.executePosts(query)
+	return db.executePosts(ctx, query)
 }
 
-// Comment operations
-func (db *DB) CreateComment(comment *models.Comment) error {
-	query := "INSERT INTO comments (content, user_id, post_id, parent_id) VALUES (?, ?, ?, ?)"
-	result, err := db.Exec(query, comment.Content, comment.UserID, comment.PostID, comment.ParentID)
+// GetRandomPostID picks a live, unarchived post by an active member at
+// random, from the category with the given ID and its subcategories, or from
+// anywhere if categoryID is 0. It returns sql.ErrNoRows if there is none.
+func (db *DB) GetRandomPostID(ctx context.Context, categoryID int) (int, error) {
+	query := `
+		SELECT p.id
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.deleted_at IS NULL AND p.archived_at IS NULL AND u.status = 'active'`
+	var args []interface{}
+	if categoryID != 0 {
+		query += " AND " + inCategoryTree
+		args = append(args, categoryID)
+	}
+	query += " ORDER BY RANDOM() LIMIT 1"
+
+	var id int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&id)
+	return id, err
+}
+
+// GetPostsBetweenWithSorting gets the posts started from from up to but not
+// including to, with specified sorting. Archived threads are included, since
+// browsing by date is how old discussions are found again.
+func (db *DB) GetPostsBetweenWithSorting(ctx context.Context, from, to time.Time, showSuspended bool, sortBy, sortOrder string) ([]models.Post, error) {
+	orderClause := db.buildOrderClause(sortBy, sortOrder)
+
+	query := `
+		SELECT
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous,
+			p.created_at, p.updated_at,
+			p.likes_count, p.dislikes_count, p.comments_count
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		JOIN categories c ON p.category_id = c.id
+		WHERE p.deleted_at IS NULL AND p.created_at >= ? AND p.created_at < ?`
+	if !showSuspended {
+		query += " AND u.status = 'active'"
+	}
+
+	return db.executePostsWithArgs(ctx, query+" "+orderClause, db.dialect.timeArg(from), db.dialect.timeArg(to))
+}
+
+// GetTopPosts ranks the posts started since the given time by likes and
+// comments, and returns the first limit of them. Archived threads count too.
+func (db *DB) GetTopPosts(ctx context.Context, since time.Time, showSuspended bool, limit int) ([]models.Post, error) {
+	query := `
+		SELECT
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous,
+			p.created_at, p.updated_at,
+			p.likes_count, p.dislikes_count, p.comments_count
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		JOIN categories c ON p.category_id = c.id
+		WHERE p.deleted_at IS NULL AND p.created_at >= ?`
+	if !showSuspended {
+		query += " AND u.status = 'active'"
+	}
+	query += " " + db.buildOrderClause("top", "desc") + ", p.created_at DESC LIMIT ?"
+
+	return db.executePostsWithArgs(ctx, query, db.dialect.timeArg(since), limit)
+}
+
+// GetPostMonths lists the months (in UTC) in which posts were started, newest
+// first, with how many posts each has
+func (db *DB) GetPostMonths(ctx context.Context, showSuspended bool) ([]models.ArchiveMonth, error) {
+	month := "substr(" + db.dialect.day("p.created_at") + ", 1, 7)"
+	query := `
+		SELECT ` + month + ` AS month, COUNT(*)
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.deleted_at IS NULL`
+	if !showSuspended {
+		query += " AND u.status = 'active'"
+	}
+	query += " GROUP BY month ORDER BY month DESC"
+
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var months []models.ArchiveMonth
+	for rows.Next() {
+		var name string
+		var m models.ArchiveMonth
+		if err := rows.Scan(&name, &m.Posts); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse month %q: %v", name, err)
+		}
+		m.Year, m.Month = t.Year(), int(t.Month())
+		months = append(months, m)
+	}
+	return months, rows.Err()
+}
+
+// Comment operations
+func (db *DB) CreateComment(ctx context.Context, comment *models.Comment) error {
+	if err := db.checkPostWritable(ctx, comment.PostID); err != nil {
 		return err
 	}
 
-	id, err := result.LastInsertId()
+	query := "INSERT INTO comments (content, user_id, post_id, parent_id) VALUES (?, ?, ?, ?)"
+	id, err := db.insert(ctx, query, comment.Content, comment.UserID, comment.PostID, comment.ParentID)
 	if err != nil {
 		return err
 	}
 
-	comment.ID = int(id)
+	comment.ID = id
 	return nil
 }
 
-func (db *DB) GetCommentsByPostID(postID int) ([]models.Comment, error) {
+// GetCommentByID gets a single comment that is not in the trash
+func (db *DB) GetCommentByID(ctx context.Context, id int) (*models.Comment, error) {
+	query := `
+		SELECT c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at, c.updated_at
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.id = ? AND c.deleted_at IS NULL
+	`
+	var comment models.Comment
+	err := db.QueryRowContext(ctx, query, id).Scan(&comment.ID, &comment.Content, &comment.UserID,
+		&comment.PostID, &comment.ParentID, &comment.Username, &comment.CreatedAt, &comment.EditedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+func (db *DB) GetCommentsByPostID(ctx context.Context, postID int) ([]models.Comment, error) {
 	query := `
 		SELECT c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at,
-		       COALESCE(SUM(CASE WHEN cl.is_like = 1 THEN 1 ELSE 0 END), 0) as likes_count,
-		       COALESCE(SUM(CASE WHEN cl.is_like = 0 THEN 1 ELSE 0 END), 0) as dislikes_count
+		       COALESCE(SUM(CASE WHEN cl.is_like = TRUE THEN 1 ELSE 0 END), 0) as likes_count,
+		       COALESCE(SUM(CASE WHEN cl.is_like = FALSE THEN 1 ELSE 0 END), 0) as dislikes_count
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
 		LEFT JOIN comment_likes cl ON c.id = cl.comment_id
-		WHERE c.post_id = ?
+		WHERE c.post_id = ? AND c.deleted_at IS NULL
 		GROUP BY c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at
 		ORDER BY c.created_at ASC
 	`
-	rows, err := db.Query(query, postID)
+	rows, err := db.QueryContext(ctx, query, postID)
 	if err != nil {
 		return nil, err
 	}
@@ -803,19 +1087,20 @@ func (db *DB) GetCommentsByPostID(postID int) ([]models.Comment, error) {
 }
 
 // GetCommentsByUser gets all comments made by a specific user
-func (db *DB) GetCommentsByUser(userID int) ([]models.Comment, error) {
+func (db *DB) GetCommentsByUser(ctx context.Context, userID int) ([]models.Comment, error) {
 	query := `
 		SELECT c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at,
-		       COALESCE(SUM(CASE WHEN cl.is_like = 1 THEN 1 ELSE 0 END), 0) as likes_count,
-		       COALESCE(SUM(CASE WHEN cl.is_like = 0 THEN 1 ELSE 0 END), 0) as dislikes_count
+		       COALESCE(SUM(CASE WHEN cl.is_like = TRUE THEN 1 ELSE 0 END), 0) as likes_count,
+		       COALESCE(SUM(CASE WHEN cl.is_like = FALSE THEN 1 ELSE 0 END), 0) as dislikes_count
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
+		JOIN posts p ON c.post_id = p.id
 		LEFT JOIN comment_likes cl ON c.id = cl.comment_id
-		WHERE c.user_id = ?
+		WHERE c.user_id = ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL AND ` + inNamedCategory + `
 		GROUP BY c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at
 		ORDER BY c.created_at DESC
 	`
-	rows, err := db.Query(query, userID)
+	rows, err := db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -836,68 +1121,60 @@ func (db *DB) GetCommentsByUser(userID int) ([]models.Comment, error) {
 }
 
 // Like operations
-func (db *DB) LikePost(userID, postID int, isLike bool) error {
-	// First, check if user already has a like/dislike on this post
-	var existingLike sql.NullBool
-	query := "SELECT is_like FROM post_likes WHERE user_id = ? AND post_id = ?"
-	err := db.QueryRow(query, userID, postID).Scan(&existingLike)
-
-	if err == sql.ErrNoRows {
-		// No existing like, insert new one
-		query = "INSERT INTO post_likes (user_id, post_id, is_like) VALUES (?, ?, ?)"
-		_, err = db.Exec(query, userID, postID, isLike)
-		return err
-	} else if err != nil {
+func (db *DB) LikePost(ctx context.Context, userID, postID int, isLike bool) error {
+	if err := db.checkPostWritable(ctx, postID); err != nil {
 		return err
 	}
+	return db.toggleVote(ctx, "post_likes", "post_id", userID, postID, isLike)
+}
 
-	// Existing like found
-	if existingLike.Valid && existingLike.Bool == isLike {
-		// Same type of like, remove it
-		query = "DELETE FROM post_likes WHERE user_id = ? AND post_id = ?"
-		_, err = db.Exec(query, userID, postID)
+func (db *DB) LikeComment(ctx context.Context, userID, commentID int, isLike bool) error {
+	var postID int
+	if err := db.QueryRowContext(ctx, "SELECT post_id FROM comments WHERE id = ?", commentID).Scan(&postID); err != nil {
 		return err
-	} else {
-		// Different type of like, update it
-		query = "UPDATE post_likes SET is_like = ? WHERE user_id = ? AND post_id = ?"
-		_, err = db.Exec(query, isLike, userID, postID)
+	}
+	if err := db.checkPostWritable(ctx, postID); err != nil {
 		return err
 	}
+	return db.toggleVote(ctx, "comment_likes", "comment_id", userID, commentID, isLike)
 }
 
-func (db *DB) LikeComment(userID, commentID int, isLike bool) error {
-	// First, check if user already has a like/dislike on this comment
-	var existingLike sql.NullBool
-	query := "SELECT is_like FROM comment_likes WHERE user_id = ? AND comment_id = ?"
-	err := db.QueryRow(query, userID, commentID).Scan(&existingLike)
+// toggleVote records a like or dislike in table, where column names the voted
+// item. Voting the same way twice removes the vote; voting the other way
+// replaces it. The delete and the upsert run in one transaction and never
+// read-then-write, so concurrent clicks cannot create duplicate votes or lose
+// updates.
+func (db *DB) toggleVote(ctx context.Context, table, column string, userID, itemID int, isLike bool) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		// Same type of vote, remove it
+		query := fmt.Sprintf("DELETE FROM %s WHERE user_id = ? AND %s = ? AND is_like = ?", table, column)
+		result, err := tx.ExecContext(ctx, query, userID, itemID, isLike)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			return nil
+		}
 
-	if err == sql.ErrNoRows {
-		// No existing like, insert new one
-		query = "INSERT INTO comment_likes (user_id, comment_id, is_like) VALUES (?, ?, ?)"
-		_, err = db.Exec(query, userID, commentID, isLike)
-		return err
-	} else if err != nil {
-		return err
-	}
+		// No vote or a different one, insert or flip it
+		query = fmt.Sprintf(`
+			INSERT INTO %s (user_id, %s, is_like) VALUES (?, ?, ?)
+			ON CONFLICT (user_id, %s) DO UPDATE SET is_like = excluded.is_like
+		`, table, column, column)
+		if _, err := tx.ExecContext(ctx, query, userID, itemID, isLike); err != nil {
+			return err
+		}
 
-	// Existing like found
-	if existingLike.Valid && existingLike.Bool == isLike {
-		// Same type of like, remove it
-		query = "DELETE FROM comment_likes WHERE user_id = ? AND comment_id = ?"
-		_, err = db.Exec(query, userID, commentID)
-		return err
-	} else {
-		// Different type of like, update it
-		query = "UPDATE comment_likes SET is_like = ? WHERE user_id = ? AND comment_id = ?"
-		_, err = db.Exec(query, isLike, userID, commentID)
-		return err
-	}
+		return nil
+	})
 }
 
-func (db *DB) GetPostLikeStatus(userID, postID int) (bool, bool, error) {
+func (db *DB) GetPostLikeStatus(ctx context.Context, userID, postID int) (bool, bool, error) {
 	var isLike sql.NullBool
 	query := "SELECT is_like FROM post_likes WHERE user_id = ? AND post_id = ?"
-	err := db.QueryRow(query, userID, postID).Scan(&isLike)
+	err := db.QueryRowContext(ctx, query, userID, postID).Scan(&isLike)
 
 	if err == sql.ErrNoRows {
 		return false, false, nil // No like/dislike
@@ -912,10 +1189,10 @@ func (db *DB) GetPostLikeStatus(userID, postID int) (bool, bool, error) {
 	return false, false, nil
 }
 
-func (db *DB) GetCommentLikeStatus(userID, commentID int) (bool, bool, error) {
+func (db *DB) GetCommentLikeStatus(ctx context.Context, userID, commentID int) (bool, bool, error) {
 	var isLike sql.NullBool
 	query := "SELECT is_like FROM comment_likes WHERE user_id = ? AND comment_id = ?"
-	err := db.QueryRow(query, userID, commentID).Scan(&isLike)
+	err := db.QueryRowContext(ctx, query, userID, commentID).Scan(&isLike)
 
 	if err == sql.ErrNoRows {
 		return false, false, nil // No like/dislike
@@ -930,121 +1207,251 @@ func (db *DB) GetCommentLikeStatus(userID, commentID int) (bool, bool, error) {
 	return false, false, nil
 }
 
+// GetPostVotes counts a post's likes and dislikes
+func (db *DB) GetPostVotes(ctx context.Context, postID int) (int, int, error) {
+	return db.countVotes(ctx, "post_likes", "post_id", postID)
+}
+
+// GetCommentVotes counts a comment's likes and dislikes
+func (db *DB) GetCommentVotes(ctx context.Context, commentID int) (int, int, error) {
+	return db.countVotes(ctx, "comment_likes", "comment_id", commentID)
+}
+
+// countVotes counts the likes and dislikes in table, where column names the
+// voted item
+func (db *DB) countVotes(ctx context.Context, table, column string, itemID int) (int, int, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COALESCE(SUM(CASE WHEN is_like = TRUE THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN is_like = FALSE THEN 1 ELSE 0 END), 0)
+		FROM %s WHERE %s = ?`, table, column)
+	var likes, dislikes int
+	err := db.QueryRowContext(ctx, query, itemID).Scan(&likes, &dislikes)
+	return likes, dislikes, err
+}
+
 // Search operations
-func (db *DB) SearchPosts(searchTerm string, limit int) ([]models.Post, error) {
+func (db *DB) SearchPosts(ctx context.Context, searchTerm string, limit int) ([]models.Post, error) {
 	searchPattern := "%" + searchTerm + "%"
 	query := `
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE p.title LIKE ? OR p.content LIKE ?
+		WHERE p.deleted_at IS NULL AND (p.title ` + db.dialect.like() + ` ? OR p.content ` + db.dialect.like() + ` ?)
 		ORDER BY p.created_at DESC
 		LIMIT ?
 	`
-	return db.executePostsWithArgs(query, searchPattern, searchPattern, limit)
+	return db.executePostsWithArgs(ctx, query, searchPattern, searchPattern, limit)
 }
 
-func (db *DB) SearchPostSuggestions(searchTerm string, limit int) ([]models.Post, error) {
+func (db *DB) SearchPostSuggestions(ctx context.Context, searchTerm string, limit int) ([]models.Post, error) {
 	searchPattern := "%" + searchTerm + "%"
 	query := `
-		SELECT p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+		SELECT p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 		       p.created_at, p.updated_at,
 		       0 as likes_count, 0 as dislikes_count, 0 as comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		WHERE p.title LIKE ?
+		WHERE p.deleted_at IS NULL AND p.title ` + db.dialect.like() + ` ?
 		ORDER BY p.created_at DESC
 		LIMIT ?
 	`
-	return db.executePostsWithArgs(query, searchPattern, limit)
+	return db.executePostsWithArgs(ctx, query, searchPattern, limit)
 }
 
 // DeleteUser deletes a user and all related data (posts, comments, likes, sessions)
 // The deletion order is important due to foreign key constraints
-func (db *DB) DeleteUser(userID int) error {
-	// Start a transaction to ensure all deletions succeed or fail together
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %v", err)
-	}
-	defer tx.Rollback()
-
-	// 1. Delete comment likes for comments on user's posts and user's comment likes
-	_, err = tx.Exec(`
-		DELETE FROM comment_likes 
-		WHERE comment_id IN (
-			SELECT c.id FROM comments c 
-			JOIN posts p ON c.post_id = p.id 
-			WHERE p.user_id = ?
-		) OR user_id = ?
-	`, userID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete comment likes: %v", err)
-	}
+func (db *DB) DeleteUser(ctx context.Context, userID int) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		// Comments to remove: the user's comments, comments on the user's posts,
+		// and every reply beneath those so no reply is left without its parent
+		doomedComments := `
+			WITH RECURSIVE doomed(id) AS (
+				SELECT id FROM comments
+				WHERE user_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)
+				UNION
+				SELECT c.id FROM comments c JOIN doomed d ON c.parent_id = d.id
+			)
+		`
+
+		// 1. Delete likes on the doomed comments and the user's comment likes
+		_, err := tx.ExecContext(ctx, doomedComments+`
+			DELETE FROM comment_likes
+			WHERE comment_id IN (SELECT id FROM doomed) OR user_id = ?
+		`, userID, userID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete comment likes: %v", err)
+		}
 
-	// 2. Delete post likes for user's posts and user's post likes
-	_, err = tx.Exec(`
-		DELETE FROM post_likes 
-		WHERE post_id IN (
-			SELECT id FROM posts WHERE user_id = ?
-		) OR user_id = ?
-	`, userID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete post likes: %v", err)
-	}
+		// 2. Delete post likes for user's posts and user's post likes
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM post_likes 
+			WHERE post_id IN (
+				SELECT id FROM posts WHERE user_id = ?
+			) OR user_id = ?
+		`, userID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete post likes: %v", err)
+		}
 
-	// 3. Delete comments on user's posts and user's comments
-	_, err = tx.Exec(`
-		DELETE FROM comments 
-		WHERE post_id IN (
-			SELECT id FROM posts WHERE user_id = ?
-		) OR user_id = ?
-	`, userID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete comments: %v", err)
-	}
+		// 3. Delete the doomed comments
+		_, err = tx.ExecContext(ctx, doomedComments+`
+			DELETE FROM comments WHERE id IN (SELECT id FROM doomed)
+		`, userID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete comments: %v", err)
+		}
 
-	// 4. Delete user's posts
-	_, err = tx.Exec("DELETE FROM posts WHERE user_id = ?", userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete posts: %v", err)
-	}
+		// 4. Delete user's posts, along with the thread mutes, follows and
+		// bookmarks of them and the user's own. Threads merged into them stay in the trash but no
+		// longer redirect.
+		_, err = tx.ExecContext(ctx, "UPDATE posts SET merged_into = NULL WHERE merged_into IN (SELECT id FROM posts WHERE user_id = ?)", userID)
+		if err != nil {
+			return fmt.Errorf("failed to clear merges into posts: %v", err)
+		}
 
-	// 5. Delete user's sessions
-	_, err = tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete sessions: %v", err)
-	}
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM thread_mutes
+			WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?) OR user_id = ?
+		`, userID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete thread mutes: %v", err)
+		}
+		for _, table := range []string{"thread_follows", "bookmarks"} {
+			_, err = tx.ExecContext(ctx, `
+				DELETE FROM `+table+`
+				WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?) OR user_id = ?
+			`, userID, userID)
+			if err != nil {
+				return fmt.Errorf("failed to delete %s: %v", table, err)
+			}
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM posts WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete posts: %v", err)
+		}
 
-	// 6. Finally, delete the user
-	_, err = tx.Exec("DELETE FROM users WHERE id = ?", userID)
-	if err != nil {
-		return fmt.Errorf("failed to delete user: %v", err)
-	}
+		// 5. Delete user's sessions
+		_, err = tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete sessions: %v", err)
+		}
 
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
-	}
+		// 6. Delete user's reading lists, review drafts, scheduled posts and
+		// held content
+		_, err = tx.ExecContext(ctx, "DELETE FROM user_books WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete shelf entries: %v", err)
+		}
 
-	return nil
+		_, err = tx.ExecContext(ctx, "DELETE FROM review_drafts WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete review drafts: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM scheduled_posts WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete scheduled posts: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM held_content WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete held content: %v", err)
+		}
+
+		// 7. Forget the user as the one who trashed posts and comments
+		_, err = tx.ExecContext(ctx, "UPDATE posts SET deleted_by = NULL WHERE deleted_by = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to clear trashed posts: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE comments SET deleted_by = NULL WHERE deleted_by = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to clear trashed comments: %v", err)
+		}
+
+		// 8. Delete the user's private conversations, including the other
+		// participants' side of them
+		userConversations := "SELECT conversation_id FROM conversation_participants WHERE user_id = ?"
+		_, err = tx.ExecContext(ctx, "DELETE FROM messages WHERE conversation_id IN ("+userConversations+")", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete messages: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM conversation_participants WHERE conversation_id IN ("+userConversations+")", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete conversation participants: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM conversations WHERE id NOT IN (SELECT conversation_id FROM conversation_participants)")
+		if err != nil {
+			return fmt.Errorf("failed to delete conversations: %v", err)
+		}
+
+		// 9. Delete blocks made by or against the user
+		_, err = tx.ExecContext(ctx, "DELETE FROM blocks WHERE blocker_id = ? OR blocked_id = ?", userID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete blocks: %v", err)
+		}
+
+		// 10. Delete the user's quotes, likes on them and the user's likes
+		_, err = tx.ExecContext(ctx, "DELETE FROM quote_likes WHERE user_id = ? OR quote_id IN (SELECT id FROM quotes WHERE user_id = ?)", userID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete quote likes: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM quotes WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete quotes: %v", err)
+		}
+
+		// 11. Delete the user's settings
+		_, err = tx.ExecContext(ctx, "DELETE FROM user_preferences WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete preferences: %v", err)
+		}
+
+		// 12. Delete the user's old usernames, freeing them for others
+		_, err = tx.ExecContext(ctx, "DELETE FROM username_history WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete username history: %v", err)
+		}
+
+		// 13. Delete the user's wall and the messages they left on others'
+		_, err = tx.ExecContext(ctx, "DELETE FROM wall_posts WHERE profile_user_id = ? OR author_id = ?", userID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete wall posts: %v", err)
+		}
+
+		// 14. Delete the user's pending email change
+		_, err = tx.ExecContext(ctx, "DELETE FROM email_changes WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete email changes: %v", err)
+		}
+
+		// 15. Finally, delete the user
+		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %v", err)
+		}
+
+		return nil
+	})
 }
 
 // Admin operations
-func (db *DB) GetAllUsers() ([]models.User, error) {
+func (db *DB) GetAllUsers(ctx context.Context) ([]models.User, error) {
 	query := `
-		SELECT id, username, email, profile_picture, signature, role, status, created_at 
+		SELECT id, username, email, profile_picture, signature, bio, location, website, favorite_genres, favorite_book, role, status, trust_level, suspension_reason, created_at 
 		FROM users 
 		ORDER BY created_at DESC
 	`
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -1054,7 +1461,8 @@ func (db *DB) GetAllUsers() ([]models.User, error) {
 	for rows.Next() {
 		var user models.User
 		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.ProfilePicture,
-			&user.Signature, &user.Role, &user.Status, &user.CreatedAt)
+			&user.Signature, &user.Bio, &user.Location, &user.Website, &user.FavoriteGenres,
+			&user.FavoriteBook, &user.Role, &user.Status, &user.TrustLevel, &user.SuspensionReason, &user.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -1064,10 +1472,11 @@ func (db *DB) GetAllUsers() ([]models.User, error) {
 	return users, nil
 }
 
-// SuspendUser suspends a user (changes status to 'suspended')
-func (db *DB) SuspendUser(userID int) error {
-	query := "UPDATE users SET status = 'suspended' WHERE id = ? AND role != 'admin'"
-	result, err := db.Exec(query, userID)
+// SuspendUser suspends a user (changes status to 'suspended'), keeping the
+// reason the admin gave
+func (db *DB) SuspendUser(ctx context.Context, userID int, reason string) error {
+	query := "UPDATE users SET status = 'suspended', suspension_reason = ? WHERE id = ? AND role != 'admin'"
+	result, err := db.ExecContext(ctx, query, reason, userID)
 	if err != nil {
 		return err
 	}
@@ -1084,34 +1493,62 @@ func (db *DB) SuspendUser(userID int) error {
 	return nil
 }
 
-// UnsuspendUser reactivates a suspended user (changes status to 'active')
-func (db *DB) UnsuspendUser(userID int) error {
-	query := "UPDATE users SET status = 'active' WHERE id = ?"
-	_, err := db.Exec(query, userID)
+// UnsuspendUser reactivates a suspended user (changes status to 'active').
+// Accounts their owner deactivated are left for them to reactivate.
+func (db *DB) UnsuspendUser(ctx context.Context, userID int) error {
+	query := "UPDATE users SET status = 'active', suspension_reason = '' WHERE id = ? AND status = 'suspended'"
+	_, err := db.ExecContext(ctx, query, userID)
 	return err
 }
 
+// DeactivateUser deactivates an active user's account, hiding their profile
+// and content, and logs them out everywhere. It returns sql.ErrNoRows if
+// the account isn't active, such as when it is suspended.
+func (db *DB) DeactivateUser(ctx context.Context, userID int) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		result, err := tx.ExecContext(ctx, "UPDATE users SET status = 'deactivated' WHERE id = ? AND status = 'active'", userID)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(result); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = ?", userID)
+		return err
+	})
+}
+
+// ReactivateUser restores a deactivated account. It returns sql.ErrNoRows
+// if the account isn't deactivated.
+func (db *DB) ReactivateUser(ctx context.Context, userID int) error {
+	result, err := db.ExecContext(ctx, "UPDATE users SET status = 'active' WHERE id = ? AND status = 'deactivated'", userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
 // GetUserStats returns statistics about a user (posts, comments, likes)
-func (db *DB) GetUserStats(userID int) (int, int, int, error) {
+func (db *DB) GetUserStats(ctx context.Context, userID int) (int, int, int, error) {
 	var postsCount, commentsCount, likesReceived int
 
 	// Count posts
-	err := db.QueryRow("SELECT COUNT(*) FROM posts WHERE user_id = ?", userID).Scan(&postsCount)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE user_id = ? AND deleted_at IS NULL", userID).Scan(&postsCount)
 	if err != nil {
 		return 0, 0, 0, err
 	}
 
 	// Count comments
-	err = db.QueryRow("SELECT COUNT(*) FROM comments WHERE user_id = ?", userID).Scan(&commentsCount)
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE user_id = ? AND deleted_at IS NULL", userID).Scan(&commentsCount)
 	if err != nil {
 		return 0, 0, 0, err
 	}
 
 	// Count likes received on user's posts
-	err = db.QueryRow(`
+	err = db.QueryRowContext(ctx, `
 		SELECT COUNT(DISTINCT p.id) FROM post_likes pl 
 		JOIN posts p ON pl.post_id = p.id 
-		WHERE p.user_id = ? AND pl.is_like = 1
+		WHERE p.user_id = ? AND pl.is_like = TRUE AND p.deleted_at IS NULL
 	`, userID).Scan(&likesReceived)
 	if err != nil {
 		return 0, 0, 0, err
@@ -1121,51 +1558,65 @@ func (db *DB) GetUserStats(userID int) (int, int, int, error) {
 }
 
 // GetPostsWithSuspendedFilter gets posts, optionally filtering out suspended users' content
-func (db *DB) GetPostsWithSuspendedFilter(showSuspended bool) ([]models.Post, error) {
+func (db *DB) GetPostsWithSuspendedFilter(ctx context.Context, showSuspended bool) ([]models.Post, error) {
 	whereClause := ""
 	if !showSuspended {
-		whereClause = "WHERE u.status = 'active'"
+		whereClause = "AND u.status = 'active'"
 	}
 
 	query := fmt.Sprintf(`
 		SELECT 
-			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
 			p.created_at, p.updated_at,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 1) as likes_count,
-			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.is_like = 0) as dislikes_count,
-			(SELECT COUNT(*) FROM comments cm WHERE cm.post_id = p.id) as comments_count
+			p.likes_count, p.dislikes_count, p.comments_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
 		JOIN categories c ON p.category_id = c.id
-		%s
+		WHERE p.deleted_at IS NULL AND p.archived_at IS NULL %s
 		ORDER BY p.created_at DESC
 	`, whereClause)
 
-	return db.executePosts(query)
+	return db.executePosts(ctx, query)
 }
 
-// GetCommentsWithSuspendedFilter gets comments for a post, optionally filtering out suspended users' content
-func (db *DB) GetCommentsWithSuspendedFilter(postID int, showSuspended bool) ([]models.Comment, error) {
-	whereClause := "WHERE c.post_id = ?"
-	args := []interface{}{postID}
-
+// GetCommentsWithSuspendedFilter gets the comment thread of a post, optionally
+// filtering out suspended users' content. The thread is walked with a
+// recursive query, so replies beneath a hidden comment are hidden too.
+// Comments come back parents first, ordered by depth and then creation time,
+// with Depth set.
+func (db *DB) GetCommentsWithSuspendedFilter(ctx context.Context, postID int, showSuspended bool) ([]models.Comment, error) {
+	statusFilter := ""
 	if !showSuspended {
-		whereClause += " AND u.status = 'active'"
+		statusFilter = " AND u.status = 'active'"
 	}
 
 	query := fmt.Sprintf(`
-		SELECT c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at,
-		       COALESCE(SUM(CASE WHEN cl.is_like = 1 THEN 1 ELSE 0 END), 0) as likes_count,
-		       COALESCE(SUM(CASE WHEN cl.is_like = 0 THEN 1 ELSE 0 END), 0) as dislikes_count
-		FROM comments c
+		WITH RECURSIVE thread(id, depth) AS (
+			SELECT c.id, 0
+			FROM comments c
+			JOIN users u ON c.user_id = u.id
+			WHERE c.post_id = ? AND c.parent_id IS NULL AND c.deleted_at IS NULL%[1]s
+			UNION ALL
+			SELECT c.id, t.depth + 1
+			FROM comments c
+			JOIN thread t ON c.parent_id = t.id
+			JOIN users u ON c.user_id = u.id
+			WHERE c.deleted_at IS NULL%[1]s
+		)
+		SELECT c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at, c.updated_at, t.depth,
+		       COALESCE(SUM(CASE WHEN cl.is_like = TRUE THEN 1 ELSE 0 END), 0) as likes_count,
+		       COALESCE(SUM(CASE WHEN cl.is_like = FALSE THEN 1 ELSE 0 END), 0) as dislikes_count,
+		       c.merged_from, COALESCE(mp.title, '')
+		FROM thread t
+		JOIN comments c ON c.id = t.id
 		JOIN users u ON c.user_id = u.id
 		LEFT JOIN comment_likes cl ON c.id = cl.comment_id
-		%s
-		GROUP BY c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at
-		ORDER BY c.created_at ASC
-	`, whereClause)
+		LEFT JOIN posts mp ON mp.id = c.merged_from
+		GROUP BY c.id, c.content, c.user_id, c.post_id, c.parent_id, u.username, c.created_at, c.updated_at, t.depth, c.merged_from, mp.title
+		ORDER BY t.depth ASC, c.created_at ASC, c.id ASC
+	`, statusFilter)
 
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, postID)
 	if err != nil {
 		return nil, err
 	}
@@ -1174,13 +1625,14 @@ func (db *DB) GetCommentsWithSuspendedFilter(postID int, showSuspended bool) ([]
 	var comments []models.Comment
 	for rows.Next() {
 		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.Content, &comment.UserID, &comment.PostID,
-			&comment.ParentID, &comment.Username, &comment.CreatedAt, &comment.LikesCount, &comment.DislikesCount)
+		err := rows.Scan(&comment.ID, &comment.Content, &comment.UserID, &comment.PostID, &comment.ParentID,
+			&comment.Username, &comment.CreatedAt, &comment.EditedAt, &comment.Depth, &comment.LikesCount, &comment.DislikesCount,
+			&comment.MergedFrom, &comment.MergedTitle)
 		if err != nil {
 			return nil, err
 		}
 		comments = append(comments, comment)
 	}
 
-	return comments, nil
+	return comments, rows.Err()
 }
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"literary-lions/config"
+	"literary-lions/models"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens a migrated SQLite database in a temporary directory, with
+// foreign keys enforced as in production
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB("sqlite3", filepath.Join(t.TempDir(), "forum.db"), DefaultSQLitePragmas(), PoolConfig{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	admin := config.Admin{Username: "admin", Email: "admin@example.com", Password: "admin"}
+	if err := db.InitDB(context.Background(), admin); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	return db
+}
+
+// createTestUser adds a member with the given username
+func createTestUser(t *testing.T, db *DB, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Email: username + "@example.com", Password: "hash"}
+	if err := db.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
+
+// createTestPost adds a post by userID in the first category
+func createTestPost(t *testing.T, db *DB, userID int, title string) *models.Post {
+	t.Helper()
+	post := &models.Post{Title: title, Content: "Content of " + title, UserID: userID, CategoryID: 1}
+	if err := db.CreatePost(context.Background(), post); err != nil {
+		t.Fatalf("create post %q: %v", title, err)
+	}
+	return post
+}
+
+// createTestComment adds a comment by userID on postID
+func createTestComment(t *testing.T, db *DB, userID, postID int, content string) *models.Comment {
+	t.Helper()
+	comment := &models.Comment{Content: content, UserID: userID, PostID: postID}
+	if err := db.CreateComment(context.Background(), comment); err != nil {
+		t.Fatalf("create comment: %v", err)
+	}
+	return comment
+}
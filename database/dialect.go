@@ -0,0 +1,309 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect identifies the SQL flavour spoken by the underlying driver.
+// Queries in this package are written with SQLite-style "?" placeholders
+// and rewritten for the active dialect before they are executed.
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite3"
+	dialectPostgres dialect = "postgres"
+)
+
+// parseDialect maps a driver name (or a DSN when no driver is given) to a dialect
+func parseDialect(driver, dataSourceName string) (dialect, error) {
+	switch strings.ToLower(driver) {
+	case "", "sqlite", "sqlite3":
+		if strings.HasPrefix(dataSourceName, "postgres://") || strings.HasPrefix(dataSourceName, "postgresql://") {
+			return dialectPostgres, nil
+		}
+		return dialectSQLite, nil
+	case "postgres", "postgresql", "pgx":
+		return dialectPostgres, nil
+	default:
+		return "", fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// rebind rewrites "?" placeholders into the dialect's placeholder syntax,
+// leaving question marks inside quoted strings untouched
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 10)
+
+	n := 0
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+			b.WriteByte(c)
+		case c == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// like returns the case-insensitive pattern matching operator
+func (d dialect) like() string {
+	if d == dialectPostgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// forUpdate returns the clause that locks selected rows until the end of the
+// transaction. SQLite has no row locks; its transactions already serialize
+// writes.
+func (d dialect) forUpdate() string {
+	if d == dialectPostgres {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+// timeArg converts a time into a query argument that compares correctly with
+// timestamp columns. SQLite stores CURRENT_TIMESTAMP defaults as
+// "YYYY-MM-DD HH:MM:SS" text in UTC, so times are formatted the same way.
+func (d dialect) timeArg(t time.Time) interface{} {
+	if d == dialectPostgres {
+		return t
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// epoch returns an expression for the Unix time, in whole seconds, of the
+// timestamp expression expr, or NULL if expr is NULL
+func (d dialect) epoch(expr string) string {
+	if d == dialectPostgres {
+		return "CAST(EXTRACT(EPOCH FROM " + expr + ") AS BIGINT)"
+	}
+	return "CAST(strftime('%s', " + expr + ") AS INTEGER)"
+}
+
+// day returns an expression for the UTC date of the timestamp expression
+// expr, as "YYYY-MM-DD" text
+func (d dialect) day(expr string) string {
+	if d == dialectPostgres {
+		return "to_char(" + expr + ", 'YYYY-MM-DD')"
+	}
+	return "date(" + expr + ")"
+}
+
+// migrationsDir returns the directory holding this dialect's migrations
+func (d dialect) migrationsDir() string {
+	if d == dialectPostgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
+
+// tableExistsQuery returns a query counting tables with the given name
+func (d dialect) tableExistsQuery() string {
+	if d == dialectPostgres {
+		return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+}
+
+// ExecContext executes a query after rewriting it for the active dialect,
+// using a cached prepared statement when possible
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query = db.dialect.rebind(query)
+	defer logSlowQuery(ctx, db.slowQuery, time.Now(), query, args)
+	if stmt := db.stmts.get(ctx, db.DB, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs a query after rewriting it for the active dialect,
+// using a cached prepared statement when possible
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query = db.dialect.rebind(query)
+	defer logSlowQuery(ctx, db.slowQuery, time.Now(), query, args)
+	if stmt := db.stmts.get(ctx, db.DB, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext runs a single-row query after rewriting it for the active
+// dialect, using a cached prepared statement when possible
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query = db.dialect.rebind(query)
+	defer logSlowQuery(ctx, db.slowQuery, time.Now(), query, args)
+	if stmt := db.stmts.get(ctx, db.DB, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+// Exec is ExecContext with a background context
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// Query is QueryContext with a background context
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow is QueryRowContext with a background context
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+// BeginTx starts a transaction whose queries are rewritten for the active dialect
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.dialect, slowQuery: db.slowQuery}, nil
+}
+
+// Begin is BeginTx with a background context
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+// WithTx runs fn inside a transaction. The transaction is committed when fn
+// returns nil and rolled back when it returns an error or panics, so callers
+// never have to remember to clean up.
+func (db *DB) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// insert runs an INSERT statement and returns the new row's id
+func (db *DB) insert(ctx context.Context, query string, args ...interface{}) (int, error) {
+	if db.dialect == dialectPostgres {
+		var id int
+		err := db.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// tableExists reports whether a table with the given name exists
+func (db *DB) tableExists(ctx context.Context, name string) (bool, error) {
+	var count int
+	if err := db.QueryRowContext(ctx, db.dialect.tableExistsQuery(), name).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Tx wraps sql.Tx so queries inside transactions are rewritten too
+type Tx struct {
+	*sql.Tx
+	dialect   dialect
+	slowQuery time.Duration
+}
+
+// ExecContext executes a query within the transaction
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query = tx.dialect.rebind(query)
+	defer logSlowQuery(ctx, tx.slowQuery, time.Now(), query, args)
+	return tx.Tx.ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs a query within the transaction
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query = tx.dialect.rebind(query)
+	defer logSlowQuery(ctx, tx.slowQuery, time.Now(), query, args)
+	return tx.Tx.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext runs a single-row query within the transaction
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query = tx.dialect.rebind(query)
+	defer logSlowQuery(ctx, tx.slowQuery, time.Now(), query, args)
+	return tx.Tx.QueryRowContext(ctx, query, args...)
+}
+
+// insert runs an INSERT statement within the transaction and returns the new row's id
+func (tx *Tx) insert(ctx context.Context, query string, args ...interface{}) (int, error) {
+	if tx.dialect == dialectPostgres {
+		var id int
+		err := tx.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Exec is ExecContext with a background context
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), query, args...)
+}
+
+// Query is QueryContext with a background context
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow is QueryRowContext with a background context
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.QueryRowContext(context.Background(), query, args...)
+}
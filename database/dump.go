@@ -0,0 +1,343 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dumpFormat identifies archives written by Dump
+const dumpFormat = "literary-lions-dump"
+
+// dumpTables lists every table holding forum data, parents before children
+// so rows can be restored without breaking foreign keys. New tables must be
+// added here to be included in dumps.
+var dumpTables = []string{
+	"books", // before users, who refer to the book they're currently reading
+	"users",
+	"username_history",
+	"categories",
+	"posts",
+	"comments",
+	"post_likes",
+	"comment_likes",
+	"sessions",
+	"user_books",
+	"review_drafts",
+	"feature_flags",
+	"conversations",
+	"conversation_participants",
+	"messages",
+	"blocks",
+	"quotes",
+	"quote_likes",
+	"user_preferences",
+	"wall_posts",
+	"user_titles",
+	"email_changes",
+	"thread_mutes",
+	"thread_follows",
+	"bookmarks",
+	"scheduled_posts",
+	"audit_log",
+	"book_links",
+	"held_content",
+	"moderation_reasons",
+}
+
+// keylessTables are the dumped tables without an id column, with the
+// columns their rows are dumped in order of
+var keylessTables = map[string]string{
+	"feature_flags":             "name",
+	"conversation_participants": "conversation_id, user_id",
+	"blocks":                    "blocker_id, blocked_id",
+	"user_preferences":          "user_id",
+	"thread_mutes":              "user_id, post_id",
+	"thread_follows":            "user_id, post_id",
+	"bookmarks":                 "user_id, post_id",
+	"book_links":                "url",
+}
+
+// validIdentifier matches the table and column names accepted from a dump
+var validIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Archive is a portable snapshot of all forum data. It does not depend on
+// the database it was taken from, so a SQLite dump can be restored into
+// PostgreSQL and the other way round.
+type Archive struct {
+	Format        string      `json:"format"`
+	SchemaVersion int         `json:"schema_version"`
+	Dialect       string      `json:"dialect"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Tables        []TableDump `json:"tables"`
+}
+
+// TableDump holds the rows of one table. Times are stored as RFC 3339
+// strings and the columns holding them are listed in TimeColumns.
+type TableDump struct {
+	Name        string          `json:"name"`
+	Columns     []string        `json:"columns"`
+	TimeColumns []string        `json:"time_columns,omitempty"`
+	Rows        [][]interface{} `json:"rows"`
+}
+
+// Dump writes every table as a JSON archive to w. The tables are read in a
+// single transaction so the archive is consistent.
+func (db *DB) Dump(ctx context.Context, w io.Writer) error {
+	version, err := db.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	var opts *sql.TxOptions
+	if db.dialect == dialectPostgres {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	archive := Archive{
+		Format:        dumpFormat,
+		SchemaVersion: version,
+		Dialect:       string(db.dialect),
+		CreatedAt:     time.Now().UTC(),
+	}
+	for _, table := range dumpTables {
+		dump, err := dumpTable(ctx, tx, table)
+		if err != nil {
+			return fmt.Errorf("failed to dump %s: %v", table, err)
+		}
+		archive.Tables = append(archive.Tables, dump)
+	}
+
+	return json.NewEncoder(w).Encode(archive)
+}
+
+// dumpTable reads all rows of table, oldest first
+func dumpTable(ctx context.Context, tx *Tx, table string) (TableDump, error) {
+	dump := TableDump{Name: table, Rows: [][]interface{}{}}
+
+	orderBy := "id"
+	if columns, ok := keylessTables[table]; ok {
+		orderBy = columns
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s ORDER BY %s", table, orderBy))
+	if err != nil {
+		return dump, err
+	}
+	defer rows.Close()
+
+	if dump.Columns, err = rows.Columns(); err != nil {
+		return dump, err
+	}
+
+	timeColumns := make(map[string]bool)
+	for rows.Next() {
+		values := make([]interface{}, len(dump.Columns))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return dump, err
+		}
+
+		for i, value := range values {
+			switch v := value.(type) {
+			case []byte:
+				values[i] = string(v)
+			case time.Time:
+				values[i] = v.UTC().Format(time.RFC3339Nano)
+				timeColumns[dump.Columns[i]] = true
+			}
+		}
+		dump.Rows = append(dump.Rows, values)
+	}
+
+	for _, column := range dump.Columns {
+		if timeColumns[column] {
+			dump.TimeColumns = append(dump.TimeColumns, column)
+		}
+	}
+
+	return dump, rows.Err()
+}
+
+// Restore replaces all forum data with the contents of an archive written by
+// Dump. The database must already be migrated to the archive's schema
+// version. Everything happens in one transaction, so a failed restore leaves
+// the existing data untouched.
+func (db *DB) Restore(ctx context.Context, r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var archive Archive
+	if err := decoder.Decode(&archive); err != nil {
+		return fmt.Errorf("failed to read archive: %v", err)
+	}
+	if archive.Format != dumpFormat {
+		return fmt.Errorf("not a forum archive")
+	}
+
+	version, err := db.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if archive.SchemaVersion != version {
+		return fmt.Errorf("archive has schema version %d but the database is at version %d", archive.SchemaVersion, version)
+	}
+
+	known := make(map[string]bool, len(dumpTables))
+	for _, table := range dumpTables {
+		known[table] = true
+	}
+	for _, dump := range archive.Tables {
+		if !known[dump.Name] {
+			return fmt.Errorf("archive contains unknown table %q", dump.Name)
+		}
+		for _, column := range dump.Columns {
+			if !validIdentifier.MatchString(column) {
+				return fmt.Errorf("archive contains invalid column %q in %s", column, dump.Name)
+			}
+		}
+	}
+
+	return db.WithTx(ctx, func(tx *Tx) error {
+		for i := len(dumpTables) - 1; i >= 0; i-- {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+dumpTables[i]); err != nil {
+				return fmt.Errorf("failed to clear %s: %v", dumpTables[i], err)
+			}
+		}
+
+		for _, dump := range archive.Tables {
+			if err := db.restoreTable(ctx, tx, dump); err != nil {
+				return fmt.Errorf("failed to restore %s: %v", dump.Name, err)
+			}
+		}
+
+		// Counter triggers fired while votes, comments, follows and
+		// bookmarks were inserted on top of the restored counts, so recount
+		// from scratch
+		_, err := tx.ExecContext(ctx, `
+			UPDATE posts SET
+				likes_count = (SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = posts.id AND pl.is_like = TRUE),
+				dislikes_count = (SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = posts.id AND pl.is_like = FALSE),
+				comments_count = (SELECT COUNT(*) FROM comments cm WHERE cm.post_id = posts.id AND cm.deleted_at IS NULL),
+				followers_count = (SELECT COUNT(*) FROM thread_follows tf WHERE tf.post_id = posts.id),
+				bookmarks_count = (SELECT COUNT(*) FROM bookmarks bm WHERE bm.post_id = posts.id)
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to recount post counters: %v", err)
+		}
+
+		// PostgreSQL sequences do not advance when ids are inserted explicitly
+		if db.dialect == dialectPostgres {
+			for _, table := range dumpTables {
+				if _, ok := keylessTables[table]; ok {
+					continue
+				}
+				query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s", table)
+				if _, err := tx.ExecContext(ctx, query); err != nil {
+					return fmt.Errorf("failed to reset %s id sequence: %v", table, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// restoreTable inserts the rows of one table
+func (db *DB) restoreTable(ctx context.Context, tx *Tx, dump TableDump) error {
+	if len(dump.Rows) == 0 {
+		return nil
+	}
+
+	timeColumns := make(map[int]bool)
+	for i, column := range dump.Columns {
+		for _, timeColumn := range dump.TimeColumns {
+			if column == timeColumn {
+				timeColumns[i] = true
+			}
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(dump.Columns)), ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", dump.Name, strings.Join(dump.Columns, ", "), placeholders)
+
+	for _, row := range dump.Rows {
+		if len(row) != len(dump.Columns) {
+			return fmt.Errorf("row has %d values for %d columns", len(row), len(dump.Columns))
+		}
+
+		args := make([]interface{}, len(row))
+		for i, value := range row {
+			arg, err := db.restoreValue(value, timeColumns[i])
+			if err != nil {
+				return fmt.Errorf("column %s: %v", dump.Columns[i], err)
+			}
+			args[i] = arg
+		}
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreValue converts a decoded JSON value back into a query argument
+func (db *DB) restoreValue(value interface{}, isTime bool) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case string:
+		if !isTime {
+			return v, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, err
+		}
+		// Whole-second times use the same text format as CURRENT_TIMESTAMP
+		// in SQLite; precise ones, like trash times, are bound as written
+		if t.Nanosecond() == 0 {
+			return db.dialect.timeArg(t), nil
+		}
+		return t, nil
+	default:
+		return v, nil
+	}
+}
+
+// schemaVersion returns the newest applied migration version
+func (db *DB) schemaVersion(ctx context.Context) (int, error) {
+	if err := db.ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
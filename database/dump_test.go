@@ -0,0 +1,95 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"literary-lions/models"
+	"testing"
+)
+
+// populateDumpTables adds a row to the tables whose restore is checked
+func populateDumpTables(t *testing.T, db *DB) {
+	t.Helper()
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	createTestPost(t, db, alice.ID, "Dumped")
+
+	entry := &models.AuditEntry{ActorID: &alice.ID, Action: "test.action", TargetUserID: &alice.ID, Details: "dumped"}
+	if err := db.AddAuditEntry(ctx, entry); err != nil {
+		t.Fatalf("AddAuditEntry: %v", err)
+	}
+
+	book := createTestBook(t, db, "Linked")
+	if err := db.SaveBookLink(ctx, "https://openlibrary.org/works/OL1W", book.ID); err != nil {
+		t.Fatalf("SaveBookLink: %v", err)
+	}
+
+	held := &models.HeldContent{Kind: "post", UserID: alice.ID, CategoryID: 1, BookID: &book.ID,
+		Title: "Held", Content: "A held post", Reason: "test"}
+	if err := db.HoldContent(ctx, held); err != nil {
+		t.Fatalf("HoldContent: %v", err)
+	}
+
+	if err := db.CreateModerationReason(ctx, &models.ModerationReason{Text: "Dumped"}); err != nil {
+		t.Fatalf("CreateModerationReason: %v", err)
+	}
+}
+
+// dumpTablesJSON dumps db and returns the archive's tables as JSON, by name
+func dumpTablesJSON(t *testing.T, db *DB) (map[string]string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := db.Dump(context.Background(), &buf); err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+	var archive Archive
+	if err := json.Unmarshal(buf.Bytes(), &archive); err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	tables := make(map[string]string)
+	for _, table := range archive.Tables {
+		encoded, err := json.Marshal(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables[table.Name] = string(encoded)
+	}
+	return tables, buf.Bytes()
+}
+
+func TestDumpRestoreRoundTrip(t *testing.T) {
+	source := newTestDB(t)
+	populateDumpTables(t, source)
+	before, archive := dumpTablesJSON(t, source)
+
+	restored := newTestDB(t)
+	if err := restored.Restore(context.Background(), bytes.NewReader(archive)); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	after, _ := dumpTablesJSON(t, restored)
+
+	for _, table := range dumpTables {
+		if before[table] != after[table] {
+			t.Errorf("%s differs after restore:\nbefore %s\nafter  %s", table, before[table], after[table])
+		}
+	}
+
+	reasons, err := restored.GetModerationReasons(context.Background())
+	if err != nil {
+		t.Fatalf("GetModerationReasons: %v", err)
+	}
+	if len(reasons) == 0 || reasons[len(reasons)-1].Text != "Dumped" {
+		t.Errorf("restored moderation reasons %v, want the added one last", reasons)
+	}
+
+	for _, table := range []string{"audit_log", "book_links", "held_content"} {
+		var rows int
+		if err := restored.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM "+table).Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		if rows != 1 {
+			t.Errorf("restored %d rows of %s, want 1", rows, table)
+		}
+	}
+}
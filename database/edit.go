@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Edits use optimistic concurrency: the edit form carries the updated_at the
+// editor loaded, and a save is rejected with ErrEditConflict if the row has
+// changed since, instead of silently overwriting someone else's edit.
+
+// ErrEditConflict is returned when a post or comment was changed after the
+// editor loaded it
+var ErrEditConflict = errors.New("edited by someone else in the meantime")
+
+// UpdatePost saves a new title and content for a post, edited at now,
+// provided it still has the updated_at the editor loaded
+func (db *DB) UpdatePost(ctx context.Context, postID int, title, content string, loadedUpdatedAt, now time.Time) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		var updatedAt time.Time
+		var archived bool
+		query := "SELECT updated_at, archived_at IS NOT NULL FROM posts WHERE id = ? AND deleted_at IS NULL" + db.dialect.forUpdate()
+		if err := tx.QueryRowContext(ctx, query, postID).Scan(&updatedAt, &archived); err != nil {
+			return err
+		}
+		if archived {
+			return ErrArchived
+		}
+		if !updatedAt.Equal(loadedUpdatedAt) {
+			return ErrEditConflict
+		}
+
+		_, err := tx.ExecContext(ctx, "UPDATE posts SET title = ?, content = ?, updated_at = ? WHERE id = ?",
+			title, content, db.dialect.timeArg(now), postID)
+		return err
+	})
+}
+
+// UpdateComment saves new content for a comment, edited at now, provided it
+// has not changed since loadedUpdatedAt (its last edit, or its creation if
+// never edited)
+func (db *DB) UpdateComment(ctx context.Context, commentID int, content string, loadedUpdatedAt, now time.Time) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		var createdAt time.Time
+		var editedAt *time.Time
+		var archived bool
+		query := `
+			SELECT c.created_at, c.updated_at, p.archived_at IS NOT NULL
+			FROM comments c
+			JOIN posts p ON c.post_id = p.id
+			WHERE c.id = ? AND c.deleted_at IS NULL` + db.dialect.forUpdate()
+		if err := tx.QueryRowContext(ctx, query, commentID).Scan(&createdAt, &editedAt, &archived); err != nil {
+			return err
+		}
+		if archived {
+			return ErrArchived
+		}
+
+		current := createdAt
+		if editedAt != nil {
+			current = *editedAt
+		}
+		if !current.Equal(loadedUpdatedAt) {
+			return ErrEditConflict
+		}
+
+		_, err := tx.ExecContext(ctx, "UPDATE comments SET content = ?, updated_at = ? WHERE id = ?",
+			content, db.dialect.timeArg(now), commentID)
+		return err
+	})
+}
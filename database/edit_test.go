@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUpdatePostRecordsTime(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	post, err := db.GetPostByID(ctx, createTestPost(t, db, alice.ID, "Dune").ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment, err := db.GetCommentByID(ctx, createTestComment(t, db, alice.ID, post.ID, "Spice").ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+	if err := db.UpdatePost(ctx, post.ID, "Dune", "Edited", post.UpdatedAt, now); err != nil {
+		t.Fatalf("UpdatePost: %v", err)
+	}
+	if err := db.UpdateComment(ctx, comment.ID, "Edited", comment.CreatedAt, now); err != nil {
+		t.Fatalf("UpdateComment: %v", err)
+	}
+
+	// Edit times compare with CURRENT_TIMESTAMP defaults, as timeArg does
+	for _, table := range []string{"posts", "comments"} {
+		var matched int
+		query := "SELECT COUNT(*) FROM " + table + " WHERE updated_at = ?"
+		if err := db.QueryRowContext(ctx, query, "2026-03-04 04:06:07").Scan(&matched); err != nil {
+			t.Fatal(err)
+		}
+		if matched != 1 {
+			t.Errorf("%s edited at %v not stored as 2026-03-04 04:06:07 UTC", table, now)
+		}
+	}
+
+	edited, err := db.GetPostByID(ctx, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdatePost(ctx, post.ID, "Dune", "Stale", post.UpdatedAt, now.Add(time.Minute)); err != ErrEditConflict {
+		t.Errorf("saving over a newer edit: err = %v, want ErrEditConflict", err)
+	}
+	if err := db.UpdatePost(ctx, post.ID, "Dune", "Edited again", edited.UpdatedAt, now.Add(time.Minute)); err != nil {
+		t.Errorf("editing the latest version: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"literary-lions/models"
+	"time"
+)
+
+// ErrEmailTaken is returned when another member already has the requested
+// email address
+var ErrEmailTaken = errors.New("email is taken")
+
+// hashToken hashes an email change token for storing, so the tokens in the
+// database can't be used to confirm changes
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestEmailChange stores a change of a user's email address, confirmed
+// by following a link with token. It replaces any change they requested
+// before. Returns ErrEmailTaken if another member has the address.
+func (db *DB) RequestEmailChange(ctx context.Context, change *models.EmailChange, token string) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		var taken int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ? AND id != ?", change.NewEmail, change.UserID).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrEmailTaken
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM email_changes WHERE user_id = ?", change.UserID); err != nil {
+			return err
+		}
+		query := "INSERT INTO email_changes (user_id, new_email, token_hash, expires_at) VALUES (?, ?, ?, ?)"
+		id, err := tx.insert(ctx, query, change.UserID, change.NewEmail, hashToken(token), db.dialect.timeArg(change.ExpiresAt))
+		if err != nil {
+			return err
+		}
+		change.ID = id
+		return nil
+	})
+}
+
+// GetPendingEmailChange gets the email change a user requested and hasn't
+// confirmed yet, or sql.ErrNoRows if there is none or it expired
+func (db *DB) GetPendingEmailChange(ctx context.Context, userID int) (*models.EmailChange, error) {
+	query := `
+		SELECT id, user_id, new_email, expires_at, created_at
+		FROM email_changes
+		WHERE user_id = ? AND expires_at > ?
+	`
+	change := &models.EmailChange{}
+	err := db.QueryRowContext(ctx, query, userID, db.dialect.timeArg(time.Now())).Scan(
+		&change.ID, &change.UserID, &change.NewEmail, &change.ExpiresAt, &change.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// ConfirmEmailChange changes a user's email address to the one in the
+// change token confirms, and returns the change. Returns sql.ErrNoRows if
+// token doesn't match an unexpired change, and ErrEmailTaken if another
+// member took the address in the meantime; either way the change is
+// dropped.
+func (db *DB) ConfirmEmailChange(ctx context.Context, token string) (*models.EmailChange, error) {
+	change := &models.EmailChange{}
+	var taken int
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		query := `
+			SELECT id, user_id, new_email, expires_at, created_at
+			FROM email_changes
+			WHERE token_hash = ? AND expires_at > ?
+		`
+		err := tx.QueryRowContext(ctx, query, hashToken(token), db.dialect.timeArg(time.Now())).Scan(
+			&change.ID, &change.UserID, &change.NewEmail, &change.ExpiresAt, &change.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM email_changes WHERE id = ?", change.ID); err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ? AND id != ?", change.NewEmail, change.UserID).Scan(&taken)
+		if err != nil || taken > 0 {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET email = ? WHERE id = ?", change.NewEmail, change.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, ErrEmailTaken
+	}
+	return change, nil
+}
+
+// CancelEmailChange drops the email change a user requested, if any
+func (db *DB) CancelEmailChange(ctx context.Context, userID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM email_changes WHERE user_id = ?", userID)
+	return err
+}
@@ -0,0 +1,34 @@
+package database
+
+import "context"
+
+// GetFeatureFlags returns the flags admins have set, by name. Flags that were
+// never set are missing and use their default.
+func (db *DB) GetFeatureFlags(ctx context.Context) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, enabled FROM feature_flags")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		var enabled bool
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, err
+		}
+		flags[name] = enabled
+	}
+	return flags, rows.Err()
+}
+
+// SetFeatureFlag turns a flag on or off
+func (db *DB) SetFeatureFlag(ctx context.Context, name string, enabled bool) error {
+	query := `
+		INSERT INTO feature_flags (name, enabled, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (name) DO UPDATE SET enabled = excluded.enabled, updated_at = excluded.updated_at
+	`
+	_, err := db.ExecContext(ctx, query, name, enabled)
+	return err
+}
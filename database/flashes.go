@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"literary-lions/models"
+)
+
+// AddFlash queues a message to show on the session's next page
+func (db *DB) AddFlash(ctx context.Context, uuid string, flash models.Flash) error {
+	var stored string
+	if err := db.QueryRowContext(ctx, "SELECT flash FROM sessions WHERE uuid = ?", uuid).Scan(&stored); err != nil {
+		return err
+	}
+
+	var flashes []models.Flash
+	if stored != "" {
+		if err := json.Unmarshal([]byte(stored), &flashes); err != nil {
+			return err
+		}
+	}
+	encoded, err := json.Marshal(append(flashes, flash))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE sessions SET flash = ? WHERE uuid = ?", string(encoded), uuid)
+	return err
+}
+
+// TakeFlashes returns the messages queued for the session and clears them,
+// so each is shown once. Unknown sessions have none.
+func (db *DB) TakeFlashes(ctx context.Context, uuid string) ([]models.Flash, error) {
+	var stored string
+	err := db.QueryRowContext(ctx, "SELECT flash FROM sessions WHERE uuid = ?", uuid).Scan(&stored)
+	if err == sql.ErrNoRows || stored == "" {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Only clear the messages read, in case more were queued meanwhile;
+	// those are shown on the page after
+	result, err := db.ExecContext(ctx, "UPDATE sessions SET flash = '' WHERE uuid = ? AND flash = ?", uuid, stored)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		// Another request took them first
+		return nil, nil
+	}
+
+	var flashes []models.Flash
+	if err := json.Unmarshal([]byte(stored), &flashes); err != nil {
+		return nil, err
+	}
+	return flashes, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"literary-lions/models"
+)
+
+// FollowThread has a member get reply emails about a post's thread without
+// having written in it. Triggers keep the post's followers_count in step.
+func (db *DB) FollowThread(ctx context.Context, userID, postID int) error {
+	query := `
+		INSERT INTO thread_follows (user_id, post_id) VALUES (?, ?)
+		ON CONFLICT (user_id, post_id) DO NOTHING
+	`
+	_, err := db.ExecContext(ctx, query, userID, postID)
+	return err
+}
+
+// UnfollowThread stops a member following a post's thread
+func (db *DB) UnfollowThread(ctx context.Context, userID, postID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM thread_follows WHERE user_id = ? AND post_id = ?", userID, postID)
+	return err
+}
+
+// IsFollowingThread reports whether a member follows a post's thread
+func (db *DB) IsFollowingThread(ctx context.Context, userID, postID int) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM thread_follows WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&count)
+	return count > 0, err
+}
+
+// BookmarkPost saves a post for a member to come back to. Triggers keep the
+// post's bookmarks_count in step.
+func (db *DB) BookmarkPost(ctx context.Context, userID, postID int) error {
+	query := `
+		INSERT INTO bookmarks (user_id, post_id) VALUES (?, ?)
+		ON CONFLICT (user_id, post_id) DO NOTHING
+	`
+	_, err := db.ExecContext(ctx, query, userID, postID)
+	return err
+}
+
+// UnbookmarkPost removes a post from a member's bookmarks
+func (db *DB) UnbookmarkPost(ctx context.Context, userID, postID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM bookmarks WHERE user_id = ? AND post_id = ?", userID, postID)
+	return err
+}
+
+// IsBookmarked reports whether a member bookmarked a post
+func (db *DB) IsBookmarked(ctx context.Context, userID, postID int) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM bookmarks WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&count)
+	return count > 0, err
+}
+
+// GetBookmarkedPostsByUserWithSorting gets the posts a member bookmarked
+// with specified sorting
+func (db *DB) GetBookmarkedPostsByUserWithSorting(ctx context.Context, userID int, sortBy, sortOrder string) ([]models.Post, error) {
+	orderClause := db.buildOrderClause(sortBy, sortOrder)
+
+	query := `
+		SELECT 
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous, 
+			p.created_at, p.updated_at,
+			p.likes_count, p.dislikes_count, p.comments_count
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		JOIN categories c ON p.category_id = c.id
+		WHERE p.deleted_at IS NULL AND EXISTS (
+			SELECT 1 FROM bookmarks bm
+			WHERE bm.post_id = p.id AND bm.user_id = ?
+		)
+		` + orderClause
+
+	return db.executePostsWithArgs(ctx, query, userID)
+}
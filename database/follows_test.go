@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"literary-lions/models"
+	"testing"
+	"time"
+)
+
+func TestFollowAndBookmarkCounts(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	carol := createTestUser(t, db, "carol")
+	post := createTestPost(t, db, alice.ID, "Dune")
+
+	for _, user := range []*models.User{bob, carol, bob} {
+		if err := db.FollowThread(ctx, user.ID, post.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.BookmarkPost(ctx, carol.ID, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertCounts(t, db, post.ID, 2, 1)
+
+	if err := db.UnfollowThread(ctx, bob.ID, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UnfollowThread(ctx, bob.ID, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertCounts(t, db, post.ID, 1, 1)
+
+	// Followers and bookmarks of a merged thread move to the target, once
+	target := createTestPost(t, db, alice.ID, "Dune, again")
+	if err := db.FollowThread(ctx, carol.ID, target.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FollowThread(ctx, bob.ID, target.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MergePost(ctx, post.ID, target.ID, alice.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	assertCounts(t, db, target.ID, 2, 1)
+}
+
+func TestFollowersGetReplyEmails(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	post := createTestPost(t, db, alice.ID, "Dune")
+
+	prefs := models.DefaultPreferences(bob.ID)
+	prefs.EmailReplies = true
+	if err := db.SavePreferences(ctx, prefs); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FollowThread(ctx, bob.ID, post.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	recipients, err := db.GetReplyRecipients(ctx, post.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 1 || recipients[0].ID != bob.ID {
+		t.Errorf("reply recipients = %+v, want bob, who follows the thread", recipients)
+	}
+}
+
+// assertCounts checks the followers and bookmarks a post is loaded with
+func assertCounts(t *testing.T, db *DB, postID, followers, bookmarks int) {
+	t.Helper()
+	post, err := db.GetPostByID(context.Background(), postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Followers != followers || post.Bookmarks != bookmarks {
+		t.Errorf("post %d has %d followers and %d bookmarks, want %d and %d",
+			postID, post.Followers, post.Bookmarks, followers, bookmarks)
+	}
+}
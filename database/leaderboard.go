@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"literary-lions/models"
+	"time"
+)
+
+// Leaderboard time windows
+const (
+	LeaderboardWeek    = "week"
+	LeaderboardMonth   = "month"
+	LeaderboardAllTime = "all"
+)
+
+// LeaderboardSize is how many users each leaderboard ranks
+const LeaderboardSize = 10
+
+// leaderboardSince returns the start of a leaderboard window
+func leaderboardSince(window string, now time.Time) (time.Time, error) {
+	switch window {
+	case LeaderboardWeek:
+		return now.AddDate(0, 0, -7), nil
+	case LeaderboardMonth:
+		return now.AddDate(0, -1, 0), nil
+	case LeaderboardAllTime:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown leaderboard window %q", window)
+	}
+}
+
+// votesReceived selects every vote on a live post or comment as
+// (author_id, is_like, created_at)
+const votesReceived = `
+	SELECT p.user_id AS author_id, pl.is_like, pl.created_at
+	FROM post_likes pl
+	JOIN posts p ON p.id = pl.post_id
+	WHERE p.deleted_at IS NULL
+	UNION ALL
+	SELECT c.user_id AS author_id, cl.is_like, cl.created_at
+	FROM comment_likes cl
+	JOIN comments c ON c.id = cl.comment_id
+	WHERE c.deleted_at IS NULL`
+
+// GetLeaderboard ranks active users by posts written, likes received and
+// reputation over a window. Reputation is one point per like received, minus
+// one per dislike, plus two per post and one per comment written.
+func (db *DB) GetLeaderboard(ctx context.Context, window string) (*models.Leaderboard, error) {
+	since, err := leaderboardSince(window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	sinceArg := db.dialect.timeArg(since)
+
+	board := &models.Leaderboard{Window: window}
+
+	board.Posts, err = db.leaderboardEntries(ctx, `
+		SELECT u.id, u.username, COUNT(*) AS score
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.deleted_at IS NULL AND p.created_at >= ? AND u.status = 'active'
+		GROUP BY u.id, u.username
+		ORDER BY score DESC, u.username
+		LIMIT ?
+	`, sinceArg, LeaderboardSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank posts: %v", err)
+	}
+
+	board.Likes, err = db.leaderboardEntries(ctx, `
+		SELECT u.id, u.username, COUNT(*) AS score
+		FROM (`+votesReceived+`) v
+		JOIN users u ON u.id = v.author_id
+		WHERE v.is_like = TRUE AND v.created_at >= ? AND u.status = 'active'
+		GROUP BY u.id, u.username
+		ORDER BY score DESC, u.username
+		LIMIT ?
+	`, sinceArg, LeaderboardSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank likes: %v", err)
+	}
+
+	board.Reputation, err = db.leaderboardEntries(ctx, `
+		SELECT u.id, u.username, SUM(points) AS score
+		FROM (
+			SELECT author_id, CASE WHEN is_like = TRUE THEN 1 ELSE -1 END AS points, created_at
+			FROM (`+votesReceived+`) v
+			UNION ALL
+			SELECT user_id, 2, created_at FROM posts WHERE deleted_at IS NULL
+			UNION ALL
+			SELECT user_id, 1, created_at FROM comments WHERE deleted_at IS NULL
+		) r
+		JOIN users u ON u.id = r.author_id
+		WHERE r.created_at >= ? AND u.status = 'active'
+		GROUP BY u.id, u.username
+		HAVING SUM(points) > 0
+		ORDER BY score DESC, u.username
+		LIMIT ?
+	`, sinceArg, LeaderboardSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank reputation: %v", err)
+	}
+
+	return board, nil
+}
+
+func (db *DB) leaderboardEntries(ctx context.Context, query string, args ...interface{}) ([]models.LeaderboardEntry, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.LeaderboardEntry
+	for rows.Next() {
+		var e models.LeaderboardEntry
+		if err := rows.Scan(&e.UserID, &e.Username, &e.Score); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
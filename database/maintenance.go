@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// maintenanceTask is one step of the periodic maintenance run
+type maintenanceTask struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// Maintain purges stale rows, archives inactive threads, refreshes query planner statistics, reclaims
+// free pages and optimizes full-text indexes. Each step is timed and logged;
+// a failing step is logged and the remaining steps still run.
+func (db *DB) Maintain(ctx context.Context) {
+	tasks := []maintenanceTask{
+		{"purge stale rows", db.purgeStaleRows},
+		{"archive inactive threads", db.archiveInactiveThreads},
+		{"analyze", db.analyze},
+		{"incremental vacuum", db.incrementalVacuum},
+		{"fts optimize", db.optimizeFullText},
+	}
+
+	start := time.Now()
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			return
+		}
+
+		taskStart := time.Now()
+		detail, err := task.run(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "maintenance task failed", "task", task.name, "elapsed", time.Since(taskStart).Round(time.Millisecond), "err", err)
+			continue
+		}
+		slog.InfoContext(ctx, "maintenance task finished", "task", task.name, "elapsed", time.Since(taskStart).Round(time.Millisecond), "result", detail)
+	}
+	slog.InfoContext(ctx, "maintenance finished", "elapsed", time.Since(start).Round(time.Millisecond))
+}
+
+// RunMaintenance calls Maintain every interval until ctx is done
+func (db *DB) RunMaintenance(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.Maintain(ctx)
+		}
+	}
+}
+
+// purgeStaleRows deletes expired sessions and books no reading list, draft,
+// post, scheduled post, post held for moderation, quote, currently reading
+// status or book link refers to any more
+func (db *DB) purgeStaleRows(ctx context.Context) (string, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < ?", time.Now())
+	if err != nil {
+		return "", fmt.Errorf("failed to delete expired sessions: %v", err)
+	}
+	sessions, _ := result.RowsAffected()
+
+	result, err = db.ExecContext(ctx, `
+		DELETE FROM books
+		WHERE NOT EXISTS (SELECT 1 FROM user_books ub WHERE ub.book_id = books.id)
+		AND NOT EXISTS (SELECT 1 FROM review_drafts rd WHERE rd.book_id = books.id)
+		AND NOT EXISTS (SELECT 1 FROM users u WHERE u.currently_reading_book_id = books.id)
+		AND NOT EXISTS (SELECT 1 FROM quotes q WHERE q.book_id = books.id)
+		AND NOT EXISTS (SELECT 1 FROM posts p WHERE p.book_id = books.id)
+		AND NOT EXISTS (SELECT 1 FROM scheduled_posts sp WHERE sp.book_id = books.id)
+		AND NOT EXISTS (SELECT 1 FROM book_links bl WHERE bl.book_id = books.id)
+		AND NOT EXISTS (SELECT 1 FROM held_content h WHERE h.book_id = books.id)
+	`)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete orphaned books: %v", err)
+	}
+	books, _ := result.RowsAffected()
+
+	return fmt.Sprintf("%d expired sessions, %d orphaned books", sessions, books), nil
+}
+
+// archiveInactiveThreads applies the archive policy set with SetArchiveAfter
+func (db *DB) archiveInactiveThreads(ctx context.Context) (string, error) {
+	if db.archiveAfterMonths <= 0 {
+		return "disabled", nil
+	}
+
+	archived, err := db.ArchiveInactivePosts(ctx, time.Now().AddDate(0, -db.archiveAfterMonths, 0))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d threads archived", archived), nil
+}
+
+// analyze refreshes the statistics the query planner uses to pick indexes
+func (db *DB) analyze(ctx context.Context) (string, error) {
+	if _, err := db.DB.ExecContext(ctx, "ANALYZE"); err != nil {
+		return "", err
+	}
+	return "statistics updated", nil
+}
+
+// incrementalVacuum returns free pages to the operating system. SQLite only
+// supports this when auto_vacuum is INCREMENTAL, which has to be chosen before
+// the database is created (see SQLitePragmas.AutoVacuum); PostgreSQL runs a
+// plain, non-blocking VACUUM.
+func (db *DB) incrementalVacuum(ctx context.Context) (string, error) {
+	if db.dialect == dialectPostgres {
+		if _, err := db.DB.ExecContext(ctx, "VACUUM"); err != nil {
+			return "", err
+		}
+		return "dead tuples reclaimed", nil
+	}
+
+	var mode int
+	if err := db.DB.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return "", err
+	}
+	// 2 is INCREMENTAL
+	if mode != 2 {
+		return "skipped, auto_vacuum is not incremental", nil
+	}
+
+	var before, after int
+	if err := db.DB.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&before); err != nil {
+		return "", err
+	}
+	if _, err := db.DB.ExecContext(ctx, "PRAGMA incremental_vacuum"); err != nil {
+		return "", err
+	}
+	if err := db.DB.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&after); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d pages freed", before-after), nil
+}
+
+// optimizeFullText merges the segments of every SQLite FTS index so searches
+// touch fewer b-trees. PostgreSQL maintains its text search indexes itself.
+func (db *DB) optimizeFullText(ctx context.Context) (string, error) {
+	if db.dialect == dialectPostgres {
+		return "skipped on PostgreSQL", nil
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT name FROM sqlite_master
+		WHERE type = 'table' AND sql LIKE 'CREATE VIRTUAL TABLE%USING fts%'
+	`)
+	if err != nil {
+		return "", err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return "", err
+		}
+		tables = append(tables, name)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return "", err
+	}
+
+	for _, table := range tables {
+		query := fmt.Sprintf(`INSERT INTO "%s"("%s") VALUES('optimize')`, table, table)
+		if _, err := db.DB.ExecContext(ctx, query); err != nil {
+			return "", fmt.Errorf("failed to optimize %s: %v", table, err)
+		}
+	}
+
+	return fmt.Sprintf("%d indexes optimized", len(tables)), nil
+}
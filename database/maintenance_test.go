@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"literary-lions/models"
+	"testing"
+)
+
+// createTestBook adds a book with the given title
+func createTestBook(t *testing.T, db *DB, title string) *models.Book {
+	t.Helper()
+	book := &models.Book{Title: title, Author: "Author of " + title}
+	if err := db.FindOrCreateBook(context.Background(), book); err != nil {
+		t.Fatalf("create book %q: %v", title, err)
+	}
+	return book
+}
+
+func TestPurgeStaleRowsKeepsLinkedBooks(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	linked := createTestBook(t, db, "Linked")
+	orphaned := createTestBook(t, db, "Orphaned")
+	if err := db.SaveBookLink(ctx, "https://openlibrary.org/works/OL1W", linked.ID); err != nil {
+		t.Fatalf("SaveBookLink: %v", err)
+	}
+
+	if _, err := db.purgeStaleRows(ctx); err != nil {
+		t.Fatalf("purgeStaleRows: %v", err)
+	}
+
+	if _, err := db.GetBookByID(ctx, linked.ID); err != nil {
+		t.Errorf("book with a link was purged: %v", err)
+	}
+	if _, err := db.GetBookByID(ctx, orphaned.ID); err != sql.ErrNoRows {
+		t.Errorf("GetBookByID of orphaned book = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPurgeStaleRowsKeepsBooksOfHeldContent(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	book := createTestBook(t, db, "Reviewed")
+	held := &models.HeldContent{Kind: "post", UserID: alice.ID, CategoryID: 1, BookID: &book.ID,
+		Title: "Review", Content: "A held review", Reason: "test"}
+	if err := db.HoldContent(ctx, held); err != nil {
+		t.Fatalf("HoldContent: %v", err)
+	}
+
+	if _, err := db.purgeStaleRows(ctx); err != nil {
+		t.Fatalf("purgeStaleRows: %v", err)
+	}
+
+	if _, err := db.GetBookByID(ctx, book.ID); err != nil {
+		t.Errorf("book of a held review was purged: %v", err)
+	}
+}
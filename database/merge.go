@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A duplicate thread can be merged into the thread it duplicates. The
+// duplicate's post becomes a comment in the other thread, with its comments
+// as replies, and its votes are added to the other post's, except from
+// members who voted on both. The duplicate is then trashed, out of the trash
+// listing, and remembers where it went so its URL can redirect there.
+
+// ErrMergeSelf is returned when merging a thread into itself
+var ErrMergeSelf = errors.New("a thread can't be merged into itself")
+
+// MergePost merges the post sourceID into targetID, as mergedBy at now, and
+// returns the ID of the comment the source post became. Both posts must be
+// live; sql.ErrNoRows is returned otherwise.
+func (db *DB) MergePost(ctx context.Context, sourceID, targetID, mergedBy int, now time.Time) (int, error) {
+	if sourceID == targetID {
+		return 0, ErrMergeSelf
+	}
+
+	var commentID int
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		var userID int
+		var title, content string
+		var createdAt time.Time
+		err := tx.QueryRowContext(ctx, `
+			SELECT user_id, title, content, created_at FROM posts
+			WHERE id = ? AND deleted_at IS NULL`+tx.dialect.forUpdate(), sourceID,
+		).Scan(&userID, &title, &content, &createdAt)
+		if err != nil {
+			return err
+		}
+		var id int
+		err = tx.QueryRowContext(ctx, "SELECT id FROM posts WHERE id = ? AND deleted_at IS NULL"+tx.dialect.forUpdate(), targetID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		// The source post opens its part of the thread
+		commentID, err = tx.insert(ctx, `
+			INSERT INTO comments (content, user_id, post_id, created_at, merged_from) VALUES (?, ?, ?, ?, ?)
+		`, "**"+title+"**\n\n"+content, userID, targetID, tx.dialect.timeArg(createdAt), sourceID)
+		if err != nil {
+			return fmt.Errorf("failed to move the post: %v", err)
+		}
+
+		// Trashed comments move too, so they can still be restored
+		_, err = tx.ExecContext(ctx, `
+			UPDATE comments SET post_id = ?, merged_from = ?, parent_id = COALESCE(parent_id, ?)
+			WHERE post_id = ?
+		`, targetID, sourceID, commentID, sourceID)
+		if err != nil {
+			return fmt.Errorf("failed to move comments: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE post_likes SET post_id = ?
+			WHERE post_id = ? AND user_id NOT IN (SELECT user_id FROM post_likes WHERE post_id = ?)
+		`, targetID, sourceID, targetID)
+		if err != nil {
+			return fmt.Errorf("failed to move votes: %v", err)
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM post_likes WHERE post_id = ?", sourceID); err != nil {
+			return fmt.Errorf("failed to delete duplicate votes: %v", err)
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM thread_mutes WHERE post_id = ?", sourceID); err != nil {
+			return fmt.Errorf("failed to delete thread mutes: %v", err)
+		}
+
+		// Followers and bookmarks carry over to the target
+		for _, table := range []string{"thread_follows", "bookmarks"} {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO `+table+` (user_id, post_id)
+				SELECT user_id, ? FROM `+table+` WHERE post_id = ?
+				ON CONFLICT (user_id, post_id) DO NOTHING
+			`, targetID, sourceID)
+			if err != nil {
+				return fmt.Errorf("failed to move %s: %v", table, err)
+			}
+			if _, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE post_id = ?", sourceID); err != nil {
+				return fmt.Errorf("failed to delete %s: %v", table, err)
+			}
+		}
+
+		// Threads merged into the source before now lead to the target
+		if _, err = tx.ExecContext(ctx, "UPDATE posts SET merged_into = ? WHERE merged_into = ?", targetID, sourceID); err != nil {
+			return fmt.Errorf("failed to update earlier merges: %v", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE posts SET merged_into = ?, deleted_at = ?, deleted_by = ? WHERE id = ?
+		`, targetID, db.dialect.timeArg(now), mergedBy, sourceID)
+		if err != nil {
+			return fmt.Errorf("failed to trash the merged post: %v", err)
+		}
+		return nil
+	})
+	return commentID, err
+}
+
+// GetMergedInto returns the ID of the thread the post with the given ID was
+// merged into, or sql.ErrNoRows if it wasn't
+func (db *DB) GetMergedInto(ctx context.Context, postID int) (int, error) {
+	var target sql.NullInt64
+	err := db.QueryRowContext(ctx, "SELECT merged_into FROM posts WHERE id = ?", postID).Scan(&target)
+	if err != nil {
+		return 0, err
+	}
+	if !target.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return int(target.Int64), nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestMergePostRecordsTime(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	source := createTestPost(t, db, alice.ID, "Duplicate")
+	target := createTestPost(t, db, alice.ID, "Original")
+
+	now := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	if _, err := db.MergePost(ctx, source.ID, target.ID, alice.ID, now); err != nil {
+		t.Fatalf("MergePost: %v", err)
+	}
+
+	var deletedAt time.Time
+	if err := db.QueryRowContext(ctx, "SELECT deleted_at FROM posts WHERE id = ?", source.ID).Scan(&deletedAt); err != nil {
+		t.Fatal(err)
+	}
+	if !deletedAt.Equal(now) {
+		t.Errorf("merged post trashed at %v, want %v", deletedAt, now)
+	}
+	// Stored as CURRENT_TIMESTAMP defaults are, so the trash purge compares
+	// it correctly
+	var matched int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE deleted_at = ?", "2026-03-04 05:06:07").Scan(&matched); err != nil {
+		t.Fatal(err)
+	}
+	if matched != 1 {
+		t.Errorf("merged post's deleted_at not stored as 2026-03-04 05:06:07")
+	}
+	if into, err := db.GetMergedInto(ctx, source.ID); err != nil || into != target.ID {
+		t.Errorf("GetMergedInto = %d, %v; want %d", into, err, target.ID)
+	}
+}
+
+func TestDeleteUserWithMergedThreads(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+
+	// Bob's duplicate is merged into Alice's thread, and Alice's own
+	// duplicate, with Bob's reply on it, into Bob's
+	bobDuplicate := createTestPost(t, db, bob.ID, "Bob's duplicate")
+	aliceThread := createTestPost(t, db, alice.ID, "Alice's thread")
+	aliceDuplicate := createTestPost(t, db, alice.ID, "Alice's duplicate")
+	bobThread := createTestPost(t, db, bob.ID, "Bob's thread")
+	bobComment := createTestComment(t, db, bob.ID, aliceDuplicate.ID, "Moved along")
+	now := time.Now()
+	if _, err := db.MergePost(ctx, bobDuplicate.ID, aliceThread.ID, bob.ID, now); err != nil {
+		t.Fatalf("MergePost: %v", err)
+	}
+	if _, err := db.MergePost(ctx, aliceDuplicate.ID, bobThread.ID, bob.ID, now); err != nil {
+		t.Fatalf("MergePost: %v", err)
+	}
+
+	if err := db.DeleteUser(ctx, alice.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	if _, err := db.GetMergedInto(ctx, bobDuplicate.ID); err != sql.ErrNoRows {
+		t.Errorf("GetMergedInto of a thread merged into a deleted one = %v, want sql.ErrNoRows", err)
+	}
+	// Alice's merged post became a comment, which goes with her replies
+	var comments int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE post_id = ? OR id = ?", bobThread.ID, bobComment.ID).Scan(&comments); err != nil {
+		t.Fatal(err)
+	}
+	if comments != 0 {
+		t.Errorf("%d comments left from Alice's merged thread, want 0", comments)
+	}
+	if _, err := db.GetPostByID(ctx, bobThread.ID); err != nil {
+		t.Errorf("GetPostByID of Bob's thread: %v", err)
+	}
+}
+
+func TestPurgePostMergedInto(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	source := createTestPost(t, db, alice.ID, "Duplicate")
+	target := createTestPost(t, db, alice.ID, "Original")
+	if _, err := db.MergePost(ctx, source.ID, target.ID, alice.ID, time.Now()); err != nil {
+		t.Fatalf("MergePost: %v", err)
+	}
+	if err := db.TrashPost(ctx, target.ID, alice.ID, ""); err != nil {
+		t.Fatalf("TrashPost: %v", err)
+	}
+
+	if err := db.PurgePost(ctx, target.ID); err != nil {
+		t.Fatalf("PurgePost: %v", err)
+	}
+	if _, err := db.GetPostByID(ctx, target.ID); err != sql.ErrNoRows {
+		t.Errorf("GetPostByID of purged post = %v, want sql.ErrNoRows", err)
+	}
+	if err := db.RestorePost(ctx, source.ID); err != nil {
+		t.Errorf("RestorePost of a thread merged into a purged one: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"literary-lions/models"
+)
+
+// GetConversations returns the user's conversations, most recently active
+// first
+func (db *DB) GetConversations(ctx context.Context, userID int) ([]models.Conversation, error) {
+	query := `
+		SELECT c.id, u.id, u.username, c.updated_at,
+			COALESCE((
+				SELECT m.content FROM messages m
+				WHERE m.conversation_id = c.id
+				ORDER BY m.id DESC LIMIT 1
+			), ''),
+			(
+				SELECT COUNT(*) FROM messages m
+				WHERE m.conversation_id = c.id AND m.id > me.last_read_message_id AND m.sender_id <> me.user_id
+			)
+		FROM conversation_participants me
+		JOIN conversations c ON c.id = me.conversation_id
+		JOIN conversation_participants other ON other.conversation_id = c.id AND other.user_id <> me.user_id
+		JOIN users u ON u.id = other.user_id
+		WHERE me.user_id = ?
+		ORDER BY c.updated_at DESC, c.id DESC
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []models.Conversation
+	for rows.Next() {
+		var c models.Conversation
+		if err := rows.Scan(&c.ID, &c.OtherUserID, &c.OtherUsername, &c.UpdatedAt, &c.LastMessage, &c.UnreadCount); err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// GetConversation returns a conversation as seen by userID. It returns
+// sql.ErrNoRows unless the user takes part in it.
+func (db *DB) GetConversation(ctx context.Context, conversationID, userID int) (*models.Conversation, error) {
+	query := `
+		SELECT c.id, u.id, u.username, c.updated_at
+		FROM conversation_participants me
+		JOIN conversations c ON c.id = me.conversation_id
+		JOIN conversation_participants other ON other.conversation_id = c.id AND other.user_id <> me.user_id
+		JOIN users u ON u.id = other.user_id
+		WHERE c.id = ? AND me.user_id = ?
+	`
+	c := &models.Conversation{}
+	err := db.QueryRowContext(ctx, query, conversationID, userID).Scan(&c.ID, &c.OtherUserID, &c.OtherUsername, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetMessages returns the messages in a conversation, oldest first
+func (db *DB) GetMessages(ctx context.Context, conversationID int) ([]models.Message, error) {
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, u.username, m.content, m.created_at
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.conversation_id = ?
+		ORDER BY m.id
+	`
+	rows, err := db.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		var m models.Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.SenderUsername, &m.Content, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// SendMessage adds a message from sender to recipient to their conversation,
+// starting one if they have none. The message's ID and ConversationID are
+// set on return.
+func (db *DB) SendMessage(ctx context.Context, message *models.Message, recipientID int) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		var conversationID int
+		err := tx.QueryRowContext(ctx, `
+			SELECT me.conversation_id
+			FROM conversation_participants me
+			JOIN conversation_participants other ON other.conversation_id = me.conversation_id
+			WHERE me.user_id = ? AND other.user_id = ?
+		`, message.SenderID, recipientID).Scan(&conversationID)
+
+		if err == sql.ErrNoRows {
+			conversationID, err = tx.insert(ctx, "INSERT INTO conversations (created_at, updated_at) VALUES (CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
+			if err != nil {
+				return err
+			}
+			for _, userID := range []int{message.SenderID, recipientID} {
+				_, err = tx.ExecContext(ctx, "INSERT INTO conversation_participants (conversation_id, user_id) VALUES (?, ?)", conversationID, userID)
+				if err != nil {
+					return err
+				}
+			}
+		} else if err != nil {
+			return err
+		}
+
+		id, err := tx.insert(ctx, "INSERT INTO messages (conversation_id, sender_id, content) VALUES (?, ?, ?)",
+			conversationID, message.SenderID, message.Content)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", conversationID)
+		if err != nil {
+			return err
+		}
+
+		// The sender has read everything up to their own message
+		_, err = tx.ExecContext(ctx, `
+			UPDATE conversation_participants SET last_read_message_id = ?
+			WHERE conversation_id = ? AND user_id = ?
+		`, id, conversationID, message.SenderID)
+		if err != nil {
+			return err
+		}
+
+		message.ID = id
+		message.ConversationID = conversationID
+		return nil
+	})
+}
+
+// MarkConversationRead marks every message in a conversation as read by the
+// user
+func (db *DB) MarkConversationRead(ctx context.Context, conversationID, userID int) error {
+	query := `
+		UPDATE conversation_participants
+		SET last_read_message_id = (SELECT COALESCE(MAX(id), 0) FROM messages WHERE conversation_id = ?)
+		WHERE conversation_id = ? AND user_id = ?
+	`
+	_, err := db.ExecContext(ctx, query, conversationID, conversationID, userID)
+	return err
+}
+
+// CountUnreadMessages returns how many messages sent to the user they have
+// not read yet
+func (db *DB) CountUnreadMessages(ctx context.Context, userID int) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM conversation_participants me
+		JOIN messages m ON m.conversation_id = me.conversation_id
+		WHERE me.user_id = ? AND m.id > me.last_read_message_id AND m.sender_id <> me.user_id
+	`
+	var count int
+	err := db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
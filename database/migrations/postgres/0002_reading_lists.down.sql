@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS review_drafts;
+DROP TABLE IF EXISTS user_books;
+DROP TABLE IF EXISTS books;
@@ -0,0 +1,8 @@
+-- sessions.uuid is already indexed by its UNIQUE constraint
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts(user_id);
+CREATE INDEX IF NOT EXISTS idx_posts_category_id ON posts(category_id);
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_post_likes_post_id_is_like ON post_likes(post_id, is_like);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS comments_count ON comments;
+DROP TRIGGER IF EXISTS post_likes_counts ON post_likes;
+DROP FUNCTION IF EXISTS update_post_comment_count();
+DROP FUNCTION IF EXISTS update_post_like_counts();
+
+ALTER TABLE posts DROP COLUMN comments_count;
+ALTER TABLE posts DROP COLUMN dislikes_count;
+ALTER TABLE posts DROP COLUMN likes_count;
@@ -0,0 +1,44 @@
+ALTER TABLE posts ADD COLUMN likes_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN dislikes_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN comments_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE posts SET
+	likes_count = (SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = posts.id AND pl.is_like = TRUE),
+	dislikes_count = (SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = posts.id AND pl.is_like = FALSE),
+	comments_count = (SELECT COUNT(*) FROM comments cm WHERE cm.post_id = posts.id);
+
+CREATE OR REPLACE FUNCTION update_post_like_counts() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		UPDATE posts SET
+			likes_count = likes_count - (CASE WHEN OLD.is_like THEN 1 ELSE 0 END),
+			dislikes_count = dislikes_count - (CASE WHEN OLD.is_like THEN 0 ELSE 1 END)
+		WHERE id = OLD.post_id;
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		UPDATE posts SET
+			likes_count = likes_count + (CASE WHEN NEW.is_like THEN 1 ELSE 0 END),
+			dislikes_count = dislikes_count + (CASE WHEN NEW.is_like THEN 0 ELSE 1 END)
+		WHERE id = NEW.post_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_likes_counts AFTER INSERT OR DELETE OR UPDATE OF is_like, post_id ON post_likes
+	FOR EACH ROW EXECUTE FUNCTION update_post_like_counts();
+
+CREATE OR REPLACE FUNCTION update_post_comment_count() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id;
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		UPDATE posts SET comments_count = comments_count + 1 WHERE id = NEW.post_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comments_count AFTER INSERT OR DELETE OR UPDATE OF post_id ON comments
+	FOR EACH ROW EXECUTE FUNCTION update_post_comment_count();
@@ -0,0 +1,25 @@
+CREATE OR REPLACE FUNCTION update_post_comment_count() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id;
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		UPDATE posts SET comments_count = comments_count + 1 WHERE id = NEW.post_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS comments_count ON comments;
+CREATE TRIGGER comments_count AFTER INSERT OR DELETE OR UPDATE OF post_id ON comments
+	FOR EACH ROW EXECUTE FUNCTION update_post_comment_count();
+
+UPDATE posts SET comments_count = (SELECT COUNT(*) FROM comments cm WHERE cm.post_id = posts.id);
+
+DROP INDEX IF EXISTS idx_comments_deleted_at;
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+
+ALTER TABLE comments DROP COLUMN deleted_by;
+ALTER TABLE comments DROP COLUMN deleted_at;
+ALTER TABLE posts DROP COLUMN deleted_by;
+ALTER TABLE posts DROP COLUMN deleted_at;
@@ -0,0 +1,31 @@
+-- Private conversations between members
+CREATE TABLE IF NOT EXISTS conversations (
+	id SERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	-- Time of the latest message, for ordering the inbox
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Members of each conversation and the last message each has read
+CREATE TABLE IF NOT EXISTS conversation_participants (
+	conversation_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	last_read_message_id INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY(conversation_id, user_id),
+	FOREIGN KEY(conversation_id) REFERENCES conversations(id),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_participants_user ON conversation_participants(user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id SERIAL PRIMARY KEY,
+	conversation_id INTEGER NOT NULL,
+	sender_id INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(conversation_id) REFERENCES conversations(id),
+	FOREIGN KEY(sender_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id, id);
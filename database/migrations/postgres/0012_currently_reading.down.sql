@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN currently_reading_book_id;
@@ -0,0 +1,3 @@
+-- The book a member is reading now, shown on their profile and next to
+-- their name on posts and comments
+ALTER TABLE users ADD COLUMN currently_reading_book_id INTEGER REFERENCES books(id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS quote_likes;
+DROP TABLE IF EXISTS quotes;
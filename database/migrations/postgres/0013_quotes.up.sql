@@ -0,0 +1,25 @@
+-- Favorite passages members share from books, separate from discussion posts
+CREATE TABLE IF NOT EXISTS quotes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	book_id INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	page TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(book_id) REFERENCES books(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_quotes_user ON quotes(user_id);
+
+CREATE TABLE IF NOT EXISTS quote_likes (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	quote_id INTEGER NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(quote_id) REFERENCES quotes(id),
+	UNIQUE(user_id, quote_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_quote_likes_quote ON quote_likes(quote_id);
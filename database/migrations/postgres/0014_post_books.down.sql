@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_book;
+ALTER TABLE posts DROP COLUMN book_id;
+ALTER TABLE books DROP COLUMN cover_url;
@@ -0,0 +1,11 @@
+-- Per-user settings. Users without a row use the defaults.
+CREATE TABLE IF NOT EXISTS user_preferences (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id),
+	posts_per_page INTEGER NOT NULL DEFAULT 20,
+	post_sort TEXT NOT NULL DEFAULT 'date',
+	post_sort_order TEXT NOT NULL DEFAULT 'desc',
+	comment_sort TEXT NOT NULL DEFAULT 'oldest',
+	email_replies BOOLEAN NOT NULL DEFAULT FALSE,
+	email_messages BOOLEAN NOT NULL DEFAULT FALSE,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
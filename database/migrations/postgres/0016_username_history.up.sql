@@ -0,0 +1,11 @@
+-- Usernames members had before changing them. Old names stay reserved for
+-- their former owner and /profile/{old name} redirects to the member.
+CREATE TABLE IF NOT EXISTS username_history (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	changed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_history_user ON username_history(user_id);
+CREATE INDEX IF NOT EXISTS idx_username_history_username ON username_history(username);
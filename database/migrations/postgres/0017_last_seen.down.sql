@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_last_seen;
+ALTER TABLE user_preferences DROP COLUMN hide_online;
+ALTER TABLE users DROP COLUMN last_seen_at;
@@ -0,0 +1,2 @@
+ALTER TABLE user_preferences DROP COLUMN wall_closed;
+DROP TABLE IF EXISTS wall_posts;
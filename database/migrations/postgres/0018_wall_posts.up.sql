@@ -0,0 +1,15 @@
+-- Messages members leave on each other's profile walls. seen is set once
+-- the wall's owner has looked at them.
+CREATE TABLE IF NOT EXISTS wall_posts (
+	id SERIAL PRIMARY KEY,
+	profile_user_id INTEGER NOT NULL REFERENCES users(id),
+	author_id INTEGER NOT NULL REFERENCES users(id),
+	content TEXT NOT NULL,
+	seen BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_wall_posts_profile ON wall_posts(profile_user_id, created_at);
+
+-- Members can close their wall to new messages
+ALTER TABLE user_preferences ADD COLUMN wall_closed BOOLEAN NOT NULL DEFAULT FALSE;
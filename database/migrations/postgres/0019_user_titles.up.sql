@@ -0,0 +1,18 @@
+-- The ladder of titles members earn by posting and staying a member. A
+-- member holds the highest title whose thresholds they meet.
+CREATE TABLE IF NOT EXISTS user_titles (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    min_posts INTEGER NOT NULL DEFAULT 0,
+    min_days INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO user_titles (name, min_posts, min_days) VALUES
+    ('Cub', 0, 0),
+    ('Bookworm', 10, 0),
+    ('Avid Reader', 50, 90),
+    ('Lion Elder', 200, 365);
+
+-- Staff may be given a title of their own, shown instead of the earned one
+ALTER TABLE users ADD COLUMN custom_title TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- The IANA time zone a member's dates and times are shown in
+ALTER TABLE user_preferences ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
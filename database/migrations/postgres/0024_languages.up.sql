@@ -0,0 +1,2 @@
+-- The locale a member reads the forum in; empty to follow their browser
+ALTER TABLE user_preferences ADD COLUMN language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- The color theme a member sees: 'auto' to follow their system, 'light' or 'dark'
+ALTER TABLE user_preferences ADD COLUMN theme TEXT NOT NULL DEFAULT 'auto';
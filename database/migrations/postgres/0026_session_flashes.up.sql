@@ -0,0 +1,3 @@
+-- Flash messages waiting to be shown on the session's next page, as a JSON
+-- array; empty when there are none
+ALTER TABLE sessions ADD COLUMN flash TEXT NOT NULL DEFAULT '';
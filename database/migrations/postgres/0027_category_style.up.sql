@@ -0,0 +1,20 @@
+-- How categories are shown: an emoji icon and a #rrggbb color for their
+-- chips (empty for none), and their position in category lists, lowest first
+ALTER TABLE categories ADD COLUMN icon TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN color TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
+
+-- Keep existing categories in the order they were created
+UPDATE categories SET sort_order = id;
+
+-- Style the categories every forum starts with
+UPDATE categories SET icon = '💬', color = '#3498db' WHERE name = 'General Discussion';
+UPDATE categories SET icon = '📖', color = '#8e44ad' WHERE name = 'Fiction';
+UPDATE categories SET icon = '🧠', color = '#16a085' WHERE name = 'Non-Fiction';
+UPDATE categories SET icon = '🔍', color = '#2c3e50' WHERE name = 'Mystery & Thriller';
+UPDATE categories SET icon = '💕', color = '#e84393' WHERE name = 'Romance';
+UPDATE categories SET icon = '🚀', color = '#6c5ce7' WHERE name = 'Science Fiction & Fantasy';
+UPDATE categories SET icon = '🏛️', color = '#a0522d' WHERE name = 'Classics';
+UPDATE categories SET icon = '⭐', color = '#f39c12' WHERE name = 'Book Reviews';
+UPDATE categories SET icon = '✍️', color = '#27ae60' WHERE name = 'Author Discussions';
+UPDATE categories SET icon = '📚', color = '#c0392b' WHERE name = 'Book Club Picks';
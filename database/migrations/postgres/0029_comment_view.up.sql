@@ -0,0 +1,3 @@
+-- How a member reads threads: 'tree' to nest replies under the comments they
+-- answer, or 'flat' to list all comments in the order they were written
+ALTER TABLE user_preferences ADD COLUMN comment_view TEXT NOT NULL DEFAULT 'tree';
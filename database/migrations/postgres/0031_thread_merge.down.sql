@@ -0,0 +1,2 @@
+ALTER TABLE comments DROP COLUMN merged_from;
+ALTER TABLE posts DROP COLUMN merged_into;
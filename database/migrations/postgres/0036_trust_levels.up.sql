@@ -0,0 +1,4 @@
+-- How far the forum trusts a member: 'new', 'member' or 'regular'. Levels
+-- are raised by a background job as accounts age and contribute, and unlock
+-- posting links, uploading pictures and higher rate limits.
+ALTER TABLE users ADD COLUMN trust_level TEXT NOT NULL DEFAULT 'new';
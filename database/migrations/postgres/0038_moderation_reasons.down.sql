@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN suspension_reason;
+ALTER TABLE comments DROP COLUMN removal_reason;
+ALTER TABLE posts DROP COLUMN removal_reason;
+DROP TABLE IF EXISTS moderation_reasons;
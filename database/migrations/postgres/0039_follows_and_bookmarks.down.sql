@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS bookmarks_count ON bookmarks;
+DROP TRIGGER IF EXISTS followers_count ON thread_follows;
+DROP FUNCTION IF EXISTS update_post_bookmarks_count();
+DROP FUNCTION IF EXISTS update_post_followers_count();
+
+ALTER TABLE posts DROP COLUMN bookmarks_count;
+ALTER TABLE posts DROP COLUMN followers_count;
+
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS thread_follows;
@@ -0,0 +1,54 @@
+-- Threads members follow, so they get reply emails about them without
+-- having written in them, and posts they bookmarked to come back to
+CREATE TABLE IF NOT EXISTS thread_follows (
+	user_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, post_id),
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(post_id) REFERENCES posts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_follows_post ON thread_follows(post_id);
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+	user_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, post_id),
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(post_id) REFERENCES posts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_post ON bookmarks(post_id);
+
+ALTER TABLE posts ADD COLUMN followers_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN bookmarks_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION update_post_followers_count() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		UPDATE posts SET followers_count = followers_count - 1 WHERE id = OLD.post_id;
+	ELSE
+		UPDATE posts SET followers_count = followers_count + 1 WHERE id = NEW.post_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER followers_count AFTER INSERT OR DELETE ON thread_follows
+	FOR EACH ROW EXECUTE FUNCTION update_post_followers_count();
+
+CREATE OR REPLACE FUNCTION update_post_bookmarks_count() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		UPDATE posts SET bookmarks_count = bookmarks_count - 1 WHERE id = OLD.post_id;
+	ELSE
+		UPDATE posts SET bookmarks_count = bookmarks_count + 1 WHERE id = NEW.post_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bookmarks_count AFTER INSERT OR DELETE ON bookmarks
+	FOR EACH ROW EXECUTE FUNCTION update_post_bookmarks_count();
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS books (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	author TEXT NOT NULL DEFAULT '',
+	isbn TEXT DEFAULT '',
+	isbn13 TEXT DEFAULT '',
+	goodreads_id TEXT DEFAULT '',
+	published_year INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_books (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	book_id INTEGER NOT NULL,
+	shelf TEXT NOT NULL DEFAULT 'to-read',
+	rating INTEGER DEFAULT 0,
+	date_read DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(book_id) REFERENCES books(id),
+	UNIQUE(user_id, book_id)
+);
+
+CREATE TABLE IF NOT EXISTS review_drafts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	book_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(book_id) REFERENCES books(id)
+);
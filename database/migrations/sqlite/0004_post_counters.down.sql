@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS comments_count_update;
+DROP TRIGGER IF EXISTS comments_count_delete;
+DROP TRIGGER IF EXISTS comments_count_insert;
+DROP TRIGGER IF EXISTS post_likes_counts_update;
+DROP TRIGGER IF EXISTS post_likes_counts_delete;
+DROP TRIGGER IF EXISTS post_likes_counts_insert;
+
+ALTER TABLE posts DROP COLUMN comments_count;
+ALTER TABLE posts DROP COLUMN dislikes_count;
+ALTER TABLE posts DROP COLUMN likes_count;
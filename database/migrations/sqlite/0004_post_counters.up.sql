@@ -0,0 +1,52 @@
+ALTER TABLE posts ADD COLUMN likes_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN dislikes_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN comments_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE posts SET
+	likes_count = (SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = posts.id AND pl.is_like = TRUE),
+	dislikes_count = (SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = posts.id AND pl.is_like = FALSE),
+	comments_count = (SELECT COUNT(*) FROM comments cm WHERE cm.post_id = posts.id);
+
+CREATE TRIGGER post_likes_counts_insert AFTER INSERT ON post_likes
+BEGIN
+	UPDATE posts SET
+		likes_count = likes_count + (CASE WHEN NEW.is_like THEN 1 ELSE 0 END),
+		dislikes_count = dislikes_count + (CASE WHEN NEW.is_like THEN 0 ELSE 1 END)
+	WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER post_likes_counts_delete AFTER DELETE ON post_likes
+BEGIN
+	UPDATE posts SET
+		likes_count = likes_count - (CASE WHEN OLD.is_like THEN 1 ELSE 0 END),
+		dislikes_count = dislikes_count - (CASE WHEN OLD.is_like THEN 0 ELSE 1 END)
+	WHERE id = OLD.post_id;
+END;
+
+CREATE TRIGGER post_likes_counts_update AFTER UPDATE OF is_like, post_id ON post_likes
+BEGIN
+	UPDATE posts SET
+		likes_count = likes_count - (CASE WHEN OLD.is_like THEN 1 ELSE 0 END),
+		dislikes_count = dislikes_count - (CASE WHEN OLD.is_like THEN 0 ELSE 1 END)
+	WHERE id = OLD.post_id;
+	UPDATE posts SET
+		likes_count = likes_count + (CASE WHEN NEW.is_like THEN 1 ELSE 0 END),
+		dislikes_count = dislikes_count + (CASE WHEN NEW.is_like THEN 0 ELSE 1 END)
+	WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER comments_count_insert AFTER INSERT ON comments
+BEGIN
+	UPDATE posts SET comments_count = comments_count + 1 WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER comments_count_delete AFTER DELETE ON comments
+BEGIN
+	UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id;
+END;
+
+CREATE TRIGGER comments_count_update AFTER UPDATE OF post_id ON comments
+BEGIN
+	UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id;
+	UPDATE posts SET comments_count = comments_count + 1 WHERE id = NEW.post_id;
+END;
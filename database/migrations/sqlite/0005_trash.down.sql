@@ -0,0 +1,23 @@
+DROP TRIGGER IF EXISTS comments_count_update;
+DROP TRIGGER IF EXISTS comments_count_delete;
+
+CREATE TRIGGER comments_count_delete AFTER DELETE ON comments
+BEGIN
+	UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id;
+END;
+
+CREATE TRIGGER comments_count_update AFTER UPDATE OF post_id ON comments
+BEGIN
+	UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id;
+	UPDATE posts SET comments_count = comments_count + 1 WHERE id = NEW.post_id;
+END;
+
+UPDATE posts SET comments_count = (SELECT COUNT(*) FROM comments cm WHERE cm.post_id = posts.id);
+
+DROP INDEX IF EXISTS idx_comments_deleted_at;
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+
+ALTER TABLE comments DROP COLUMN deleted_by;
+ALTER TABLE comments DROP COLUMN deleted_at;
+ALTER TABLE posts DROP COLUMN deleted_by;
+ALTER TABLE posts DROP COLUMN deleted_at;
@@ -0,0 +1,23 @@
+ALTER TABLE posts ADD COLUMN deleted_at DATETIME;
+ALTER TABLE posts ADD COLUMN deleted_by INTEGER;
+ALTER TABLE comments ADD COLUMN deleted_at DATETIME;
+ALTER TABLE comments ADD COLUMN deleted_by INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments(deleted_at);
+
+-- Trashed comments no longer count towards their post's comments_count
+DROP TRIGGER IF EXISTS comments_count_delete;
+DROP TRIGGER IF EXISTS comments_count_update;
+
+CREATE TRIGGER comments_count_delete AFTER DELETE ON comments
+WHEN OLD.deleted_at IS NULL
+BEGIN
+	UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id;
+END;
+
+CREATE TRIGGER comments_count_update AFTER UPDATE OF post_id, deleted_at ON comments
+BEGIN
+	UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id AND OLD.deleted_at IS NULL;
+	UPDATE posts SET comments_count = comments_count + 1 WHERE id = NEW.post_id AND NEW.deleted_at IS NULL;
+END;
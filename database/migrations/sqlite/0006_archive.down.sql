@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_live_category_created_at;
+DROP INDEX IF EXISTS idx_posts_live_created_at;
+
+ALTER TABLE posts DROP COLUMN archived_at;
@@ -0,0 +1,8 @@
+ALTER TABLE posts ADD COLUMN archived_at DATETIME;
+
+-- Hot listings only look at live posts, so these partial indexes stay small
+-- no matter how many threads have been archived
+CREATE INDEX IF NOT EXISTS idx_posts_live_created_at ON posts(created_at)
+	WHERE deleted_at IS NULL AND archived_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_posts_live_category_created_at ON posts(category_id, created_at)
+	WHERE deleted_at IS NULL AND archived_at IS NULL;
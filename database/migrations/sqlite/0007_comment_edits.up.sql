@@ -0,0 +1,2 @@
+-- Set when a comment is edited; NULL means the comment is unchanged
+ALTER TABLE comments ADD COLUMN updated_at DATETIME;
@@ -0,0 +1,6 @@
+-- Feature flags toggled by admins. Flags without a row use their default.
+CREATE TABLE IF NOT EXISTS feature_flags (
+	name TEXT PRIMARY KEY,
+	enabled BOOLEAN NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN favorite_book;
+ALTER TABLE users DROP COLUMN favorite_genres;
+ALTER TABLE users DROP COLUMN website;
+ALTER TABLE users DROP COLUMN location;
+ALTER TABLE users DROP COLUMN bio;
@@ -0,0 +1,7 @@
+-- Optional details users can show on their profile
+ALTER TABLE users ADD COLUMN bio TEXT DEFAULT '';
+ALTER TABLE users ADD COLUMN location TEXT DEFAULT '';
+ALTER TABLE users ADD COLUMN website TEXT DEFAULT '';
+-- Comma-separated list of genres
+ALTER TABLE users ADD COLUMN favorite_genres TEXT DEFAULT '';
+ALTER TABLE users ADD COLUMN favorite_book TEXT DEFAULT '';
@@ -0,0 +1,12 @@
+-- Members a user has blocked. Their posts and comments are hidden from the
+-- blocker, and neither can send the other private messages.
+CREATE TABLE IF NOT EXISTS blocks (
+	blocker_id INTEGER NOT NULL,
+	blocked_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(blocker_id, blocked_id),
+	FOREIGN KEY(blocker_id) REFERENCES users(id),
+	FOREIGN KEY(blocked_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_blocks_blocked ON blocks(blocked_id);
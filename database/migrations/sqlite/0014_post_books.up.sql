@@ -0,0 +1,7 @@
+-- Cover images of books, from Open Library when the book was looked up there
+ALTER TABLE books ADD COLUMN cover_url TEXT DEFAULT '';
+
+-- The book a post discusses or reviews, if any
+ALTER TABLE posts ADD COLUMN book_id INTEGER REFERENCES books(id);
+
+CREATE INDEX IF NOT EXISTS idx_posts_book ON posts(book_id);
@@ -0,0 +1,6 @@
+-- When members were last active, for "online now" and "last seen", and
+-- whether they would rather not show it
+ALTER TABLE users ADD COLUMN last_seen_at DATETIME;
+ALTER TABLE user_preferences ADD COLUMN hide_online BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_users_last_seen ON users(last_seen_at);
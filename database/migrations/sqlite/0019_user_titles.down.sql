@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN custom_title;
+DROP TABLE IF EXISTS user_titles;
@@ -0,0 +1,2 @@
+-- Whether anyone may see a member's Year in Books pages, or just them
+ALTER TABLE user_preferences ADD COLUMN year_in_books_public BOOLEAN NOT NULL DEFAULT FALSE;
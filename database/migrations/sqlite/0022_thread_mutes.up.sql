@@ -0,0 +1,12 @@
+-- Threads members muted, so they get no notifications about them even if
+-- they wrote the post or commented on it
+CREATE TABLE IF NOT EXISTS thread_mutes (
+	user_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, post_id),
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(post_id) REFERENCES posts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_mutes_post ON thread_mutes(post_id);
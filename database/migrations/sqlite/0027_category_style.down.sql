@@ -0,0 +1,3 @@
+ALTER TABLE categories DROP COLUMN sort_order;
+ALTER TABLE categories DROP COLUMN color;
+ALTER TABLE categories DROP COLUMN icon;
@@ -0,0 +1,2 @@
+-- The category a subcategory belongs to; NULL for top-level categories
+ALTER TABLE categories ADD COLUMN parent_id INTEGER REFERENCES categories(id);
@@ -0,0 +1,19 @@
+-- Posts waiting to be published at a later time. The publishing job moves
+-- them into posts once publish_at has passed; until then only their author
+-- sees them, on the drafts page.
+CREATE TABLE IF NOT EXISTS scheduled_posts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	category_id INTEGER NOT NULL,
+	book_id INTEGER,
+	title TEXT NOT NULL,
+	content TEXT NOT NULL,
+	publish_at DATETIME NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(category_id) REFERENCES categories(id),
+	FOREIGN KEY(book_id) REFERENCES books(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_posts_publish_at ON scheduled_posts(publish_at);
+CREATE INDEX IF NOT EXISTS idx_scheduled_posts_user ON scheduled_posts(user_id);
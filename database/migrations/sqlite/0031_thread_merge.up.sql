@@ -0,0 +1,5 @@
+-- A thread merged into another is trashed and remembers where it went, so
+-- its URL can redirect there. Comments moved over remember where they came
+-- from.
+ALTER TABLE posts ADD COLUMN merged_into INTEGER REFERENCES posts(id);
+ALTER TABLE comments ADD COLUMN merged_from INTEGER REFERENCES posts(id);
@@ -0,0 +1,3 @@
+-- Categories whose posts and comments are shown as by "Anonymous Lion".
+-- The real author is still recorded, for moderation.
+ALTER TABLE categories ADD COLUMN anonymous BOOLEAN NOT NULL DEFAULT FALSE;
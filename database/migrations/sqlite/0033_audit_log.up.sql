@@ -0,0 +1,12 @@
+-- Security-relevant and moderation actions, for admins to review. User IDs
+-- have no foreign keys, so entries outlive deleted accounts.
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	actor_id INTEGER,
+	action TEXT NOT NULL,
+	target_user_id INTEGER,
+	details TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
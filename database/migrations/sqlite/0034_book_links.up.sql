@@ -0,0 +1,8 @@
+-- Links to book pages on other sites, such as Open Library and Goodreads,
+-- with the book found there, so each page is only fetched once. Links
+-- without a book held none and are checked again later.
+CREATE TABLE IF NOT EXISTS book_links (
+	url TEXT PRIMARY KEY,
+	book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,
+	checked_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,20 @@
+-- Posts and comments held for a moderator because they looked like spam.
+-- Approving one moves it into posts or comments; rejecting deletes it.
+-- Held comments have a post_id and, for replies, a parent_id; held posts a
+-- category_id and title.
+CREATE TABLE IF NOT EXISTS held_content (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	category_id INTEGER,
+	book_id INTEGER,
+	post_id INTEGER,
+	parent_id INTEGER,
+	title TEXT NOT NULL DEFAULT '',
+	content TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_held_content_created ON held_content(created_at);
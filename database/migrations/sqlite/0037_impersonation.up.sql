@@ -0,0 +1,4 @@
+-- The admin viewing the forum as the session's user, for sessions admins
+-- start from the admin panel to reproduce what a member sees; NULL for
+-- sessions members logged in to themselves
+ALTER TABLE sessions ADD COLUMN impersonator_id INTEGER;
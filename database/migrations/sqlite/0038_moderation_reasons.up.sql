@@ -0,0 +1,18 @@
+-- Canned reasons admins pick from when removing content or suspending
+-- members, managed from the admin panel
+CREATE TABLE IF NOT EXISTS moderation_reasons (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    text TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO moderation_reasons (text) VALUES
+    ('Off-topic'),
+    ('Spoilers without tags'),
+    ('Personal attack');
+
+-- Why a moderator trashed a post or comment or suspended a member; empty
+-- when none was given or the author deleted their own content
+ALTER TABLE posts ADD COLUMN removal_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE comments ADD COLUMN removal_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
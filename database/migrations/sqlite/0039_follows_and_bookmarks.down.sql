@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS bookmarks_count_delete;
+DROP TRIGGER IF EXISTS bookmarks_count_insert;
+DROP TRIGGER IF EXISTS followers_count_delete;
+DROP TRIGGER IF EXISTS followers_count_insert;
+
+ALTER TABLE posts DROP COLUMN bookmarks_count;
+ALTER TABLE posts DROP COLUMN followers_count;
+
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS thread_follows;
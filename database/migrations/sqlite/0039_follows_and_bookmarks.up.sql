@@ -0,0 +1,46 @@
+-- Threads members follow, so they get reply emails about them without
+-- having written in them, and posts they bookmarked to come back to
+CREATE TABLE IF NOT EXISTS thread_follows (
+	user_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, post_id),
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(post_id) REFERENCES posts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_thread_follows_post ON thread_follows(post_id);
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+	user_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, post_id),
+	FOREIGN KEY(user_id) REFERENCES users(id),
+	FOREIGN KEY(post_id) REFERENCES posts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookmarks_post ON bookmarks(post_id);
+
+ALTER TABLE posts ADD COLUMN followers_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN bookmarks_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TRIGGER followers_count_insert AFTER INSERT ON thread_follows
+BEGIN
+	UPDATE posts SET followers_count = followers_count + 1 WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER followers_count_delete AFTER DELETE ON thread_follows
+BEGIN
+	UPDATE posts SET followers_count = followers_count - 1 WHERE id = OLD.post_id;
+END;
+
+CREATE TRIGGER bookmarks_count_insert AFTER INSERT ON bookmarks
+BEGIN
+	UPDATE posts SET bookmarks_count = bookmarks_count + 1 WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER bookmarks_count_delete AFTER DELETE ON bookmarks
+BEGIN
+	UPDATE posts SET bookmarks_count = bookmarks_count - 1 WHERE id = OLD.post_id;
+END;
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"literary-lions/models"
+	"time"
+)
+
+// HoldContent adds a post or comment to the moderation queue and sets its ID
+func (db *DB) HoldContent(ctx context.Context, held *models.HeldContent) error {
+	query := `
+		INSERT INTO held_content (kind, user_id, category_id, book_id, post_id, parent_id, title, content, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	id, err := db.insert(ctx, query, held.Kind, held.UserID, nullID(held.CategoryID), held.BookID,
+		nullID(held.PostID), held.ParentID, held.Title, held.Content, held.Reason)
+	if err != nil {
+		return err
+	}
+	held.ID = id
+	return nil
+}
+
+// heldContentQuery selects held content with the names shown with it
+const heldContentQuery = `
+	SELECT h.id, h.kind, h.user_id, u.username, COALESCE(h.category_id, 0), COALESCE(c.name, ''),
+	       h.book_id, COALESCE(h.post_id, 0), COALESCE(p.title, ''), h.parent_id,
+	       h.title, h.content, h.reason, h.created_at
+	FROM held_content h
+	JOIN users u ON u.id = h.user_id
+	LEFT JOIN categories c ON c.id = h.category_id
+	LEFT JOIN posts p ON p.id = h.post_id
+`
+
+// GetHeldContent gets the moderation queue, oldest first
+func (db *DB) GetHeldContent(ctx context.Context) ([]models.HeldContent, error) {
+	rows, err := db.QueryContext(ctx, heldContentQuery+"ORDER BY h.created_at, h.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queue []models.HeldContent
+	for rows.Next() {
+		var held models.HeldContent
+		if err := scanHeldContent(rows, &held); err != nil {
+			return nil, err
+		}
+		queue = append(queue, held)
+	}
+	return queue, rows.Err()
+}
+
+// GetHeldContentByID gets a post or comment in the moderation queue. It
+// returns sql.ErrNoRows if there is none with that ID.
+func (db *DB) GetHeldContentByID(ctx context.Context, id int) (*models.HeldContent, error) {
+	var held models.HeldContent
+	if err := scanHeldContent(db.QueryRowContext(ctx, heldContentQuery+"WHERE h.id = ?", id), &held); err != nil {
+		return nil, err
+	}
+	return &held, nil
+}
+
+// scanHeldContent scans a row selected with heldContentQuery
+func scanHeldContent(row interface{ Scan(...interface{}) error }, held *models.HeldContent) error {
+	return row.Scan(&held.ID, &held.Kind, &held.UserID, &held.Username, &held.CategoryID, &held.CategoryName,
+		&held.BookID, &held.PostID, &held.PostTitle, &held.ParentID,
+		&held.Title, &held.Content, &held.Reason, &held.CreatedAt)
+}
+
+// DeleteHeldContent removes a post or comment from the moderation queue. It
+// returns sql.ErrNoRows if there is none with that ID.
+func (db *DB) DeleteHeldContent(ctx context.Context, id int) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM held_content WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// CountHeldContent counts the posts and comments in the moderation queue
+func (db *DB) CountHeldContent(ctx context.Context) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM held_content").Scan(&count)
+	return count, err
+}
+
+// CountDuplicates counts the posts, comments and held content with exactly
+// the given text written since a time, including deleted ones
+func (db *DB) CountDuplicates(ctx context.Context, content string, since time.Time) (int, error) {
+	query := `
+		SELECT (SELECT COUNT(*) FROM posts WHERE content = ? AND created_at >= ?)
+		     + (SELECT COUNT(*) FROM comments WHERE content = ? AND created_at >= ?)
+		     + (SELECT COUNT(*) FROM held_content WHERE content = ? AND created_at >= ?)
+	`
+	after := db.dialect.timeArg(since)
+	var count int
+	err := db.QueryRowContext(ctx, query, content, after, content, after, content, after).Scan(&count)
+	return count, err
+}
+
+// nullID stores an ID of 0 as NULL
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"literary-lions/models"
+)
+
+// MuteThread stops a user getting notifications about a post and its
+// comments
+func (db *DB) MuteThread(ctx context.Context, userID, postID int) error {
+	query := `
+		INSERT INTO thread_mutes (user_id, post_id) VALUES (?, ?)
+		ON CONFLICT (user_id, post_id) DO NOTHING
+	`
+	_, err := db.ExecContext(ctx, query, userID, postID)
+	return err
+}
+
+// UnmuteThread lets a user get notifications about a post again
+func (db *DB) UnmuteThread(ctx context.Context, userID, postID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM thread_mutes WHERE user_id = ? AND post_id = ?", userID, postID)
+	return err
+}
+
+// IsThreadMuted reports whether a user muted a post
+func (db *DB) IsThreadMuted(ctx context.Context, userID, postID int) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM thread_mutes WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&count)
+	return count > 0, err
+}
+
+// GetReplyRecipients gets the members to email about a new comment by
+// authorID on a post: the post's author, everyone who commented on it and
+// everyone following it, as long as they are active, asked for reply emails, haven't muted the
+// thread and haven't blocked the comment's author
+func (db *DB) GetReplyRecipients(ctx context.Context, postID, authorID int) ([]models.User, error) {
+	query := `
+		SELECT u.id, u.username, u.email
+		FROM users u
+		JOIN user_preferences p ON p.user_id = u.id
+		WHERE p.email_replies = TRUE
+		  AND u.status = 'active'
+		  AND u.id != ?
+		  AND (u.id IN (SELECT user_id FROM posts WHERE id = ?)
+		       OR u.id IN (SELECT user_id FROM comments WHERE post_id = ? AND deleted_at IS NULL)
+		       OR u.id IN (SELECT user_id FROM thread_follows WHERE post_id = ?))
+		  AND u.id NOT IN (SELECT user_id FROM thread_mutes WHERE post_id = ?)
+		  AND u.id NOT IN (SELECT blocker_id FROM blocks WHERE blocked_id = ?)
+		ORDER BY u.id
+	`
+	rows, err := db.QueryContext(ctx, query, authorID, postID, postID, postID, postID, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
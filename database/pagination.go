@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"literary-lions/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits for the number of posts returned per page
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ErrInvalidCursor is returned for malformed pagination cursors
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PostPageQuery selects one page of the newest-first post feed
+type PostPageQuery struct {
+	CategoryID    int    // only posts in this category and its subcategories; 0 for all
+	ShowSuspended bool   // include posts by suspended users
+	ViewerID      int    // leave out posts by users the viewer blocked; 0 for anonymous viewers
+	Cursor        string // NextCursor of the previous page; empty for the first page
+	Limit         int    // page size; defaults to DefaultPageSize
+}
+
+// postCursor marks the last post of a page. Because it is based on the
+// (created_at, id) position rather than an offset, pages stay stable while
+// new posts arrive.
+type postCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// encodeCursor returns an opaque cursor string pointing after post
+func encodeCursor(post models.Post) string {
+	raw := post.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(post.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(cursor string) (*postCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &postCursor{}
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID, err = strconv.Atoi(id); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// GetPostsPage returns one page of posts, newest first, along with the cursor
+// for the next page. The cursor is empty when there are no more posts.
+func (db *DB) GetPostsPage(ctx context.Context, q PostPageQuery) ([]models.Post, string, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	conditions := []string{"p.deleted_at IS NULL", "p.archived_at IS NULL"}
+	var args []interface{}
+
+	if !q.ShowSuspended {
+		conditions = append(conditions, "u.status = 'active'")
+	}
+	if q.ViewerID > 0 {
+		// Posts in anonymous categories stay, or leaving them out would say
+		// who wrote them
+		conditions = append(conditions, "(c.anonymous = TRUE OR p.user_id NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?))")
+		args = append(args, q.ViewerID)
+	}
+	if q.CategoryID > 0 {
+		conditions = append(conditions, inCategoryTree)
+		args = append(args, q.CategoryID)
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		createdAt := db.dialect.timeArg(cursor.CreatedAt)
+		conditions = append(conditions, "(p.created_at < ? OR (p.created_at = ? AND p.id < ?))")
+		args = append(args, createdAt, createdAt, cursor.ID)
+	}
+
+	query := `
+		SELECT
+			p.id, p.title, p.content, p.user_id, p.category_id, u.username, c.name, c.anonymous,
+			p.created_at, p.updated_at,
+			p.likes_count, p.dislikes_count, p.comments_count
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		JOIN categories c ON p.category_id = c.id`
+	query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	query += "\n\t\tORDER BY p.created_at DESC, p.id DESC\n\t\tLIMIT ?"
+
+	// Fetch one extra row to find out whether another page follows
+	args = append(args, limit+1)
+
+	posts, err := db.executePostsWithArgs(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(posts) > limit {
+		posts = posts[:limit]
+		next = encodeCursor(posts[limit-1])
+	}
+
+	return posts, next, nil
+}
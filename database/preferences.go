@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"literary-lions/models"
+)
+
+// GetPreferences gets a user's settings, or the defaults if they never
+// changed them
+func (db *DB) GetPreferences(ctx context.Context, userID int) (*models.Preferences, error) {
+	prefs := models.DefaultPreferences(userID)
+	query := `
+		SELECT posts_per_page, post_sort, post_sort_order, comment_sort, comment_view, email_replies, email_messages, hide_online, wall_closed, year_in_books_public, timezone, language, theme
+		FROM user_preferences WHERE user_id = ?
+	`
+	err := db.QueryRowContext(ctx, query, userID).Scan(
+		&prefs.PostsPerPage, &prefs.PostSort, &prefs.PostSortOrder, &prefs.CommentSort, &prefs.CommentView,
+		&prefs.EmailReplies, &prefs.EmailMessages, &prefs.HideOnline, &prefs.WallClosed, &prefs.YearPublic, &prefs.Timezone, &prefs.Language, &prefs.Theme,
+	)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// SavePreferences stores a user's settings
+func (db *DB) SavePreferences(ctx context.Context, prefs *models.Preferences) error {
+	query := `
+		INSERT INTO user_preferences (user_id, posts_per_page, post_sort, post_sort_order, comment_sort, comment_view, email_replies, email_messages, hide_online, wall_closed, year_in_books_public, timezone, language, theme, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE SET
+			posts_per_page = excluded.posts_per_page,
+			post_sort = excluded.post_sort,
+			post_sort_order = excluded.post_sort_order,
+			comment_sort = excluded.comment_sort,
+			comment_view = excluded.comment_view,
+			email_replies = excluded.email_replies,
+			email_messages = excluded.email_messages,
+			hide_online = excluded.hide_online,
+			wall_closed = excluded.wall_closed,
+			year_in_books_public = excluded.year_in_books_public,
+			timezone = excluded.timezone,
+			language = excluded.language,
+			theme = excluded.theme,
+			updated_at = excluded.updated_at
+	`
+	_, err := db.ExecContext(ctx, query, prefs.UserID, prefs.PostsPerPage, prefs.PostSort, prefs.PostSortOrder,
+		prefs.CommentSort, prefs.CommentView, prefs.EmailReplies, prefs.EmailMessages, prefs.HideOnline, prefs.WallClosed, prefs.YearPublic, prefs.Timezone, prefs.Language, prefs.Theme)
+	return err
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TouchLastSeen records that a user was active at the given time
+func (db *DB) TouchLastSeen(ctx context.Context, userID int, at time.Time) error {
+	_, err := db.ExecContext(ctx, "UPDATE users SET last_seen_at = ? WHERE id = ?", db.dialect.timeArg(at), userID)
+	return err
+}
+
+// GetLastSeen gets when a user was last active. It is nil if they never
+// were since this was tracked, or they chose to hide it.
+func (db *DB) GetLastSeen(ctx context.Context, userID int) (*time.Time, error) {
+	query := `
+		SELECT u.last_seen_at
+		FROM users u
+		LEFT JOIN user_preferences p ON p.user_id = u.id
+		WHERE u.id = ? AND COALESCE(p.hide_online, FALSE) = FALSE
+	`
+	var lastSeen *time.Time
+	err := db.QueryRowContext(ctx, query, userID).Scan(&lastSeen)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return lastSeen, nil
+}
+
+// CountOnlineUsers counts the active members seen since the given time,
+// leaving out those who hide when they're online
+func (db *DB) CountOnlineUsers(ctx context.Context, since time.Time) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM users u
+		LEFT JOIN user_preferences p ON p.user_id = u.id
+		WHERE u.last_seen_at >= ? AND u.status = 'active' AND COALESCE(p.hide_online, FALSE) = FALSE
+	`
+	var count int
+	err := db.QueryRowContext(ctx, query, db.dialect.timeArg(since)).Scan(&count)
+	return count, err
+}
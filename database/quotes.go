@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"literary-lions/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuotePageQuery selects one page of the newest-first list of quotes
+type QuotePageQuery struct {
+	Search        string // only quotes whose text, book title or author contain this
+	ShowSuspended bool   // include quotes by suspended users
+	ViewerID      int    // marks the quotes the viewer liked and leaves out those by users they blocked; 0 for anonymous viewers
+	Cursor        string // NextCursor of the previous page; empty for the first page
+	Limit         int    // page size; defaults to DefaultPageSize
+}
+
+// encodeQuoteCursor returns an opaque cursor string pointing after quote. It
+// has the same form as post cursors, so decodeCursor reads it.
+func encodeQuoteCursor(quote models.Quote) string {
+	raw := quote.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(quote.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// quoteColumns are the columns scanned by scanQuote. The viewer's ID is the
+// first query argument.
+const quoteColumns = `
+	q.id, q.user_id, u.username, q.book_id, b.title, b.author, q.content, q.page, q.created_at,
+	(SELECT COUNT(*) FROM quote_likes ql WHERE ql.quote_id = q.id) AS likes_count,
+	EXISTS (SELECT 1 FROM quote_likes ql WHERE ql.quote_id = q.id AND ql.user_id = ?) AS user_liked`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanQuote(row rowScanner) (models.Quote, error) {
+	var q models.Quote
+	err := row.Scan(&q.ID, &q.UserID, &q.Username, &q.BookID, &q.BookTitle, &q.BookAuthor,
+		&q.Content, &q.Page, &q.CreatedAt, &q.LikesCount, &q.UserLiked)
+	return q, err
+}
+
+// GetQuotesPage returns one page of quotes, newest first, along with the
+// cursor for the next page. The cursor is empty when there are no more
+// quotes.
+func (db *DB) GetQuotesPage(ctx context.Context, q QuotePageQuery) ([]models.Quote, string, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	var conditions []string
+	args := []interface{}{q.ViewerID}
+	if !q.ShowSuspended {
+		conditions = append(conditions, "u.status = 'active'")
+	}
+	if q.ViewerID > 0 {
+		conditions = append(conditions, "q.user_id NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)")
+		args = append(args, q.ViewerID)
+	}
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		like := db.dialect.like()
+		conditions = append(conditions, "(q.content "+like+" ? OR b.title "+like+" ? OR b.author "+like+" ?)")
+		args = append(args, pattern, pattern, pattern)
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		createdAt := db.dialect.timeArg(cursor.CreatedAt)
+		conditions = append(conditions, "(q.created_at < ? OR (q.created_at = ? AND q.id < ?))")
+		args = append(args, createdAt, createdAt, cursor.ID)
+	}
+
+	query := `
+		SELECT` + quoteColumns + `
+		FROM quotes q
+		JOIN users u ON q.user_id = u.id
+		JOIN books b ON q.book_id = b.id`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += "\n\t\tORDER BY q.created_at DESC, q.id DESC\n\t\tLIMIT ?"
+
+	// Fetch one extra row to find out whether another page follows
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var quotes []models.Quote
+	for rows.Next() {
+		quote, err := scanQuote(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		quotes = append(quotes, quote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(quotes) > limit {
+		quotes = quotes[:limit]
+		next = encodeQuoteCursor(quotes[limit-1])
+	}
+	return quotes, next, nil
+}
+
+// GetQuoteByID gets a quote, as seen by the viewer with viewerID (0 for
+// anonymous viewers)
+func (db *DB) GetQuoteByID(ctx context.Context, quoteID, viewerID int) (*models.Quote, error) {
+	query := `
+		SELECT` + quoteColumns + `
+		FROM quotes q
+		JOIN users u ON q.user_id = u.id
+		JOIN books b ON q.book_id = b.id
+		WHERE q.id = ?`
+	quote, err := scanQuote(db.QueryRowContext(ctx, query, viewerID, quoteID))
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// CreateQuote stores a new quote. Its BookID must be set.
+func (db *DB) CreateQuote(ctx context.Context, quote *models.Quote) error {
+	query := "INSERT INTO quotes (user_id, book_id, content, page) VALUES (?, ?, ?, ?)"
+	id, err := db.insert(ctx, query, quote.UserID, quote.BookID, quote.Content, quote.Page)
+	if err != nil {
+		return err
+	}
+
+	quote.ID = id
+	return nil
+}
+
+// DeleteQuote deletes a quote and its likes
+func (db *DB) DeleteQuote(ctx context.Context, quoteID int) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM quote_likes WHERE quote_id = ?", quoteID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM quotes WHERE id = ?", quoteID)
+		return err
+	})
+}
+
+// ToggleQuoteLike likes a quote, or takes the like back if the user already
+// liked it
+func (db *DB) ToggleQuoteLike(ctx context.Context, userID, quoteID int) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM quote_likes WHERE user_id = ? AND quote_id = ?", userID, quoteID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO quote_likes (user_id, quote_id) VALUES (?, ?) ON CONFLICT (user_id, quote_id) DO NOTHING", userID, quoteID)
+		return err
+	})
+}
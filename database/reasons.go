@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"literary-lions/models"
+)
+
+// GetModerationReasons gets the canned moderation reasons, oldest first
+func (db *DB) GetModerationReasons(ctx context.Context) ([]models.ModerationReason, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, text FROM moderation_reasons ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reasons []models.ModerationReason
+	for rows.Next() {
+		var reason models.ModerationReason
+		if err := rows.Scan(&reason.ID, &reason.Text); err != nil {
+			return nil, err
+		}
+		reasons = append(reasons, reason)
+	}
+	return reasons, rows.Err()
+}
+
+// CreateModerationReason adds a canned moderation reason
+func (db *DB) CreateModerationReason(ctx context.Context, reason *models.ModerationReason) error {
+	id, err := db.insert(ctx, "INSERT INTO moderation_reasons (text) VALUES (?)", reason.Text)
+	if err != nil {
+		return err
+	}
+	reason.ID = id
+	return nil
+}
+
+// DeleteModerationReason removes a canned moderation reason. Content removed
+// and members suspended with it keep it. Returns sql.ErrNoRows if there is
+// no such reason.
+func (db *DB) DeleteModerationReason(ctx context.Context, reasonID int) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM moderation_reasons WHERE id = ?", reasonID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"literary-lions/config"
+	"time"
+)
+
+// purgeExec runs a delete in a retention purge, adding the rows it deleted
+// to count unless count is nil
+type purgeExec func(count *int, query string, args ...interface{}) error
+
+// errDryRun rolls back a retention purge that was only counting
+var errDryRun = errors.New("dry run")
+
+// PurgeReport counts the rows a retention purge deleted, or would have
+// deleted in a dry run
+type PurgeReport struct {
+	Posts        int // trashed posts
+	Comments     int // trashed comments, with their replies and the comments of purged posts
+	EmailChanges int // expired email change confirmations
+	Drafts       int // stale review drafts
+}
+
+// Total is how many rows were purged in all
+func (r PurgeReport) Total() int {
+	return r.Posts + r.Comments + r.EmailChanges + r.Drafts
+}
+
+// String summarizes the report for logs and the audit log
+func (r PurgeReport) String() string {
+	return fmt.Sprintf("%d trashed posts, %d comments, %d expired email changes, %d stale drafts",
+		r.Posts, r.Comments, r.EmailChanges, r.Drafts)
+}
+
+// PurgeRetained permanently deletes what the retention policy in cfg no
+// longer keeps, as of now: posts and comments trashed more than TrashDays
+// ago, review drafts older than DraftDays and expired email change
+// confirmations. Threads merged into others stay, as do threads others were
+// merged into, so the merged threads' URLs keep redirecting. With DryRun
+// nothing is deleted, but the report counts what would have been.
+func (db *DB) PurgeRetained(ctx context.Context, cfg config.Retention, now time.Time) (PurgeReport, error) {
+	var report PurgeReport
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		var exec purgeExec = func(count *int, query string, args ...interface{}) error {
+			result, err := tx.ExecContext(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if count != nil {
+				*count += int(n)
+			}
+			return nil
+		}
+
+		if cfg.TrashDays > 0 {
+			trashedBefore := db.dialect.timeArg(now.AddDate(0, 0, -cfg.TrashDays))
+			if err := db.purgeTrashedPosts(exec, trashedBefore, &report); err != nil {
+				return err
+			}
+			if err := db.purgeTrashedComments(exec, trashedBefore, &report); err != nil {
+				return err
+			}
+		}
+
+		if err := exec(&report.EmailChanges, "DELETE FROM email_changes WHERE expires_at < ?", db.dialect.timeArg(now)); err != nil {
+			return fmt.Errorf("failed to delete expired email changes: %v", err)
+		}
+
+		if cfg.DraftDays > 0 {
+			query := "DELETE FROM review_drafts WHERE created_at < ?"
+			if err := exec(&report.Drafts, query, db.dialect.timeArg(now.AddDate(0, 0, -cfg.DraftDays))); err != nil {
+				return fmt.Errorf("failed to delete stale drafts: %v", err)
+			}
+		}
+
+		if cfg.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	return report, err
+}
+
+// purgeTrashedPosts deletes the posts trashed before a time, with their
+// comments and votes, except those that redirect to or from merged threads
+func (db *DB) purgeTrashedPosts(exec purgeExec, trashedBefore interface{}, report *PurgeReport) error {
+	doomed := `
+		SELECT id FROM posts
+		WHERE deleted_at < ? AND merged_into IS NULL
+		  AND id NOT IN (SELECT merged_into FROM posts WHERE merged_into IS NOT NULL)
+	`
+	steps := []struct {
+		what  string
+		count *int
+		query string
+	}{
+		{"comment likes", nil, "DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM comments WHERE post_id IN (" + doomed + "))"},
+		{"comments", &report.Comments, "DELETE FROM comments WHERE post_id IN (" + doomed + ")"},
+		{"post likes", nil, "DELETE FROM post_likes WHERE post_id IN (" + doomed + ")"},
+		{"thread mutes", nil, "DELETE FROM thread_mutes WHERE post_id IN (" + doomed + ")"},
+		{"thread follows", nil, "DELETE FROM thread_follows WHERE post_id IN (" + doomed + ")"},
+		{"bookmarks", nil, "DELETE FROM bookmarks WHERE post_id IN (" + doomed + ")"},
+		{"posts", &report.Posts, "DELETE FROM posts WHERE id IN (" + doomed + ")"},
+	}
+	for _, step := range steps {
+		if err := exec(step.count, step.query, trashedBefore); err != nil {
+			return fmt.Errorf("failed to delete trashed %s: %v", step.what, err)
+		}
+	}
+	return nil
+}
+
+// purgeTrashedComments deletes the comments trashed before a time, every
+// reply beneath them and their votes
+func (db *DB) purgeTrashedComments(exec purgeExec, trashedBefore interface{}, report *PurgeReport) error {
+	subtrees := `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM comments WHERE deleted_at < ?
+			UNION
+			SELECT c.id FROM comments c JOIN subtree s ON c.parent_id = s.id
+		)
+	`
+	if err := exec(nil, subtrees+"DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM subtree)", trashedBefore); err != nil {
+		return fmt.Errorf("failed to delete trashed comment likes: %v", err)
+	}
+	if err := exec(&report.Comments, subtrees+"DELETE FROM comments WHERE id IN (SELECT id FROM subtree)", trashedBefore); err != nil {
+		return fmt.Errorf("failed to delete trashed comments: %v", err)
+	}
+	return nil
+}
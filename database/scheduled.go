@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"literary-lions/models"
+	"time"
+)
+
+// SchedulePost stores a post to be published at post.PublishAt
+func (db *DB) SchedulePost(ctx context.Context, post *models.ScheduledPost) error {
+	query := `
+		INSERT INTO scheduled_posts (user_id, category_id, book_id, title, content, publish_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	id, err := db.insert(ctx, query, post.UserID, post.CategoryID, post.BookID, post.Title, post.Content, db.dialect.timeArg(post.PublishAt))
+	if err != nil {
+		return err
+	}
+	post.ID = id
+	return nil
+}
+
+// GetScheduledPostsByUser gets a user's posts waiting to be published,
+// soonest first
+func (db *DB) GetScheduledPostsByUser(ctx context.Context, userID int) ([]models.ScheduledPost, error) {
+	query := `
+		SELECT sp.id, sp.user_id, sp.category_id, sp.book_id, sp.title, sp.content,
+		       sp.publish_at, sp.created_at, c.name
+		FROM scheduled_posts sp
+		JOIN categories c ON sp.category_id = c.id
+		WHERE sp.user_id = ?
+		ORDER BY sp.publish_at, sp.id
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.ScheduledPost
+	for rows.Next() {
+		var post models.ScheduledPost
+		if err := rows.Scan(&post.ID, &post.UserID, &post.CategoryID, &post.BookID, &post.Title, &post.Content,
+			&post.PublishAt, &post.CreatedAt, &post.CategoryName); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// CancelScheduledPost deletes one of a user's scheduled posts. It returns
+// sql.ErrNoRows if the user has no scheduled post with that ID.
+func (db *DB) CancelScheduledPost(ctx context.Context, postID, userID int) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM scheduled_posts WHERE id = ? AND user_id = ?", postID, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// PublishDuePosts publishes the scheduled posts whose time has come by
+// moving them into posts, dated when they are published, and returns how
+// many were published. Posts by suspended members wait until they are
+// reinstated.
+func (db *DB) PublishDuePosts(ctx context.Context, now time.Time) (int, error) {
+	published := 0
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT sp.id, sp.user_id, sp.category_id, sp.book_id, sp.title, sp.content
+			FROM scheduled_posts sp
+			JOIN users u ON sp.user_id = u.id
+			WHERE sp.publish_at <= ? AND u.status = 'active'
+			ORDER BY sp.publish_at, sp.id
+		`, db.dialect.timeArg(now))
+		if err != nil {
+			return err
+		}
+		var due []models.ScheduledPost
+		for rows.Next() {
+			var post models.ScheduledPost
+			if err := rows.Scan(&post.ID, &post.UserID, &post.CategoryID, &post.BookID, &post.Title, &post.Content); err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, post)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, post := range due {
+			query := "INSERT INTO posts (title, content, user_id, category_id, book_id) VALUES (?, ?, ?, ?, ?)"
+			if _, err := tx.insert(ctx, query, post.Title, post.Content, post.UserID, post.CategoryID, post.BookID); err != nil {
+				return fmt.Errorf("failed to publish scheduled post %d: %v", post.ID, err)
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM scheduled_posts WHERE id = ?", post.ID); err != nil {
+				return fmt.Errorf("failed to delete scheduled post %d: %v", post.ID, err)
+			}
+		}
+		published = len(due)
+		return nil
+	})
+	return published, err
+}
@@ -0,0 +1,222 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"literary-lions/auth"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SeedOptions controls how much fake data SeedDemoData generates
+type SeedOptions struct {
+	Users    int
+	Posts    int
+	Comments int
+	Likes    int   // split between post and comment votes
+	Seed     int64 // random seed, so runs can be reproduced
+}
+
+// seedPassword is the password of every generated user
+const seedPassword = "password"
+
+var (
+	seedFirstNames = []string{"ada", "bram", "charlotte", "dante", "emily", "fyodor", "george", "harper",
+		"italo", "jane", "kazuo", "leo", "mary", "neil", "octavia", "pablo", "quentin", "ray",
+		"sylvia", "toni", "ursula", "virginia", "walt", "xiaolu", "yasunari", "zadie"}
+	seedBooks = []string{"Pride and Prejudice", "Crime and Punishment", "The Left Hand of Darkness",
+		"One Hundred Years of Solitude", "Beloved", "The Remains of the Day", "Middlemarch",
+		"Invisible Cities", "Dune", "Jane Eyre", "The Master and Margarita", "Kindred", "Ulysses",
+		"Never Let Me Go", "The Name of the Rose", "Frankenstein", "To the Lighthouse", "Dracula",
+		"The Bell Jar", "Moby-Dick", "Snow Country", "White Teeth", "Anna Karenina", "The Hobbit"}
+	seedTitles = []string{"Just finished %s", "Thoughts on %s", "Is %s overrated?",
+		"Reading %s for the first time", "Favourite passage from %s", "%s: book club discussion",
+		"Best translation of %s?", "Re-reading %s after ten years"}
+	seedSentences = []string{
+		"I couldn't put it down once the second half started.",
+		"The prose is dense, but it rewards patience.",
+		"Some of the side characters felt underdeveloped to me.",
+		"The ending completely changed how I read the opening chapters.",
+		"I'd love to hear how others interpreted the final scene.",
+		"It's one of those books that gets better every time you revisit it.",
+		"The historical context makes a big difference here.",
+		"I listened to the audiobook and the narration was excellent.",
+		"Honestly, the pacing in the middle section lost me for a while.",
+		"This one has stayed with me for weeks.",
+	}
+	seedReplies = []string{"Completely agree!", "I read it quite differently, actually.",
+		"Great point about the ending.", "Adding this to my list.", "Have you read anything else by the same author?",
+		"The second read is where it really clicked for me.", "Not for me, but I see the appeal.",
+		"That passage gets me every time."}
+)
+
+// seedComment tracks generated comments so replies can be attached to them
+type seedComment struct {
+	id        int
+	createdAt time.Time
+}
+
+// SeedDemoData fills the database with realistic fake users, posts, nested
+// comments and votes for local development. All generated users share the
+// password "password". Data is written in a single transaction.
+func (db *DB) SeedDemoData(ctx context.Context, opts SeedOptions) error {
+	if opts.Users < 1 {
+		return fmt.Errorf("at least one user is required")
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	now := time.Now()
+	randomTime := func(after time.Time) time.Time {
+		return after.Add(time.Duration(rng.Int63n(int64(now.Sub(after)) + 1)))
+	}
+
+	var categoryIDs []int
+	rows, err := db.QueryContext(ctx, "SELECT id FROM categories")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		categoryIDs = append(categoryIDs, id)
+	}
+	rows.Close()
+	if len(categoryIDs) == 0 {
+		return fmt.Errorf("no categories found; run the server once to create them")
+	}
+
+	// Continue numbering after existing users so seeding can be repeated
+	var maxUserID int
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM users").Scan(&maxUserID); err != nil {
+		return err
+	}
+
+	hashedPassword, err := auth.HashPassword(seedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash seed password: %v", err)
+	}
+
+	return db.WithTx(ctx, func(tx *Tx) error {
+		start := now.AddDate(-1, 0, 0)
+
+		userIDs := make([]int, 0, opts.Users)
+		for i := 0; i < opts.Users; i++ {
+			username := fmt.Sprintf("%s%d", seedFirstNames[rng.Intn(len(seedFirstNames))], maxUserID+i+1)
+			id, err := tx.insert(ctx, "INSERT INTO users (username, email, password, signature, created_at) VALUES (?, ?, ?, ?, ?)",
+				username, username+"@example.com", hashedPassword, "Currently reading "+seedBooks[rng.Intn(len(seedBooks))],
+				db.dialect.timeArg(randomTime(start)))
+			if err != nil {
+				return fmt.Errorf("failed to create user: %v", err)
+			}
+			userIDs = append(userIDs, id)
+		}
+
+		// Generate post times up front so ids follow creation order
+		postTimes := make([]time.Time, opts.Posts)
+		for i := range postTimes {
+			postTimes[i] = randomTime(start)
+		}
+		sort.Slice(postTimes, func(i, j int) bool { return postTimes[i].Before(postTimes[j]) })
+
+		postIDs := make([]int, 0, opts.Posts)
+		for _, createdAt := range postTimes {
+			book := seedBooks[rng.Intn(len(seedBooks))]
+			title := fmt.Sprintf(seedTitles[rng.Intn(len(seedTitles))], book)
+			content := seedParagraph(rng, 2+rng.Intn(5))
+			ts := db.dialect.timeArg(createdAt)
+
+			id, err := tx.insert(ctx, "INSERT INTO posts (title, content, user_id, category_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+				title, content, userIDs[rng.Intn(len(userIDs))], categoryIDs[rng.Intn(len(categoryIDs))], ts, ts)
+			if err != nil {
+				return fmt.Errorf("failed to create post: %v", err)
+			}
+			postIDs = append(postIDs, id)
+		}
+
+		// Comments reply to the post or, some of the time, to an earlier comment
+		commentsByPost := make(map[int][]seedComment)
+		postCreated := make(map[int]time.Time, len(postIDs))
+		for i, id := range postIDs {
+			postCreated[id] = postTimes[i]
+		}
+
+		var commentIDs []int
+		for i := 0; i < opts.Comments && len(postIDs) > 0; i++ {
+			postID := postIDs[rng.Intn(len(postIDs))]
+			existing := commentsByPost[postID]
+
+			var parentID *int
+			after := postCreated[postID]
+			if len(existing) > 0 && rng.Intn(10) < 4 {
+				parent := existing[rng.Intn(len(existing))]
+				parentID = &parent.id
+				after = parent.createdAt
+			}
+
+			content := seedReplies[rng.Intn(len(seedReplies))]
+			if rng.Intn(2) == 0 {
+				content += " " + seedParagraph(rng, 1+rng.Intn(2))
+			}
+			createdAt := randomTime(after)
+
+			id, err := tx.insert(ctx, "INSERT INTO comments (content, user_id, post_id, parent_id, created_at) VALUES (?, ?, ?, ?, ?)",
+				content, userIDs[rng.Intn(len(userIDs))], postID, parentID, db.dialect.timeArg(createdAt))
+			if err != nil {
+				return fmt.Errorf("failed to create comment: %v", err)
+			}
+			commentsByPost[postID] = append(existing, seedComment{id: id, createdAt: createdAt})
+			commentIDs = append(commentIDs, id)
+		}
+
+		// Votes lean positive; each user votes on an item at most once
+		type vote struct{ user, item int }
+		postVotes := make(map[vote]bool)
+		commentVotes := make(map[vote]bool)
+		for i, attempts := 0, 0; i < opts.Likes && attempts < opts.Likes*10; attempts++ {
+			onComment := len(commentIDs) > 0 && (len(postIDs) == 0 || rng.Intn(2) == 0)
+			if !onComment && len(postIDs) == 0 {
+				break
+			}
+
+			userID := userIDs[rng.Intn(len(userIDs))]
+			isLike := rng.Intn(5) > 0
+
+			var err error
+			if onComment {
+				v := vote{userID, commentIDs[rng.Intn(len(commentIDs))]}
+				if commentVotes[v] {
+					continue
+				}
+				commentVotes[v] = true
+				_, err = tx.ExecContext(ctx, "INSERT INTO comment_likes (user_id, comment_id, is_like) VALUES (?, ?, ?)", v.user, v.item, isLike)
+			} else {
+				v := vote{userID, postIDs[rng.Intn(len(postIDs))]}
+				if postVotes[v] {
+					continue
+				}
+				postVotes[v] = true
+				_, err = tx.ExecContext(ctx, "INSERT INTO post_likes (user_id, post_id, is_like) VALUES (?, ?, ?)", v.user, v.item, isLike)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to create vote: %v", err)
+			}
+			i++
+		}
+
+		return nil
+	})
+}
+
+// seedParagraph joins n random sentences
+func seedParagraph(rng *rand.Rand, n int) string {
+	sentences := make([]string, n)
+	for i := range sentences {
+		sentences[i] = seedSentences[rng.Intn(len(seedSentences))]
+	}
+	return strings.Join(sentences, " ")
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"literary-lions/models"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSessionStore keeps login sessions in Redis so several forum instances
+// can share them. Each session is stored under its own key with a TTL
+// matching its expiry, so Redis drops expired sessions by itself.
+type RedisSessionStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisSessionStore connects to the Redis server at url
+// (e.g. "redis://localhost:6379/0")
+func NewRedisSessionStore(ctx context.Context, url string) (*RedisSessionStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %v", err)
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	return &RedisSessionStore{client: client, prefix: "literary-lions:"}, nil
+}
+
+// Close closes the connection to Redis
+func (s *RedisSessionStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisSessionStore) sessionKey(uuid string) string {
+	return s.prefix + "session:" + uuid
+}
+
+func (s *RedisSessionStore) flashKey(uuid string) string {
+	return s.prefix + "flash:" + uuid
+}
+
+func (s *RedisSessionStore) userSessionsKey(userID int) string {
+	return s.prefix + "user_sessions:" + strconv.Itoa(userID)
+}
+
+// CreateSession stores a session until its expiry time
+func (s *RedisSessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("session already expired")
+	}
+
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	// Track the user's sessions so they can all be revoked at once. The set
+	// lives as long as its longest session: a shorter one, such as an
+	// admin's impersonation session, must not cut it short. NX sets the
+	// TTL of a new set, GT only ever extends it (both need Redis 7).
+	userKey := s.userSessionsKey(session.UserID)
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, s.sessionKey(session.UUID), data, ttl)
+	pipe.SAdd(ctx, userKey, session.UUID)
+	pipe.ExpireNX(ctx, userKey, ttl)
+	pipe.ExpireGT(ctx, userKey, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetSessionByUUID returns an unexpired session, or sql.ErrNoRows
+func (s *RedisSessionStore) GetSessionByUUID(ctx context.Context, uuid string) (*models.Session, error) {
+	data, err := s.client.Get(ctx, s.sessionKey(uuid)).Bytes()
+	if err == redis.Nil {
+		return nil, sql.ErrNoRows
+	} else if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// DeleteSession removes a session
+func (s *RedisSessionStore) DeleteSession(ctx context.Context, uuid string) error {
+	return s.client.Del(ctx, s.sessionKey(uuid), s.flashKey(uuid)).Err()
+}
+
+// AddFlash queues a message to show on the session's next page. The queue
+// expires with the session.
+func (s *RedisSessionStore) AddFlash(ctx context.Context, uuid string, flash models.Flash) error {
+	ttl, err := s.client.PTTL(ctx, s.sessionKey(uuid)).Result()
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return sql.ErrNoRows
+	}
+
+	data, err := json.Marshal(flash)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.RPush(ctx, s.flashKey(uuid), data)
+	pipe.PExpire(ctx, s.flashKey(uuid), ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// TakeFlashes returns the messages queued for the session and clears them,
+// so each is shown once
+func (s *RedisSessionStore) TakeFlashes(ctx context.Context, uuid string) ([]models.Flash, error) {
+	pipe := s.client.TxPipeline()
+	queued := pipe.LRange(ctx, s.flashKey(uuid), 0, -1)
+	pipe.Del(ctx, s.flashKey(uuid))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	var flashes []models.Flash
+	for _, data := range queued.Val() {
+		var flash models.Flash
+		if err := json.Unmarshal([]byte(data), &flash); err != nil {
+			return nil, err
+		}
+		flashes = append(flashes, flash)
+	}
+	return flashes, nil
+}
+
+// CleanExpiredSessions is a no-op: Redis expires sessions through their TTL
+func (s *RedisSessionStore) CleanExpiredSessions(ctx context.Context) error {
+	return nil
+}
+
+// DeleteUserSessions removes all of a user's sessions
+func (s *RedisSessionStore) DeleteUserSessions(ctx context.Context, userID int) error {
+	userKey := s.userSessionsKey(userID)
+	uuids, err := s.client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, 2*len(uuids)+1)
+	for _, uuid := range uuids {
+		keys = append(keys, s.sessionKey(uuid), s.flashKey(uuid))
+	}
+	keys = append(keys, userKey)
+
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// Ensure *RedisSessionStore implements SessionStore
+var _ SessionStore = (*RedisSessionStore)(nil)
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"time"
+)
+
+// SiteActivityDays is how many days of activity the site statistics chart,
+// up to and including today
+const SiteActivityDays = 30
+
+// siteContributions selects the created_at of every live post and comment
+const siteContributions = `
+	SELECT p.created_at FROM posts p WHERE p.deleted_at IS NULL
+	UNION ALL
+	SELECT c.created_at
+	FROM comments c
+	JOIN posts p ON p.id = c.post_id
+	WHERE c.deleted_at IS NULL AND p.deleted_at IS NULL`
+
+// GetSiteStats summarizes the activity on the forum: how many active members,
+// posts and comments it has, who joined last, the busiest day ever and how
+// many posts, comments and new members each recent day (in UTC) saw
+func (db *DB) GetSiteStats(ctx context.Context) (*models.SiteStats, error) {
+	stats := &models.SiteStats{}
+
+	err := db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM users WHERE status = 'active'),
+			(SELECT COUNT(*) FROM posts WHERE deleted_at IS NULL),
+			(SELECT COUNT(*) FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.deleted_at IS NULL AND p.deleted_at IS NULL)
+	`).Scan(&stats.Members, &stats.Posts, &stats.Comments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count members, posts and comments: %v", err)
+	}
+
+	err = db.QueryRowContext(ctx, `
+		SELECT username FROM users WHERE status = 'active' ORDER BY created_at DESC, id DESC LIMIT 1
+	`).Scan(&stats.NewestMember)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to find the newest member: %v", err)
+	}
+
+	day := db.dialect.day("a.created_at")
+	var busiest string
+	err = db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT %s AS day, COUNT(*) AS n
+		FROM (%s) a
+		GROUP BY day
+		ORDER BY n DESC, day DESC
+		LIMIT 1
+	`, day, siteContributions)).Scan(&busiest, &stats.BusiestDayPosts)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, fmt.Errorf("failed to find the busiest day: %v", err)
+	default:
+		if stats.BusiestDay, err = time.Parse(time.DateOnly, busiest); err != nil {
+			return nil, fmt.Errorf("failed to parse the busiest day: %v", err)
+		}
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(SiteActivityDays - 1))
+	series := []struct {
+		daily *[]int
+		query string
+	}{
+		{&stats.DailyPosts, `SELECT p.created_at FROM posts p WHERE p.deleted_at IS NULL`},
+		{&stats.DailyComments, `SELECT c.created_at FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.deleted_at IS NULL AND p.deleted_at IS NULL`},
+		{&stats.DailyMembers, `SELECT u.created_at FROM users u WHERE u.status = 'active'`},
+	}
+	for _, s := range series {
+		if *s.daily, err = db.dailyCounts(ctx, s.query, since); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// dailyCounts counts the rows of query, which selects a created_at column,
+// on each of the SiteActivityDays days from since
+func (db *DB) dailyCounts(ctx context.Context, query string, since time.Time) ([]int, error) {
+	day := db.dialect.day("a.created_at")
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s AS day, COUNT(*)
+		FROM (%s) a
+		WHERE a.created_at >= ?
+		GROUP BY day
+	`, day, query), db.dialect.timeArg(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count daily activity: %v", err)
+	}
+	defer rows.Close()
+
+	daily := make([]int, SiteActivityDays)
+	for rows.Next() {
+		var date string
+		var n int
+		if err := rows.Scan(&date, &n); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse day %q: %v", date, err)
+		}
+		if i := int(t.Sub(since).Hours() / 24); i >= 0 && i < SiteActivityDays {
+			daily[i] += n
+		}
+	}
+	return daily, rows.Err()
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// SetSlowQueryThreshold logs every statement that takes longer than d, with
+// its SQL, a summary of its arguments and the code that ran it. A threshold of
+// zero turns slow query logging off. It should be called before the database
+// is shared between goroutines.
+func (db *DB) SetSlowQueryThreshold(d time.Duration) {
+	db.slowQuery = d
+}
+
+// logSlowQuery logs query if it has been running since start for longer than
+// threshold. For queries returning rows only the time until the first row is
+// available is measured.
+func logSlowQuery(ctx context.Context, threshold time.Duration, start time.Time, query string, args []interface{}) {
+	if threshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed < threshold {
+		return
+	}
+
+	slog.WarnContext(ctx, "slow query",
+		"elapsed", elapsed.Round(time.Microsecond),
+		"caller", queryCaller(),
+		"query", strings.Join(strings.Fields(query), " "),
+		"args", summarizeArgs(args))
+}
+
+// queryCaller returns the function and line that issued the query, skipping
+// the query wrappers in this package
+func queryCaller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasSuffix(frame.File, "/database/dialect.go") &&
+			!strings.HasSuffix(frame.File, "/database/slowlog.go") &&
+			!strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s (%s:%d)", frame.Function, trimPath(frame.File), frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// trimPath shortens a source path to its package directory and file name
+func trimPath(file string) string {
+	if i := strings.LastIndex(file, "/"); i > 0 {
+		if j := strings.LastIndex(file[:i], "/"); j >= 0 {
+			return file[j+1:]
+		}
+	}
+	return file
+}
+
+// summarizeArgs describes query arguments without exposing user data such as
+// session tokens or password hashes: strings and byte slices are reduced to
+// their length
+func summarizeArgs(args []interface{}) string {
+	if len(args) == 0 {
+		return "none"
+	}
+
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			parts[i] = "NULL"
+		case string:
+			parts[i] = fmt.Sprintf("string(%d)", len(v))
+		case []byte:
+			parts[i] = fmt.Sprintf("bytes(%d)", len(v))
+		case time.Time:
+			parts[i] = v.Format(time.RFC3339)
+		default:
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+)
+
+// maxCachedStatements bounds the statement cache; queries beyond this are
+// executed without preparing
+const maxCachedStatements = 256
+
+// stmtCache holds prepared statements keyed by their (rebound) SQL text, so
+// frequently used queries are parsed once and reused across requests
+type stmtCache struct {
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache() *stmtCache {
+	return &stmtCache{stmts: make(map[string]*sql.Stmt)}
+}
+
+// cacheable reports whether a query is a single data statement worth preparing.
+// Schema changes and multi-statement scripts (migrations) are run directly.
+func cacheable(query string) bool {
+	trimmed := strings.TrimSpace(query)
+	if strings.Contains(strings.TrimSuffix(trimmed, ";"), ";") {
+		return false
+	}
+
+	keyword, _, _ := strings.Cut(trimmed, " ")
+	switch strings.ToUpper(strings.TrimSpace(keyword)) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH":
+		return true
+	default:
+		return false
+	}
+}
+
+// get returns a prepared statement for query, preparing and caching it on
+// first use. It returns nil when the query should not or cannot be cached.
+func (c *stmtCache) get(ctx context.Context, db *sql.DB, query string) *sql.Stmt {
+	if !cacheable(query) {
+		return nil
+	}
+
+	c.mu.RLock()
+	stmt, ok := c.stmts[query]
+	full := len(c.stmts) >= maxCachedStatements
+	c.mu.RUnlock()
+
+	if ok {
+		return stmt
+	}
+	if full {
+		return nil
+	}
+
+	// Prepare outside the lock; the statement is not tied to ctx once prepared
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.stmts[query]; ok {
+		// Another request prepared it first
+		stmt.Close()
+		return existing
+	}
+
+	c.stmts[query] = stmt
+	return stmt
+}
+
+// close closes all cached statements
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for query, stmt := range c.stmts {
+		stmt.Close()
+		delete(c.stmts, query)
+	}
+}
@@ -0,0 +1,378 @@
+package database
+
+import (
+	"context"
+	"literary-lions/config"
+	"literary-lions/models"
+	"time"
+)
+
+// Store is the storage interface the HTTP handlers depend on. *DB is the
+// production implementation; other implementations (such as in-memory fakes
+// for tests) must return sql.ErrNoRows when a single record is not found.
+type Store interface {
+	UserStore
+	SessionStore
+	CategoryStore
+	PostStore
+	CommentStore
+	LikeStore
+	BookStore
+	TrashStore
+	FeatureFlagStore
+	ActivityStore
+	MessageStore
+	BlockStore
+	LeaderboardStore
+	QuoteStore
+	PreferenceStore
+	PresenceStore
+	WallStore
+	TitleStore
+	YearInBooksStore
+	EmailChangeStore
+	ThreadMuteStore
+	FollowStore
+	ScheduledPostStore
+	PageVersionStore
+	AuditStore
+	ModerationStore
+}
+
+// UserStore manages user accounts
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	UpdateUserProfile(ctx context.Context, user *models.User) error
+	CheckUserExists(ctx context.Context, email, username string) (bool, bool, error)
+	ChangeUsername(ctx context.Context, userID int, newUsername string) error
+	GetUsernameHistory(ctx context.Context, userID int) ([]models.UsernameChange, error)
+	GetRenamedUsername(ctx context.Context, oldUsername string) (string, error)
+	DeleteUser(ctx context.Context, userID int) error
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+	SuspendUser(ctx context.Context, userID int, reason string) error
+	UnsuspendUser(ctx context.Context, userID int) error
+	DeactivateUser(ctx context.Context, userID int) error
+	ReactivateUser(ctx context.Context, userID int) error
+	GetUserStats(ctx context.Context, userID int) (int, int, int, error)
+	UpdateTrustLevels(ctx context.Context, cfg config.Trust, now time.Time) (int, error)
+	PurgeRetained(ctx context.Context, cfg config.Retention, now time.Time) (PurgeReport, error)
+}
+
+// SessionStore manages login sessions and the flash messages queued on
+// them
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSessionByUUID(ctx context.Context, uuid string) (*models.Session, error)
+	DeleteSession(ctx context.Context, uuid string) error
+	CleanExpiredSessions(ctx context.Context) error
+	AddFlash(ctx context.Context, uuid string, flash models.Flash) error
+	TakeFlashes(ctx context.Context, uuid string) ([]models.Flash, error)
+}
+
+// CategoryStore manages post categories and their hierarchy
+type CategoryStore interface {
+	GetAllCategories(ctx context.Context) ([]models.Category, error)
+	GetCategoryByID(ctx context.Context, id int) (*models.Category, error)
+	CreateCategory(ctx context.Context, category *models.Category) error
+	UpdateCategory(ctx context.Context, category *models.Category) error
+	GetCategoryStats(ctx context.Context, categoryID int) (*models.CategoryStats, error)
+}
+
+// PostStore manages posts and post listings
+type PostStore interface {
+	CreatePost(ctx context.Context, post *models.Post) error
+	GetPostByID(ctx context.Context, id int) (*models.Post, error)
+	UpdatePost(ctx context.Context, postID int, title, content string, loadedUpdatedAt, now time.Time) error
+	GetAllPosts(ctx context.Context) ([]models.Post, error)
+	GetPostsByCategory(ctx context.Context, categoryID int) ([]models.Post, error)
+	GetPostsByUser(ctx context.Context, userID int) ([]models.Post, error)
+	GetLikedPostsByUser(ctx context.Context, userID int) ([]models.Post, error)
+	GetPostsWithSorting(ctx context.Context, sortBy, sortOrder string) ([]models.Post, error)
+	GetPostsByCategoryWithSorting(ctx context.Context, categoryID int, sortBy, sortOrder string) ([]models.Post, error)
+	GetPostsByUserWithSorting(ctx context.Context, userID int, sortBy, sortOrder string) ([]models.Post, error)
+	GetLikedPostsByUserWithSorting(ctx context.Context, userID int, sortBy, sortOrder string) ([]models.Post, error)
+	GetPostsWithSuspendedFilter(ctx context.Context, showSuspended bool) ([]models.Post, error)
+	GetPostsWithSuspendedFilterAndSorting(ctx context.Context, showSuspended bool, sortBy, sortOrder string) ([]models.Post, error)
+	GetPostsBetweenWithSorting(ctx context.Context, from, to time.Time, showSuspended bool, sortBy, sortOrder string) ([]models.Post, error)
+	GetPostMonths(ctx context.Context, showSuspended bool) ([]models.ArchiveMonth, error)
+	GetRandomPostID(ctx context.Context, categoryID int) (int, error)
+	GetTopPosts(ctx context.Context, since time.Time, showSuspended bool, limit int) ([]models.Post, error)
+	SearchPosts(ctx context.Context, searchTerm string, limit int) ([]models.Post, error)
+	SearchPostSuggestions(ctx context.Context, searchTerm string, limit int) ([]models.Post, error)
+	GetPostsPage(ctx context.Context, q PostPageQuery) ([]models.Post, string, error)
+}
+
+// CommentStore manages comments
+type CommentStore interface {
+	CreateComment(ctx context.Context, comment *models.Comment) error
+	GetCommentByID(ctx context.Context, id int) (*models.Comment, error)
+	UpdateComment(ctx context.Context, commentID int, content string, loadedUpdatedAt, now time.Time) error
+	GetCommentsByPostID(ctx context.Context, postID int) ([]models.Comment, error)
+	GetCommentsByUser(ctx context.Context, userID int) ([]models.Comment, error)
+	GetCommentsWithSuspendedFilter(ctx context.Context, postID int, showSuspended bool) ([]models.Comment, error)
+}
+
+// LikeStore manages likes and dislikes on posts and comments
+type LikeStore interface {
+	LikePost(ctx context.Context, userID, postID int, isLike bool) error
+	LikeComment(ctx context.Context, userID, commentID int, isLike bool) error
+	GetPostLikeStatus(ctx context.Context, userID, postID int) (bool, bool, error)
+	GetCommentLikeStatus(ctx context.Context, userID, commentID int) (bool, bool, error)
+	GetPostVotes(ctx context.Context, postID int) (int, int, error)
+	GetCommentVotes(ctx context.Context, commentID int) (int, int, error)
+}
+
+// BookStore manages books and users' reading lists
+type BookStore interface {
+	FindOrCreateBook(ctx context.Context, book *models.Book) error
+	GetBookByID(ctx context.Context, id int) (*models.Book, error)
+	GetBookRating(ctx context.Context, bookID int) (float64, int, error)
+	GetPostsByBook(ctx context.Context, bookID int, showSuspended bool) ([]models.Post, error)
+	SaveShelfEntry(ctx context.Context, entry *models.ShelfEntry) error
+	GetShelfEntriesByUser(ctx context.Context, userID int) ([]models.ShelfEntry, error)
+	MoveShelfEntry(ctx context.Context, userID, bookID int, shelf string) error
+	RemoveShelfEntry(ctx context.Context, userID, bookID int) error
+	SetCurrentlyReading(ctx context.Context, userID, bookID int) error
+	GetCurrentlyReading(ctx context.Context, userIDs []int) (map[int]models.Book, error)
+	CreateReviewDraft(ctx context.Context, draft *models.ReviewDraft) error
+	HasReviewed(ctx context.Context, userID, bookID int) (bool, error)
+	GetBookLinks(ctx context.Context, urls []string) (map[string]models.BookLink, error)
+	SaveBookLink(ctx context.Context, url string, bookID int) error
+}
+
+// TrashStore soft-deletes posts and comments, merges duplicate threads and
+// manages the trash
+type TrashStore interface {
+	TrashPost(ctx context.Context, postID, deletedBy int, reason string) error
+	RestorePost(ctx context.Context, postID int) error
+	PurgePost(ctx context.Context, postID int) error
+	TrashComment(ctx context.Context, commentID, deletedBy int, reason string) error
+	RestoreComment(ctx context.Context, commentID int) error
+	PurgeComment(ctx context.Context, commentID int) error
+	GetTrashedPosts(ctx context.Context) ([]models.TrashItem, error)
+	GetTrashedComments(ctx context.Context) ([]models.TrashItem, error)
+	TrashUserContent(ctx context.Context, userID, deletedBy int, reason string, since, until time.Time) (UserContentReport, error)
+	PurgeUserContent(ctx context.Context, userID, deletedBy int, reason string, since, until time.Time) (UserContentReport, error)
+	MergePost(ctx context.Context, sourceID, targetID, mergedBy int, now time.Time) (int, error)
+	GetMergedInto(ctx context.Context, postID int) (int, error)
+}
+
+// FeatureFlagStore keeps the feature flags admins have set
+type FeatureFlagStore interface {
+	GetFeatureFlags(ctx context.Context) (map[string]bool, error)
+	SetFeatureFlag(ctx context.Context, name string, enabled bool) error
+}
+
+// ActivityStore reads users' activity timelines and when they last posted
+type ActivityStore interface {
+	GetUserActivity(ctx context.Context, q ActivityPageQuery) ([]models.Activity, string, error)
+	GetLastContributions(ctx context.Context, userID int) (lastPost, lastComment time.Time, err error)
+}
+
+// MessageStore manages private conversations between members
+type MessageStore interface {
+	GetConversations(ctx context.Context, userID int) ([]models.Conversation, error)
+	GetConversation(ctx context.Context, conversationID, userID int) (*models.Conversation, error)
+	GetMessages(ctx context.Context, conversationID int) ([]models.Message, error)
+	SendMessage(ctx context.Context, message *models.Message, recipientID int) error
+	MarkConversationRead(ctx context.Context, conversationID, userID int) error
+	CountUnreadMessages(ctx context.Context, userID int) (int, error)
+}
+
+// BlockStore manages the members users have blocked
+type BlockStore interface {
+	BlockUser(ctx context.Context, blockerID, blockedID int) error
+	UnblockUser(ctx context.Context, blockerID, blockedID int) error
+	GetBlockedUserIDs(ctx context.Context, blockerID int) (map[int]bool, error)
+	GetBlockedUsers(ctx context.Context, blockerID int) ([]models.User, error)
+	IsBlockedEitherWay(ctx context.Context, userID, otherID int) (bool, error)
+}
+
+// WallStore manages the messages members leave on profile walls
+type WallStore interface {
+	GetWallPage(ctx context.Context, q WallPageQuery) ([]models.WallPost, string, error)
+	GetWallPostByID(ctx context.Context, postID int) (*models.WallPost, error)
+	CreateWallPost(ctx context.Context, post *models.WallPost) error
+	DeleteWallPost(ctx context.Context, postID int) error
+	CountNewWallPosts(ctx context.Context, userID int) (int, error)
+	MarkWallSeen(ctx context.Context, userID int) error
+}
+
+// TitleStore manages the titles shown next to members' names
+type TitleStore interface {
+	GetTitleLadder(ctx context.Context) ([]models.UserTitle, error)
+	CreateUserTitle(ctx context.Context, title *models.UserTitle) error
+	DeleteUserTitle(ctx context.Context, titleID int) error
+	GetUserTitles(ctx context.Context, userIDs []int) (map[int]string, error)
+	GetStaffTitles(ctx context.Context) ([]models.StaffTitle, error)
+	SetCustomTitle(ctx context.Context, userID int, title string) error
+}
+
+// YearInBooksStore sums up members' years on the forum
+type YearInBooksStore interface {
+	GetYearInBooks(ctx context.Context, userID, year int) (*models.YearInBooks, error)
+}
+
+// EmailChangeStore manages changes of members' email addresses, which wait
+// for them to confirm the new address
+type EmailChangeStore interface {
+	RequestEmailChange(ctx context.Context, change *models.EmailChange, token string) error
+	GetPendingEmailChange(ctx context.Context, userID int) (*models.EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, token string) (*models.EmailChange, error)
+	CancelEmailChange(ctx context.Context, userID int) error
+}
+
+// ThreadMuteStore manages the threads members muted and finds who to
+// notify about replies
+type ThreadMuteStore interface {
+	MuteThread(ctx context.Context, userID, postID int) error
+	UnmuteThread(ctx context.Context, userID, postID int) error
+	IsThreadMuted(ctx context.Context, userID, postID int) (bool, error)
+	GetReplyRecipients(ctx context.Context, postID, authorID int) ([]models.User, error)
+}
+
+// FollowStore manages the threads members follow and the posts they
+// bookmarked
+type FollowStore interface {
+	FollowThread(ctx context.Context, userID, postID int) error
+	UnfollowThread(ctx context.Context, userID, postID int) error
+	IsFollowingThread(ctx context.Context, userID, postID int) (bool, error)
+	BookmarkPost(ctx context.Context, userID, postID int) error
+	UnbookmarkPost(ctx context.Context, userID, postID int) error
+	IsBookmarked(ctx context.Context, userID, postID int) (bool, error)
+	GetBookmarkedPostsByUserWithSorting(ctx context.Context, userID int, sortBy, sortOrder string) ([]models.Post, error)
+}
+
+// ScheduledPostStore manages posts waiting to be published at a later time
+type ScheduledPostStore interface {
+	SchedulePost(ctx context.Context, post *models.ScheduledPost) error
+	GetScheduledPostsByUser(ctx context.Context, userID int) ([]models.ScheduledPost, error)
+	CancelScheduledPost(ctx context.Context, postID, userID int) error
+	PublishDuePosts(ctx context.Context, now time.Time) (int, error)
+}
+
+// PageVersionStore reports when the data behind cacheable pages last
+// changed, for answering conditional requests without rendering them
+type PageVersionStore interface {
+	GetPostVersion(ctx context.Context, postID int) (models.PageVersion, error)
+	GetPostsVersion(ctx context.Context) (models.PageVersion, error)
+}
+
+// PresenceStore tracks when members were last active
+type PresenceStore interface {
+	TouchLastSeen(ctx context.Context, userID int, at time.Time) error
+	GetLastSeen(ctx context.Context, userID int) (*time.Time, error)
+	CountOnlineUsers(ctx context.Context, since time.Time) (int, error)
+}
+
+// PreferenceStore keeps members' settings
+type PreferenceStore interface {
+	GetPreferences(ctx context.Context, userID int) (*models.Preferences, error)
+	SavePreferences(ctx context.Context, prefs *models.Preferences) error
+}
+
+// LeaderboardStore ranks top contributors and sums up the forum's activity
+type LeaderboardStore interface {
+	GetLeaderboard(ctx context.Context, window string) (*models.Leaderboard, error)
+	GetSiteStats(ctx context.Context) (*models.SiteStats, error)
+}
+
+// AuditStore keeps the audit log of security-relevant and moderation
+// actions
+type AuditStore interface {
+	AddAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	GetAuditLog(ctx context.Context, limit int) ([]models.AuditEntry, error)
+}
+
+// ModerationStore keeps the posts and comments held for a moderator and the
+// canned reasons moderators give
+type ModerationStore interface {
+	HoldContent(ctx context.Context, held *models.HeldContent) error
+	GetHeldContent(ctx context.Context) ([]models.HeldContent, error)
+	GetHeldContentByID(ctx context.Context, id int) (*models.HeldContent, error)
+	DeleteHeldContent(ctx context.Context, id int) error
+	CountHeldContent(ctx context.Context) (int, error)
+	CountDuplicates(ctx context.Context, content string, since time.Time) (int, error)
+	GetModerationReasons(ctx context.Context) ([]models.ModerationReason, error)
+	CreateModerationReason(ctx context.Context, reason *models.ModerationReason) error
+	DeleteModerationReason(ctx context.Context, reasonID int) error
+}
+
+// Ensure *DB implements Store
+var _ Store = (*DB)(nil)
+
+// WithSessionStore returns a Store that keeps sessions in sessions and
+// everything else in store
+func WithSessionStore(store Store, sessions SessionStore) Store {
+	return &splitSessionStore{Store: store, sessions: sessions}
+}
+
+type splitSessionStore struct {
+	Store
+	sessions SessionStore
+}
+
+func (s *splitSessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	return s.sessions.CreateSession(ctx, session)
+}
+
+func (s *splitSessionStore) GetSessionByUUID(ctx context.Context, uuid string) (*models.Session, error) {
+	return s.sessions.GetSessionByUUID(ctx, uuid)
+}
+
+func (s *splitSessionStore) DeleteSession(ctx context.Context, uuid string) error {
+	return s.sessions.DeleteSession(ctx, uuid)
+}
+
+func (s *splitSessionStore) CleanExpiredSessions(ctx context.Context) error {
+	return s.sessions.CleanExpiredSessions(ctx)
+}
+
+func (s *splitSessionStore) AddFlash(ctx context.Context, uuid string, flash models.Flash) error {
+	return s.sessions.AddFlash(ctx, uuid, flash)
+}
+
+func (s *splitSessionStore) TakeFlashes(ctx context.Context, uuid string) ([]models.Flash, error) {
+	return s.sessions.TakeFlashes(ctx, uuid)
+}
+
+// DeleteUser deletes the user and, when the session store supports it,
+// revokes the user's sessions there too
+func (s *splitSessionStore) DeleteUser(ctx context.Context, userID int) error {
+	if err := s.Store.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.revokeSessions(ctx, userID)
+}
+
+// DeactivateUser deactivates the user and, when the session store supports
+// it, revokes the user's sessions there too
+func (s *splitSessionStore) DeactivateUser(ctx context.Context, userID int) error {
+	if err := s.Store.DeactivateUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.revokeSessions(ctx, userID)
+}
+
+// revokeSessions deletes all of a user's sessions from the session store,
+// if it supports that
+func (s *splitSessionStore) revokeSessions(ctx context.Context, userID int) error {
+	if revoker, ok := s.sessions.(interface {
+		DeleteUserSessions(ctx context.Context, userID int) error
+	}); ok {
+		return revoker.DeleteUserSessions(ctx, userID)
+	}
+	return nil
+}
+
+// QuoteStore manages the passages members share from books
+type QuoteStore interface {
+	GetQuotesPage(ctx context.Context, q QuotePageQuery) ([]models.Quote, string, error)
+	GetQuoteByID(ctx context.Context, quoteID, viewerID int) (*models.Quote, error)
+	CreateQuote(ctx context.Context, quote *models.Quote) error
+	DeleteQuote(ctx context.Context, quoteID int) error
+	ToggleQuoteLike(ctx context.Context, userID, quoteID int) error
+}
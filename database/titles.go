@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"literary-lions/models"
+	"strings"
+	"time"
+)
+
+// GetTitleLadder gets the titles members can earn, lowest first
+func (db *DB) GetTitleLadder(ctx context.Context) ([]models.UserTitle, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, name, min_posts, min_days FROM user_titles ORDER BY min_posts, min_days, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ladder []models.UserTitle
+	for rows.Next() {
+		var title models.UserTitle
+		if err := rows.Scan(&title.ID, &title.Name, &title.MinPosts, &title.MinDays); err != nil {
+			return nil, err
+		}
+		ladder = append(ladder, title)
+	}
+	return ladder, rows.Err()
+}
+
+// CreateUserTitle adds a title to the ladder
+func (db *DB) CreateUserTitle(ctx context.Context, title *models.UserTitle) error {
+	query := "INSERT INTO user_titles (name, min_posts, min_days) VALUES (?, ?, ?)"
+	id, err := db.insert(ctx, query, title.Name, title.MinPosts, title.MinDays)
+	if err != nil {
+		return err
+	}
+	title.ID = id
+	return nil
+}
+
+// DeleteUserTitle takes a title off the ladder. Returns sql.ErrNoRows if
+// there is no such title.
+func (db *DB) DeleteUserTitle(ctx context.Context, titleID int) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM user_titles WHERE id = ?", titleID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserTitles gets the titles shown for the given users, keyed by user ID:
+// a staff member's custom title, or else the highest title they earned.
+// Users without a title are left out.
+func (db *DB) GetUserTitles(ctx context.Context, userIDs []int) (map[int]string, error) {
+	titles := make(map[int]string)
+	if len(userIDs) == 0 {
+		return titles, nil
+	}
+
+	ladder, err := db.GetTitleLadder(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(userIDs)), ", ")
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	query := `
+		SELECT u.id, u.role, u.custom_title, u.created_at,
+		       (SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id AND p.deleted_at IS NULL)
+		FROM users u
+		WHERE u.id IN (` + placeholders + `)
+	`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	for rows.Next() {
+		var userID, posts int
+		var role, custom string
+		var createdAt time.Time
+		if err := rows.Scan(&userID, &role, &custom, &createdAt, &posts); err != nil {
+			return nil, err
+		}
+		title := custom
+		if role != "admin" || title == "" {
+			title = models.EarnedTitle(ladder, posts, int(now.Sub(createdAt).Hours()/24))
+		}
+		if title != "" {
+			titles[userID] = title
+		}
+	}
+	return titles, rows.Err()
+}
+
+// GetStaffTitles gets the custom titles of the staff, by username
+func (db *DB) GetStaffTitles(ctx context.Context) ([]models.StaffTitle, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, username, custom_title FROM users WHERE role = 'admin' ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var staff []models.StaffTitle
+	for rows.Next() {
+		var s models.StaffTitle
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Title); err != nil {
+			return nil, err
+		}
+		staff = append(staff, s)
+	}
+	return staff, rows.Err()
+}
+
+// SetCustomTitle sets a staff member's custom title; an empty title shows
+// their earned one again. Returns sql.ErrNoRows if the user isn't staff.
+func (db *DB) SetCustomTitle(ctx context.Context, userID int, title string) error {
+	result, err := db.ExecContext(ctx, "UPDATE users SET custom_title = ? WHERE id = ? AND role = 'admin'", title, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"time"
+)
+
+// Posts and comments are soft-deleted by setting deleted_at and deleted_by.
+// Public queries skip trashed rows; admins can restore them from the trash
+// or purge them for good, except threads merged into others, which stay to
+// redirect to them. deleted_at keeps full precision because replies
+// trashed along with a comment are recognised by sharing its deleted_at.
+
+// commentSubtree selects a comment and every reply beneath it
+const commentSubtree = `
+	WITH RECURSIVE subtree(id) AS (
+		SELECT id FROM comments WHERE id = ?
+		UNION
+		SELECT c.id FROM comments c JOIN subtree s ON c.parent_id = s.id
+	)
+`
+
+// TrashPost moves a post to the trash, with the reason a moderator gave
+func (db *DB) TrashPost(ctx context.Context, postID, deletedBy int, reason string) error {
+	query := "UPDATE posts SET deleted_at = ?, deleted_by = ?, removal_reason = ? WHERE id = ? AND deleted_at IS NULL"
+	result, err := db.ExecContext(ctx, query, time.Now().UTC(), deletedBy, reason, postID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// RestorePost takes a post out of the trash
+func (db *DB) RestorePost(ctx context.Context, postID int) error {
+	query := "UPDATE posts SET deleted_at = NULL, deleted_by = NULL, removal_reason = '' WHERE id = ? AND deleted_at IS NOT NULL AND merged_into IS NULL"
+	result, err := db.ExecContext(ctx, query, postID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// PurgePost permanently deletes a trashed post with its comments and votes.
+// Threads that were merged into it stay in the trash, no longer redirecting,
+// so they can still be restored or purged themselves.
+func (db *DB) PurgePost(ctx context.Context, postID int) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		var id int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM posts WHERE id = ? AND deleted_at IS NOT NULL AND merged_into IS NULL", postID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM comment_likes
+			WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)
+		`, postID)
+		if err != nil {
+			return fmt.Errorf("failed to delete comment likes: %v", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM comments WHERE post_id = ?", postID); err != nil {
+			return fmt.Errorf("failed to delete comments: %v", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM post_likes WHERE post_id = ?", postID); err != nil {
+			return fmt.Errorf("failed to delete post likes: %v", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM thread_mutes WHERE post_id = ?", postID); err != nil {
+			return fmt.Errorf("failed to delete thread mutes: %v", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM thread_follows WHERE post_id = ?", postID); err != nil {
+			return fmt.Errorf("failed to delete thread follows: %v", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM bookmarks WHERE post_id = ?", postID); err != nil {
+			return fmt.Errorf("failed to delete bookmarks: %v", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, "UPDATE posts SET merged_into = NULL WHERE merged_into = ?", postID); err != nil {
+			return fmt.Errorf("failed to clear merges into the post: %v", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM posts WHERE id = ?", postID); err != nil {
+			return fmt.Errorf("failed to delete post: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// TrashComment moves a comment and the replies beneath it to the trash, with
+// the reason a moderator gave
+func (db *DB) TrashComment(ctx context.Context, commentID, deletedBy int, reason string) error {
+	query := commentSubtree + `
+		UPDATE comments SET deleted_at = ?, deleted_by = ?, removal_reason = ?
+		WHERE id IN (SELECT id FROM subtree) AND deleted_at IS NULL
+	`
+	result, err := db.ExecContext(ctx, query, commentID, time.Now().UTC(), deletedBy, reason)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// RestoreComment takes a comment out of the trash along with the replies
+// that were trashed with it
+func (db *DB) RestoreComment(ctx context.Context, commentID int) error {
+	var deletedAt time.Time
+	err := db.QueryRowContext(ctx, "SELECT deleted_at FROM comments WHERE id = ? AND deleted_at IS NOT NULL", commentID).Scan(&deletedAt)
+	if err != nil {
+		return err
+	}
+
+	query := commentSubtree + `
+		UPDATE comments SET deleted_at = NULL, deleted_by = NULL, removal_reason = ''
+		WHERE id IN (SELECT id FROM subtree) AND deleted_at = ?
+	`
+	_, err = db.ExecContext(ctx, query, commentID, deletedAt)
+	return err
+}
+
+// PurgeComment permanently deletes a trashed comment, every reply beneath it
+// and their votes
+func (db *DB) PurgeComment(ctx context.Context, commentID int) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		var id int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM comments WHERE id = ? AND deleted_at IS NOT NULL", commentID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, commentSubtree+`
+			DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM subtree)
+		`, commentID)
+		if err != nil {
+			return fmt.Errorf("failed to delete comment likes: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, commentSubtree+`
+			DELETE FROM comments WHERE id IN (SELECT id FROM subtree)
+		`, commentID)
+		if err != nil {
+			return fmt.Errorf("failed to delete comments: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// GetTrashedPosts lists trashed posts, most recently trashed first
+func (db *DB) GetTrashedPosts(ctx context.Context) ([]models.TrashItem, error) {
+	query := `
+		SELECT p.id, p.id, p.title, p.content, u.username, p.deleted_at, COALESCE(d.username, ''), p.removal_reason
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		LEFT JOIN users d ON p.deleted_by = d.id
+		WHERE p.deleted_at IS NOT NULL AND p.merged_into IS NULL
+		ORDER BY p.deleted_at DESC
+	`
+	return db.executeTrashItems(ctx, query)
+}
+
+// GetTrashedComments lists trashed comments, most recently trashed first.
+// Replies trashed together with their parent are not listed separately.
+func (db *DB) GetTrashedComments(ctx context.Context) ([]models.TrashItem, error) {
+	query := `
+		SELECT c.id, c.post_id, p.title, c.content, u.username, c.deleted_at, COALESCE(d.username, ''), c.removal_reason
+		FROM comments c
+		JOIN posts p ON c.post_id = p.id
+		JOIN users u ON c.user_id = u.id
+		LEFT JOIN users d ON c.deleted_by = d.id
+		WHERE c.deleted_at IS NOT NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM comments pc
+			WHERE pc.id = c.parent_id AND pc.deleted_at = c.deleted_at
+		)
+		ORDER BY c.deleted_at DESC
+	`
+	return db.executeTrashItems(ctx, query)
+}
+
+func (db *DB) executeTrashItems(ctx context.Context, query string) ([]models.TrashItem, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.TrashItem
+	for rows.Next() {
+		var item models.TrashItem
+		err := rows.Scan(&item.ID, &item.PostID, &item.PostTitle, &item.Content,
+			&item.Username, &item.DeletedAt, &item.DeletedBy, &item.Reason)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// requireAffected returns sql.ErrNoRows if a statement changed no rows
+func requireAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"literary-lions/config"
+	"literary-lions/models"
+	"time"
+)
+
+// contributionsQuery counts a user's posts and comments that are not deleted
+const contributionsQuery = `
+	(SELECT COUNT(*) FROM posts WHERE user_id = users.id AND deleted_at IS NULL)
+	+ (SELECT COUNT(*) FROM comments WHERE user_id = users.id AND deleted_at IS NULL)
+`
+
+// UpdateTrustLevels promotes the members whose account age and posts and
+// comments, as of now, reach the thresholds in cfg, returning how many
+// promotions were made. Members are never demoted, so deleting their
+// contributions later keeps the level they earned.
+func (db *DB) UpdateTrustLevels(ctx context.Context, cfg config.Trust, now time.Time) (int, error) {
+	promoted := 0
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		// One level at a time, so members who reach both thresholds at once
+		// become members and then regulars
+		for _, step := range []struct {
+			from, to      string
+			age           time.Duration
+			contributions int
+		}{
+			{models.TrustNew, models.TrustMember, cfg.MemberAge, cfg.MemberContributions},
+			{models.TrustMember, models.TrustRegular, cfg.RegularAge, cfg.RegularContributions},
+		} {
+			query := `
+				UPDATE users SET trust_level = ?
+				WHERE trust_level = ? AND created_at <= ? AND ` + contributionsQuery + ` >= ?
+			`
+			result, err := tx.ExecContext(ctx, query, step.to, step.from, db.dialect.timeArg(now.Add(-step.age)), step.contributions)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			promoted += int(n)
+		}
+		return nil
+	})
+	return promoted, err
+}
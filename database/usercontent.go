@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// UserContentReport counts the posts and comments a bulk moderation action
+// on a user's content trashed or purged
+type UserContentReport struct {
+	Posts    int
+	Comments int // the user's comments with the replies beneath them, and comments on purged posts
+}
+
+// userContent selects a user's posts or comments made between since and
+// until, either of which may be zero to leave that end open, as a condition
+// and its arguments
+func (db *DB) userContent(userID int, since, until time.Time) (string, []interface{}) {
+	cond := "user_id = ?"
+	args := []interface{}{userID}
+	if !since.IsZero() {
+		cond += " AND created_at >= ?"
+		args = append(args, db.dialect.timeArg(since))
+	}
+	if !until.IsZero() {
+		cond += " AND created_at < ?"
+		args = append(args, db.dialect.timeArg(until))
+	}
+	return cond, args
+}
+
+// TrashUserContent moves every post and comment the user made between since
+// and until to the trash in one go, along with the replies beneath the
+// comments, with the reason a moderator gave. Zero times leave that end of
+// the range open. Everything is trashed at the same moment, so a comment
+// restored from the trash brings back its replies.
+func (db *DB) TrashUserContent(ctx context.Context, userID, deletedBy int, reason string, since, until time.Time) (UserContentReport, error) {
+	var report UserContentReport
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		var err error
+		report, err = db.trashUserContent(ctx, tx, userID, deletedBy, reason, since, until)
+		return err
+	})
+	return report, err
+}
+
+func (db *DB) trashUserContent(ctx context.Context, tx *Tx, userID, deletedBy int, reason string, since, until time.Time) (UserContentReport, error) {
+	var report UserContentReport
+	cond, args := db.userContent(userID, since, until)
+	now := time.Now().UTC()
+
+	query := "UPDATE posts SET deleted_at = ?, deleted_by = ?, removal_reason = ? WHERE deleted_at IS NULL AND " + cond
+	result, err := tx.ExecContext(ctx, query, append([]interface{}{now, deletedBy, reason}, args...)...)
+	if err != nil {
+		return report, fmt.Errorf("failed to trash posts: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return report, err
+	}
+	report.Posts = int(n)
+
+	query = `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM comments WHERE deleted_at IS NULL AND ` + cond + `
+			UNION
+			SELECT c.id FROM comments c JOIN subtree s ON c.parent_id = s.id
+		)
+		UPDATE comments SET deleted_at = ?, deleted_by = ?, removal_reason = ?
+		WHERE id IN (SELECT id FROM subtree) AND deleted_at IS NULL
+	`
+	result, err = tx.ExecContext(ctx, query, append(args, now, deletedBy, reason)...)
+	if err != nil {
+		return report, fmt.Errorf("failed to trash comments: %v", err)
+	}
+	n, err = result.RowsAffected()
+	if err != nil {
+		return report, err
+	}
+	report.Comments = int(n)
+	return report, nil
+}
+
+// PurgeUserContent permanently deletes every post and comment the user made
+// between since and until in one go, trashed or not, with the replies
+// beneath the comments, the comments on the posts and their votes. Zero
+// times leave that end of the range open. Threads merged into others, or
+// that others were merged into, are only trashed, with the reason a
+// moderator gave, so the merged threads' URLs keep redirecting.
+func (db *DB) PurgeUserContent(ctx context.Context, userID, deletedBy int, reason string, since, until time.Time) (UserContentReport, error) {
+	var report UserContentReport
+	err := db.WithTx(ctx, func(tx *Tx) error {
+		if _, err := db.trashUserContent(ctx, tx, userID, deletedBy, reason, since, until); err != nil {
+			return err
+		}
+
+		cond, args := db.userContent(userID, since, until)
+		doomedPosts := `
+			SELECT id FROM posts
+			WHERE ` + cond + ` AND merged_into IS NULL
+			  AND id NOT IN (SELECT merged_into FROM posts WHERE merged_into IS NOT NULL)
+		`
+		doomedComments := `
+			WITH RECURSIVE subtree(id) AS (
+				SELECT id FROM comments WHERE (` + cond + `) OR post_id IN (` + doomedPosts + `)
+				UNION
+				SELECT c.id FROM comments c JOIN subtree s ON c.parent_id = s.id
+			)
+		`
+		commentArgs := append(append([]interface{}{}, args...), args...)
+
+		steps := []struct {
+			what  string
+			count *int
+			query string
+			args  []interface{}
+		}{
+			{"comment likes", nil, doomedComments + "DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM subtree)", commentArgs},
+			{"comments", &report.Comments, doomedComments + "DELETE FROM comments WHERE id IN (SELECT id FROM subtree)", commentArgs},
+			{"post likes", nil, "DELETE FROM post_likes WHERE post_id IN (" + doomedPosts + ")", args},
+			{"thread mutes", nil, "DELETE FROM thread_mutes WHERE post_id IN (" + doomedPosts + ")", args},
+			{"thread follows", nil, "DELETE FROM thread_follows WHERE post_id IN (" + doomedPosts + ")", args},
+			{"bookmarks", nil, "DELETE FROM bookmarks WHERE post_id IN (" + doomedPosts + ")", args},
+			{"posts", &report.Posts, "DELETE FROM posts WHERE id IN (" + doomedPosts + ")", args},
+		}
+		for _, step := range steps {
+			result, err := tx.ExecContext(ctx, step.query, step.args...)
+			if err != nil {
+				return fmt.Errorf("failed to delete %s: %v", step.what, err)
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if step.count != nil {
+				*step.count = int(n)
+			}
+		}
+		return nil
+	})
+	return report, err
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"literary-lions/models"
+)
+
+// ErrUsernameTaken is returned by ChangeUsername when another member has,
+// or used to have, the requested name
+var ErrUsernameTaken = errors.New("username is taken")
+
+// ChangeUsername renames a user, keeping their old name in their username
+// history. Names other members have or used to have can't be taken; members
+// may go back to a name they used before.
+func (db *DB) ChangeUsername(ctx context.Context, userID int, newUsername string) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		var taken int
+		query := `
+			SELECT (SELECT COUNT(*) FROM users WHERE username = ? AND id != ?)
+				+ (SELECT COUNT(*) FROM username_history WHERE username = ? AND user_id != ?)
+		`
+		if err := tx.QueryRowContext(ctx, query, newUsername, userID, newUsername, userID).Scan(&taken); err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrUsernameTaken
+		}
+
+		var oldUsername string
+		if err := tx.QueryRowContext(ctx, "SELECT username FROM users WHERE id = ?", userID).Scan(&oldUsername); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO username_history (user_id, username) VALUES (?, ?)", userID, oldUsername); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE users SET username = ? WHERE id = ?", newUsername, userID)
+		return err
+	})
+}
+
+// GetUsernameHistory gets the names a user had before, most recent first
+func (db *DB) GetUsernameHistory(ctx context.Context, userID int) ([]models.UsernameChange, error) {
+	query := "SELECT username, changed_at FROM username_history WHERE user_id = ? ORDER BY changed_at DESC, id DESC"
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.UsernameChange
+	for rows.Next() {
+		var change models.UsernameChange
+		if err := rows.Scan(&change.Username, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// GetRenamedUsername gets the current name of the member who used to be
+// called oldUsername, or sql.ErrNoRows if nobody was
+func (db *DB) GetRenamedUsername(ctx context.Context, oldUsername string) (string, error) {
+	query := `
+		SELECT u.username
+		FROM username_history h
+		JOIN users u ON u.id = h.user_id
+		WHERE h.username = ?
+		ORDER BY h.changed_at DESC, h.id DESC
+		LIMIT 1
+	`
+	var username string
+	err := db.QueryRowContext(ctx, query, oldUsername).Scan(&username)
+	return username, err
+}
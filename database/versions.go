@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"literary-lions/models"
+)
+
+// GetPostVersion returns the version of a post's page: the post itself, its
+// votes, followers, bookmarks and archive state, and its comments and their
+// votes. It returns
+// sql.ErrNoRows if the post doesn't exist or is in the trash.
+func (db *DB) GetPostVersion(ctx context.Context, postID int) (models.PageVersion, error) {
+	epoch := db.dialect.epoch
+	query := fmt.Sprintf(`
+		SELECT
+			COALESCE(%s, 0), COALESCE(%s, 0),
+			p.likes_count, p.dislikes_count, p.comments_count, p.followers_count, p.bookmarks_count,
+			COALESCE(MAX(%s), 0), COALESCE(MAX(%s), 0), COALESCE(MAX(%s), 0),
+			(SELECT COUNT(*) FROM comment_likes cl JOIN comments cm ON cm.id = cl.comment_id WHERE cm.post_id = p.id),
+			(SELECT COALESCE(SUM(CASE WHEN cl.is_like THEN 1 ELSE 0 END), 0) FROM comment_likes cl JOIN comments cm ON cm.id = cl.comment_id WHERE cm.post_id = p.id)
+		FROM posts p
+		LEFT JOIN comments c ON c.post_id = p.id
+		WHERE p.id = ? AND p.deleted_at IS NULL
+		GROUP BY p.id
+	`, epoch("p.updated_at"), epoch("p.archived_at"),
+		epoch("c.created_at"), epoch("c.updated_at"), epoch("c.deleted_at"))
+
+	var updated, archived, commented, edited, trashed int64
+	var likes, dislikes, comments, followers, bookmarks, commentVotes, commentLikes int
+	err := db.QueryRowContext(ctx, query, postID).Scan(&updated, &archived,
+		&likes, &dislikes, &comments, &followers, &bookmarks, &commented, &edited, &trashed, &commentVotes, &commentLikes)
+	if err != nil {
+		return models.PageVersion{}, err
+	}
+
+	return models.PageVersion{
+		Tag: fmt.Sprintf("%d.%d.%d.%d.%d.%d.%d.%d.%d.%d.%d.%d", updated, archived,
+			likes, dislikes, comments, followers, bookmarks, commented, edited, trashed, commentVotes, commentLikes),
+	}, nil
+}
+
+// GetPostsVersion returns the version of the post listings: the posts not
+// in the trash, with their vote and comment counts
+func (db *DB) GetPostsVersion(ctx context.Context) (models.PageVersion, error) {
+	epoch := db.dialect.epoch
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*), COALESCE(MAX(id), 0),
+			COALESCE(MAX(%s), 0), COALESCE(MAX(%s), 0), COALESCE(MAX(%s), 0),
+			COALESCE(SUM(likes_count), 0), COALESCE(SUM(dislikes_count), 0), COALESCE(SUM(comments_count), 0)
+		FROM posts
+		WHERE deleted_at IS NULL
+	`, epoch("created_at"), epoch("updated_at"), epoch("archived_at"))
+
+	var count, maxID, likes, dislikes, comments int
+	var created, updated, archived int64
+	err := db.QueryRowContext(ctx, query).Scan(&count, &maxID,
+		&created, &updated, &archived, &likes, &dislikes, &comments)
+	if err != nil {
+		return models.PageVersion{}, err
+	}
+
+	return models.PageVersion{
+		Tag: fmt.Sprintf("%d.%d.%d.%d.%d.%d.%d.%d", count, maxID,
+			created, updated, archived, likes, dislikes, comments),
+	}, nil
+}
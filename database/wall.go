@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"literary-lions/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WallPageQuery selects one page of the newest-first messages on a profile
+// wall
+type WallPageQuery struct {
+	ProfileUserID int    // whose wall
+	ShowSuspended bool   // include messages by suspended users
+	ViewerID      int    // leaves out messages by users the viewer blocked; 0 for anonymous viewers
+	Cursor        string // NextCursor of the previous page; empty for the first page
+	Limit         int    // page size; defaults to DefaultPageSize
+}
+
+// encodeWallCursor returns an opaque cursor string pointing after post. It
+// has the same form as post cursors, so decodeCursor reads it.
+func encodeWallCursor(post models.WallPost) string {
+	raw := post.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(post.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// wallColumns are the columns scanned by scanWallPost
+const wallColumns = `
+	w.id, w.profile_user_id, w.author_id, u.username, w.content, w.created_at`
+
+func scanWallPost(row rowScanner) (models.WallPost, error) {
+	var p models.WallPost
+	err := row.Scan(&p.ID, &p.ProfileUserID, &p.AuthorID, &p.AuthorUsername, &p.Content, &p.CreatedAt)
+	return p, err
+}
+
+// GetWallPage returns one page of the messages on a profile wall, newest
+// first, along with the cursor for the next page. The cursor is empty when
+// there are no more messages.
+func (db *DB) GetWallPage(ctx context.Context, q WallPageQuery) ([]models.WallPost, string, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	conditions := []string{"w.profile_user_id = ?"}
+	args := []interface{}{q.ProfileUserID}
+	if !q.ShowSuspended {
+		conditions = append(conditions, "u.status = 'active'")
+	}
+	if q.ViewerID > 0 {
+		conditions = append(conditions, "w.author_id NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)")
+		args = append(args, q.ViewerID)
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		createdAt := db.dialect.timeArg(cursor.CreatedAt)
+		conditions = append(conditions, "(w.created_at < ? OR (w.created_at = ? AND w.id < ?))")
+		args = append(args, createdAt, createdAt, cursor.ID)
+	}
+
+	query := `
+		SELECT` + wallColumns + `
+		FROM wall_posts w
+		JOIN users u ON w.author_id = u.id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY w.created_at DESC, w.id DESC
+		LIMIT ?`
+
+	// Fetch one extra row to find out whether another page follows
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var posts []models.WallPost
+	for rows.Next() {
+		post, err := scanWallPost(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(posts) > limit {
+		posts = posts[:limit]
+		next = encodeWallCursor(posts[limit-1])
+	}
+	return posts, next, nil
+}
+
+// GetWallPostByID gets a message from a profile wall
+func (db *DB) GetWallPostByID(ctx context.Context, postID int) (*models.WallPost, error) {
+	query := `
+		SELECT` + wallColumns + `
+		FROM wall_posts w
+		JOIN users u ON w.author_id = u.id
+		WHERE w.id = ?`
+	post, err := scanWallPost(db.QueryRowContext(ctx, query, postID))
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// CreateWallPost leaves a message on a profile wall. Messages members leave
+// on their own wall don't need to be seen.
+func (db *DB) CreateWallPost(ctx context.Context, post *models.WallPost) error {
+	query := "INSERT INTO wall_posts (profile_user_id, author_id, content, seen) VALUES (?, ?, ?, ?)"
+	id, err := db.insert(ctx, query, post.ProfileUserID, post.AuthorID, post.Content, post.AuthorID == post.ProfileUserID)
+	if err != nil {
+		return err
+	}
+	post.ID = id
+	return nil
+}
+
+// DeleteWallPost deletes a message from a profile wall
+func (db *DB) DeleteWallPost(ctx context.Context, postID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM wall_posts WHERE id = ?", postID)
+	return err
+}
+
+// CountNewWallPosts counts the messages on a user's wall they haven't seen
+func (db *DB) CountNewWallPosts(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM wall_posts WHERE profile_user_id = ? AND seen = FALSE", userID).Scan(&count)
+	return count, err
+}
+
+// MarkWallSeen marks all the messages on a user's wall as seen by them
+func (db *DB) MarkWallSeen(ctx context.Context, userID int) error {
+	_, err := db.ExecContext(ctx, "UPDATE wall_posts SET seen = TRUE WHERE profile_user_id = ? AND seen = FALSE", userID)
+	return err
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"literary-lions/models"
+	"time"
+)
+
+// GetYearInBooks sums up what a user did in the given calendar year (UTC):
+// what they wrote, the likes they gave and got, the books they read and the
+// category they posted in most. Trashed posts and comments don't count.
+func (db *DB) GetYearInBooks(ctx context.Context, userID, year int) (*models.YearInBooks, error) {
+	start := db.dialect.timeArg(time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC))
+	end := db.dialect.timeArg(time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC))
+	summary := &models.YearInBooks{Year: year}
+
+	counts := []struct {
+		dest  *int
+		query string
+		args  []interface{}
+	}{
+		{&summary.Posts, `
+			SELECT COUNT(*) FROM posts
+			WHERE user_id = ? AND deleted_at IS NULL AND created_at >= ? AND created_at < ?`,
+			[]interface{}{userID, start, end}},
+		{&summary.Comments, `
+			SELECT COUNT(*) FROM comments
+			WHERE user_id = ? AND deleted_at IS NULL AND created_at >= ? AND created_at < ?`,
+			[]interface{}{userID, start, end}},
+		{&summary.LikesGiven, `
+			SELECT
+				(SELECT COUNT(*) FROM post_likes WHERE user_id = ? AND is_like = TRUE AND created_at >= ? AND created_at < ?) +
+				(SELECT COUNT(*) FROM comment_likes WHERE user_id = ? AND is_like = TRUE AND created_at >= ? AND created_at < ?)`,
+			[]interface{}{userID, start, end, userID, start, end}},
+		{&summary.LikesReceived, `
+			SELECT
+				(SELECT COUNT(*) FROM post_likes pl JOIN posts p ON pl.post_id = p.id
+				 WHERE p.user_id = ? AND pl.user_id != p.user_id AND pl.is_like = TRUE AND pl.created_at >= ? AND pl.created_at < ?) +
+				(SELECT COUNT(*) FROM comment_likes cl JOIN comments c ON cl.comment_id = c.id
+				 WHERE c.user_id = ? AND cl.user_id != c.user_id AND cl.is_like = TRUE AND cl.created_at >= ? AND cl.created_at < ?)`,
+			[]interface{}{userID, start, end, userID, start, end}},
+	}
+	for _, count := range counts {
+		if err := db.QueryRowContext(ctx, count.query, count.args...).Scan(count.dest); err != nil {
+			return nil, err
+		}
+	}
+
+	// Books count in the year they were read, or shelved when the date
+	// they were read isn't known
+	rows, err := db.QueryContext(ctx, `
+		SELECT ub.id, ub.user_id, ub.book_id, ub.shelf, ub.rating, ub.date_read, b.title, b.author, ub.created_at
+		FROM user_books ub
+		JOIN books b ON ub.book_id = b.id
+		WHERE ub.user_id = ? AND ub.shelf = 'read'
+		  AND COALESCE(ub.date_read, ub.created_at) >= ? AND COALESCE(ub.date_read, ub.created_at) < ?
+		ORDER BY COALESCE(ub.date_read, ub.created_at), ub.id
+	`, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry models.ShelfEntry
+		err := rows.Scan(&entry.ID, &entry.UserID, &entry.BookID, &entry.Shelf, &entry.Rating,
+			&entry.DateRead, &entry.BookTitle, &entry.BookAuthor, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		summary.BooksRead = append(summary.BooksRead, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRowContext(ctx, `
+		SELECT c.name, COUNT(*) AS n
+		FROM posts p
+		JOIN categories c ON p.category_id = c.id
+		WHERE p.user_id = ? AND p.deleted_at IS NULL AND c.anonymous = FALSE AND p.created_at >= ? AND p.created_at < ?
+		GROUP BY c.id, c.name
+		ORDER BY n DESC, c.name
+		LIMIT 1
+	`, userID, start, end).Scan(&summary.TopCategory, &summary.TopCategoryPosts)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,137 @@
+// Package errorreport forwards panics and server errors to an error tracking
+// service, so they are noticed without anyone reading the logs. Reporters
+// are pluggable; the one included speaks the Sentry protocol, which
+// self-hosted services such as GlitchTip also accept.
+package errorreport
+
+import (
+	"literary-lions/clientip"
+	"literary-lions/config"
+	"literary-lions/logging"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Levels of reported events
+const (
+	LevelFatal = "fatal" // panics
+	LevelError = "error" // 5xx responses
+)
+
+// Event is an error to report, with the request it happened in
+type Event struct {
+	Time    time.Time
+	Level   string
+	Message string
+	Stack   []Frame // outermost call first; empty when not known
+
+	RequestID string
+	UserID    int
+	Handler   string
+	Status    int
+	Request   Request
+}
+
+// Request describes the request an event happened in. Only headers that
+// cannot hold credentials are kept.
+type Request struct {
+	Method   string
+	URL      string
+	Headers  map[string]string
+	ClientIP string
+}
+
+// Frame is a function call in a stack trace
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// reportedHeaders are the request headers included in events. Cookies and
+// Authorization are left out on purpose.
+var reportedHeaders = []string{"Accept", "Accept-Language", "Content-Type", "Referer", "User-Agent"}
+
+// Reporter sends events somewhere. Report must not block the request for
+// long, so reporters that talk to a network service send in the background.
+type Reporter interface {
+	Report(e Event)
+}
+
+// Nop is a reporter that drops every event, used when no error tracking
+// service is configured
+type Nop struct{}
+
+func (Nop) Report(Event) {}
+
+// NewFromConfig creates the reporter configured in cfg: Sentry when a DSN is
+// set, Nop otherwise. environment names the deployment in reported events.
+func NewFromConfig(cfg config.ErrorReporting, environment string) (Reporter, error) {
+	if cfg.DSN == "" {
+		return Nop{}, nil
+	}
+	return NewSentry(cfg.DSN, environment, cfg.Release)
+}
+
+// NewEvent creates an event for an error that happened while serving r
+func NewEvent(r *http.Request, level, message string) Event {
+	info := logging.RequestInfo(r.Context())
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	headers := make(map[string]string)
+	for _, name := range reportedHeaders {
+		if value := r.Header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+
+	return Event{
+		Time:      time.Now(),
+		Level:     level,
+		Message:   message,
+		RequestID: info.RequestID,
+		UserID:    info.UserID,
+		Handler:   info.Handler,
+		Request: Request{
+			Method:   r.Method,
+			URL:      scheme + "://" + r.Host + r.URL.RequestURI(),
+			Headers:  headers,
+			ClientIP: clientip.FromRequest(r),
+		},
+	}
+}
+
+// Stack returns the calls leading to its caller, outermost first, leaving
+// out skip more frames. Called from a deferred recover, the innermost frames
+// are where the panic happened.
+func Stack(skip int) []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []Frame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			break
+		}
+	}
+
+	// Reverse into outermost-first order
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return stack
+}
+
+// inApp reports whether a function belongs to the forum rather than to Go
+// or a dependency
+func inApp(function string) bool {
+	return strings.HasPrefix(function, "main.") || strings.HasPrefix(function, "literary-lions/")
+}
@@ -0,0 +1,249 @@
+package errorreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sentryQueueSize is how many events can wait to be sent. Further events are
+// dropped, so an error storm cannot pile up memory.
+const sentryQueueSize = 100
+
+// Sentry reports events to a Sentry-compatible service through its store
+// API. Events are sent one at a time in the background.
+type Sentry struct {
+	endpoint    string
+	auth        string
+	environment string
+	release     string
+	serverName  string
+	client      *http.Client
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan Event
+	done   chan struct{}
+}
+
+// NewSentry creates a reporter for a DSN of the form
+// https://<public key>@<host>/<project ID>
+func NewSentry(dsn, environment, release string) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid error reporting DSN: %v", err)
+	}
+	key := u.User.Username()
+	projectID := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme == "" || u.Host == "" || key == "" || projectID == "" {
+		return nil, fmt.Errorf("invalid error reporting DSN: want https://<key>@<host>/<project>")
+	}
+	// Projects may live below a path prefix, e.g. https://key@host/sentry/42
+	prefix := ""
+	if i := strings.LastIndex(projectID, "/"); i >= 0 {
+		prefix, projectID = "/"+projectID[:i], projectID[i+1:]
+	}
+
+	serverName, _ := os.Hostname()
+	s := &Sentry{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, projectID),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=literary-lions/1.0, sentry_key=%s", key),
+		environment: environment,
+		release:     release,
+		serverName:  serverName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan Event, sentryQueueSize),
+		done:        make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Report queues an event to be sent. It never blocks; when the queue is full
+// or the reporter is closed the event is dropped.
+func (s *Sentry) Report(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.queue <- e:
+	default:
+		slog.Warn("error report dropped, queue full", "request_id", e.RequestID)
+	}
+}
+
+// Close stops accepting events and waits until the queued ones are sent or
+// ctx is done
+func (s *Sentry) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Sentry) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.send(e); err != nil {
+			slog.Warn("failed to send error report", "request_id", e.RequestID, "err", err)
+		}
+	}
+}
+
+func (s *Sentry) send(e Event) error {
+	body, err := json.Marshal(s.payload(e))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error tracking service returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sentryEvent and the types below follow Sentry's event payload format
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+	Request     sentryRequest     `json:"request"`
+	User        sentryUser        `json:"user"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string           `json:"type"`
+	Value      string           `json:"value"`
+	Stacktrace sentryStacktrace `json:"stacktrace"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+type sentryUser struct {
+	ID        string `json:"id,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+// payload converts an event to Sentry's format. Panics are sent as
+// exceptions with their stack trace; other errors as plain messages.
+func (s *Sentry) payload(e Event) sentryEvent {
+	p := sentryEvent{
+		EventID:     newEventID(),
+		Timestamp:   e.Time.UTC().Format(time.RFC3339),
+		Level:       e.Level,
+		Platform:    "go",
+		Logger:      "literary-lions",
+		ServerName:  s.serverName,
+		Environment: s.environment,
+		Release:     s.release,
+		Request: sentryRequest{
+			URL:     e.Request.URL,
+			Method:  e.Request.Method,
+			Headers: e.Request.Headers,
+		},
+		User: sentryUser{IPAddress: e.Request.ClientIP},
+		Tags: map[string]string{},
+	}
+
+	if len(e.Stack) > 0 {
+		exception := sentryException{Type: "panic", Value: e.Message}
+		for _, frame := range e.Stack {
+			exception.Stacktrace.Frames = append(exception.Stacktrace.Frames, sentryFrame{
+				Function: frame.Function,
+				AbsPath:  frame.File,
+				Lineno:   frame.Line,
+				InApp:    inApp(frame.Function),
+			})
+		}
+		p.Exception = &sentryExceptions{Values: []sentryException{exception}}
+	} else {
+		p.Message = e.Message
+	}
+
+	if e.Request.ClientIP != "" {
+		p.Request.Env = map[string]string{"REMOTE_ADDR": e.Request.ClientIP}
+	}
+	if e.UserID != 0 {
+		p.User.ID = strconv.Itoa(e.UserID)
+	}
+	if e.RequestID != "" {
+		p.Tags["request_id"] = e.RequestID
+	}
+	if e.Handler != "" {
+		p.Tags["handler"] = e.Handler
+	}
+	if e.Status != 0 {
+		p.Tags["status_code"] = strconv.Itoa(e.Status)
+	}
+	return p
+}
+
+// newEventID returns a random 32-character hex ID, as Sentry expects
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,191 @@
+// Package features turns optional parts of the forum on and off per
+// deployment without recompiling. Each flag has a built-in default that
+// admins can change from the admin panel; the FEATURES setting overrides
+// both, for deployments that want a flag fixed.
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Flag describes a feature that can be turned on and off
+type Flag struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// Known lists every flag, in the order the admin panel shows them. New
+// features add their flag here.
+var Known = []Flag{
+	{
+		Name:        "goodreads_import",
+		Description: "Let users import their reading lists from a Goodreads CSV export",
+		Default:     true,
+	},
+	{
+		Name:        "search_suggestions",
+		Description: "Suggest matching posts while typing in the search box",
+		Default:     true,
+	},
+	{
+		Name:        "open_library_lookup",
+		Description: "Fill in the details of the book members are currently reading from Open Library",
+		Default:     true,
+	},
+	{
+		Name:        "book_cards",
+		Description: "Show a card under posts for the books they link to on Open Library, Goodreads and publishers' sites",
+		Default:     true,
+	},
+	{
+		Name:        "members_online",
+		Description: "Show how many members are online in the footer",
+		Default:     true,
+	},
+}
+
+// Errors returned by Set
+var (
+	ErrUnknownFlag = errors.New("unknown feature flag")
+	ErrOverridden  = errors.New("feature flag is fixed by the FEATURES setting")
+)
+
+// Store keeps the flags admins have set
+type Store interface {
+	GetFeatureFlags(ctx context.Context) (map[string]bool, error)
+	SetFeatureFlag(ctx context.Context, name string, enabled bool) error
+}
+
+// Flags reports which features are on. The flags admins set are re-read from
+// the store at most once per refresh interval, so toggles made by another
+// instance show up after that delay.
+type Flags struct {
+	store     Store
+	overrides map[string]bool
+	refresh   time.Duration
+
+	mu       sync.Mutex
+	stored   map[string]bool
+	loadedAt time.Time
+}
+
+// New creates flags backed by store. overrides fix flags regardless of what
+// admins set; naming an unknown flag there is an error.
+func New(store Store, overrides map[string]bool, refresh time.Duration) (*Flags, error) {
+	for name := range overrides {
+		if lookup(name) == nil {
+			return nil, fmt.Errorf("%w %q", ErrUnknownFlag, name)
+		}
+	}
+	return &Flags{store: store, overrides: overrides, refresh: refresh}, nil
+}
+
+// IsKnown reports whether name is a known flag
+func IsKnown(name string) bool {
+	return lookup(name) != nil
+}
+
+// lookup returns the known flag with the given name, or nil
+func lookup(name string) *Flag {
+	for i := range Known {
+		if Known[i].Name == name {
+			return &Known[i]
+		}
+	}
+	return nil
+}
+
+// load returns the flags admins have set, re-reading them when they are
+// older than the refresh interval. If the store fails the last known values
+// are kept. Callers must hold f.mu.
+func (f *Flags) load(ctx context.Context) map[string]bool {
+	if f.stored != nil && time.Since(f.loadedAt) < f.refresh {
+		return f.stored
+	}
+
+	stored, err := f.store.GetFeatureFlags(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load feature flags", "err", err)
+		return f.stored
+	}
+	f.stored, f.loadedAt = stored, time.Now()
+	return stored
+}
+
+// Enabled reports whether a feature is on. Unknown flags are off. A nil
+// Flags uses every flag's default.
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	return f.All(ctx)[name]
+}
+
+// All returns the state of every known flag, by name
+func (f *Flags) All(ctx context.Context) map[string]bool {
+	state := make(map[string]bool, len(Known))
+	for _, flag := range Known {
+		state[flag.Name] = flag.Default
+	}
+	if f == nil {
+		return state
+	}
+
+	f.mu.Lock()
+	stored := f.load(ctx)
+	f.mu.Unlock()
+
+	for name, enabled := range stored {
+		if _, ok := state[name]; ok {
+			state[name] = enabled
+		}
+	}
+	for name, enabled := range f.overrides {
+		state[name] = enabled
+	}
+	return state
+}
+
+// Status describes a flag for the admin panel
+type Status struct {
+	Flag
+	Enabled    bool
+	Overridden bool // fixed by the FEATURES setting, so admins cannot change it
+}
+
+// Statuses returns the state of every known flag
+func (f *Flags) Statuses(ctx context.Context) []Status {
+	state := f.All(ctx)
+	statuses := make([]Status, 0, len(Known))
+	for _, flag := range Known {
+		status := Status{Flag: flag, Enabled: state[flag.Name]}
+		if f != nil {
+			_, status.Overridden = f.overrides[flag.Name]
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Set turns a feature on or off
+func (f *Flags) Set(ctx context.Context, name string, enabled bool) error {
+	if lookup(name) == nil {
+		return fmt.Errorf("%w %q", ErrUnknownFlag, name)
+	}
+	if _, ok := f.overrides[name]; ok {
+		return ErrOverridden
+	}
+
+	if err := f.store.SetFeatureFlag(ctx, name, enabled); err != nil {
+		return err
+	}
+
+	// Make the change visible on this instance straight away
+	f.mu.Lock()
+	f.stored = nil
+	f.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import "literary-lions/models"
+
+// hideAuthors shows a post in an anonymous category, and its comments, as
+// by models.AnonymousName to everyone but admins, who moderate them.
+// UserID is kept, so members can still edit and delete their own. Reports
+// whether the authors were hidden.
+func hideAuthors(currentUser *models.User, post *models.Post, comments []models.Comment) bool {
+	if !post.Anonymous || (currentUser != nil && currentUser.IsAdmin()) {
+		return false
+	}
+	post.Username = models.AnonymousName
+	post.AuthorHidden = true
+	for i := range comments {
+		comments[i].Username = models.AnonymousName
+		comments[i].AuthorHidden = true
+	}
+	return true
+}
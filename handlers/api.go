@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"literary-lions/database"
+	"literary-lions/markup"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// postsPageResponse is the JSON body returned by APIPostsHandler
+type postsPageResponse struct {
+	Posts      []models.Post `json:"posts"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// APIPostsHandler serves the newest-first post feed as JSON for
+// infinite-scroll clients. Query parameters: cursor (next_cursor from the
+// previous response), limit, and category.
+func (h *Handler) APIPostsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	query := r.URL.Query()
+
+	q := database.PostPageQuery{
+		ShowSuspended: currentUser != nil && currentUser.IsAdmin(),
+		Cursor:        query.Get("cursor"),
+	}
+	if currentUser != nil {
+		q.ViewerID = currentUser.ID
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		q.Limit = limit
+	}
+
+	if categoryStr := query.Get("category"); categoryStr != "" {
+		categoryID, err := strconv.Atoi(categoryStr)
+		if err != nil {
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+			return
+		}
+		q.CategoryID = categoryID
+	}
+
+	posts, next, err := h.DB.GetPostsPage(r.Context(), q)
+	if err != nil {
+		if err == database.ErrInvalidCursor {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to fetch posts page", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching posts")
+		return
+	}
+
+	if posts == nil {
+		posts = []models.Post{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(postsPageResponse{Posts: posts, NextCursor: next}); err != nil {
+		slog.ErrorContext(r.Context(), "failed to encode posts page", "err", err)
+	}
+}
+
+// likeResponse is the JSON body returned by the like APIs: the item's vote
+// counts after the vote, and how the current user now votes on it
+type likeResponse struct {
+	Likes    int  `json:"likes"`
+	Dislikes int  `json:"dislikes"`
+	Liked    bool `json:"liked"`
+	Disliked bool `json:"disliked"`
+}
+
+// APILikePostHandler likes or dislikes a post like LikePostHandler, but
+// answers with the post's updated votes as JSON instead of a redirect, so
+// like buttons can update without reloading the page
+func (h *Handler) APILikePostHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser, postID, ok := h.likePost(w, r)
+	if !ok {
+		return
+	}
+
+	var resp likeResponse
+	var err error
+	resp.Likes, resp.Dislikes, err = h.DB.GetPostVotes(r.Context(), postID)
+	if err == nil {
+		resp.Liked, resp.Disliked, err = h.DB.GetPostLikeStatus(r.Context(), currentUser.ID, postID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch post votes", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching votes")
+		return
+	}
+	writeLikeResponse(w, r, resp)
+}
+
+// APILikeCommentHandler likes or dislikes a comment like
+// LikeCommentHandler, answering with the comment's updated votes as JSON
+func (h *Handler) APILikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser, commentID, ok := h.likeComment(w, r)
+	if !ok {
+		return
+	}
+
+	var resp likeResponse
+	var err error
+	resp.Likes, resp.Dislikes, err = h.DB.GetCommentVotes(r.Context(), commentID)
+	if err == nil {
+		resp.Liked, resp.Disliked, err = h.DB.GetCommentLikeStatus(r.Context(), currentUser.ID, commentID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch comment votes", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching votes")
+		return
+	}
+	writeLikeResponse(w, r, resp)
+}
+
+func writeLikeResponse(w http.ResponseWriter, r *http.Request, resp likeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "failed to encode votes", "err", err)
+	}
+}
+
+// previewResponse is the JSON body returned by APIPreviewHandler
+type previewResponse struct {
+	HTML string `json:"html"`
+}
+
+// APIPreviewHandler renders the text of a post or comment being written,
+// from the content form value, the way it will show once saved, for the
+// forms' Preview tab
+func (h *Handler) APIPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := previewResponse{HTML: string(markup.Render(r.FormValue("content")))}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "failed to encode preview", "err", err)
+	}
+}
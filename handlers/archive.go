@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveYear is a year in the archive index with its months that have
+// posts, newest first
+type archiveYear struct {
+	Year   int
+	Posts  int
+	Months []models.ArchiveMonth
+}
+
+// ArchiveHandler lets old discussions be browsed by when they were started:
+// /archive lists the years and months that have posts, and
+// /archive/{year}/{month} the posts started that month (in UTC), oldest
+// first unless sort_by and sort_order say otherwise. /archive/{year} leads
+// to that year in the index.
+func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	showSuspended := currentUser != nil && currentUser.IsAdmin()
+	months, err := h.DB.GetPostMonths(r.Context(), showSuspended)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch post months", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching the archive")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/archive"), "/")
+	if rest == "" {
+		h.renderArchiveIndex(w, r, currentUser, months)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	year, err := strconv.Atoi(parts[0])
+	if err != nil || year < 1 || year > 9999 || len(parts) > 2 {
+		h.NotFoundHandler(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		http.Redirect(w, r, fmt.Sprintf("/archive#year-%d", year), http.StatusSeeOther)
+		return
+	}
+	month, err := strconv.Atoi(parts[1])
+	if err != nil || month < 1 || month > 12 {
+		h.NotFoundHandler(w, r)
+		return
+	}
+
+	from := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	sortBy := r.URL.Query().Get("sort_by")
+	sortOrder := r.URL.Query().Get("sort_order")
+	if sortBy == "" {
+		sortBy, sortOrder = "date", "asc"
+	}
+	posts, err := h.DB.GetPostsBetweenWithSorting(r.Context(), from, from.AddDate(0, 1, 0), showSuspended, sortBy, sortOrder)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch posts by month", "year", year, "month", month, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching posts")
+		return
+	}
+	h.styleCategories(r, posts)
+
+	// The neighbouring months with posts; months are listed newest first
+	var newer, older *models.ArchiveMonth
+	for i := range months {
+		m := &months[i]
+		at := time.Date(m.Year, time.Month(m.Month), 1, 0, 0, 0, 0, time.UTC)
+		if at.After(from) {
+			newer = m
+		} else if at.Before(from) && older == nil {
+			older = m
+		}
+	}
+
+	name := from.Format("January 2006")
+	data := struct {
+		PageData
+		Year      int                  `json:"year"`
+		Month     int                  `json:"month"`
+		MonthName string               `json:"-"`
+		SortBy    string               `json:"sort_by"`
+		SortOrder string               `json:"sort_order"`
+		Newer     *models.ArchiveMonth `json:"newer,omitempty"`
+		Older     *models.ArchiveMonth `json:"older,omitempty"`
+	}{
+		PageData: PageData{
+			Posts:       withoutBlocked(posts, h.blockedUsers(r, currentUser)),
+			CurrentUser: currentUser,
+			Title:       "Archive: " + name,
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser),
+				Breadcrumb{Name: "Archive", URL: "/archive"},
+				Breadcrumb{Name: name, URL: fmt.Sprintf("/archive/%d/%02d", year, month)}),
+		},
+		Year:      year,
+		Month:     month,
+		MonthName: name,
+		SortBy:    sortBy,
+		SortOrder: sortOrder,
+		Newer:     newer,
+		Older:     older,
+	}
+
+	h.Render(w, r, "archive_month", data)
+}
+
+// renderArchiveIndex shows the archive's years and months
+func (h *Handler) renderArchiveIndex(w http.ResponseWriter, r *http.Request, currentUser *models.User, months []models.ArchiveMonth) {
+	var years []archiveYear
+	for _, m := range months {
+		if len(years) == 0 || years[len(years)-1].Year != m.Year {
+			years = append(years, archiveYear{Year: m.Year})
+		}
+		year := &years[len(years)-1]
+		year.Posts += m.Posts
+		year.Months = append(year.Months, m)
+	}
+
+	data := struct {
+		PageData
+		Years []archiveYear `json:"years"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Archive",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Archive", URL: "/archive"}),
+		},
+		Years: years,
+	}
+
+	h.Render(w, r, "archive", data)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"literary-lions/database"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+)
+
+// audit records an action in the audit log, and in the server log. actor is
+// who did it, nil for the forum itself, and targetUserID the member it was
+// done to, 0 for none. Failures are only logged, since the action they
+// record has already happened.
+func (h *Handler) audit(r *http.Request, actor *models.User, action string, targetUserID int, details string) {
+	entry := &models.AuditEntry{Action: action, Details: details}
+	attrs := []any{"action", action}
+	if actor != nil {
+		entry.ActorID = &actor.ID
+		attrs = append(attrs, "actor_id", actor.ID)
+	}
+	if targetUserID != 0 {
+		entry.TargetUserID = &targetUserID
+		attrs = append(attrs, "target_user_id", targetUserID)
+	}
+	slog.InfoContext(r.Context(), "audit", append(attrs, "details", details)...)
+	if err := h.DB.AddAuditEntry(r.Context(), entry); err != nil {
+		slog.ErrorContext(r.Context(), "failed to record audit entry", "action", action, "err", err)
+	}
+}
+
+// AdminAuditLogHandler lists the latest entries of the audit log
+func (h *Handler) AdminAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	currentUser := h.GetCurrentUser(r)
+
+	entries, err := h.DB.GetAuditLog(r.Context(), database.AuditLogSize)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch audit log", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching the audit log")
+		return
+	}
+
+	data := struct {
+		PageData
+		Entries []models.AuditEntry `json:"entries"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Audit Log",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), adminCrumb, Breadcrumb{Name: "Audit Log", URL: "/admin/audit"}),
+		},
+		Entries: entries,
+	}
+
+	h.Render(w, r, "admin_audit", data)
+}
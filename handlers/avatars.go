@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"literary-lions/avatars"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// profilePictureWidth is how wide, in pixels, profile pictures stored on
+// other sites are served through the image proxy: twice the largest size
+// pages show them at, for high-density screens
+const profilePictureWidth = 240
+
+// editProfilePageData is rendered by templates/edit_profile.html
+type editProfilePageData struct {
+	PageData
+	MaxUploadMB  int
+	BlockedUsers []models.User
+	Reading      *models.Book // The book the user is currently reading, if any
+
+	UsernameHistory    []models.UsernameChange
+	NextUsernameChange time.Time // When the user may change their username again; zero if now
+
+	PendingEmail *models.EmailChange // The email change waiting for the user to confirm, if any
+}
+
+// renderEditProfile renders the edit profile page with an optional error.
+// The profile form is filled in from user, and the username, email and
+// reading forms with what was submitted in them.
+func (h *Handler) renderEditProfile(w http.ResponseWriter, r *http.Request, user *models.User, status int, message string) {
+	data := editProfilePageData{
+		PageData: PageData{
+			CurrentUser: user,
+			Title:       "Edit Profile",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, user), profileCrumb(user.Username), Breadcrumb{Name: "Edit Profile", URL: "/edit-profile"}),
+			Error:       message,
+			FormData:    formValues(r, "username", "email", "book", "author"),
+		},
+		MaxUploadMB: h.Config.Avatars.MaxUploadMB,
+	}
+
+	blocked, err := h.DB.GetBlockedUsers(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch blocked users", "err", err)
+	}
+	data.BlockedUsers = blocked
+
+	if book, ok := h.readingBooks(r, []int{user.ID})[user.ID]; ok {
+		data.Reading = &book
+	}
+
+	history, err := h.DB.GetUsernameHistory(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch username history", "err", err)
+	}
+	data.UsernameHistory = history
+	if len(history) > 0 {
+		data.NextUsernameChange = nextUsernameChange(history[0].ChangedAt)
+	}
+
+	pending, err := h.DB.GetPendingEmailChange(r.Context(), user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "failed to fetch pending email change", "err", err)
+	}
+	data.PendingEmail = pending
+
+	h.RenderStatus(w, r, status, "edit_profile", data)
+}
+
+// saveAvatar scans and processes the picture user uploaded in the "avatar"
+// form field and stores it, returning its URL. It returns "" when no file
+// was uploaded, and errNotTrusted when user is too new to upload one.
+// Errors other than those and those of scanUpload and avatars.Process are
+// storage failures.
+func (h *Handler) saveAvatar(r *http.Request, user *models.User) (string, error) {
+	file, _, err := r.FormFile("avatar")
+	if err == http.ErrMissingFile {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if !user.Trusted(models.TrustMember) {
+		return "", errNotTrusted
+	}
+
+	upload, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	if err := h.scanUpload(r, user, "avatar", upload); err != nil {
+		return "", err
+	}
+
+	data, err := avatars.Process(bytes.NewReader(upload), h.Config.Avatars.Size)
+	if err != nil {
+		return "", err
+	}
+	if err := h.Avatars.Put(r.Context(), user.ID, data); err != nil {
+		return "", err
+	}
+	return avatars.URL(user.ID, avatars.Hash(data)), nil
+}
+
+// deleteAvatar removes a user's stored picture, if any. Failures are only
+// logged since the account change they accompany has already happened.
+func (h *Handler) deleteAvatar(r *http.Request, userID int) {
+	if err := h.Avatars.Delete(r.Context(), userID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete avatar", "target_user_id", userID, "err", err)
+	}
+}
+
+// AvatarHandler serves uploaded profile pictures at /avatars/{user ID}.
+// Requests with the current hash in v, as generated by avatars.URL, may be
+// cached forever; others must be revalidated.
+func (h *Handler) AvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/avatars/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := h.Avatars.Get(r.Context(), userID)
+	if errors.Is(err, avatars.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load avatar", "target_user_id", userID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error loading avatar")
+		return
+	}
+
+	hash := avatars.Hash(data)
+	if r.URL.Query().Get("v") == hash {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("ETag", `"`+hash+`"`)
+	// ServeContent answers If-None-Match using the ETag
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// avatarCacheKey is the PageCache key of a generated avatar
+func avatarCacheKey(username string) string {
+	return "avatar:" + username
+}
+
+// MemberAvatarHandler serves the avatar shown next to a member's name in
+// listings and comments, at /avatar/{username}: a redirect to their profile
+// picture, or an SVG of their initials if they haven't uploaded one.
+// Browsers may keep either for a few minutes, so a new picture shows up
+// shortly after it is uploaded.
+func (h *Handler) MemberAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := strings.TrimPrefix(r.URL.Path, "/avatar/")
+	user, err := h.DB.GetUserByUsername(r.Context(), username)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch user", "username", username, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error loading avatar")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if user.ProfilePicture != "" {
+		http.Redirect(w, r, h.ImageProxy.URL(user.ProfilePicture, profilePictureWidth), http.StatusFound)
+		return
+	}
+
+	// The avatar only depends on the username, so it never goes stale
+	var data []byte
+	if cached, ok := h.PageCache.Get(avatarCacheKey(user.Username)); ok {
+		data = cached.([]byte)
+	} else {
+		data = avatars.Initials(user.Username)
+		h.PageCache.Set(avatarCacheKey(user.Username), data)
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// The SVG is only ever an image; don't let it run anything if opened
+	// directly
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("ETag", `"`+avatars.Hash(data)+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// blockedUsers returns the IDs of the users the viewer has blocked. Errors
+// are logged and nothing is hidden.
+func (h *Handler) blockedUsers(r *http.Request, viewer *models.User) map[int]bool {
+	if viewer == nil {
+		return nil
+	}
+	blocked, err := h.DB.GetBlockedUserIDs(r.Context(), viewer.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch blocked users", "err", err)
+		return nil
+	}
+	return blocked
+}
+
+// withoutBlocked leaves out posts by blocked users. Listings are cached for
+// all viewers, so they are filtered here rather than in the queries.
+func withoutBlocked(posts []models.Post, blocked map[int]bool) []models.Post {
+	if len(blocked) == 0 {
+		return posts
+	}
+	visible := make([]models.Post, 0, len(posts))
+	for _, post := range posts {
+		if !blocked[post.UserID] {
+			visible = append(visible, post)
+		}
+	}
+	return visible
+}
+
+// BlockHandler blocks and unblocks members. Blocked members' posts are
+// hidden from the blocker, their comments are collapsed, and neither can
+// send the other private messages.
+func (h *Handler) BlockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.DB.GetUserByID(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch user", "target_user_id", userID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating block list")
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "block":
+		if target.ID == currentUser.ID {
+			http.Error(w, "You can't block yourself", http.StatusBadRequest)
+			return
+		}
+		if target.IsAdmin() {
+			h.RenderError(w, r, http.StatusForbidden, "Admins can't be blocked")
+			return
+		}
+		err = h.DB.BlockUser(r.Context(), currentUser.ID, target.ID)
+	case "unblock":
+		err = h.DB.UnblockUser(r.Context(), currentUser.ID, target.ID)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update block list", "target_user_id", target.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating block list")
+		return
+	}
+
+	// Unblocking from the list on the edit profile page returns there
+	if r.FormValue("return") == "edit-profile" {
+		http.Redirect(w, r, "/edit-profile", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/profile/"+target.Username, http.StatusSeeOther)
+}
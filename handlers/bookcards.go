@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"literary-lions/models"
+	"literary-lions/unfurl"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// bookLookupTimeout bounds how long looking up the books linked in one post
+// may take
+const bookLookupTimeout = time.Minute
+
+// linkedBooks returns the books a post links to that have been looked up
+// already, for the cards shown under it. Links not looked up yet are looked
+// up in the background, and their cards show once they are found.
+func (h *Handler) linkedBooks(r *http.Request, post *models.Post) []models.Book {
+	if h.BookCards == nil || !h.Features.Enabled(r.Context(), "book_cards") {
+		return nil
+	}
+	links := h.BookCards.Links(post.Content)
+	if len(links) == 0 {
+		return nil
+	}
+
+	found, err := h.DB.GetBookLinks(r.Context(), links)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch book links", "post_id", post.ID, "err", err)
+		return nil
+	}
+
+	var books []models.Book
+	var missing []string
+	shown := make(map[int]bool)
+	for _, url := range links {
+		link, ok := found[url]
+		switch {
+		case !ok || h.BookCards.Retry(link):
+			missing = append(missing, url)
+		case link.Book == nil || shown[link.Book.ID]:
+		case post.BookID != nil && *post.BookID == link.Book.ID:
+			// The post is about this book, which it already shows
+		default:
+			shown[link.Book.ID] = true
+			books = append(books, *link.Book)
+		}
+	}
+	if len(missing) > 0 {
+		h.lookUpBookLinks(r, post.ID, missing)
+	}
+	return books
+}
+
+// lookUpBookLinks looks up the books at links in the background and stores
+// what was found, dropping the post's cached pages so its cards show. Links
+// where no book could be found are stored too, to be tried again later.
+func (h *Handler) lookUpBookLinks(r *http.Request, postID int, links []string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), bookLookupTimeout)
+
+	go func() {
+		defer cancel()
+
+		changed := false
+		for _, link := range links {
+			if !h.BookCards.Claim(link) {
+				continue
+			}
+			bookID, err := h.lookUpBookLink(ctx, link)
+			h.BookCards.Done(link)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to store book link", "url", link, "err", err)
+				continue
+			}
+			changed = changed || bookID > 0
+		}
+		if changed {
+			h.PageCache.DeletePrefix(postPagePrefix(postID))
+		}
+	}()
+}
+
+// lookUpBookLink looks up the book at link and stores it, returning its ID,
+// or 0 when none was found
+func (h *Handler) lookUpBookLink(ctx context.Context, link string) (int, error) {
+	book, err := h.BookCards.Fetch(ctx, link)
+	if err != nil {
+		if !errors.Is(err, unfurl.ErrNotFound) {
+			slog.WarnContext(ctx, "failed to fetch linked book", "url", link, "err", err)
+		}
+		return 0, h.DB.SaveBookLink(ctx, link, 0)
+	}
+	if err := h.DB.FindOrCreateBook(ctx, book); err != nil {
+		return 0, err
+	}
+	return book.ID, h.DB.SaveBookLink(ctx, link, book.ID)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"literary-lions/models"
+	"literary-lions/openlibrary"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// findBook works out which book a member means from the title or ISBN and
+// author they typed, looking it up on Open Library when that is turned on.
+// Titles that can't be looked up are used as typed; ISBNs must be found. The
+// message is set, for the user, when no book could be found.
+func (h *Handler) findBook(r *http.Request, query, author string) (*models.Book, string) {
+	const isbnUnavailable = "Books can't be looked up by ISBN right now. Please enter the title instead."
+	_, isISBN := openlibrary.CleanISBN(query)
+
+	if h.OpenLibrary == nil || !h.Features.Enabled(r.Context(), "open_library_lookup") {
+		if isISBN {
+			return nil, isbnUnavailable
+		}
+		return &models.Book{Title: query, Author: author}, ""
+	}
+
+	book, err := h.OpenLibrary.Lookup(r.Context(), query, author)
+	switch {
+	case err == nil:
+		return book, ""
+	case errors.Is(err, openlibrary.ErrNotFound) && isISBN:
+		return nil, "No book was found with that ISBN"
+	case errors.Is(err, openlibrary.ErrNotFound):
+	case isISBN:
+		slog.WarnContext(r.Context(), "open library lookup failed", "err", err)
+		return nil, isbnUnavailable
+	default:
+		slog.WarnContext(r.Context(), "open library lookup failed", "err", err)
+	}
+	return &models.Book{Title: query, Author: author}, ""
+}
+
+// BookHandler shows a book with its average rating and all the posts
+// discussing or reviewing it
+func (h *Handler) BookHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/book/"))
+	if err != nil {
+		h.NotFoundHandler(w, r)
+		return
+	}
+
+	book, err := h.DB.GetBookByID(r.Context(), bookID)
+	if err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch book", "book_id", bookID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching book")
+		return
+	}
+
+	average, ratings, err := h.DB.GetBookRating(r.Context(), bookID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch book rating", "book_id", bookID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching book")
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	posts, err := h.DB.GetPostsByBook(r.Context(), bookID, currentUser != nil && currentUser.IsAdmin())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch posts about book", "book_id", bookID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching posts")
+		return
+	}
+	h.styleCategories(r, posts)
+
+	data := struct {
+		PageData
+		Book          *models.Book `json:"book"`
+		AverageRating string       `json:"average_rating,omitempty"` // One decimal place; empty when unrated
+		Ratings       int          `json:"ratings"`
+	}{
+		PageData: PageData{
+			Posts:       withoutBlocked(posts, h.blockedUsers(r, currentUser)),
+			CurrentUser: currentUser,
+			Title:       book.Title,
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: book.Title, URL: fmt.Sprintf("/book/%d", book.ID)}),
+		},
+		Book:    book,
+		Ratings: ratings,
+	}
+	if ratings > 0 {
+		data.AverageRating = fmt.Sprintf("%.1f", average)
+	}
+
+	h.Render(w, r, "book", data)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Limits on books added to shelves by hand
+const (
+	maxShelfNameLength  = 30
+	maxBookTitleLength  = 200
+	maxBookAuthorLength = 100
+)
+
+// builtinShelves are the shelves every member has, in display order
+var builtinShelves = []struct {
+	Name  string
+	Label string
+}{
+	{"currently-reading", "Currently Reading"},
+	{"to-read", "Want to Read"},
+	{"read", "Read"},
+}
+
+// bookshelf is a named shelf and the books on it, for display
+type bookshelf struct {
+	Name    string
+	Label   string
+	Entries []models.ShelfEntry
+}
+
+// groupShelves sorts a member's shelved books into shelves: the built-in
+// shelves first, even when empty, then custom shelves in the order their
+// most recently shelved book was added
+func groupShelves(entries []models.ShelfEntry) []bookshelf {
+	shelves := make([]bookshelf, 0, len(builtinShelves))
+	index := make(map[string]int)
+	for _, s := range builtinShelves {
+		index[s.Name] = len(shelves)
+		shelves = append(shelves, bookshelf{Name: s.Name, Label: s.Label})
+	}
+
+	for _, entry := range entries {
+		i, ok := index[entry.Shelf]
+		if !ok {
+			i = len(shelves)
+			index[entry.Shelf] = i
+			shelves = append(shelves, bookshelf{Name: entry.Shelf, Label: entry.Shelf})
+		}
+		shelves[i].Entries = append(shelves[i].Entries, entry)
+	}
+	return shelves
+}
+
+// normalizeShelfName turns a typed shelf name into the lowercase, hyphenated
+// form shelves are stored under, e.g. "Summer Reads" becomes "summer-reads"
+func normalizeShelfName(raw string) (string, error) {
+	name := strings.ToLower(strings.Join(strings.Fields(raw), "-"))
+	if name == "" {
+		return "", errors.New("Shelf name is required")
+	}
+	if len(name) > maxShelfNameLength {
+		return "", fmt.Errorf("Shelf names must be less than %d characters", maxShelfNameLength)
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return "", errors.New("Shelf names may only contain letters, numbers and spaces")
+		}
+	}
+	return name, nil
+}
+
+// shelfFromForm reads the shelf a book should go on: a new shelf typed into
+// new_shelf, or else one picked from the existing shelves
+func shelfFromForm(r *http.Request) (string, error) {
+	if name := strings.TrimSpace(r.FormValue("new_shelf")); name != "" {
+		return normalizeShelfName(name)
+	}
+	return normalizeShelfName(r.FormValue("shelf"))
+}
+
+// BookshelfHandler adds books to the current user's shelves, moves them
+// between shelves and removes them. The shelf is a built-in shelf or any
+// custom shelf name; custom shelves exist while they hold books.
+func (h *Handler) BookshelfHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	var err error
+	switch r.FormValue("action") {
+	case "add":
+		shelf, shelfErr := shelfFromForm(r)
+		if shelfErr != nil {
+			http.Error(w, shelfErr.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Books shown on the forum, such as in the cards under posts, are
+		// added by ID; others by their title and author
+		var book *models.Book
+		if r.FormValue("book_id") != "" {
+			bookID, convErr := strconv.Atoi(r.FormValue("book_id"))
+			if convErr != nil {
+				http.Error(w, "Invalid book ID", http.StatusBadRequest)
+				return
+			}
+			book, err = h.DB.GetBookByID(r.Context(), bookID)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Book not found", http.StatusNotFound)
+				return
+			} else if err != nil {
+				break
+			}
+		} else {
+			book = &models.Book{
+				Title:  strings.TrimSpace(r.FormValue("title")),
+				Author: strings.TrimSpace(r.FormValue("author")),
+			}
+			if book.Title == "" {
+				http.Error(w, "Book title is required", http.StatusBadRequest)
+				return
+			}
+			if len(book.Title) > maxBookTitleLength || len(book.Author) > maxBookAuthorLength {
+				http.Error(w, "Book title or author is too long", http.StatusBadRequest)
+				return
+			}
+			if err = h.DB.FindOrCreateBook(r.Context(), book); err != nil {
+				break
+			}
+		}
+		// Adding a book that is already shelved moves it, keeping its rating
+		err = h.DB.MoveShelfEntry(r.Context(), currentUser.ID, book.ID, shelf)
+		if err == sql.ErrNoRows {
+			err = h.DB.SaveShelfEntry(r.Context(), &models.ShelfEntry{UserID: currentUser.ID, BookID: book.ID, Shelf: shelf})
+		}
+	case "move":
+		bookID, convErr := strconv.Atoi(r.FormValue("book_id"))
+		if convErr != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+		shelf, shelfErr := shelfFromForm(r)
+		if shelfErr != nil {
+			http.Error(w, shelfErr.Error(), http.StatusBadRequest)
+			return
+		}
+		err = h.DB.MoveShelfEntry(r.Context(), currentUser.ID, bookID, shelf)
+	case "remove":
+		bookID, convErr := strconv.Atoi(r.FormValue("book_id"))
+		if convErr != nil {
+			http.Error(w, "Invalid book ID", http.StatusBadRequest)
+			return
+		}
+		err = h.DB.RemoveShelfEntry(r.Context(), currentUser.ID, bookID)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "That book isn't on your shelves", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update bookshelf", "action", r.FormValue("action"), "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating bookshelf")
+		return
+	}
+
+	http.Redirect(w, r, "/profile/"+currentUser.Username+"?tab=shelves", http.StatusSeeOther)
+}
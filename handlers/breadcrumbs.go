@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"literary-lions/i18n"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+)
+
+// Breadcrumb is a step on the way from the home page to the page being
+// shown, for the navigation trail above the page content
+type Breadcrumb struct {
+	Name string `json:"name"`
+	URL  string `json:"url"` // path of the step's page
+
+	// absoluteURL is the step's full address, for search engines
+	absoluteURL string
+}
+
+// Steps that lead to several pages
+var (
+	adminCrumb    = Breadcrumb{Name: "Admin Panel", URL: "/admin"}
+	messagesCrumb = Breadcrumb{Name: "Messages", URL: "/messages"}
+)
+
+// profileCrumb is the step for a member's profile
+func profileCrumb(username string) Breadcrumb {
+	return Breadcrumb{Name: username, URL: "/profile/" + username}
+}
+
+// categoryCrumb is the step for the home page listing of a category
+func categoryCrumb(id int, name string) Breadcrumb {
+	return Breadcrumb{Name: name, URL: fmt.Sprintf("/?category=%d", id)}
+}
+
+// categoryCrumbs is the trail to the home page listing of a category: the
+// categories it is in, then itself. Errors are logged and leave it empty.
+func (h *Handler) categoryCrumbs(r *http.Request, categoryID int) []Breadcrumb {
+	categories, err := h.DB.GetAllCategories(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch categories", "err", err)
+		return nil
+	}
+	byID := make(map[int]models.Category)
+	for _, category := range models.FlattenCategories(categories) {
+		byID[category.ID] = category
+	}
+
+	var trail []Breadcrumb
+	for category, ok := byID[categoryID]; ok; {
+		trail = append([]Breadcrumb{categoryCrumb(category.ID, category.Name)}, trail...)
+		if category.ParentID == nil {
+			break
+		}
+		category, ok = byID[*category.ParentID]
+	}
+	return trail
+}
+
+// postCrumb is the step for a post's page
+func postCrumb(post *models.Post) Breadcrumb {
+	return Breadcrumb{Name: post.Title, URL: fmt.Sprintf("/post/%d", post.ID)}
+}
+
+// breadcrumbs builds the navigation trail of a page: the home page, then
+// trail, which ends with the page itself
+func (h *Handler) breadcrumbs(r *http.Request, locale string, trail ...Breadcrumb) []Breadcrumb {
+	crumbs := append([]Breadcrumb{{Name: i18n.T(locale, "nav.home"), URL: "/"}}, trail...)
+	for i := range crumbs {
+		crumbs[i].absoluteURL = h.absoluteURL(r, crumbs[i].URL)
+	}
+	return crumbs
+}
+
+// breadcrumbList describes a navigation trail as schema.org structured
+// data, for search engines to show in results
+func breadcrumbList(crumbs []Breadcrumb) map[string]interface{} {
+	items := make([]map[string]interface{}, len(crumbs))
+	for i, crumb := range crumbs {
+		items[i] = map[string]interface{}{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"name":     crumb.Name,
+			"item":     crumb.absoluteURL,
+		}
+	}
+	return map[string]interface{}{
+		"@context":        "https://schema.org",
+		"@type":           "BreadcrumbList",
+		"itemListElement": items,
+	}
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxCategoryIconLength limits category icons, in characters. Emoji can
+	// take a few, e.g. with skin tones or variation selectors.
+	maxCategoryIconLength = 8
+
+	// maxCategoryNameLength limits category names, in characters
+	maxCategoryNameLength = 50
+)
+
+// categoryColor matches the colors categories may have
+var categoryColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// styleCategories sets the icon and color of the posts' category chips.
+// Errors are logged and leave the chips plain.
+func (h *Handler) styleCategories(r *http.Request, posts []models.Post) {
+	categories, err := h.DB.GetAllCategories(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch categories", "err", err)
+		return
+	}
+	byID := make(map[int]models.Category)
+	for _, category := range models.FlattenCategories(categories) {
+		byID[category.ID] = category
+	}
+	for i := range posts {
+		category := byID[posts[i].CategoryID]
+		posts[i].CategoryIcon = category.Icon
+		posts[i].CategoryColor = category.Color
+	}
+}
+
+// AdminCategoriesHandler lists the categories with their icons, colors,
+// positions and parents, changes them and adds new ones
+func (h *Handler) AdminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "create":
+			h.createCategory(w, r)
+		case "update":
+			h.updateCategory(w, r)
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+		}
+		return
+	}
+
+	categories, err := h.DB.GetAllCategories(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch categories", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching categories")
+		return
+	}
+
+	data := struct {
+		PageData
+		MaxIconLength int `json:"-"`
+		MaxNameLength int `json:"-"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Categories",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), adminCrumb, Breadcrumb{Name: "Categories", URL: "/admin/categories"}),
+			Categories:  models.FlattenCategories(categories),
+		},
+		MaxIconLength: maxCategoryIconLength,
+		MaxNameLength: maxCategoryNameLength,
+	}
+
+	h.Render(w, r, "admin_categories", data)
+}
+
+// categoryParent reads the parent category picked in the admin categories
+// form, nil for none. ok is false if the parent doesn't exist or is the
+// category itself or one of its subcategories, which would make a loop.
+func (h *Handler) categoryParent(r *http.Request, categoryID int) (parentID *int, ok bool) {
+	value := r.FormValue("parent_id")
+	if value == "" {
+		return nil, true
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, false
+	}
+
+	categories, err := h.DB.GetAllCategories(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch categories", "err", err)
+		return nil, false
+	}
+	byID := make(map[int]models.Category)
+	for _, category := range models.FlattenCategories(categories) {
+		byID[category.ID] = category
+	}
+
+	// Walk up from the parent; reaching the category means it would be its
+	// own ancestor
+	for category, found := byID[id]; ; {
+		if !found || category.ID == categoryID {
+			return nil, false
+		}
+		if category.ParentID == nil {
+			return &id, true
+		}
+		category, found = byID[*category.ParentID]
+	}
+}
+
+// createCategory adds a category, or a subcategory, from the admin
+// categories form
+func (h *Handler) createCategory(w http.ResponseWriter, r *http.Request) {
+	category := &models.Category{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Anonymous:   r.FormValue("anonymous") != "",
+	}
+	if category.Name == "" || utf8.RuneCountInString(category.Name) > maxCategoryNameLength {
+		h.addFlash(w, r, "error", fmt.Sprintf("Category names must be 1 to %d characters.", maxCategoryNameLength))
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+		return
+	}
+	parentID, ok := h.categoryParent(r, 0)
+	if !ok {
+		http.Error(w, "Invalid parent category", http.StatusBadRequest)
+		return
+	}
+	category.ParentID = parentID
+
+	categories, err := h.DB.GetAllCategories(r.Context())
+	if err == nil {
+		for _, existing := range models.FlattenCategories(categories) {
+			if strings.EqualFold(existing.Name, category.Name) {
+				h.addFlash(w, r, "error", "There is already a category with that name.")
+				http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+				return
+			}
+		}
+		err = h.DB.CreateCategory(r.Context(), category)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create category", "err", err)
+		h.addFlash(w, r, "error", "Failed to add the category. Please try again.")
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+		return
+	}
+	slog.InfoContext(r.Context(), "category created", "category_id", category.ID, "name", category.Name)
+
+	h.addFlash(w, r, "success", "Category added.")
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// updateCategory saves the icon, color, position, parent and anonymity of a
+// category from the admin categories form. An empty color shows the category's chips
+// in the default style.
+func (h *Handler) updateCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	category := &models.Category{
+		ID:        categoryID,
+		Icon:      strings.TrimSpace(r.FormValue("icon")),
+		Color:     strings.TrimSpace(r.FormValue("color")),
+		Anonymous: r.FormValue("anonymous") != "",
+	}
+	sortOrder, sortErr := strconv.Atoi(r.FormValue("sort_order"))
+	if utf8.RuneCountInString(category.Icon) > maxCategoryIconLength || (category.Color != "" && !categoryColor.MatchString(category.Color)) || sortErr != nil {
+		h.addFlash(w, r, "error", fmt.Sprintf("Icons can be up to %d characters, colors must look like #3498db and positions must be numbers.", maxCategoryIconLength))
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+		return
+	}
+	category.SortOrder = sortOrder
+
+	parentID, ok := h.categoryParent(r, categoryID)
+	if !ok {
+		h.addFlash(w, r, "error", "A category can't be moved into itself or one of its subcategories.")
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+		return
+	}
+	category.ParentID = parentID
+
+	err = h.DB.UpdateCategory(r.Context(), category)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update category", "category_id", categoryID, "err", err)
+		h.addFlash(w, r, "error", "Failed to update the category. Please try again.")
+		http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+		return
+	}
+	slog.InfoContext(r.Context(), "category updated", "category_id", categoryID, "icon", category.Icon, "color", category.Color, "sort_order", category.SortOrder, "parent_id", category.ParentID, "anonymous", category.Anonymous)
+
+	// Cached post pages show the category's chip and its parents, and the
+	// authors unless it is anonymous
+	h.invalidatePostPages()
+	h.addFlash(w, r, "success", "Category updated.")
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// sparklineWidth and sparklineHeight are the size in pixels of the activity
+// chart on category pages
+const (
+	sparklineWidth  = 300
+	sparklineHeight = 40
+)
+
+// findCategory finds a category in a category tree
+func findCategory(tree []models.Category, id int) (models.Category, bool) {
+	for _, category := range tree {
+		if category.ID == id {
+			return category, true
+		}
+		if found, ok := findCategory(category.Children, id); ok {
+			return found, true
+		}
+	}
+	return models.Category{}, false
+}
+
+// sparkline draws counts as the points of an SVG polyline of the given size,
+// from left to right, with the highest count reaching the top
+func sparkline(counts []int, width, height int) string {
+	highest := 1
+	for _, n := range counts {
+		highest = max(highest, n)
+	}
+
+	points := make([]string, len(counts))
+	for i, n := range counts {
+		x := 0.0
+		if len(counts) > 1 {
+			x = float64(i*width) / float64(len(counts)-1)
+		}
+		y := float64(height) - float64(n*height)/float64(highest)
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(points, " ")
+}
+
+// CategoryAboutHandler shows the statistics of a category at
+// /category/{id}/about: how many posts and comments it and its
+// subcategories hold, their most active members and recent activity
+func (h *Handler) CategoryAboutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/category/"), "/about")
+	categoryID, err := strconv.Atoi(idStr)
+	if !ok || err != nil {
+		h.NotFoundHandler(w, r)
+		return
+	}
+
+	categories, err := h.DB.GetAllCategories(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch categories", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching categories")
+		return
+	}
+	category, ok := findCategory(categories, categoryID)
+	if !ok {
+		h.NotFoundHandler(w, r)
+		return
+	}
+
+	stats, err := h.DB.GetCategoryStats(r.Context(), categoryID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch category stats", "category_id", categoryID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching category statistics")
+		return
+	}
+	recent := 0
+	for _, n := range stats.Daily {
+		recent += n
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	data := struct {
+		PageData
+		Category        models.Category       `json:"category"`
+		Stats           *models.CategoryStats `json:"stats"`
+		RecentActivity  int                   `json:"recent_activity"` // Posts and comments written over ActivityDays
+		ActivityDays    int                   `json:"activity_days"`
+		Sparkline       string                `json:"-"`
+		SparklineWidth  int                   `json:"-"`
+		SparklineHeight int                   `json:"-"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "About " + category.Name,
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), append(h.categoryCrumbs(r, categoryID),
+				Breadcrumb{Name: "About", URL: fmt.Sprintf("/category/%d/about", categoryID)})...),
+		},
+		Category:        category,
+		Stats:           stats,
+		RecentActivity:  recent,
+		ActivityDays:    len(stats.Daily),
+		Sparkline:       sparkline(stats.Daily, sparklineWidth, sparklineHeight),
+		SparklineWidth:  sparklineWidth,
+		SparklineHeight: sparklineHeight,
+	}
+
+	h.Render(w, r, "category_about", data)
+}
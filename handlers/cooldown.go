@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// contributionWait returns how much longer user must wait, under the
+// configured cooldowns, before writing another post, or another comment
+// when comment is set. It is zero when they may go ahead. New accounts, by
+// age or trust level, wait longer; regulars and admins never wait.
+func (h *Handler) contributionWait(r *http.Request, user *models.User, comment bool) time.Duration {
+	if user.Trusted(models.TrustRegular) {
+		return 0
+	}
+	cooldown := h.Config.Cooldown
+	interval := cooldown.Post
+	if comment {
+		interval = cooldown.Comment
+	}
+	if time.Since(user.CreatedAt) < cooldown.NewAccountAge || !user.Trusted(models.TrustMember) {
+		if comment {
+			interval = max(interval, cooldown.NewComment)
+		} else {
+			interval = max(interval, cooldown.NewPost)
+		}
+	}
+	if interval <= 0 {
+		return 0
+	}
+
+	lastPost, lastComment, err := h.DB.GetLastContributions(r.Context(), user.ID)
+	if err != nil {
+		// Better to let a member through than to stop everyone posting
+		slog.ErrorContext(r.Context(), "failed to check contribution cooldown", "err", err)
+		return 0
+	}
+	last := lastPost
+	if comment {
+		last = lastComment
+	}
+	if last.IsZero() {
+		return 0
+	}
+	return max(time.Until(last.Add(interval)), 0)
+}
+
+// slowDown tells a member how long they have to wait before writing another
+// post or comment
+func slowDown(wait time.Duration, what string) string {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	when := pluralize(seconds, "second", "seconds")
+	if seconds >= 60 {
+		when = pluralize((seconds+59)/60, "minute", "minutes")
+	}
+	return fmt.Sprintf("Slow down a little! You can write another %s in %s.", what, when)
+}
+
+// setRetryAfter tells clients refused by a cooldown when to try again, in
+// whole seconds as Retry-After requires
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
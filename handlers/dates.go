@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"literary-lions/i18n"
+	"literary-lions/models"
+	"time"
+)
+
+// dateFormats are the named layouts of formatDate, so pages show dates
+// alike
+var dateFormats = map[string]string{
+	"date":          "January 2, 2006",
+	"datetime":      "January 2, 2006 at 3:04 PM",
+	"short":         "Jan 2, 2006",
+	"shortdatetime": "Jan 2, 2006 at 3:04 PM",
+	"month":         "January 2006",
+	"iso":           time.RFC3339,
+}
+
+// formatDate formats t, a time.Time or *time.Time, in the viewer's time
+// zone with one of the dateFormats, e.g. "datetime". A nil *time.Time
+// formats as "".
+func formatDate(t interface{}, viewer *models.User, format string) (string, error) {
+	layout, ok := dateFormats[format]
+	if !ok {
+		return "", fmt.Errorf("formatDate: unknown format %q", format)
+	}
+	return localTime(t, viewer, layout), nil
+}
+
+// timeago describes how long ago t, a time.Time or *time.Time, was, such
+// as "3 hours ago", in the locale's language. Times less than a minute ago,
+// or in the future, are "just now".
+func timeago(t interface{}, locale string) string {
+	when, ok := timeValue(t)
+	if !ok {
+		return ""
+	}
+
+	const day = 24 * time.Hour
+	switch d := time.Since(when); {
+	case d < time.Minute:
+		return i18n.T(locale, "time.just_now")
+	case d < time.Hour:
+		return i18n.N(locale, "time.minutes_ago", int(d/time.Minute))
+	case d < day:
+		return i18n.N(locale, "time.hours_ago", int(d/time.Hour))
+	case d < 30*day:
+		return i18n.N(locale, "time.days_ago", int(d/day))
+	case d < 365*day:
+		return i18n.N(locale, "time.months_ago", int(d/(30*day)))
+	default:
+		return i18n.N(locale, "time.years_ago", int(d/(365*day)))
+	}
+}
+
+// pluralize counts n things, such as "1 comment" or "3 comments"
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"database/sql"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+)
+
+// DeactivateAccountHandler deactivates the current user's account: their
+// profile and content are hidden and they are logged out everywhere until
+// they log in again and reactivate it
+func (h *Handler) DeactivateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	currentUser := h.GetCurrentUser(r)
+
+	err := h.DB.DeactivateUser(r.Context(), currentUser.ID)
+	if err == sql.ErrNoRows {
+		h.renderEditProfile(w, r, currentUser, http.StatusConflict, "Suspended accounts can't be deactivated")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to deactivate user", "target_user_id", currentUser.ID, "err", err)
+		h.renderEditProfile(w, r, currentUser, http.StatusInternalServerError, "Failed to deactivate your account. Please try again.")
+		return
+	}
+	h.invalidatePostPages()
+	slog.InfoContext(r.Context(), "account deactivated", "target_user_id", currentUser.ID)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	h.addFlash(w, r, "success", "Your account is deactivated. Log in again whenever you want to bring it back.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// hiddenFrom reports whether user's profile and content are hidden from
+// viewer, who may be nil, because user deactivated their account. Admins
+// still see them.
+func hiddenFrom(viewer, user *models.User) bool {
+	return user.IsDeactivated() && (viewer == nil || !viewer.IsAdmin())
+}
+
+// postHidden reports whether post is hidden from viewer, who may be nil,
+// because its author deactivated their account. Every page showing a thread
+// checks it.
+func (h *Handler) postHidden(r *http.Request, viewer *models.User, post *models.Post) bool {
+	author, err := h.DB.GetUserByID(r.Context(), post.UserID)
+	return err == nil && hiddenFrom(viewer, author)
+}
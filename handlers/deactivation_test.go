@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"literary-lions/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestDeactivatedMembersThreadsAreHidden(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	post := &models.Post{Title: "Alice's thread", Content: "Soon gone", UserID: alice.ID, CategoryID: 1}
+	if err := db.CreatePost(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	comment := &models.Comment{Content: "A reply", UserID: bob.ID, PostID: post.ID}
+	if err := db.CreateComment(ctx, comment); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeactivateUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	thread := "/post/" + strconv.Itoa(post.ID)
+	for _, route := range []struct {
+		target  string
+		handler http.HandlerFunc
+	}{
+		{thread, h.ViewPostHandler},
+		{thread + "/reader", h.ViewPostHandler},
+		{thread + "/export.md", h.ViewPostHandler},
+		{"/comment/" + strconv.Itoa(comment.ID), h.CommentFragmentHandler},
+	} {
+		w := httptest.NewRecorder()
+		route.handler(w, httptest.NewRequest(http.MethodGet, route.target, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s answered %d, want %d", route.target, w.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Posts can be scheduled for up to a year ahead, in whole minutes. Times
+// are entered in the author's time zone, as a datetime-local input sends
+// them.
+const (
+	maxScheduleAhead = 365 * 24 * time.Hour
+	scheduleLayout   = "2006-01-02T15:04"
+)
+
+// parsePublishAt reads the time a post is scheduled for, entered in the
+// author's time zone. It returns a message for the author if the time isn't
+// valid or isn't in the next year.
+func parsePublishAt(value string, author *models.User, now time.Time) (time.Time, string) {
+	if value == "" {
+		return time.Time{}, "Choose when to publish the post"
+	}
+	publishAt, err := time.ParseInLocation(scheduleLayout, value, viewerLocation(author))
+	if err != nil {
+		return time.Time{}, "Choose a valid date and time to publish the post"
+	}
+	if !publishAt.After(now) {
+		return time.Time{}, "Scheduled posts must be published in the future"
+	}
+	if publishAt.Sub(now) > maxScheduleAhead {
+		return time.Time{}, "Posts can be scheduled for up to a year ahead"
+	}
+	return publishAt, ""
+}
+
+// DraftsHandler lists the current user's posts waiting to be published and
+// cancels them
+func (h *Handler) DraftsHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	if r.Method == http.MethodPost {
+		h.cancelScheduledPost(w, r, currentUser)
+		return
+	}
+
+	scheduled, err := h.DB.GetScheduledPostsByUser(r.Context(), currentUser.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch scheduled posts", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching drafts")
+		return
+	}
+
+	data := struct {
+		PageData
+		Scheduled []models.ScheduledPost `json:"scheduled"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Drafts",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Drafts", URL: "/drafts"}),
+		},
+		Scheduled: scheduled,
+	}
+
+	h.Render(w, r, "drafts", data)
+}
+
+// cancelScheduledPost deletes one of the current user's scheduled posts, as
+// the drafts page's cancel button asks
+func (h *Handler) cancelScheduledPost(w http.ResponseWriter, r *http.Request, currentUser *models.User) {
+	if r.FormValue("action") != "cancel" {
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	postID, err := strconv.Atoi(r.FormValue("scheduled_id"))
+	if err != nil {
+		http.Error(w, "Invalid scheduled post ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.CancelScheduledPost(r.Context(), postID, currentUser.ID)
+	switch {
+	case err == sql.ErrNoRows:
+		// Already published, or not theirs
+		h.addFlash(w, r, "error", "That post is no longer scheduled.")
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to cancel scheduled post", "scheduled_id", postID, "err", err)
+		h.addFlash(w, r, "error", "Failed to cancel the post. Please try again.")
+	default:
+		slog.InfoContext(r.Context(), "scheduled post cancelled", "scheduled_id", postID)
+		h.addFlash(w, r, "success", "The scheduled post was cancelled.")
+	}
+	http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+}
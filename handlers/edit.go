@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/database"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// editPageData is rendered by templates/edit.html for both posts and comments.
+// UpdatedAt is the version token the form posts back; when a save conflicts,
+// the Saved fields hold the version someone else stored in the meantime.
+type editPageData struct {
+	PageData
+	Kind         string // "post" or "comment"
+	ID           int
+	PostID       int
+	EditTitle    string
+	Content      string
+	UpdatedAt    string
+	Conflict     bool
+	SavedTitle   string
+	SavedContent string
+}
+
+// formatVersion encodes an updated_at time as the edit form's version token
+func formatVersion(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// EditPostHandler shows and saves the post edit form. Authors can edit their
+// own posts; admins can edit any post. A save is rejected with a merge
+// conflict page if the post changed after the form was loaded.
+func (h *Handler) EditPostHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	postID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	post, err := h.DB.GetPostByID(r.Context(), postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.NotFoundHandler(w, r)
+			return
+		}
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+
+	if post.UserID != currentUser.ID && !currentUser.IsAdmin() {
+		h.RenderError(w, r, http.StatusForbidden, "")
+		return
+	}
+	if post.ArchivedAt != nil {
+		h.RenderError(w, r, http.StatusForbidden, "This thread is archived")
+		return
+	}
+
+	data := editPageData{
+		PageData:  PageData{CurrentUser: currentUser, Title: "Edit Post"},
+		Kind:      "post",
+		ID:        post.ID,
+		PostID:    post.ID,
+		EditTitle: post.Title,
+		Content:   post.Content,
+		UpdatedAt: formatVersion(post.UpdatedAt),
+	}
+	data.Breadcrumbs = h.breadcrumbs(r, h.locale(r, currentUser), append(h.categoryCrumbs(r, post.CategoryID), postCrumb(post),
+		Breadcrumb{Name: "Edit Post", URL: fmt.Sprintf("/edit-post?id=%d", post.ID)})...)
+
+	switch r.Method {
+	case http.MethodGet:
+		h.renderEditPage(w, r, http.StatusOK, data)
+	case http.MethodPost:
+		data.EditTitle = strings.TrimSpace(r.FormValue("title"))
+		data.Content = strings.TrimSpace(r.FormValue("content"))
+		data.UpdatedAt = r.FormValue("updated_at")
+
+		errors := h.checkPostLengths(data.EditTitle, data.Content)
+		if msg := linksNotAllowed(currentUser, data.EditTitle+"\n"+data.Content); msg != "" {
+			errors = append(errors, msg)
+		}
+		loadedAt, err := time.Parse(time.RFC3339Nano, data.UpdatedAt)
+		if err != nil {
+			errors = append(errors, "The edit form is out of date, please reload it")
+		}
+		if len(errors) > 0 {
+			data.Error = strings.Join(errors, "; ")
+			h.renderEditPage(w, r, http.StatusBadRequest, data)
+			return
+		}
+
+		err = h.DB.UpdatePost(r.Context(), postID, data.EditTitle, data.Content, loadedAt, time.Now())
+		if err == database.ErrEditConflict {
+			// Keep the user's text in the form, but take the newer version as
+			// the token so saving again deliberately overwrites it
+			data.Conflict = true
+			data.SavedTitle = post.Title
+			data.SavedContent = post.Content
+			data.UpdatedAt = formatVersion(post.UpdatedAt)
+			h.renderEditPage(w, r, http.StatusConflict, data)
+			return
+		}
+		if err != nil {
+			if err == database.ErrArchived {
+				h.RenderError(w, r, http.StatusForbidden, "This thread is archived")
+				return
+			}
+			slog.ErrorContext(r.Context(), "failed to update post", "post_id", postID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error saving post")
+			return
+		}
+		h.PageCache.DeletePrefix(postPagePrefix(postID))
+
+		http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// EditCommentHandler shows and saves the comment edit form, with the same
+// permission and conflict rules as EditPostHandler
+func (h *Handler) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	commentID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.DB.GetCommentByID(r.Context(), commentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.NotFoundHandler(w, r)
+			return
+		}
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching comment")
+		return
+	}
+
+	if comment.UserID != currentUser.ID && !currentUser.IsAdmin() {
+		h.RenderError(w, r, http.StatusForbidden, "")
+		return
+	}
+
+	version := comment.CreatedAt
+	if comment.EditedAt != nil {
+		version = *comment.EditedAt
+	}
+
+	data := editPageData{
+		PageData:  PageData{CurrentUser: currentUser, Title: "Edit Comment"},
+		Kind:      "comment",
+		ID:        comment.ID,
+		PostID:    comment.PostID,
+		Content:   comment.Content,
+		UpdatedAt: formatVersion(version),
+	}
+	// Lead back to the comment's thread
+	if post, err := h.DB.GetPostByID(r.Context(), comment.PostID); err == nil {
+		data.Breadcrumbs = h.breadcrumbs(r, h.locale(r, currentUser), append(h.categoryCrumbs(r, post.CategoryID), postCrumb(post),
+			Breadcrumb{Name: "Edit Comment", URL: fmt.Sprintf("/edit-comment?id=%d", comment.ID)})...)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.renderEditPage(w, r, http.StatusOK, data)
+	case http.MethodPost:
+		data.Content = strings.TrimSpace(r.FormValue("content"))
+		data.UpdatedAt = r.FormValue("updated_at")
+
+		var errors []string
+		if msg := checkLength("Comment", data.Content, h.Config.Content.Comment); msg != "" {
+			errors = append(errors, msg)
+		}
+		if msg := linksNotAllowed(currentUser, data.Content); msg != "" {
+			errors = append(errors, msg)
+		}
+		loadedAt, err := time.Parse(time.RFC3339Nano, data.UpdatedAt)
+		if err != nil {
+			errors = append(errors, "The edit form is out of date, please reload it")
+		}
+		if len(errors) > 0 {
+			data.Error = strings.Join(errors, "; ")
+			h.renderEditPage(w, r, http.StatusBadRequest, data)
+			return
+		}
+
+		err = h.DB.UpdateComment(r.Context(), commentID, data.Content, loadedAt, time.Now())
+		if err == database.ErrEditConflict {
+			data.Conflict = true
+			data.SavedContent = comment.Content
+			data.UpdatedAt = formatVersion(version)
+			h.renderEditPage(w, r, http.StatusConflict, data)
+			return
+		}
+		if err != nil {
+			if err == database.ErrArchived {
+				h.RenderError(w, r, http.StatusForbidden, "This thread is archived")
+				return
+			}
+			slog.ErrorContext(r.Context(), "failed to update comment", "comment_id", commentID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error saving comment")
+			return
+		}
+		h.PageCache.DeletePrefix(postPagePrefix(comment.PostID))
+
+		http.Redirect(w, r, fmt.Sprintf("/post/%d#comment-%d", comment.PostID, commentID), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderEditPage renders the shared edit form with the given status code
+func (h *Handler) renderEditPage(w http.ResponseWriter, r *http.Request, status int, data editPageData) {
+	h.RenderStatus(w, r, status, "edit", data)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"literary-lions/auth"
+	"literary-lions/database"
+	"literary-lions/mailer"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// emailChangeLifetime is how long the link confirming a new email address
+// works
+const emailChangeLifetime = 24 * time.Hour
+
+// sendMail sends msg with the configured mailer, or logs it when there is
+// none
+func (h *Handler) sendMail(ctx context.Context, msg mailer.Message) error {
+	if h.Mailer == nil {
+		return mailer.Log{}.Send(ctx, msg)
+	}
+	return h.Mailer.Send(ctx, msg)
+}
+
+// absoluteURL turns a path into a link for emails, on the configured base
+// URL or else the address the request was sent to
+func (h *Handler) absoluteURL(r *http.Request, path string) string {
+	if h.Config != nil && h.Config.Server.BaseURL != "" {
+		return strings.TrimRight(h.Config.Server.BaseURL, "/") + path
+	}
+	scheme := "http"
+	if h.Config != nil && h.Config.TLS.Enabled() {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// ChangeEmailHandler starts changing the current user's email address. A
+// link to confirm it is sent to the new address and a notice to the old
+// one; the address only changes once the link is followed. Posting
+// action=cancel drops the pending change.
+func (h *Handler) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	if r.FormValue("action") == "cancel" {
+		if err := h.DB.CancelEmailChange(r.Context(), currentUser.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to cancel email change", "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error cancelling email change")
+			return
+		}
+		http.Redirect(w, r, "/edit-profile", http.StatusSeeOther)
+		return
+	}
+
+	newEmail := strings.TrimSpace(r.FormValue("email"))
+	if !auth.ValidateEmail(newEmail) {
+		h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, "Invalid email format")
+		return
+	}
+	if newEmail == currentUser.Email {
+		h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, "That's already your email address")
+		return
+	}
+
+	// Asking for the password keeps anyone who finds a logged in browser
+	// from taking over the account
+	account, err := h.DB.GetUserByEmail(r.Context(), currentUser.Email)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch account", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error changing email")
+		return
+	}
+	if !auth.CheckPassword(r.FormValue("password"), account.Password) {
+		h.renderEditProfile(w, r, currentUser, http.StatusForbidden, "Incorrect password")
+		return
+	}
+
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate email change token", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error changing email")
+		return
+	}
+	change := &models.EmailChange{
+		UserID:    currentUser.ID,
+		NewEmail:  newEmail,
+		ExpiresAt: time.Now().Add(emailChangeLifetime),
+	}
+	err = h.DB.RequestEmailChange(r.Context(), change, token)
+	if err == database.ErrEmailTaken {
+		h.renderEditProfile(w, r, currentUser, http.StatusConflict, "Email already exists")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to request email change", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error changing email")
+		return
+	}
+
+	link := h.absoluteURL(r, "/confirm-email?token="+url.QueryEscape(token))
+	err = h.sendMail(r.Context(), mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Literary Lions email address",
+		Body: fmt.Sprintf("Hi %s,\n\nTo use this address for your Literary Lions account, follow this link within %d hours:\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			currentUser.Username, int(emailChangeLifetime.Hours()), link),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to send email change confirmation", "err", err)
+		if err := h.DB.CancelEmailChange(r.Context(), currentUser.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to cancel email change", "err", err)
+		}
+		h.renderEditProfile(w, r, currentUser, http.StatusInternalServerError, "We couldn't send the confirmation email. Please try again later.")
+		return
+	}
+
+	err = h.sendMail(r.Context(), mailer.Message{
+		To:      currentUser.Email,
+		Subject: "Your Literary Lions email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email address of your Literary Lions account to %s. It changes once the link sent there is followed.\n\nIf this wasn't you, log in, cancel the change on your Edit Profile page and change your password.\n",
+			currentUser.Username, newEmail),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to send email change notice", "err", err)
+	}
+
+	slog.InfoContext(r.Context(), "email change requested")
+	http.Redirect(w, r, "/edit-profile", http.StatusSeeOther)
+}
+
+// ConfirmEmailHandler changes a member's email address when they follow the
+// link sent to the new address. They don't need to be logged in.
+func (h *Handler) ConfirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := http.StatusOK
+	var message string
+	change, err := h.DB.ConfirmEmailChange(r.Context(), r.URL.Query().Get("token"))
+	switch {
+	case err == sql.ErrNoRows:
+		status = http.StatusBadRequest
+		message = "This link is invalid or has expired. Change your email address again from your Edit Profile page."
+	case err == database.ErrEmailTaken:
+		status = http.StatusConflict
+		message = "Another member has started using this email address, so it can't be used."
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to confirm email change", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error confirming email")
+		return
+	default:
+		slog.InfoContext(r.Context(), "email changed", "target_user_id", change.UserID)
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	data := struct {
+		PageData
+		NewEmail string `json:"new_email,omitempty"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Confirm Email",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Confirm Email", URL: "/confirm-email"}),
+			Error:       message,
+		},
+	}
+	if change != nil {
+		data.NewEmail = change.NewEmail
+	}
+
+	h.RenderStatus(w, r, status, "confirm_email", data)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"literary-lions/i18n"
+	"literary-lions/logging"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// errorTitles are the catalog keys for the error pages' titles
+var errorTitles = map[int]string{
+	http.StatusForbidden:           "forbidden.title",
+	http.StatusNotFound:            "not_found.title",
+	http.StatusInternalServerError: "server_error.title",
+	http.StatusServiceUnavailable:  "unavailable.title",
+}
+
+// errorPage is the data error page templates are rendered with
+type errorPage struct {
+	PageData
+	Status    int    `json:"status"`
+	Message   string `json:"message,omitempty"`    // shown instead of the page's usual explanation, if set
+	RequestID string `json:"request_id,omitempty"` // shown on server error pages, for reporting the problem
+}
+
+// RenderError answers with the error page for status: 403, 404, 500 or 503,
+// or the 500 page for other server errors. A message, if given, replaces the
+// page's usual explanation on 403 and 404 pages. Scripts, which call the
+// JSON API or ask for page fragments, get the message or status text as
+// plain text instead, as do statuses without a page.
+//
+// Server error pages may be shown while the database or templates are
+// failing, during a panic even, so they look nothing up: they only show the
+// user the request was already authenticated as, in the browser's language,
+// with the templates parsed at startup.
+func (h *Handler) RenderError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	// A request that ran out of time failed because the forum is too busy
+	if status == http.StatusInternalServerError && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		status = http.StatusServiceUnavailable
+	}
+
+	page := status
+	tmpl, ok := h.Templates.ErrorPage(page)
+	if !ok && status >= 500 {
+		page = http.StatusInternalServerError
+		tmpl, ok = h.Templates.ErrorPage(page)
+	}
+	if !ok || wantsPlainError(r) {
+		plainError(w, r, status, message)
+		return
+	}
+
+	data := errorPage{Status: status, Message: message}
+	if status >= 500 {
+		user := requestUser(r)
+		data.PageData = PageData{
+			CurrentUser: user,
+			Locale:      h.locale(r, user),
+			Theme:       "auto", // following the system; the saved theme needs the database
+		}
+		data.RequestID = logging.RequestID(r.Context())
+	} else {
+		h.fillPageData(w, r, &data.PageData)
+	}
+	data.Title = http.StatusText(page)
+	if key, ok := errorTitles[page]; ok {
+		data.Title = i18n.T(data.Locale, key)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "base", data); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render error page", "status", status, "err", err)
+		plainError(w, r, status, message)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// wantsPlainError reports whether a request came from a script that shows
+// or handles errors itself, rather than from someone browsing
+func wantsPlainError(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || isFragmentRequest(r) ||
+		strings.HasPrefix(r.Header.Get("Accept"), "application/json")
+}
+
+// plainError answers with message, or the status text if there is none, as
+// plain text. Server errors also carry the request ID.
+func plainError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	if status >= 500 {
+		message += " (request ID " + logging.RequestID(r.Context()) + ")"
+	}
+	http.Error(w, message, status)
+}
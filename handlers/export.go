@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// exportThread answers /post/{id}/export.md with the post with the given ID
+// and its whole comment tree, with authors and times, as a Markdown file to
+// download. Replies are quoted one level deeper than what they answer.
+// Dates are in the viewer's time zone. For a PDF, the reader view is made
+// for printing.
+func (h *Handler) exportThread(w http.ResponseWriter, r *http.Request, postIDStr string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.Atoi(postIDStr)
+	if err != nil {
+		h.NotFoundHandler(w, r)
+		return
+	}
+
+	post, err := h.DB.GetPostByID(r.Context(), postID)
+	if err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch post", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	if h.postHidden(r, currentUser, post) {
+		h.NotFoundHandler(w, r)
+		return
+	}
+	comments, err := h.threadComments(r, currentUser, post)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch comments", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching comments")
+		return
+	}
+	// The tree needs parents first, which oldest first guarantees
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+	})
+	trees := h.buildCommentTree(comments)
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": exportFilename(post) + ".md",
+	}))
+
+	out := bufio.NewWriter(w)
+	when := func(t time.Time) string { return localTime(t, currentUser, dateFormats["datetime"]) }
+
+	fmt.Fprintf(out, "# %s\n\n", post.Title)
+	fmt.Fprintf(out, "*By **%s** in %s, %s", post.Username, post.CategoryName, when(post.CreatedAt))
+	if post.UpdatedAt.After(post.CreatedAt) {
+		fmt.Fprintf(out, " (edited %s)", when(post.UpdatedAt))
+	}
+	out.WriteString("*\n\n")
+	if post.BookID != nil {
+		fmt.Fprintf(out, "About *%s*\n\n", post.BookTitle)
+	}
+	if post.Collapsed {
+		out.WriteString("*This post is by a member you blocked.*\n\n")
+	} else {
+		fmt.Fprintf(out, "%s\n\n", strings.TrimSpace(post.Content))
+	}
+	fmt.Fprintf(out, "👍 %d · 👎 %d\n\n---\n\n", post.LikesCount, post.DislikesCount)
+
+	fmt.Fprintf(out, "## %s\n\n", pluralize(len(comments), "Comment", "Comments"))
+	var write func(tree models.CommentTree, depth int)
+	write = func(tree models.CommentTree, depth int) {
+		quote := strings.Repeat("> ", depth)
+		lines := []string{fmt.Sprintf("**%s** · %s · 👍 %d · 👎 %d", tree.Username, when(tree.CreatedAt), tree.LikesCount, tree.DislikesCount), ""}
+		if tree.Collapsed {
+			lines = append(lines, "*This comment is by a member you blocked.*")
+		} else {
+			lines = append(lines, strings.Split(strings.TrimSpace(tree.Content), "\n")...)
+		}
+		for _, line := range lines {
+			out.WriteString(strings.TrimRight(quote+line, " ") + "\n")
+		}
+		out.WriteString(strings.TrimRight(quote, " ") + "\n")
+		for _, reply := range tree.Replies {
+			write(reply, depth+1)
+		}
+		if depth == 0 {
+			out.WriteString("\n")
+		}
+	}
+	for _, tree := range trees {
+		write(tree, 0)
+	}
+
+	fmt.Fprintf(out, "---\n\nExported from %s on %s.\n", h.absoluteURL(r, fmt.Sprintf("/post/%d", post.ID)), when(time.Now()))
+	if err := out.Flush(); err != nil {
+		slog.WarnContext(r.Context(), "failed to send thread export", "post_id", postID, "err", err)
+	}
+}
+
+// exportFilename names a thread's export after its title, such as
+// "my-favourite-novels", or "thread-12" if the title has no letters or
+// digits
+func exportFilename(post *models.Post) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(post.Title) {
+		switch {
+		case c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c)):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			dash = false
+		default:
+			dash = true
+		}
+		if b.Len() >= 60 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return fmt.Sprintf("thread-%d", post.ID)
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"literary-lions/features"
+	"log/slog"
+	"net/http"
+)
+
+// AdminFeaturesHandler lists the feature flags and turns them on and off
+func (h *Handler) AdminFeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	if r.Method == http.MethodPost {
+		name := r.FormValue("name")
+		enabled := r.FormValue("enabled") == "true"
+
+		err := h.Features.Set(r.Context(), name, enabled)
+		switch {
+		case errors.Is(err, features.ErrUnknownFlag):
+			http.Error(w, "Unknown feature flag", http.StatusBadRequest)
+			return
+		case errors.Is(err, features.ErrOverridden):
+			h.addFlash(w, r, "error", "This flag is fixed by the FEATURES setting and cannot be changed here.")
+			http.Redirect(w, r, "/admin/features", http.StatusSeeOther)
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "failed to set feature flag", "flag", name, "enabled", enabled, "err", err)
+			h.addFlash(w, r, "error", "Failed to update feature flag. Please try again.")
+			http.Redirect(w, r, "/admin/features", http.StatusSeeOther)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "feature flag changed", "flag", name, "enabled", enabled)
+		// Cached post pages may show or hide the feature
+		h.invalidatePostPages()
+		h.addFlash(w, r, "success", "Feature flag updated.")
+		http.Redirect(w, r, "/admin/features", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		PageData
+		Flags []features.Status `json:"flags"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Feature Flags",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), adminCrumb, Breadcrumb{Name: "Feature Flags", URL: "/admin/features"}),
+		},
+		Flags: h.Features.Statuses(r.Context()),
+	}
+
+	h.Render(w, r, "admin_features", data)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// flashCookie holds the flash messages of visitors who aren't logged in,
+	// such as members who just deleted their profile
+	flashCookie = "flash"
+
+	// flashCookieLifetime is how long visitors' flash messages wait to be
+	// shown
+	flashCookieLifetime = 5 * time.Minute
+)
+
+// addFlash queues a message for the next page the viewer sees, for
+// confirming actions that redirect. It is stored on their session, or in a
+// cookie when they have none. kind is "success" or "error".
+func (h *Handler) addFlash(w http.ResponseWriter, r *http.Request, kind, message string) {
+	flash := models.Flash{Kind: kind, Message: message}
+
+	if cookie, err := r.Cookie("session"); err == nil {
+		err := h.DB.AddFlash(r.Context(), cookie.Value, flash)
+		if err == nil {
+			return
+		}
+		if err != sql.ErrNoRows {
+			slog.ErrorContext(r.Context(), "failed to add flash message", "err", err)
+			return
+		}
+		// The session has ended, e.g. with the member deleting their profile
+	}
+
+	encoded, err := json.Marshal(append(cookieFlashes(r), flash))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to encode flash message", "err", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(encoded),
+		Expires:  time.Now().Add(flashCookieLifetime),
+		HttpOnly: true,
+		Secure:   h.Config.TLS.Enabled(),
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+}
+
+// flashes takes the messages queued for the viewer, to show on the page
+// being rendered. Each is shown once. Errors are logged and show none.
+func (h *Handler) flashes(w http.ResponseWriter, r *http.Request) []models.Flash {
+	var flashes []models.Flash
+
+	if cookie, err := r.Cookie("session"); err == nil {
+		flashes, err = h.DB.TakeFlashes(r.Context(), cookie.Value)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to fetch flash messages", "err", err)
+		}
+	}
+
+	if hasCookieFlashes(r) {
+		flashes = append(flashes, cookieFlashes(r)...)
+		http.SetCookie(w, &http.Cookie{
+			Name:     flashCookie,
+			Value:    "",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Path:     "/",
+		})
+	}
+	return flashes
+}
+
+// hasCookieFlashes reports whether a visitor has flash messages waiting in
+// their cookie. Pages showing them mustn't be cached for other visitors.
+func hasCookieFlashes(r *http.Request) bool {
+	_, err := r.Cookie(flashCookie)
+	return err == nil
+}
+
+// cookieFlashes decodes the flash messages in the visitor's cookie. A
+// malformed cookie holds none.
+func cookieFlashes(r *http.Request) []models.Flash {
+	cookie, err := r.Cookie(flashCookie)
+	if err != nil {
+		return nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	var flashes []models.Flash
+	if err := json.Unmarshal(data, &flashes); err != nil {
+		return nil
+	}
+	return flashes
+}
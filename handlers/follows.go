@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// FollowThreadHandler follows or unfollows a thread for the current user, so
+// they get reply emails about it without having written in it
+func (h *Handler) FollowThreadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.DB.GetPostByID(r.Context(), postID); err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch post", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating thread")
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "follow":
+		err = h.DB.FollowThread(r.Context(), currentUser.ID, postID)
+	case "unfollow":
+		err = h.DB.UnfollowThread(r.Context(), currentUser.ID, postID)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update thread follow", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating thread")
+		return
+	}
+	h.PageCache.DeletePrefix(postPagePrefix(postID))
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+}
+
+// BookmarkPostHandler bookmarks a post for the current user, or removes the
+// bookmark. Bookmarked posts are listed under the home page's Bookmarks
+// filter.
+func (h *Handler) BookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.DB.GetPostByID(r.Context(), postID); err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch post", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating bookmark")
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "bookmark":
+		err = h.DB.BookmarkPost(r.Context(), currentUser.ID, postID)
+	case "unbookmark":
+		err = h.DB.UnbookmarkPost(r.Context(), currentUser.ID, postID)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update bookmark", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating bookmark")
+		return
+	}
+	h.PageCache.DeletePrefix(postPagePrefix(postID))
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// isFragmentRequest reports whether the page's script asked for just the
+// changed part of the page, HTMX-style, rather than a redirect to the whole
+// page
+func isFragmentRequest(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// CommentFragmentHandler serves one comment and its replies at
+// /comment/{id}, rendered as they are on the thread page, for refreshing a
+// part of the thread without reloading it
+func (h *Handler) CommentFragmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	commentID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/comment/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	comment, err := h.DB.GetCommentByID(r.Context(), commentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to fetch comment", "comment_id", commentID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching comment")
+		return
+	}
+
+	h.renderCommentFragment(w, r, h.GetCurrentUser(r), comment.PostID, commentID, http.StatusOK)
+}
+
+// renderCommentFragment writes the HTML of a comment subtree, or of the
+// comment alone for viewers of the flat view, without the page around it,
+// using the thread page's renderComment template
+func (h *Handler) renderCommentFragment(w http.ResponseWriter, r *http.Request, currentUser *models.User, postID, commentID, status int) {
+	post, err := h.DB.GetPostByID(r.Context(), postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+	if h.postHidden(r, currentUser, post) {
+		http.NotFound(w, r)
+		return
+	}
+
+	comments, err := h.threadComments(r, currentUser, post)
+	if err != nil {
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching comments")
+		return
+	}
+
+	// The comment is missing when the viewer can't see it, e.g. because its
+	// author is suspended
+	tree, ok := findCommentTree(h.buildCommentTree(comments), commentID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// In the flat view, a comment is shown alone, its replies listed after
+	// it in the order they were written
+	fragment := map[string]interface{}{"Comment": tree}
+	if currentUser != nil && h.preferences(r, currentUser).CommentView == "flat" {
+		for _, flat := range flattenComments(comments) {
+			if flat.ID == commentID {
+				fragment = map[string]interface{}{"Comment": flat.CommentTree, "ReplyTo": flat.ReplyTo, "Flat": true}
+				break
+			}
+		}
+	}
+
+	tmpl, err := h.LoadPageTemplate("templates/post.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load template", "template", "post.html", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := PageData{Post: post, CurrentUser: currentUser}
+	h.fillViewerData(r, &data)
+
+	// Render into a buffer, so a failure can still send an error status
+	var buf bytes.Buffer
+	fragment["PageData"] = data
+	if err := tmpl.ExecuteTemplate(&buf, "renderComment", fragment); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render template", "template", "renderComment", "comment_id", commentID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error rendering template")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// findCommentTree finds the subtree of the comment with the given ID
+func findCommentTree(trees []models.CommentTree, commentID int) (models.CommentTree, bool) {
+	for _, tree := range trees {
+		if tree.ID == commentID {
+			return tree, true
+		}
+		if found, ok := findCommentTree(tree.Replies, commentID); ok {
+			return found, true
+		}
+	}
+	return models.CommentTree{}, false
+}
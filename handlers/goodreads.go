@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportSize limits the size of uploaded Goodreads exports (10 MB)
+const maxImportSize = 10 << 20
+
+// goodreadsRow holds the fields we use from a Goodreads library export
+type goodreadsRow struct {
+	Book     models.Book
+	Shelf    string
+	Rating   int
+	DateRead *time.Time
+	Review   string
+}
+
+// parseGoodreadsCSV parses the standard Goodreads library export CSV
+func parseGoodreadsCSV(r io.Reader) ([]goodreadsRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read CSV header: %v", err)
+	}
+
+	// Map column names to their positions
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	if _, ok := columns["Title"]; !ok {
+		return nil, fmt.Errorf("not a Goodreads export: missing Title column")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []goodreadsRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+
+		title := field(record, "Title")
+		if title == "" {
+			continue
+		}
+
+		row := goodreadsRow{
+			Book: models.Book{
+				Title:       title,
+				Author:      field(record, "Author"),
+				ISBN:        cleanISBN(field(record, "ISBN")),
+				ISBN13:      cleanISBN(field(record, "ISBN13")),
+				GoodreadsID: field(record, "Book Id"),
+			},
+			Shelf:  normalizeShelf(field(record, "Exclusive Shelf")),
+			Review: field(record, "My Review"),
+		}
+
+		// Prefer the original publication year over the edition's
+		year := field(record, "Original Publication Year")
+		if year == "" {
+			year = field(record, "Year Published")
+		}
+		row.Book.PublishedYear, _ = strconv.Atoi(year)
+
+		if rating, err := strconv.Atoi(field(record, "My Rating")); err == nil && rating >= 0 && rating <= 5 {
+			row.Rating = rating
+		}
+
+		if dateRead := field(record, "Date Read"); dateRead != "" {
+			if t, err := time.Parse("2006/01/02", dateRead); err == nil {
+				row.DateRead = &t
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// cleanISBN strips the ="..." wrapping Goodreads puts around ISBNs
+func cleanISBN(isbn string) string {
+	return strings.Trim(isbn, `="`)
+}
+
+// normalizeShelf maps a Goodreads exclusive shelf to one of our shelves
+func normalizeShelf(shelf string) string {
+	switch shelf {
+	case "read", "currently-reading", "to-read":
+		return shelf
+	default:
+		return "to-read"
+	}
+}
+
+// Goodreads import handler
+func (h *Handler) ImportGoodreadsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.Features.Enabled(r.Context(), "goodreads_import") {
+		h.NotFoundHandler(w, r)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	if r.Method == http.MethodGet {
+		data := PageData{
+			CurrentUser: currentUser,
+			Title:       "Import from Goodreads",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), profileCrumb(currentUser.Username), Breadcrumb{Name: "Import from Goodreads", URL: "/import/goodreads"}),
+		}
+
+		h.Render(w, r, "import_goodreads", data)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+		renderError := func(message string) {
+			data := PageData{
+				CurrentUser: currentUser,
+				Title:       "Import from Goodreads",
+				Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), profileCrumb(currentUser.Username), Breadcrumb{Name: "Import from Goodreads", URL: "/import/goodreads"}),
+				Error:       message,
+			}
+
+			h.RenderStatus(w, r, http.StatusBadRequest, "import_goodreads", data)
+		}
+
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			renderError("The uploaded file is too large or invalid")
+			return
+		}
+
+		file, _, err := r.FormFile("csv_file")
+		if err != nil {
+			renderError("Please choose a Goodreads export CSV file")
+			return
+		}
+		defer file.Close()
+
+		upload, err := io.ReadAll(file)
+		if err != nil {
+			renderError("The uploaded file is too large or invalid")
+			return
+		}
+		switch err := h.scanUpload(r, currentUser, "goodreads import", upload); {
+		case errors.Is(err, errInfected):
+			renderError("The uploaded file was flagged by our virus scanner and was not imported")
+			return
+		case errors.Is(err, errScanFailed):
+			renderError("Uploads can't be checked for viruses right now. Please try again later.")
+			return
+		}
+
+		rows, err := parseGoodreadsCSV(bytes.NewReader(upload))
+		if err != nil {
+			renderError(err.Error())
+			return
+		}
+
+		createDrafts := r.FormValue("create_drafts") == "on"
+
+		imported, drafts, skipped := 0, 0, 0
+		for _, row := range rows {
+			book := row.Book
+			if err := h.DB.FindOrCreateBook(r.Context(), &book); err != nil {
+				slog.ErrorContext(r.Context(), "failed to import book", "title", book.Title, "err", err)
+				skipped++
+				continue
+			}
+
+			entry := &models.ShelfEntry{
+				UserID:   currentUser.ID,
+				BookID:   book.ID,
+				Shelf:    row.Shelf,
+				Rating:   row.Rating,
+				DateRead: row.DateRead,
+			}
+			if err := h.DB.SaveShelfEntry(r.Context(), entry); err != nil {
+				slog.ErrorContext(r.Context(), "failed to shelve book", "book_id", book.ID, "err", err)
+				skipped++
+				continue
+			}
+			imported++
+
+			// Importing again leaves reviews already drafted or posted alone
+			if createDrafts && row.Review != "" {
+				reviewed, err := h.DB.HasReviewed(r.Context(), currentUser.ID, book.ID)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "failed to check for a review", "book_id", book.ID, "err", err)
+					continue
+				}
+				if reviewed {
+					continue
+				}
+				draft := &models.ReviewDraft{
+					UserID:  currentUser.ID,
+					BookID:  book.ID,
+					Title:   "Review: " + book.Title,
+					Content: row.Review,
+				}
+				if err := h.DB.CreateReviewDraft(r.Context(), draft); err != nil {
+					slog.ErrorContext(r.Context(), "failed to create review draft", "book_id", book.ID, "err", err)
+					continue
+				}
+				drafts++
+			}
+		}
+
+		summary := "Imported " + pluralize(imported, "book", "books") + " to your shelves"
+		if drafts > 0 {
+			summary += " and created " + pluralize(drafts, "review draft", "review drafts")
+		}
+		summary += "."
+		if skipped > 0 {
+			summary += " " + pluralize(skipped, "row", "rows") + " could not be imported."
+		}
+		h.addFlash(w, r, "success", summary)
+		http.Redirect(w, r, "/import/goodreads", http.StatusSeeOther)
+		return
+	}
+
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"literary-lions/database"
+	"literary-lions/models"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testGoodreadsExport = `Book Id,Title,Author,ISBN,ISBN13,My Rating,Exclusive Shelf,My Review
+1,Dune,Frank Herbert,,,5,read,A desert epic
+2,Emma,Jane Austen,,,4,read,A comedy of manners
+`
+
+// importGoodreads uploads the export as the session's member, asking for
+// review drafts
+func importGoodreads(t *testing.T, h *Handler, session *http.Cookie, export string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("create_drafts", "on"); err != nil {
+		t.Fatal(err)
+	}
+	part, err := mw.CreateFormFile("csv_file", "goodreads_library_export.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(export))
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/import/goodreads", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.AddCookie(session)
+	w := httptest.NewRecorder()
+	h.ImportGoodreadsHandler(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("import answered %d, want %d: %s", w.Code, http.StatusSeeOther, w.Body)
+	}
+	if location := w.Header().Get("Location"); location != "/import/goodreads" {
+		t.Errorf("import redirected to %s, want /import/goodreads", location)
+	}
+}
+
+func TestGoodreadsReimportKeepsOneDraftPerBook(t *testing.T) {
+	h, db := newTestHandler(t)
+	alice := createTestUser(t, db, "alice")
+	session := signIn(t, db, alice)
+
+	importGoodreads(t, h, session, testGoodreadsExport)
+	importGoodreads(t, h, session, testGoodreadsExport)
+
+	r := httptest.NewRequest(http.MethodGet, "/import/goodreads", nil)
+	r.AddCookie(session)
+	w := httptest.NewRecorder()
+	h.ImportGoodreadsHandler(w, r)
+	if body := w.Body.String(); !strings.Contains(body, "Imported 2 books to your shelves.") {
+		t.Errorf("import page doesn't show the second import's summary:\n%s", body)
+	}
+
+	if n := countRows(t, db, "review_drafts"); n != 2 {
+		t.Errorf("%d review drafts after importing twice, want 2", n)
+	}
+	if n := countRows(t, db, "user_books"); n != 2 {
+		t.Errorf("%d shelf entries after importing twice, want 2", n)
+	}
+}
+
+func TestGoodreadsImportSkipsPostedReviews(t *testing.T) {
+	h, db := newTestHandler(t)
+	alice := createTestUser(t, db, "alice")
+	session := signIn(t, db, alice)
+	reviewBook(t, db, alice.ID, "1", "Dune", "Frank Herbert")
+
+	importGoodreads(t, h, session, testGoodreadsExport)
+
+	if n := countRows(t, db, "review_drafts"); n != 1 {
+		t.Errorf("%d review drafts, want 1 for the book not reviewed yet", n)
+	}
+}
+
+// reviewBook posts a review by userID of the book with the given Goodreads ID
+func reviewBook(t *testing.T, db *database.DB, userID int, goodreadsID, title, author string) {
+	t.Helper()
+	ctx := context.Background()
+	book := &models.Book{Title: title, Author: author, GoodreadsID: goodreadsID}
+	if err := db.FindOrCreateBook(ctx, book); err != nil {
+		t.Fatal(err)
+	}
+	post := &models.Post{Title: "Review: " + title, Content: "Loved it", UserID: userID, CategoryID: 1, BookID: &book.ID}
+	if err := db.CreatePost(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,13 +2,29 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
+	"literary-lions/accesslog"
 	"literary-lions/auth"
+	"literary-lions/avatars"
+	"literary-lions/cache"
+	"literary-lions/config"
 	"literary-lions/database"
+	"literary-lions/features"
+	"literary-lions/i18n"
+	"literary-lions/imageproxy"
+	"literary-lions/logging"
+	"literary-lions/mailer"
 	"literary-lions/models"
-	"log"
+	"literary-lions/openlibrary"
+	"literary-lions/scanner"
+	"literary-lions/spam"
+	"literary-lions/unfurl"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,177 +32,228 @@ import (
 
 // PageData represents the common data structure for all templates
 type PageData struct {
-	Posts         []models.Post        `json:"posts,omitempty"`
-	Categories    []models.Category    `json:"categories,omitempty"`
-	Post          *models.Post         `json:"post,omitempty"`
-	Comments      []models.Comment     `json:"comments,omitempty"`
-	CommentTrees  []models.CommentTree `json:"comment_trees,omitempty"`
-	CurrentUser   *models.User         `json:"current_user,omitempty"`
-	Filter        string               `json:"filter,omitempty"`
-	CategoryID    string               `json:"category_id,omitempty"`
-	SortBy        string               `json:"sort_by,omitempty"`
-	SortOrder     string               `json:"sort_order,omitempty"`
-	Title         string               `json:"title,omitempty"`
-	Error         string               `json:"error,omitempty"`
-	FormData      map[string]string    `json:"form_data,omitempty"`
-	TotalComments int                  `json:"total_comments,omitempty"`
+	Posts             []models.Post             `json:"posts,omitempty"`
+	Categories        []models.Category         `json:"categories,omitempty"`
+	Post              *models.Post              `json:"post,omitempty"`
+	Comments          []models.Comment          `json:"comments,omitempty"`
+	CommentTrees      []models.CommentTree      `json:"comment_trees,omitempty"`
+	FlatComments      []models.FlatComment      `json:"flat_comments,omitempty"` // the thread in the flat view, set instead of the tree when the viewer prefers it
+	CurrentUser       *models.User              `json:"current_user,omitempty"`
+	Filter            string                    `json:"filter,omitempty"`
+	CategoryID        string                    `json:"category_id,omitempty"`
+	SortBy            string                    `json:"sort_by,omitempty"`
+	SortOrder         string                    `json:"sort_order,omitempty"`
+	Title             string                    `json:"title,omitempty"`
+	Error             string                    `json:"error,omitempty"`
+	FormData          map[string]string         `json:"form_data,omitempty"`
+	TotalComments     int                       `json:"total_comments,omitempty"`
+	Features          map[string]bool           `json:"features,omitempty"`        // feature flag state, by flag name
+	UnreadMessages    int                       `json:"unread_messages,omitempty"` // unread private messages, shown in the header
+	MembersOnline     int                       `json:"members_online,omitempty"`  // members active in the last few minutes, shown in the footer
+	NewWallPosts      int                       `json:"new_wall_posts,omitempty"`  // messages left on the user's profile wall they haven't seen, shown in the header
+	Locale            string                    `json:"locale,omitempty"`          // locale the page's text is translated into
+	Theme             string                    `json:"theme,omitempty"`           // color theme the page is rendered in: "auto", "light" or "dark"
+	Flashes           []models.Flash            `json:"flashes,omitempty"`         // messages queued by the previous request, shown once
+	Breadcrumbs       []Breadcrumb              `json:"breadcrumbs,omitempty"`     // navigation trail from the home page to this one
+	ModerationReasons []models.ModerationReason `json:"-"`                         // canned reasons offered to admins who remove content on the page
 }
 
 type Handler struct {
-	DB        *database.DB
-	Templates *template.Template
+	DB        database.Store
+	Templates *TemplateSet
+	Config    *config.Config
+
+	// PageCache holds rendered post pages served to anonymous visitors and
+	// generated avatars. It is nil (disabled) unless set by the caller.
+	PageCache *cache.Cache
+
+	// Backups is the database backup job, or nil if backups are disabled
+	Backups *database.BackupScheduler
+
+	// Features reports which optional features are on. When nil every
+	// feature uses its default.
+	Features *features.Flags
+
+	// Avatars stores uploaded profile pictures
+	Avatars avatars.Storage
+
+	// OpenLibrary looks up the books members are reading. When nil books
+	// are used as typed.
+	OpenLibrary *openlibrary.Client
+
+	// ImageProxy serves images from other sites from the forum's own
+	// origin. When nil they are linked directly.
+	ImageProxy *imageproxy.Proxy
+
+	// BookCards finds the books linked in posts, for the cards shown under
+	// them. When nil no cards are shown.
+	BookCards *unfurl.Fetcher
+
+	// Mailer sends email. When nil emails are written to the log.
+	Mailer mailer.Sender
+
+	// Scanner checks uploaded files for malware. When nil uploads are not
+	// scanned.
+	Scanner scanner.Scanner
+
+	// Spam checks new posts and comments, holding those that look like spam
+	// for a moderator. When nil nothing is checked.
+	Spam spam.Checker
+
+	presence presence
+}
+
+// postPageKey is the PageCache key for a rendered post page in a locale and
+// color theme
+func postPageKey(postID int, locale, theme string) string {
+	return postPagePrefix(postID) + locale + ":" + theme
+}
+
+// postPagePrefix is the PageCache key prefix of a post's rendered pages in
+// every locale and theme
+func postPagePrefix(postID int) string {
+	return fmt.Sprintf("post:%d:", postID)
+}
+
+// invalidatePostPages drops all cached post pages, for writes that can
+// change any of them (e.g. suspending or deleting a user)
+func (h *Handler) invalidatePostPages() {
+	h.PageCache.DeletePrefix("post:")
 }
 
 // NewHandler creates a new handler instance
-func NewHandler(db *database.DB, templates *template.Template) *Handler {
+func NewHandler(db database.Store, templates *TemplateSet, cfg *config.Config) *Handler {
 	return &Handler{
 		DB:        db,
 		Templates: templates,
+		Config:    cfg,
 	}
 }
 
-// Middleware for authentication
-func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		user := h.GetCurrentUser(r)
-		if user == nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-		next(w, r)
+// GetCurrentUser retrieves the current user from session. Once known, the
+// user is kept for the rest of the request (see TrackUser) and returned
+// without looking the session up again.
+func (h *Handler) GetCurrentUser(r *http.Request) *models.User {
+	if user := requestUser(r); user != nil {
+		return user
 	}
-}
 
-// GetCurrentUser retrieves the current user from session
-func (h *Handler) GetCurrentUser(r *http.Request) *models.User {
 	cookie, err := r.Cookie("session")
 	if err != nil {
 		return nil
 	}
 
-	session, err := h.DB.GetSessionByUUID(cookie.Value)
+	session, err := h.DB.GetSessionByUUID(r.Context(), cookie.Value)
 	if err != nil {
 		return nil
 	}
 
-	user, err := h.DB.GetUserByID(session.UserID)
-	if err != nil {
+	user, err := h.DB.GetUserByID(r.Context(), session.UserID)
+	if err != nil || user.IsDeactivated() {
 		return nil
 	}
-
-	return user
-}
-
-func (h *Handler) countTotalComments(commentTrees []models.CommentTree) int {
-	total := 0
-	for _, tree := range commentTrees {
-		total += 1 + h.countCommentsInTree(tree)
+	if session.ImpersonatorID != nil && !h.startImpersonatedRequest(r, user, *session.ImpersonatorID) {
+		return nil
 	}
-	return total
-}
 
-func (h *Handler) countCommentsInTree(tree models.CommentTree) int {
-	count := 0
-	for _, reply := range tree.Replies {
-		count += 1 + h.countCommentsInTree(reply)
+	accesslog.SetUserID(r, user.ID)
+	logging.SetUserID(r.Context(), user.ID)
+	// Admins viewing as a member don't make them look online
+	if user.Impersonator == nil {
+		h.touchLastSeen(r, user)
 	}
-	return count
+	rememberUser(r, user)
+	return user
 }
 
+// buildCommentTree nests comments into trees in linear time. Comments must
+// come parents first, as GetCommentsWithSuspendedFilter returns them; replies
+// whose parent is missing are left out.
 func (h *Handler) buildCommentTree(comments []models.Comment) []models.CommentTree {
-	// Create a map to store comments by their ID for quick lookup
-	commentMap := make(map[int]models.Comment)
-	var topLevelComments []models.Comment
-
-	// First pass: create comment map and identify top-level comments
-	for _, comment := range comments {
-		commentMap[comment.ID] = comment
+	// Group replies under their parent, keeping the query's order
+	var roots []int
+	replies := make(map[int][]int)
+	for i, comment := range comments {
 		if comment.ParentID == nil {
-			topLevelComments = append(topLevelComments, comment)
+			roots = append(roots, i)
+		} else {
+			replies[*comment.ParentID] = append(replies[*comment.ParentID], i)
 		}
 	}
 
-	// Build the tree recursively
-	var result []models.CommentTree
-	for _, comment := range topLevelComments {
-		tree := h.buildCommentSubtree(comment, commentMap)
-		result = append(result, tree)
+	var build func(i int) models.CommentTree
+	build = func(i int) models.CommentTree {
+		tree := models.CommentTree{Comment: comments[i]}
+		for _, j := range replies[comments[i].ID] {
+			tree.Replies = append(tree.Replies, build(j))
+		}
+		return tree
+	}
+
+	result := make([]models.CommentTree, 0, len(roots))
+	for _, i := range roots {
+		result = append(result, build(i))
 	}
 
 	return result
 }
 
-// Helper function to recursively build comment subtree
-func (h *Handler) buildCommentSubtree(comment models.Comment, commentMap map[int]models.Comment) models.CommentTree {
-	var replies []models.CommentTree
-
-	// Find all direct replies to this comment
-	for _, c := range commentMap {
-		if c.ParentID != nil && *c.ParentID == comment.ID {
-			// Recursively build subtree for this reply
-			subtree := h.buildCommentSubtree(c, commentMap)
-			replies = append(replies, subtree)
-		}
+// flattenComments lists comments for the flat view of a thread: oldest
+// first, each reply naming the author of the comment it answers. Like in
+// the tree, replies whose parent is missing are left out.
+func flattenComments(comments []models.Comment) []models.FlatComment {
+	authors := make(map[int]string, len(comments))
+	for _, comment := range comments {
+		authors[comment.ID] = comment.Username
 	}
 
-	return models.CommentTree{
-		Comment: comment,
-		Replies: replies,
+	sorted := make([]models.Comment, len(comments))
+	copy(sorted, comments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	result := make([]models.FlatComment, 0, len(sorted))
+	for _, comment := range sorted {
+		flat := models.FlatComment{CommentTree: models.CommentTree{Comment: comment}}
+		if comment.ParentID != nil {
+			author, ok := authors[*comment.ParentID]
+			if !ok {
+				continue
+			}
+			flat.ReplyTo = author
+		}
+		result = append(result, flat)
 	}
+	return result
 }
 
-// LoadPageTemplate loads the base template and a specific page template
+// LoadPageTemplate returns the parsed template set for a page template
 func (h *Handler) LoadPageTemplate(templateFile string) (*template.Template, error) {
-	// Create a new template with custom functions
-	tmpl := template.New("").Funcs(template.FuncMap{
-		"slice": func(s string, start, end int) string {
-			if start < 0 {
-				start = 0
-			}
-			if end > len(s) {
-				end = len(s)
-			}
-			if start >= end {
-				return ""
-			}
-			return s[start:end]
-		},
-		"printf": func(format string, args ...interface{}) string {
-			return fmt.Sprintf(format, args...)
-		},
-		"add": func(a, b int) int {
-			return a + b
-		},
-		"countComments": func(commentTrees []models.CommentTree) int {
-			count := 0
-			for _, tree := range commentTrees {
-				count += 1 + h.countCommentsInTree(tree)
-			}
-			return count
-		},
-		"dict": func(values ...interface{}) map[string]interface{} {
-			if len(values)%2 != 0 {
-				panic("dict requires an even number of arguments")
-			}
-			result := make(map[string]interface{})
-			for i := 0; i < len(values); i += 2 {
-				key, ok := values[i].(string)
-				if !ok {
-					panic("dict keys must be strings")
-				}
-				result[key] = values[i+1]
-			}
-			return result
-		},
-	})
+	return h.Templates.Page(templateFile)
+}
 
-	// Parse base template and the specific page template
-	tmpl, err := tmpl.ParseFiles("templates/base.html", templateFile)
-	if err != nil {
-		return nil, err
+// formValues returns what was submitted in the named form fields, so a
+// rejected form can be shown again filled in. Never list password fields.
+func formValues(r *http.Request, fields ...string) map[string]string {
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		values[field] = r.PostFormValue(field)
 	}
+	return values
+}
 
-	return tmpl, nil
+// pageURL links to another page of the listing at the request URL, keeping
+// its filters and sorting
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	} else {
+		query.Del("page")
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return u.String()
 }
 
 // Home page handler
@@ -202,24 +269,44 @@ func (h *Handler) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	currentUser := h.GetCurrentUser(r)
 
 	// Get categories for filter
-	categories, err = h.DB.GetAllCategories()
+	categories, err = h.DB.GetAllCategories(r.Context())
 	if err != nil {
-		http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching categories")
 		return
 	}
 
+	// Visitors whose browser has the listing since it last changed are told
+	// to use that
+	if currentUser == nil && !hasCookieFlashes(r) {
+		version, err := h.DB.GetPostsVersion(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to fetch posts version", "err", err)
+		} else if h.notModified(w, r, version, categories) {
+			return
+		}
+	}
+
 	// Handle filtering
 	filter := r.URL.Query().Get("filter")
 	categoryID := r.URL.Query().Get("category")
 	sortBy := r.URL.Query().Get("sort_by")
 	sortOrder := r.URL.Query().Get("sort_order")
 
-	// Set default sort values
+	// Sort by the viewer's preferred order unless they picked one
+	prefs := h.preferences(r, currentUser)
 	if sortBy == "" {
-		sortBy = "date"
+		sortBy = prefs.PostSort
 	}
 	if sortOrder == "" {
-		sortOrder = "desc"
+		sortOrder = prefs.PostSortOrder
+	}
+
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		if page, err = strconv.Atoi(p); err != nil || page < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
 	}
 
 	// Check if current user is admin to decide whether to show suspended content
@@ -228,61 +315,75 @@ func (h *Handler) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	switch filter {
 	case "my-posts":
 		if currentUser != nil {
-			posts, err = h.DB.GetPostsByUserWithSorting(currentUser.ID, sortBy, sortOrder)
+			posts, err = h.DB.GetPostsByUserWithSorting(r.Context(), currentUser.ID, sortBy, sortOrder)
 		}
 	case "liked-posts":
 		if currentUser != nil {
-			posts, err = h.DB.GetLikedPostsByUserWithSorting(currentUser.ID, sortBy, sortOrder)
+			posts, err = h.DB.GetLikedPostsByUserWithSorting(r.Context(), currentUser.ID, sortBy, sortOrder)
+		}
+	case "bookmarks":
+		if currentUser != nil {
+			posts, err = h.DB.GetBookmarkedPostsByUserWithSorting(r.Context(), currentUser.ID, sortBy, sortOrder)
 		}
 	default:
 		if categoryID != "" {
 			catID, parseErr := strconv.Atoi(categoryID)
 			if parseErr == nil {
-				posts, err = h.DB.GetPostsByCategoryWithSorting(catID, sortBy, sortOrder)
+				posts, err = h.DB.GetPostsByCategoryWithSorting(r.Context(), catID, sortBy, sortOrder)
 			} else {
-				posts, err = h.DB.GetPostsWithSuspendedFilterAndSorting(showSuspended, sortBy, sortOrder)
+				posts, err = h.DB.GetPostsWithSuspendedFilterAndSorting(r.Context(), showSuspended, sortBy, sortOrder)
 			}
 		} else {
-			posts, err = h.DB.GetPostsWithSuspendedFilterAndSorting(showSuspended, sortBy, sortOrder)
+			posts, err = h.DB.GetPostsWithSuspendedFilterAndSorting(r.Context(), showSuspended, sortBy, sortOrder)
 		}
 	}
 
 	if err != nil {
-		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching posts")
 		return
 	}
+	posts = withoutBlocked(posts, h.blockedUsers(r, currentUser))
 
-	// Check if user was just deleted
-	var successMessage string
-	if r.URL.Query().Get("deleted") == "true" {
-		successMessage = "Profile successfully deleted. Thank you for being part of Literary Lions!"
+	// Show the viewer's preferred number of posts per page
+	hasNext := len(posts) > page*prefs.PostsPerPage
+	if start := (page - 1) * prefs.PostsPerPage; start >= len(posts) {
+		posts = nil
+	} else {
+		posts = posts[start:min(start+prefs.PostsPerPage, len(posts))]
 	}
+	h.styleCategories(r, posts)
 
-	data := PageData{
-		Posts:       posts,
-		Categories:  categories,
-		CurrentUser: currentUser,
-		Filter:      filter,
-		CategoryID:  categoryID,
-		SortBy:      sortBy,
-		SortOrder:   sortOrder,
-		Title:       "Home",
-		FormData: map[string]string{
-			"success": successMessage,
+	data := struct {
+		PageData
+		Page     int    `json:"page"`
+		PrevPage string `json:"prev_page,omitempty"` // Link to the previous page, if any
+		NextPage string `json:"next_page,omitempty"` // Link to the next page, if any
+	}{
+		PageData: PageData{
+			Posts:       posts,
+			Categories:  models.FlattenCategories(categories),
+			CurrentUser: currentUser,
+			Filter:      filter,
+			CategoryID:  categoryID,
+			SortBy:      sortBy,
+			SortOrder:   sortOrder,
+			Title:       "Home",
 		},
+		Page: page,
 	}
-
-	tmpl, err := h.LoadPageTemplate("templates/index.html")
-	if err != nil {
-		log.Printf("Failed to load index template: %v", err)
-		http.Error(w, "Error loading template", http.StatusInternalServerError)
-		return
+	if catID, err := strconv.Atoi(categoryID); err == nil {
+		if trail := h.categoryCrumbs(r, catID); len(trail) > 0 {
+			data.Breadcrumbs = h.breadcrumbs(r, h.locale(r, currentUser), trail...)
+		}
 	}
-
-	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-		log.Printf("Template execution error: %v", err)
-		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+	if page > 1 {
+		data.PrevPage = pageURL(r, page-1)
+	}
+	if hasNext {
+		data.NextPage = pageURL(r, page+1)
 	}
+
+	h.Render(w, r, "index", data)
 }
 
 // Login handlers
@@ -290,20 +391,10 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodGet {
 		data := PageData{
-			Title: "Login",
+			Title: i18n.T(h.locale(r, nil), "login.title"),
 		}
 
-		tmpl, err := h.LoadPageTemplate("templates/login.html")
-		if err != nil {
-			log.Printf("Failed to load login template: %v", err)
-			http.Error(w, "Error loading template", http.StatusInternalServerError)
-			return
-		}
-
-		if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-			log.Printf("Login template execution error: %v", err)
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		}
+		h.Render(w, r, "login", data)
 		return
 	}
 
@@ -313,54 +404,65 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 		if email == "" || password == "" {
 			data := PageData{
-				Error: "Email and password are required",
-				Title: "Login",
+				Error:    i18n.T(h.locale(r, nil), "login.error.required"),
+				FormData: formValues(r, "email"),
+				Title:    i18n.T(h.locale(r, nil), "login.title"),
 			}
 
-			tmpl, err := h.LoadPageTemplate("templates/login.html")
-			if err != nil {
-				http.Error(w, "Error loading template", http.StatusInternalServerError)
-				return
-			}
-
-			w.WriteHeader(http.StatusBadRequest)
-			tmpl.ExecuteTemplate(w, "base", data)
+			h.RenderStatus(w, r, http.StatusBadRequest, "login", data)
 			return
 		}
 
-		user, err := h.DB.GetUserByEmail(email)
+		user, err := h.DB.GetUserByEmail(r.Context(), email)
 		if err != nil || !auth.CheckPassword(password, user.Password) {
 			data := PageData{
-				Error: "Invalid email or password",
-				Title: "Login",
+				Error:    i18n.T(h.locale(r, nil), "login.error.invalid"),
+				FormData: formValues(r, "email"),
+				Title:    i18n.T(h.locale(r, nil), "login.title"),
 			}
 
-			tmpl, err := h.LoadPageTemplate("templates/login.html")
-			if err != nil {
-				http.Error(w, "Error loading template", http.StatusInternalServerError)
+			h.RenderStatus(w, r, http.StatusUnauthorized, "login", data)
+			return
+		}
+
+		// Deactivated accounts come back once their owner confirms it
+		reactivated := false
+		if user.IsDeactivated() {
+			if r.FormValue("reactivate") != "on" {
+				data := PageData{
+					Error:    i18n.T(h.locale(r, nil), "login.error.deactivated"),
+					FormData: map[string]string{"email": email, "reactivate": "on"},
+					Title:    i18n.T(h.locale(r, nil), "login.title"),
+				}
+
+				h.RenderStatus(w, r, http.StatusForbidden, "login", data)
 				return
 			}
-
-			w.WriteHeader(http.StatusUnauthorized)
-			tmpl.ExecuteTemplate(w, "base", data)
-			return
+			if err := h.DB.ReactivateUser(r.Context(), user.ID); err != nil && err != sql.ErrNoRows {
+				slog.ErrorContext(r.Context(), "failed to reactivate user", "target_user_id", user.ID, "err", err)
+				h.RenderError(w, r, http.StatusInternalServerError, "Error reactivating account")
+				return
+			}
+			h.invalidatePostPages()
+			slog.InfoContext(r.Context(), "account reactivated", "target_user_id", user.ID)
+			reactivated = true
 		}
 
 		// Create session
 		uuid, err := auth.GenerateUUID()
 		if err != nil {
-			http.Error(w, "Error creating session", http.StatusInternalServerError)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error creating session")
 			return
 		}
 
 		session := &models.Session{
 			UserID:    user.ID,
 			UUID:      uuid,
-			ExpiresAt: time.Now().Add(24 * time.Hour),
+			ExpiresAt: time.Now().Add(h.Config.Sessions.Lifetime),
 		}
 
-		if err := h.DB.CreateSession(session); err != nil {
-			http.Error(w, "Error creating session", http.StatusInternalServerError)
+		if err := h.DB.CreateSession(r.Context(), session); err != nil {
+			h.RenderError(w, r, http.StatusInternalServerError, "Error creating session")
 			return
 		}
 
@@ -370,9 +472,17 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 			Value:    uuid,
 			Expires:  session.ExpiresAt,
 			HttpOnly: true,
+			Secure:   h.Config.TLS.Enabled(),
 			Path:     "/",
 		})
 
+		if reactivated {
+			// Straight into the new session, which the request doesn't carry yet
+			flash := models.Flash{Kind: "success", Message: "Welcome back! Your account is active again."}
+			if err := h.DB.AddFlash(r.Context(), uuid, flash); err != nil {
+				slog.ErrorContext(r.Context(), "failed to add flash message", "err", err)
+			}
+		}
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -384,19 +494,10 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		data := PageData{
-			Title: "Register",
+			Title: i18n.T(h.locale(r, nil), "register.title"),
 		}
 
-		tmpl, err := h.LoadPageTemplate("templates/register.html")
-		if err != nil {
-			log.Printf("Failed to load register template: %v", err)
-			http.Error(w, "Error loading template", http.StatusInternalServerError)
-			return
-		}
-
-		if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		}
+		h.Render(w, r, "register", data)
 		return
 	}
 
@@ -406,61 +507,56 @@ func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		password := r.FormValue("password")
 
 		// Validation
+		locale := h.locale(r, nil)
 		var errors []string
 
 		if email == "" {
-			errors = append(errors, "Email is required")
+			errors = append(errors, i18n.T(locale, "register.error.email_required"))
 		} else if !auth.ValidateEmail(email) {
-			errors = append(errors, "Invalid email format")
+			errors = append(errors, i18n.T(locale, "register.error.email_invalid"))
 		}
 
 		if username == "" {
-			errors = append(errors, "Username is required")
+			errors = append(errors, i18n.T(locale, "register.error.username_required"))
 		} else if err := auth.ValidateUsername(username); err != nil {
 			errors = append(errors, err.Error())
 		}
 
 		if password == "" {
-			errors = append(errors, "Password is required")
+			errors = append(errors, i18n.T(locale, "register.error.password_required"))
 		} else if err := auth.ValidatePassword(password); err != nil {
 			errors = append(errors, err.Error())
 		}
 
 		// Check for existing users
-		emailExists, usernameExists, err := h.DB.CheckUserExists(email, username)
+		emailExists, usernameExists, err := h.DB.CheckUserExists(r.Context(), email, username)
 		if err != nil {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			h.RenderError(w, r, http.StatusInternalServerError, "Database error")
 			return
 		}
 
 		if emailExists {
-			errors = append(errors, "Email already exists")
+			errors = append(errors, i18n.T(locale, "register.error.email_taken"))
 		}
 		if usernameExists {
-			errors = append(errors, "Username already exists")
+			errors = append(errors, i18n.T(locale, "register.error.username_taken"))
 		}
 
 		if len(errors) > 0 {
 			data := PageData{
-				Error: strings.Join(errors, "; "),
-				Title: "Register",
-			}
-
-			tmpl, err := h.LoadPageTemplate("templates/register.html")
-			if err != nil {
-				http.Error(w, "Error loading template", http.StatusInternalServerError)
-				return
+				Error:    strings.Join(errors, "; "),
+				FormData: formValues(r, "username", "email"),
+				Title:    i18n.T(h.locale(r, nil), "register.title"),
 			}
 
-			w.WriteHeader(http.StatusBadRequest)
-			tmpl.ExecuteTemplate(w, "base", data)
+			h.RenderStatus(w, r, http.StatusBadRequest, "register", data)
 			return
 		}
 
 		// Hash password
 		hashedPassword, err := auth.HashPassword(password)
 		if err != nil {
-			http.Error(w, "Error processing password", http.StatusInternalServerError)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error processing password")
 			return
 		}
 
@@ -471,8 +567,8 @@ func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			Password: hashedPassword,
 		}
 
-		if err := h.DB.CreateUser(user); err != nil {
-			http.Error(w, "Error creating user", http.StatusInternalServerError)
+		if err := h.DB.CreateUser(r.Context(), user); err != nil {
+			h.RenderError(w, r, http.StatusInternalServerError, "Error creating user")
 			return
 		}
 
@@ -487,7 +583,7 @@ func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("session")
 	if err == nil {
-		h.DB.DeleteSession(cookie.Value)
+		h.DB.DeleteSession(r.Context(), cookie.Value)
 	}
 
 	// Clear cookie
@@ -505,34 +601,22 @@ func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 // Create post handlers
 func (h *Handler) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
 
 	if r.Method == http.MethodGet {
-		categories, err := h.DB.GetAllCategories()
+		categories, err := h.DB.GetAllCategories(r.Context())
 		if err != nil {
-			http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error fetching categories")
 			return
 		}
 
 		data := PageData{
-			Categories:  categories,
+			Categories:  models.FlattenCategories(categories),
 			CurrentUser: currentUser,
 			Title:       "Create Post",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Create Post", URL: "/create-post"}),
 		}
 
-		tmpl, err := h.LoadPageTemplate("templates/create_post.html")
-		if err != nil {
-			log.Printf("Failed to load create_post template: %v", err)
-			http.Error(w, "Error loading template", http.StatusInternalServerError)
-			return
-		}
-
-		if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		}
+		h.Render(w, r, "create_post", data)
 		return
 	}
 
@@ -541,13 +625,9 @@ func (h *Handler) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		content := strings.TrimSpace(r.FormValue("content"))
 		categoryIDStr := r.FormValue("category_id")
 
-		var errors []string
-
-		if title == "" {
-			errors = append(errors, "Title is required")
-		}
-		if content == "" {
-			errors = append(errors, "Content is required")
+		errors := h.checkPostLengths(title, content)
+		if msg := linksNotAllowed(currentUser, title+"\n"+content); msg != "" {
+			errors = append(errors, msg)
 		}
 
 		categoryID, err := strconv.Atoi(categoryIDStr)
@@ -555,21 +635,50 @@ func (h *Handler) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 			errors = append(errors, "Valid category is required")
 		}
 
+		// Posts can be scheduled to be published later instead of now
+		schedule := r.FormValue("schedule") == "on"
+		var publishAt time.Time
+		if schedule {
+			var msg string
+			if publishAt, msg = parsePublishAt(r.FormValue("publish_at"), currentUser, time.Now()); msg != "" {
+				errors = append(errors, msg)
+			}
+		}
+
+		// Posts can optionally be about a particular book
+		var book *models.Book
+		bookQuery := strings.TrimSpace(r.FormValue("book"))
+		bookAuthor := strings.TrimSpace(r.FormValue("book_author"))
+		if len(bookQuery) > maxBookTitleLength || len(bookAuthor) > maxBookAuthorLength {
+			errors = append(errors, "Book title or author is too long")
+		} else if bookQuery != "" && len(errors) == 0 {
+			var msg string
+			if book, msg = h.findBook(r, bookQuery, bookAuthor); msg != "" {
+				errors = append(errors, msg)
+			}
+		}
+
+		// Posts published right away count towards the posting cooldown
+		status := http.StatusBadRequest
+		if !schedule && len(errors) == 0 {
+			if wait := h.contributionWait(r, currentUser, false); wait > 0 {
+				errors = append(errors, slowDown(wait, "post"))
+				status = http.StatusTooManyRequests
+				setRetryAfter(w, wait)
+			}
+		}
+
 		if len(errors) > 0 {
-			categories, _ := h.DB.GetAllCategories()
+			categories, _ := h.DB.GetAllCategories(r.Context())
 			data := PageData{
-				Categories:  categories,
+				Categories:  models.FlattenCategories(categories),
 				CurrentUser: currentUser,
 				Error:       strings.Join(errors, "; "),
+				FormData:    formValues(r, "title", "content", "category_id", "book", "book_author", "schedule", "publish_at"),
 				Title:       "Create Post",
+				Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Create Post", URL: "/create-post"}),
 			}
-			tmpl, err := h.LoadPageTemplate("templates/create_post.html")
-			if err != nil {
-				http.Error(w, "Error loading template", http.StatusInternalServerError)
-				return
-			}
-			w.WriteHeader(http.StatusBadRequest)
-			tmpl.ExecuteTemplate(w, "base", data)
+			h.RenderStatus(w, r, status, "create_post", data)
 			return
 		}
 
@@ -579,9 +688,57 @@ func (h *Handler) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 			UserID:     currentUser.ID,
 			CategoryID: categoryID,
 		}
+		if book != nil {
+			if err := h.DB.FindOrCreateBook(r.Context(), book); err != nil {
+				slog.ErrorContext(r.Context(), "failed to find or create book", "err", err)
+				h.RenderError(w, r, http.StatusInternalServerError, "Error creating post")
+				return
+			}
+			post.BookID = &book.ID
+		}
 
-		if err := h.DB.CreatePost(post); err != nil {
-			http.Error(w, "Error creating post", http.StatusInternalServerError)
+		// Posts that look like spam wait for a moderator, even scheduled ones
+		if reason := h.spamReason(r, currentUser, "post", title, content, ""); reason != "" {
+			held := &models.HeldContent{
+				Kind:       "post",
+				UserID:     post.UserID,
+				CategoryID: post.CategoryID,
+				BookID:     post.BookID,
+				Title:      post.Title,
+				Content:    post.Content,
+				Reason:     reason,
+			}
+			if !h.holdContent(r, held) {
+				h.RenderError(w, r, http.StatusInternalServerError, "Error creating post")
+				return
+			}
+			h.addFlash(w, r, "success", heldMessage("post"))
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if schedule {
+			scheduled := &models.ScheduledPost{
+				UserID:     post.UserID,
+				CategoryID: post.CategoryID,
+				BookID:     post.BookID,
+				Title:      post.Title,
+				Content:    post.Content,
+				PublishAt:  publishAt,
+			}
+			if err := h.DB.SchedulePost(r.Context(), scheduled); err != nil {
+				slog.ErrorContext(r.Context(), "failed to schedule post", "err", err)
+				h.RenderError(w, r, http.StatusInternalServerError, "Error scheduling post")
+				return
+			}
+			slog.InfoContext(r.Context(), "post scheduled", "scheduled_id", scheduled.ID, "publish_at", publishAt)
+			h.addFlash(w, r, "success", "Your post is scheduled for "+localTime(publishAt, currentUser, dateFormats["datetime"])+".")
+			http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+			return
+		}
+
+		if err := h.DB.CreatePost(r.Context(), post); err != nil {
+			h.RenderError(w, r, http.StatusInternalServerError, "Error creating post")
 			return
 		}
 
@@ -592,35 +749,76 @@ func (h *Handler) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
-// View post handler
+// View post handler, which also serves the reader view at /post/{id}/reader
+// and the Markdown export at /post/{id}/export.md
 func (h *Handler) ViewPostHandler(w http.ResponseWriter, r *http.Request) {
 	postIDStr := strings.TrimPrefix(r.URL.Path, "/post/")
+	if idStr, ok := strings.CutSuffix(postIDStr, "/reader"); ok {
+		h.readerView(w, r, idStr)
+		return
+	}
+	if idStr, ok := strings.CutSuffix(postIDStr, "/export.md"); ok {
+		h.exportThread(w, r, idStr)
+		return
+	}
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
 		h.NotFoundHandler(w, r)
 		return
 	}
 
-	post, err := h.DB.GetPostByID(postID)
+	currentUser := h.GetCurrentUser(r)
+
+	// Anonymous visitors with the same language and theme all see the same
+	// page, so answer from their browser's copy or serve it from cache,
+	// unless they have messages waiting
+	if currentUser == nil && !hasCookieFlashes(r) {
+		version, err := h.DB.GetPostVersion(r.Context(), postID)
+		if err == nil {
+			categories, _ := h.DB.GetAllCategories(r.Context())
+			if h.notModified(w, r, version, categories) {
+				return
+			}
+		} else if err != sql.ErrNoRows {
+			slog.ErrorContext(r.Context(), "failed to fetch post version", "post_id", postID, "err", err)
+		}
+		if page, ok := h.PageCache.Get(postPageKey(postID, h.locale(r, nil), h.theme(r, nil))); ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page.([]byte))
+			return
+		}
+	}
+
+	post, err := h.DB.GetPostByID(r.Context(), postID)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			// Threads merged into another live on there
+			if target, err := h.DB.GetMergedInto(r.Context(), postID); err == nil {
+				http.Redirect(w, r, fmt.Sprintf("/post/%d", target), http.StatusMovedPermanently)
+				return
+			}
 			h.NotFoundHandler(w, r)
 			return
 		}
-		http.Error(w, "Error fetching post", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+	if h.postHidden(r, currentUser, post) {
+		h.NotFoundHandler(w, r)
 		return
 	}
 
-	currentUser := h.GetCurrentUser(r)
-
-	// Get comments for the post (filter suspended users unless admin)
-	showSuspended := currentUser != nil && currentUser.IsAdmin()
-	allComments, err := h.DB.GetCommentsWithSuspendedFilter(postID, showSuspended)
+	allComments, err := h.threadComments(r, currentUser, post)
 	if err != nil {
-		http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching comments")
 		return
 	}
 
+	if category, err := h.DB.GetCategoryByID(r.Context(), post.CategoryID); err == nil {
+		post.CategoryIcon, post.CategoryColor = category.Icon, category.Color
+	}
+	post.LinkedBooks = h.linkedBooks(r, post)
+
 	// Build hierarchical comment tree
 	commentTrees := h.buildCommentTree(allComments)
 
@@ -630,6 +828,7 @@ func (h *Handler) ViewPostHandler(w http.ResponseWriter, r *http.Request) {
 		CommentTrees: commentTrees,
 		CurrentUser:  currentUser,
 		Title:        post.Title,
+		Breadcrumbs:  h.breadcrumbs(r, h.locale(r, currentUser), append(h.categoryCrumbs(r, post.CategoryID), postCrumb(post))...),
 	}
 
 	// Add total comments count to FormData for template access
@@ -637,20 +836,107 @@ func (h *Handler) ViewPostHandler(w http.ResponseWriter, r *http.Request) {
 		data.FormData = make(map[string]string)
 	}
 	data.FormData["total_comments"] = strconv.Itoa(len(allComments))
+	if currentUser != nil {
+		if h.preferences(r, currentUser).CommentView == "flat" {
+			data.FlatComments = flattenComments(allComments)
+		}
 
-	tmpl, err := h.LoadPageTemplate("templates/post.html")
-	if err != nil {
-		log.Printf("Failed to load post template: %v", err)
-		http.Error(w, "Error loading template", http.StatusInternalServerError)
-		return
+		muted, err := h.DB.IsThreadMuted(r.Context(), currentUser.ID, postID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to check thread mute", "post_id", postID, "err", err)
+		} else if muted {
+			data.FormData["thread_muted"] = "true"
+		}
+
+		following, err := h.DB.IsFollowingThread(r.Context(), currentUser.ID, postID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to check thread follow", "post_id", postID, "err", err)
+		} else if following {
+			data.FormData["thread_following"] = "true"
+		}
+
+		bookmarked, err := h.DB.IsBookmarked(r.Context(), currentUser.ID, postID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to check bookmark", "post_id", postID, "err", err)
+		} else if bookmarked {
+			data.FormData["bookmarked"] = "true"
+		}
 	}
 
-	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-		log.Printf("Template execution error in ViewPostHandler: %v", err)
-		log.Printf("Post ID: %d, CommentTrees count: %d", postID, len(commentTrees))
-		// Don't try to send error response as headers may already be written
+	if currentUser == nil && h.PageCache != nil {
+		page, ok := h.renderPage(w, r, "post", &data)
+		if !ok {
+			return
+		}
+		// A page showing the visitor's messages is theirs alone
+		if len(data.Flashes) == 0 {
+			h.PageCache.Set(postPageKey(postID, data.Locale, data.Theme), page)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
 		return
 	}
+
+	h.Render(w, r, "post", data)
+}
+
+// threadComments fetches a post's comments as the viewer sees them, in the
+// order they prefer, and marks the post and comments with their authors'
+// titles and reading, and whether the viewer blocked them. In anonymous
+// categories the authors are hidden instead, except from admins.
+func (h *Handler) threadComments(r *http.Request, currentUser *models.User, post *models.Post) ([]models.Comment, error) {
+	// Get comments for the post (filter suspended users unless admin)
+	showSuspended := currentUser != nil && currentUser.IsAdmin()
+	allComments, err := h.DB.GetCommentsWithSuspendedFilter(r.Context(), post.ID, showSuspended)
+	if err != nil {
+		return nil, err
+	}
+
+	// Order comments the way the viewer prefers. Visitors, who may be
+	// served the cached page, see them oldest first.
+	if currentUser != nil {
+		sortComments(allComments, h.preferences(r, currentUser).CommentSort)
+	}
+
+	// Nothing about the authors of an anonymous thread is shown, not even
+	// whether the viewer blocked them
+	if hideAuthors(currentUser, post, allComments) {
+		return allComments, nil
+	}
+
+	// Collapse the post and comments of users the viewer blocked
+	if blocked := h.blockedUsers(r, currentUser); len(blocked) > 0 {
+		post.Collapsed = blocked[post.UserID]
+		for i := range allComments {
+			allComments[i].Collapsed = blocked[allComments[i].UserID]
+		}
+	}
+
+	// Show what the post and comment authors are currently reading, and
+	// their titles
+	authorIDs := []int{post.UserID}
+	for _, comment := range allComments {
+		authorIDs = append(authorIDs, comment.UserID)
+	}
+	if reading := h.readingBooks(r, authorIDs); len(reading) > 0 {
+		if book, ok := reading[post.UserID]; ok {
+			post.AuthorReading = &book
+		}
+		for i := range allComments {
+			if book, ok := reading[allComments[i].UserID]; ok {
+				allComments[i].AuthorReading = &book
+			}
+		}
+	}
+
+	if titles := h.userTitles(r, authorIDs); len(titles) > 0 {
+		post.AuthorTitle = titles[post.UserID]
+		for i := range allComments {
+			allComments[i].AuthorTitle = titles[allComments[i].UserID]
+		}
+	}
+
+	return allComments, nil
 }
 
 // Create comment handler
@@ -661,10 +947,6 @@ func (h *Handler) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
 
 	postIDStr := r.FormValue("post_id")
 	parentIDStr := r.FormValue("parent_id")
@@ -676,8 +958,12 @@ func (h *Handler) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if content == "" {
-		http.Error(w, "Comment content is required", http.StatusBadRequest)
+	if msg := checkLength("Comment", content, h.Config.Content.Comment); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := linksNotAllowed(currentUser, content); msg != "" {
+		http.Error(w, msg, http.StatusForbidden)
 		return
 	}
 
@@ -697,26 +983,74 @@ func (h *Handler) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		comment.ParentID = &parentID
 	}
 
-	if err := h.DB.CreateComment(comment); err != nil {
-		http.Error(w, "Error creating comment", http.StatusInternalServerError)
+	if wait := h.contributionWait(r, currentUser, true); wait > 0 {
+		setRetryAfter(w, wait)
+		if isFragmentRequest(r) {
+			http.Error(w, slowDown(wait, "comment"), http.StatusTooManyRequests)
+			return
+		}
+		h.addFlash(w, r, "error", slowDown(wait, "comment"))
+		http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+		return
+	}
+
+	if reason := h.spamReason(r, currentUser, "comment", "", content, fmt.Sprintf("/post/%d", postID)); reason != "" {
+		held := &models.HeldContent{
+			Kind:     "comment",
+			UserID:   comment.UserID,
+			PostID:   comment.PostID,
+			ParentID: comment.ParentID,
+			Content:  comment.Content,
+			Reason:   reason,
+		}
+		if !h.holdContent(r, held) {
+			h.RenderError(w, r, http.StatusInternalServerError, "Error creating comment")
+			return
+		}
+		// The thread page's script shows the message where the comment
+		// would have gone
+		if isFragmentRequest(r) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, `<p class="alert alert-success">%s</p>`, heldMessage("comment"))
+			return
+		}
+		h.addFlash(w, r, "success", heldMessage("comment"))
+		http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+		return
+	}
+
+	if err := h.DB.CreateComment(r.Context(), comment); err != nil {
+		if err == database.ErrArchived {
+			h.RenderError(w, r, http.StatusForbidden, "This thread is archived")
+			return
+		}
+		h.RenderError(w, r, http.StatusInternalServerError, "Error creating comment")
+		return
+	}
+	h.PageCache.DeletePrefix(postPagePrefix(postID))
+	h.notifyReply(r, currentUser, comment)
+
+	// The thread page's script adds the new comment in place
+	if isFragmentRequest(r) {
+		h.renderCommentFragment(w, r, currentUser, postID, comment.ID, http.StatusCreated)
 		return
 	}
 
 	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
 }
 
-// Like post handler
-func (h *Handler) LikePostHandler(w http.ResponseWriter, r *http.Request) {
+// likePost records the current user's like or dislike of a post, from the
+// post_id and action ("like" or "dislike") form values. Voting the same way
+// twice takes the vote back. On failure it writes the error response and
+// returns ok false.
+func (h *Handler) likePost(w http.ResponseWriter, r *http.Request) (currentUser *models.User, postID int, ok bool) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return nil, 0, false
 	}
 
-	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
-		return
-	}
+	currentUser = h.GetCurrentUser(r)
 
 	postIDStr := r.FormValue("post_id")
 	action := r.FormValue("action")
@@ -724,13 +1058,27 @@ func (h *Handler) LikePostHandler(w http.ResponseWriter, r *http.Request) {
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
 		http.Error(w, "Invalid post ID", http.StatusBadRequest)
-		return
+		return nil, 0, false
 	}
 
 	isLike := action == "like"
 
-	if err := h.DB.LikePost(currentUser.ID, postID, isLike); err != nil {
-		http.Error(w, "Error processing like", http.StatusInternalServerError)
+	if err := h.DB.LikePost(r.Context(), currentUser.ID, postID, isLike); err != nil {
+		if err == database.ErrArchived {
+			h.RenderError(w, r, http.StatusForbidden, "This thread is archived")
+			return nil, 0, false
+		}
+		h.RenderError(w, r, http.StatusInternalServerError, "Error processing like")
+		return nil, 0, false
+	}
+	h.PageCache.DeletePrefix(postPagePrefix(postID))
+	return currentUser, postID, true
+}
+
+// Like post handler
+func (h *Handler) LikePostHandler(w http.ResponseWriter, r *http.Request) {
+	_, postID, ok := h.likePost(w, r)
+	if !ok {
 		return
 	}
 
@@ -743,18 +1091,15 @@ func (h *Handler) LikePostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Like comment handler
-func (h *Handler) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+// likeComment records the current user's like or dislike of a comment, from
+// the comment_id and action ("like" or "dislike") form values, like likePost
+func (h *Handler) likeComment(w http.ResponseWriter, r *http.Request) (currentUser *models.User, commentID int, ok bool) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return nil, 0, false
 	}
 
-	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
-		return
-	}
+	currentUser = h.GetCurrentUser(r)
 
 	commentIDStr := r.FormValue("comment_id")
 	action := r.FormValue("action")
@@ -762,13 +1107,30 @@ func (h *Handler) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
 		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
-		return
+		return nil, 0, false
 	}
 
 	isLike := action == "like"
 
-	if err := h.DB.LikeComment(currentUser.ID, commentID, isLike); err != nil {
-		http.Error(w, "Error processing like", http.StatusInternalServerError)
+	if err := h.DB.LikeComment(r.Context(), currentUser.ID, commentID, isLike); err != nil {
+		if err == database.ErrArchived {
+			h.RenderError(w, r, http.StatusForbidden, "This thread is archived")
+			return nil, 0, false
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return nil, 0, false
+		}
+		h.RenderError(w, r, http.StatusInternalServerError, "Error processing like")
+		return nil, 0, false
+	}
+	h.invalidatePostPages()
+	return currentUser, commentID, true
+}
+
+// Like comment handler
+func (h *Handler) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := h.likeComment(w, r); !ok {
 		return
 	}
 
@@ -783,22 +1145,7 @@ func (h *Handler) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 
 // 404 handler
 func (h *Handler) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	data := PageData{
-		CurrentUser: h.GetCurrentUser(r),
-		Title:       "Page Not Found",
-	}
-
-	tmpl, err := h.LoadPageTemplate("templates/404.html")
-	if err != nil {
-		log.Printf("Failed to load 404 template: %v", err)
-		http.Error(w, "Page not found", http.StatusNotFound)
-		return
-	}
-
-	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-		http.Error(w, "Page not found", http.StatusNotFound)
-	}
+	h.RenderError(w, r, http.StatusNotFound, "")
 }
 
 // Search handler
@@ -810,44 +1157,43 @@ func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	var err error
 
 	if searchTerm != "" {
-		posts, err = h.DB.SearchPosts(searchTerm, 50)
+		posts, err = h.DB.SearchPosts(r.Context(), searchTerm, 50)
 		if err != nil {
-			http.Error(w, "Error searching posts", http.StatusInternalServerError)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error searching posts")
 			return
 		}
+		posts = withoutBlocked(posts, h.blockedUsers(r, currentUser))
+		h.styleCategories(r, posts)
 	}
 
-	categories, err := h.DB.GetAllCategories()
+	categories, err := h.DB.GetAllCategories(r.Context())
 	if err != nil {
-		http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching categories")
 		return
 	}
 
 	data := PageData{
 		Posts:       posts,
-		Categories:  categories,
+		Categories:  models.FlattenCategories(categories),
 		CurrentUser: currentUser,
 		Title:       "Search Results",
+		Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Search Results", URL: "/search?" + r.URL.RawQuery}),
 		Filter:      "search",
 		FormData: map[string]string{
 			"q": searchTerm,
 		},
 	}
 
-	tmpl, err := h.LoadPageTemplate("templates/search.html")
-	if err != nil {
-		log.Printf("Failed to load search template: %v", err)
-		http.Error(w, "Error loading template", http.StatusInternalServerError)
-		return
-	}
-
-	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-		http.Error(w, "Please enter search criteria", http.StatusInternalServerError)
-	}
+	h.Render(w, r, "search", data)
 }
 
 // Search suggestions API for real-time search
 func (h *Handler) SearchSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.Features.Enabled(r.Context(), "search_suggestions") {
+		http.NotFound(w, r)
+		return
+	}
+
 	searchTerm := strings.TrimSpace(r.URL.Query().Get("q"))
 
 	if searchTerm == "" {
@@ -856,11 +1202,12 @@ func (h *Handler) SearchSuggestionsHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	posts, err := h.DB.SearchPostSuggestions(searchTerm, 5)
+	posts, err := h.DB.SearchPostSuggestions(r.Context(), searchTerm, 5)
 	if err != nil {
-		http.Error(w, "Error searching posts", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error searching posts")
 		return
 	}
+	posts = withoutBlocked(posts, h.blockedUsers(r, h.GetCurrentUser(r)))
 
 	// Create a simple response structure
 	type suggestion struct {
@@ -896,135 +1243,276 @@ func (h *Handler) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	username := strings.TrimPrefix(r.URL.Path, "/profile/")
 
 	// Get user by username
-	user, err := h.DB.GetUserByUsername(username)
-	if err != nil {
+	user, err := h.DB.GetUserByUsername(r.Context(), username)
+	if err == sql.ErrNoRows {
+		// Links to members who have since changed their name lead to them
+		newUsername, err := h.DB.GetRenamedUsername(r.Context(), username)
 		if err == sql.ErrNoRows {
 			h.NotFoundHandler(w, r)
-			return
+		} else if err != nil {
+			slog.ErrorContext(r.Context(), "failed to look up renamed user", "username", username, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user")
+		} else {
+			target := url.URL{Path: "/profile/" + newUsername, RawQuery: r.URL.RawQuery}
+			http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
 		}
-		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user")
+		return
+	}
+	if hiddenFrom(h.GetCurrentUser(r), user) {
+		h.NotFoundHandler(w, r)
 		return
 	}
 
 	// Get user's posts
-	posts, err := h.DB.GetPostsByUser(user.ID)
+	posts, err := h.DB.GetPostsByUser(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, "Error fetching user posts", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user posts")
 		return
 	}
 
 	// Get user's comments
-	comments, err := h.DB.GetCommentsByUser(user.ID)
+	comments, err := h.DB.GetCommentsByUser(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, "Error fetching user comments", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user comments")
 		return
 	}
 
 	currentUser := h.GetCurrentUser(r)
 
+	// The profile shows the activity timeline, the bookshelves or the wall
+	var activity []models.Activity
+	var nextCursor string
+	var shelves []bookshelf
+	var reading *models.Book
+	var wallPosts []models.WallPost
+	var wallClosed bool
+	tab := r.URL.Query().Get("tab")
+	switch tab {
+	case "wall":
+		query := database.WallPageQuery{
+			ProfileUserID: user.ID,
+			ShowSuspended: currentUser != nil && currentUser.IsAdmin(),
+			Cursor:        r.URL.Query().Get("cursor"),
+		}
+		if currentUser != nil {
+			query.ViewerID = currentUser.ID
+		}
+		wallPosts, nextCursor, err = h.DB.GetWallPage(r.Context(), query)
+		if err == database.ErrInvalidCursor {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			slog.ErrorContext(r.Context(), "failed to fetch wall", "target_user_id", user.ID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error fetching wall")
+			return
+		}
+
+		prefs, err := h.DB.GetPreferences(r.Context(), user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to fetch preferences", "target_user_id", user.ID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error fetching wall")
+			return
+		}
+		wallClosed = prefs.WallClosed
+
+		// Owners seeing their wall clears the new messages badge, unless it
+		// is an admin viewing as them
+		if currentUser != nil && currentUser.ID == user.ID && currentUser.Impersonator == nil {
+			if err := h.DB.MarkWallSeen(r.Context(), user.ID); err != nil {
+				slog.ErrorContext(r.Context(), "failed to mark wall seen", "err", err)
+			}
+		}
+	case "shelves":
+		entries, err := h.DB.GetShelfEntriesByUser(r.Context(), user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to fetch bookshelves", "target_user_id", user.ID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error fetching bookshelves")
+			return
+		}
+		shelves = groupShelves(entries)
+	case "":
+		tab = "activity"
+		// Get one page of the user's activity timeline
+		activity, nextCursor, err = h.DB.GetUserActivity(r.Context(), database.ActivityPageQuery{
+			UserID: user.ID,
+			Cursor: r.URL.Query().Get("cursor"),
+		})
+		if err == database.ErrInvalidCursor {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			slog.ErrorContext(r.Context(), "failed to fetch user activity", "target_user_id", user.ID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user activity")
+			return
+		}
+	default:
+		h.NotFoundHandler(w, r)
+		return
+	}
+
 	data := PageData{
 		Posts:       posts,
 		Comments:    comments,
 		CurrentUser: currentUser,
 		Title:       fmt.Sprintf("%s's Profile", user.Username),
+		Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), profileCrumb(user.Username)),
 	}
 
 	// Add the profile user to the data structure
 	type ProfilePageData struct {
 		PageData
-		ProfileUser *models.User `json:"profile_user"`
-	}
-
-	profileData := ProfilePageData{
-		PageData:    data,
-		ProfileUser: user,
+		ProfileUser *models.User      `json:"profile_user"`
+		Activity    []models.Activity `json:"activity"`
+		NextCursor  string            `json:"next_cursor,omitempty"`
+		OlderPage   bool              `json:"-"` // Whether this is not the first page of activity
+		Blocked     bool              `json:"-"` // Whether the viewer has blocked the profile user
+		Tab         string            `json:"-"` // "activity", "shelves" or "wall"
+		Shelves     []bookshelf       `json:"-"`
+		WallPosts   []models.WallPost `json:"-"`
+		WallClosed  bool              `json:"-"`                    // Whether the profile user's wall is closed to new messages
+		Reading     *models.Book      `json:"reading,omitempty"`    // The book the profile user is currently reading
+		Previously  []string          `json:"previously,omitempty"` // The profile user's old usernames, most recent first
+		LastSeen    *time.Time        `json:"last_seen,omitempty"`  // When the profile user was last active, unless they hide it
+		Online      bool              `json:"online"`
+		UserTitle   string            `json:"user_title,omitempty"` // The profile user's earned or custom title
+	}
+
+	if book, ok := h.readingBooks(r, []int{user.ID})[user.ID]; ok {
+		reading = &book
+	}
+
+	history, err := h.DB.GetUsernameHistory(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch username history", "target_user_id", user.ID, "err", err)
 	}
-
-	tmpl, err := h.LoadPageTemplate("templates/profile.html")
+	lastSeen, err := h.DB.GetLastSeen(r.Context(), user.ID)
 	if err != nil {
-		log.Printf("Failed to load profile template: %v", err)
-		http.Error(w, "Error loading template", http.StatusInternalServerError)
-		return
+		slog.ErrorContext(r.Context(), "failed to fetch last seen", "target_user_id", user.ID, "err", err)
 	}
 
-	if err := tmpl.ExecuteTemplate(w, "base", profileData); err != nil {
-		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+	// Members may go back to an old name, so skip it and repeats
+	var previously []string
+	seen := map[string]bool{user.Username: true}
+	for _, change := range history {
+		if !seen[change.Username] {
+			seen[change.Username] = true
+			previously = append(previously, change.Username)
+		}
 	}
+
+	profileData := ProfilePageData{
+		PageData:    data,
+		ProfileUser: user,
+		Activity:    activity,
+		NextCursor:  nextCursor,
+		OlderPage:   r.URL.Query().Get("cursor") != "",
+		Blocked:     h.blockedUsers(r, currentUser)[user.ID],
+		Tab:         tab,
+		Shelves:     shelves,
+		WallPosts:   wallPosts,
+		WallClosed:  wallClosed,
+		Reading:     reading,
+		Previously:  previously,
+		LastSeen:    lastSeen,
+		Online:      isOnline(lastSeen),
+		UserTitle:   h.userTitles(r, []int{user.ID})[user.ID],
+	}
+
+	h.Render(w, r, "profile", profileData)
 }
 
 // Edit profile handler
 func (h *Handler) EditProfileHandler(w http.ResponseWriter, r *http.Request) {
 	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
 
 	if r.Method == http.MethodGet {
-		data := PageData{
-			CurrentUser: currentUser,
-			Title:       "Edit Profile",
-		}
-
-		tmpl, err := h.LoadPageTemplate("templates/edit_profile.html")
-		if err != nil {
-			log.Printf("Failed to load edit profile template: %v", err)
-			http.Error(w, "Error loading template", http.StatusInternalServerError)
-			return
-		}
-
-		if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		}
+		h.renderEditProfile(w, r, currentUser, http.StatusOK, "")
 		return
 	}
 
 	if r.Method == http.MethodPost {
-		profilePicture := strings.TrimSpace(r.FormValue("profile_picture"))
-		signature := strings.TrimSpace(r.FormValue("signature"))
-
-		// Basic validation for profile picture URL
-		if profilePicture != "" && !strings.HasPrefix(profilePicture, "http") {
-			data := PageData{
-				CurrentUser: currentUser,
-				Title:       "Edit Profile",
-				Error:       "Profile picture must be a valid URL starting with http",
-			}
-
-			tmpl, err := h.LoadPageTemplate("templates/edit_profile.html")
-			if err != nil {
-				http.Error(w, "Error loading template", http.StatusInternalServerError)
+		// Leave room for the other form fields next to the picture
+		maxUpload := int64(h.Config.Avatars.MaxUploadMB) << 20
+		r.Body = http.MaxBytesReader(w, r.Body, maxUpload+64<<10)
+		if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				h.renderEditProfile(w, r, currentUser, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Profile picture must be at most %d MB", h.Config.Avatars.MaxUploadMB))
 				return
 			}
-
-			w.WriteHeader(http.StatusBadRequest)
-			tmpl.ExecuteTemplate(w, "base", data)
+			h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, "The form could not be read, please try again")
 			return
 		}
+		if r.MultipartForm != nil {
+			defer r.MultipartForm.RemoveAll()
+		}
 
-		if len(signature) > 500 {
-			data := PageData{
-				CurrentUser: currentUser,
-				Title:       "Edit Profile",
-				Error:       "Signature must be less than 500 characters",
+		// Edit a copy so the form shows what was typed if it is rejected
+		profile := *currentUser
+		profile.Signature = strings.TrimSpace(r.FormValue("signature"))
+		if profile.Signature != "" {
+			if msg := checkLength("Signature", profile.Signature, h.Config.Content.Signature); msg != "" {
+				h.renderEditProfile(w, r, &profile, http.StatusBadRequest, msg)
+				return
 			}
-
-			tmpl, err := h.LoadPageTemplate("templates/edit_profile.html")
-			if err != nil {
-				http.Error(w, "Error loading template", http.StatusInternalServerError)
+		}
+		if profile.Signature != currentUser.Signature {
+			if msg := linksNotAllowed(currentUser, profile.Signature); msg != "" {
+				h.renderEditProfile(w, r, &profile, http.StatusForbidden, msg)
 				return
 			}
-
-			w.WriteHeader(http.StatusBadRequest)
-			tmpl.ExecuteTemplate(w, "base", data)
+		}
+		if err := readProfileFields(r, &profile); err != nil {
+			h.renderEditProfile(w, r, &profile, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		err := h.DB.UpdateUserProfile(currentUser.ID, profilePicture, signature)
+		removeAvatar := r.FormValue("remove_avatar") == "on"
+		if removeAvatar {
+			profile.ProfilePicture = ""
+		} else {
+			url, err := h.saveAvatar(r, currentUser)
+			switch {
+			case errors.Is(err, errNotTrusted):
+				h.renderEditProfile(w, r, &profile, http.StatusForbidden, "New members can't upload a profile picture yet. You'll be able to once you've been around a little longer and joined in a few discussions.")
+				return
+			case errors.Is(err, errInfected):
+				h.renderEditProfile(w, r, &profile, http.StatusBadRequest, "Your profile picture was flagged by our virus scanner and was not saved")
+				return
+			case errors.Is(err, errScanFailed):
+				h.renderEditProfile(w, r, &profile, http.StatusServiceUnavailable, "Profile pictures can't be checked for viruses right now. Please try again later.")
+				return
+			case errors.Is(err, avatars.ErrUnsupportedType):
+				h.renderEditProfile(w, r, &profile, http.StatusBadRequest, "Profile pictures must be JPEG, PNG, GIF or WebP images")
+				return
+			case errors.Is(err, avatars.ErrTooManyPixels):
+				h.renderEditProfile(w, r, &profile, http.StatusBadRequest, "Profile picture dimensions are too large")
+				return
+			case errors.Is(err, avatars.ErrInvalidImage):
+				h.renderEditProfile(w, r, &profile, http.StatusBadRequest, "Profile picture could not be read as an image")
+				return
+			case err != nil:
+				slog.ErrorContext(r.Context(), "failed to save avatar", "err", err)
+				h.renderEditProfile(w, r, &profile, http.StatusInternalServerError, "Failed to save profile picture. Please try again.")
+				return
+			case url != "":
+				profile.ProfilePicture = url
+			}
+		}
+
+		err := h.DB.UpdateUserProfile(r.Context(), &profile)
 		if err != nil {
-			http.Error(w, "Error updating profile", http.StatusInternalServerError)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error updating profile")
 			return
 		}
+		if removeAvatar {
+			h.deleteAvatar(r, currentUser.ID)
+		}
+		h.invalidatePostPages()
 
 		http.Redirect(w, r, fmt.Sprintf("/profile/%s", currentUser.Username), http.StatusSeeOther)
 		return
@@ -1036,10 +1524,6 @@ func (h *Handler) EditProfileHandler(w http.ResponseWriter, r *http.Request) {
 // Delete profile handler
 func (h *Handler) DeleteProfileHandler(w http.ResponseWriter, r *http.Request) {
 	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
 
 	if r.Method == http.MethodPost {
 		// Get confirmation from form
@@ -1047,43 +1531,19 @@ func (h *Handler) DeleteProfileHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Check if user typed their username correctly for confirmation
 		if confirmation != currentUser.Username {
-			data := PageData{
-				CurrentUser: currentUser,
-				Title:       "Edit Profile",
-				Error:       "Please type your username exactly to confirm deletion",
-			}
-
-			tmpl, err := h.LoadPageTemplate("templates/edit_profile.html")
-			if err != nil {
-				http.Error(w, "Error loading template", http.StatusInternalServerError)
-				return
-			}
-
-			w.WriteHeader(http.StatusBadRequest)
-			tmpl.ExecuteTemplate(w, "base", data)
+			h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, "Please type your username exactly to confirm deletion")
 			return
 		}
 
 		// Delete the user and all related data
-		err := h.DB.DeleteUser(currentUser.ID)
+		err := h.DB.DeleteUser(r.Context(), currentUser.ID)
 		if err != nil {
-			log.Printf("Error deleting user %d: %v", currentUser.ID, err)
-			data := PageData{
-				CurrentUser: currentUser,
-				Title:       "Edit Profile",
-				Error:       "Failed to delete profile. Please try again.",
-			}
-
-			tmpl, err2 := h.LoadPageTemplate("templates/edit_profile.html")
-			if err2 != nil {
-				http.Error(w, "Error loading template", http.StatusInternalServerError)
-				return
-			}
-
-			w.WriteHeader(http.StatusInternalServerError)
-			tmpl.ExecuteTemplate(w, "base", data)
+			slog.ErrorContext(r.Context(), "failed to delete user", "target_user_id", currentUser.ID, "err", err)
+			h.renderEditProfile(w, r, currentUser, http.StatusInternalServerError, "Failed to delete profile. Please try again.")
 			return
 		}
+		h.deleteAvatar(r, currentUser.ID)
+		h.invalidatePostPages()
 
 		// Clear the session cookie
 		http.SetCookie(w, &http.Cookie{
@@ -1094,44 +1554,22 @@ func (h *Handler) DeleteProfileHandler(w http.ResponseWriter, r *http.Request) {
 			HttpOnly: true,
 		})
 
-		// Redirect to home page with success message
-		http.Redirect(w, r, "/?deleted=true", http.StatusSeeOther)
+		h.addFlash(w, r, "success", "Profile successfully deleted. Thank you for being part of Literary Lions!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
-// Admin middleware
-func (h *Handler) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		user := h.GetCurrentUser(r)
-		if user == nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		if !user.IsAdmin() {
-			http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
-			return
-		}
-
-		next(w, r)
-	}
-}
-
 // Admin panel handler
 func (h *Handler) AdminPanelHandler(w http.ResponseWriter, r *http.Request) {
 	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil || !currentUser.IsAdmin() {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
 
 	// Get all users
-	users, err := h.DB.GetAllUsers()
+	users, err := h.DB.GetAllUsers(r.Context())
 	if err != nil {
-		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching users")
 		return
 	}
 
@@ -1145,9 +1583,9 @@ func (h *Handler) AdminPanelHandler(w http.ResponseWriter, r *http.Request) {
 
 	var usersWithStats []UserWithStats
 	for _, user := range users {
-		posts, comments, likes, err := h.DB.GetUserStats(user.ID)
+		posts, comments, likes, err := h.DB.GetUserStats(r.Context(), user.ID)
 		if err != nil {
-			log.Printf("Error getting stats for user %d: %v", user.ID, err)
+			slog.WarnContext(r.Context(), "failed to get user stats", "target_user_id", user.ID, "err", err)
 			posts, comments, likes = 0, 0, 0
 		}
 
@@ -1159,36 +1597,29 @@ func (h *Handler) AdminPanelHandler(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	// Handle URL parameters for success/error messages
-	var formData map[string]string
-	if success := r.URL.Query().Get("success"); success != "" {
-		formData = map[string]string{"success": success}
-	} else if errorMsg := r.URL.Query().Get("error"); errorMsg != "" {
-		formData = map[string]string{"error": errorMsg}
-	}
-
 	data := struct {
 		PageData
-		Users []UserWithStats `json:"users"`
+		Users          []UserWithStats `json:"users"`
+		BackupsEnabled bool            `json:"backups_enabled"`
+		LastBackup     time.Time       `json:"last_backup"`
+		HeldContent    int             `json:"held_content"` // Posts and comments in the moderation queue
 	}{
 		PageData: PageData{
 			CurrentUser: currentUser,
 			Title:       "Admin Panel",
-			FormData:    formData,
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), adminCrumb),
 		},
-		Users: usersWithStats,
+		Users:          usersWithStats,
+		BackupsEnabled: h.Backups != nil,
 	}
-
-	tmpl, err := h.LoadPageTemplate("templates/admin_panel.html")
-	if err != nil {
-		log.Printf("Failed to load admin panel template: %v", err)
-		http.Error(w, "Error loading template", http.StatusInternalServerError)
-		return
+	if h.Backups != nil {
+		data.LastBackup = h.Backups.LastSuccess()
 	}
-
-	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+	if data.HeldContent, err = h.DB.CountHeldContent(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "failed to count held content", "err", err)
 	}
+
+	h.Render(w, r, "admin_panel", data)
 }
 
 // Admin suspend user handler
@@ -1198,12 +1629,6 @@ func (h *Handler) AdminSuspendUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil || !currentUser.IsAdmin() {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-
 	userIDStr := r.FormValue("user_id")
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
@@ -1212,22 +1637,32 @@ func (h *Handler) AdminSuspendUserHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	action := r.FormValue("action")
+	reason, ok := formReason(r)
+	if !ok {
+		http.Error(w, "Reason too long", http.StatusBadRequest)
+		return
+	}
 
 	switch action {
 	case "suspend":
-		err = h.DB.SuspendUser(userID)
+		err = h.DB.SuspendUser(r.Context(), userID, reason)
 	case "unsuspend":
-		err = h.DB.UnsuspendUser(userID)
+		err = h.DB.UnsuspendUser(r.Context(), userID)
 	default:
 		http.Error(w, "Invalid action", http.StatusBadRequest)
 		return
 	}
 
 	if err != nil {
-		log.Printf("Error %s user %d: %v", action, userID, err)
-		http.Error(w, fmt.Sprintf("Error %s user", action), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to change user status", "action", action, "target_user_id", userID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error %s user", action))
 		return
 	}
+	h.invalidatePostPages()
+	if action == "suspend" {
+		h.audit(r, h.GetCurrentUser(r), "user.suspend", userID, withReason("suspended", reason))
+		h.notifyModeration(r, userID, "suspended your account", reason)
+	}
 
 	// Redirect back to admin panel
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
@@ -1241,10 +1676,6 @@ func (h *Handler) AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	currentUser := h.GetCurrentUser(r)
-	if currentUser == nil || !currentUser.IsAdmin() {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
 
 	userIDStr := r.FormValue("user_id")
 	userID, err := strconv.Atoi(userIDStr)
@@ -1254,37 +1685,41 @@ func (h *Handler) AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Prevent admin from deleting themselves or other admins
-	targetUser, err := h.DB.GetUserByID(userID)
+	targetUser, err := h.DB.GetUserByID(r.Context(), userID)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
 	if targetUser.IsAdmin() {
-		http.Error(w, "Cannot delete admin users", http.StatusForbidden)
+		h.RenderError(w, r, http.StatusForbidden, "Cannot delete admin users")
 		return
 	}
 
 	if targetUser.ID == currentUser.ID {
-		http.Error(w, "Cannot delete yourself", http.StatusForbidden)
+		h.RenderError(w, r, http.StatusForbidden, "Cannot delete yourself")
 		return
 	}
 
 	// Confirmation check
 	confirmation := r.FormValue("confirmation")
 	if confirmation != targetUser.Username {
-		http.Redirect(w, r, "/admin?error=confirmation", http.StatusSeeOther)
+		h.addFlash(w, r, "error", "Username confirmation failed. Please try again.")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 		return
 	}
 
 	// Delete the user and all related data
-	err = h.DB.DeleteUser(userID)
+	err = h.DB.DeleteUser(r.Context(), userID)
 	if err != nil {
-		log.Printf("Error deleting user %d: %v", userID, err)
-		http.Redirect(w, r, "/admin?error=delete", http.StatusSeeOther)
+		slog.ErrorContext(r.Context(), "failed to delete user", "target_user_id", userID, "err", err)
+		h.addFlash(w, r, "error", "Failed to delete user. Please try again.")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 		return
 	}
+	h.deleteAvatar(r, userID)
+	h.invalidatePostPages()
 
-	// Redirect back to admin panel with success message
-	http.Redirect(w, r, "/admin?success=deleted", http.StatusSeeOther)
+	h.addFlash(w, r, "success", "User successfully deleted!")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
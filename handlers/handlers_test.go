@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"literary-lions/config"
+	"literary-lions/database"
+	"literary-lions/models"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestHandler returns a handler backed by a migrated SQLite database in a
+// temporary directory, rendering the templates from the repository
+func newTestHandler(t *testing.T) (*Handler, *database.DB) {
+	t.Helper()
+	db, err := database.NewDB("sqlite3", filepath.Join(t.TempDir(), "forum.db"), database.DefaultSQLitePragmas(), database.PoolConfig{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := config.Default()
+	if err := db.InitDB(context.Background(), cfg.Admin); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+
+	assetURL := func(name string) string { return "/static/" + name }
+	imageURL := func(src string, width int) string { return src }
+	templates, err := LoadTemplates(os.DirFS("../templates"), false, assetURL, imageURL, cfg.Content)
+	if err != nil {
+		t.Fatalf("load templates: %v", err)
+	}
+	return NewHandler(db, templates, &cfg), db
+}
+
+// createTestUser adds a member with the given username, new to the forum
+func createTestUser(t *testing.T, db *database.DB, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Email: username + "@example.com", Password: "hash"}
+	if err := db.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	user, err := db.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("fetch user %s: %v", username, err)
+	}
+	return user
+}
+
+// signIn starts a session for user and returns its cookie
+func signIn(t *testing.T, db *database.DB, user *models.User) *http.Cookie {
+	t.Helper()
+	session := &models.Session{UserID: user.ID, UUID: "session-" + user.Username, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.CreateSession(context.Background(), session); err != nil {
+		t.Fatalf("create session for %s: %v", user.Username, err)
+	}
+	return &http.Cookie{Name: "session", Value: session.UUID}
+}
+
+// postForm sends form to handler as a POST to target from the session's member
+func postForm(handler http.HandlerFunc, session *http.Cookie, target string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(session)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// postMultipart sends form to handler as a multipart POST to target from the
+// session's member, as forms that can upload files are sent
+func postMultipart(t *testing.T, handler http.HandlerFunc, session *http.Cookie, target string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, values := range form {
+		for _, value := range values {
+			if err := mw.WriteField(name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, target, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.AddCookie(session)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// countRows counts the rows of a table
+func countRows(t *testing.T, db *database.DB, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM "+table).Scan(&n); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
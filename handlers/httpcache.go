@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"literary-lions/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// startedAt goes into every page validator, so pages browsers kept from
+// before a restart, which may have brought new templates, are sent again
+var startedAt = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// notModified sets the validators of a page for visitors: an ETag built from
+// version, anything else the page shows (such as the categories), and the
+// visitor's language and theme. If the copy the request already has is
+// current, it answers 304 Not Modified and returns true, so the page need not
+// be loaded or rendered. Browsers are told to check back every time, so
+// visitors never see a stale page. There is no Last-Modified: no single time
+// covers votes, restarts, feature flags and the rest of what the ETag does.
+func (h *Handler) notModified(w http.ResponseWriter, r *http.Request, version models.PageVersion, shows ...any) bool {
+	parts := []string{
+		startedAt,
+		version.Tag,
+		h.locale(r, nil),
+		h.theme(r, nil),
+		strconv.Itoa(h.membersOnline(r)),
+		fmt.Sprint(h.Features.All(r.Context())),
+		fmt.Sprint(shows...),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	etag := `W/"` + hex.EncodeToString(sum[:12]) + `"`
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "no-cache")
+	header.Add("Vary", "Accept-Language, Cookie")
+
+	if !fresh(r, etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// fresh reports whether the copy of a page a GET or HEAD request already
+// has is current, going by If-None-Match alone
+func fresh(r *http.Request, etag string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	match := r.Header.Get("If-None-Match")
+	return match != "" && etagListed(match, etag)
+}
+
+// etagListed reports whether an If-None-Match header lists etag. Tags are
+// compared weakly, ignoring the W/ prefix, as the header requires.
+func etagListed(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
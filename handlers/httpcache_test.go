@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"literary-lions/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPostPageRevalidatesAfterVotes(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	post := &models.Post{Title: "Alice's thread", Content: "Vote on me", UserID: alice.ID, CategoryID: 1}
+	if err := db.CreatePost(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	target := "/post/" + strconv.Itoa(post.ID)
+	get := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		h.ViewPostHandler(w, r)
+		return w
+	}
+
+	w := get("", "")
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") != "" {
+		t.Fatalf("post page validators: ETag %q, Last-Modified %q, want only an ETag", etag, w.Header().Get("Last-Modified"))
+	}
+	if w = get("If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("revalidating an unchanged page answered %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	if err := db.LikePost(ctx, bob.ID, post.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if w = get("If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("revalidating after a vote answered %d, want %d", w.Code, http.StatusOK)
+	}
+	if w = get("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); w.Code != http.StatusOK {
+		t.Errorf("If-Modified-Since alone answered %d, want %d", w.Code, http.StatusOK)
+	}
+}
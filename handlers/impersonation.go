@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"literary-lions/auth"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// impersonationLifetime is how long an admin may view the forum as a member
+// before having to start again
+const impersonationLifetime = time.Hour
+
+// privatePages are the paths of pages only their member sees, such as their
+// messages and the posts they scheduled, by prefix
+var privatePages = []string{"/messages", "/drafts", "/settings", "/edit-profile"}
+
+// startImpersonatedRequest marks user as being viewed by the admin with the
+// given ID, reporting whether the session is still allowed. Everything
+// changed while impersonating is recorded in the audit log, and so is every
+// private page viewed.
+func (h *Handler) startImpersonatedRequest(r *http.Request, user *models.User, adminID int) bool {
+	admin, err := h.DB.GetUserByID(r.Context(), adminID)
+	if err != nil || !admin.IsAdmin() {
+		return false
+	}
+	user.Impersonator = admin
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.audit(r, admin, "impersonation.request", user.ID, r.Method+" "+r.URL.Path)
+	} else if isPrivatePage(r.URL.Path) {
+		h.audit(r, admin, "impersonation.view", user.ID, r.URL.Path)
+	}
+	return true
+}
+
+// isPrivatePage reports whether path is one of the privatePages
+func isPrivatePage(path string) bool {
+	for _, prefix := range privatePages {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RefuseImpersonation keeps admins viewing the forum as a member out of
+// next, for account settings only the member themselves may change. It
+// goes after RequireUser.
+func (h *Handler) RefuseImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.GetCurrentUser(r).Impersonator != nil {
+			h.RenderError(w, r, http.StatusForbidden, "Account settings can't be changed while viewing the forum as another member")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RefuseImpersonatedWrites lets admins viewing the forum as a member see
+// what next serves but not act on it, for pages such as private messages
+// where acting would speak for the member. It goes after RequireUser.
+func (h *Handler) RefuseImpersonatedWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && h.GetCurrentUser(r).Impersonator != nil {
+			h.RenderError(w, r, http.StatusForbidden, "Messages can't be sent while viewing the forum as another member")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminImpersonateHandler starts viewing the forum as a member, to see what
+// they see, replacing the admin's session with one as the member that
+// remembers the admin. No password is needed or revealed.
+func (h *Handler) AdminImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	currentUser := h.GetCurrentUser(r)
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	target, err := h.DB.GetUserByID(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user")
+		return
+	}
+	switch {
+	case target.IsAdmin():
+		h.addFlash(w, r, "error", "Admins can't be viewed as.")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	case target.IsDeactivated():
+		h.addFlash(w, r, "error", target.Username+" has deactivated their account.")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	if h.switchSession(w, r, target.ID, impersonationLifetime, &currentUser.ID) == "" {
+		return
+	}
+	h.audit(r, currentUser, "impersonation.start", target.ID, "viewing the forum as "+target.Username)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// StopImpersonatingHandler ends viewing the forum as a member, logging the
+// admin back in to their own account
+func (h *Handler) StopImpersonatingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	currentUser := h.GetCurrentUser(r)
+	admin := currentUser.Impersonator
+	if admin == nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	uuid := h.switchSession(w, r, admin.ID, h.Config.Sessions.Lifetime, nil)
+	if uuid == "" {
+		return
+	}
+	h.audit(r, admin, "impersonation.stop", currentUser.ID, "stopped viewing the forum as "+currentUser.Username)
+	flash := models.Flash{Kind: "success", Message: "You're back in your own account."}
+	if err := h.DB.AddFlash(r.Context(), uuid, flash); err != nil {
+		slog.ErrorContext(r.Context(), "failed to add flash message", "err", err)
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// switchSession ends the request's session and starts a new one as userID,
+// lasting lifetime, on behalf of impersonatorID if set, returning its UUID.
+// On failure it writes the response and returns "".
+func (h *Handler) switchSession(w http.ResponseWriter, r *http.Request, userID int, lifetime time.Duration, impersonatorID *int) string {
+	uuid, err := auth.GenerateUUID()
+	if err != nil {
+		h.RenderError(w, r, http.StatusInternalServerError, "Error creating session")
+		return ""
+	}
+	session := &models.Session{
+		UserID:         userID,
+		UUID:           uuid,
+		ExpiresAt:      time.Now().Add(lifetime),
+		ImpersonatorID: impersonatorID,
+	}
+	if err := h.DB.CreateSession(r.Context(), session); err != nil {
+		slog.ErrorContext(r.Context(), "failed to create session", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error creating session")
+		return ""
+	}
+
+	if cookie, err := r.Cookie("session"); err == nil {
+		if err := h.DB.DeleteSession(r.Context(), cookie.Value); err != nil {
+			slog.ErrorContext(r.Context(), "failed to end session", "err", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    uuid,
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   h.Config.TLS.Enabled(),
+		Path:     "/",
+	})
+	return uuid
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"literary-lions/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestImpersonationAuditsPrivatePages(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	createTestUser(t, db, "bob")
+	admin, err := db.GetUserByUsername(ctx, h.Config.Admin.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &models.Session{UserID: alice.ID, UUID: "viewing-alice", ExpiresAt: time.Now().Add(time.Hour), ImpersonatorID: &admin.ID}
+	if err := db.CreateSession(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	cookie := &http.Cookie{Name: "session", Value: session.UUID}
+
+	for _, path := range []string{"/", "/messages"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.AddCookie(cookie)
+		h.GetCurrentUser(r)
+	}
+	entries, err := db.GetAuditLog(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "impersonation.view" || entries[0].Details != "/messages" {
+		t.Errorf("audit log after viewing / and /messages = %+v, want one view of /messages", entries)
+	}
+
+	send := h.RefuseImpersonatedWrites(http.HandlerFunc(h.MessagesHandler))
+	w := postForm(send.ServeHTTP, cookie, "/messages/new", url.Values{"to": {"bob"}, "content": {"Hello"}})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("sending a message while viewing as alice answered %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if n := countRows(t, db, "messages"); n != 0 {
+		t.Errorf("%d messages sent, want 0", n)
+	}
+}
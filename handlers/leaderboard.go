@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"literary-lions/database"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+)
+
+// leaderboardWindow is a tab on the leaderboard page
+type leaderboardWindow struct {
+	Name  string
+	Label string
+}
+
+// leaderboardWindows are the time windows offered on the leaderboard page,
+// in the order their tabs are shown
+var leaderboardWindows = []leaderboardWindow{
+	{database.LeaderboardWeek, "This Week"},
+	{database.LeaderboardMonth, "This Month"},
+	{database.LeaderboardAllTime, "All Time"},
+}
+
+// LeaderboardHandler shows the top contributors over the window given by the
+// window query parameter ("week", "month" or "all"; "week" by default)
+func (h *Handler) LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = database.LeaderboardWeek
+	}
+	known := false
+	for _, lw := range leaderboardWindows {
+		known = known || lw.Name == window
+	}
+	if !known {
+		http.Error(w, "Invalid window", http.StatusBadRequest)
+		return
+	}
+
+	board, err := h.DB.GetLeaderboard(r.Context(), window)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch leaderboard", "window", window, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching leaderboard")
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	data := struct {
+		PageData
+		Leaderboard *models.Leaderboard `json:"leaderboard"`
+		Windows     []leaderboardWindow `json:"-"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Leaderboard",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Leaderboard", URL: "/leaderboard"}),
+		},
+		Leaderboard: board,
+		Windows:     leaderboardWindows,
+	}
+
+	h.Render(w, r, "leaderboard", data)
+}
+
+// siteSparkline is one of the activity charts on the statistics page
+type siteSparkline struct {
+	Label  string
+	Total  int
+	Points string
+	Color  string
+}
+
+// StatsHandler shows the forum's statistics at /stats: how many members,
+// posts and comments it has, its newest member, its busiest day and charts
+// of recent activity
+func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := h.DB.GetSiteStats(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch site stats", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching statistics")
+		return
+	}
+
+	charts := []siteSparkline{
+		{Label: "New posts", Points: sparkline(stats.DailyPosts, sparklineWidth, sparklineHeight), Color: "#3498db"},
+		{Label: "New comments", Points: sparkline(stats.DailyComments, sparklineWidth, sparklineHeight), Color: "#27ae60"},
+		{Label: "New members", Points: sparkline(stats.DailyMembers, sparklineWidth, sparklineHeight), Color: "#e67e22"},
+	}
+	for i, daily := range [][]int{stats.DailyPosts, stats.DailyComments, stats.DailyMembers} {
+		for _, n := range daily {
+			charts[i].Total += n
+		}
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	data := struct {
+		PageData
+		Stats           *models.SiteStats `json:"stats"`
+		ActivityDays    int               `json:"activity_days"`
+		Charts          []siteSparkline   `json:"-"`
+		SparklineWidth  int               `json:"-"`
+		SparklineHeight int               `json:"-"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Statistics",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Statistics", URL: "/stats"}),
+		},
+		Stats:           stats,
+		ActivityDays:    database.SiteActivityDays,
+		Charts:          charts,
+		SparklineWidth:  sparklineWidth,
+		SparklineHeight: sparklineHeight,
+	}
+
+	h.Render(w, r, "stats", data)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"fmt"
+	"literary-lions/config"
+	"unicode/utf8"
+)
+
+// checkLength returns a message for the writer if text, the named field, is
+// shorter or longer than length allows, or "" if it fits. Lengths count
+// characters, not bytes, as the character counters on the forms do.
+func checkLength(field, text string, length config.Length) string {
+	n := utf8.RuneCountInString(text)
+	switch {
+	case n == 0 && length.Min > 0:
+		return field + " is required"
+	case n < length.Min:
+		return fmt.Sprintf("%s must be at least %s long", field, pluralize(length.Min, "character", "characters"))
+	case n > length.Max:
+		return fmt.Sprintf("%s must be at most %s long, but is %d", field, pluralize(length.Max, "character", "characters"), n)
+	}
+	return ""
+}
+
+// checkPostLengths checks the title and text of a post, returning a message
+// for each that doesn't fit the configured limits
+func (h *Handler) checkPostLengths(title, content string) []string {
+	var errors []string
+	if msg := checkLength("Title", title, h.Config.Content.Title); msg != "" {
+		errors = append(errors, msg)
+	}
+	if msg := checkLength("Content", content, h.Config.Content.Post); msg != "" {
+		errors = append(errors, msg)
+	}
+	return errors
+}
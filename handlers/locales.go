@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"html/template"
+	"literary-lions/i18n"
+	"literary-lions/models"
+	"net/http"
+	"strings"
+)
+
+// locale picks the locale to show the page in: the viewer's language setting
+// if they chose one, otherwise the best match for their browser's languages
+func (h *Handler) locale(r *http.Request, viewer *models.User) string {
+	if viewer != nil && i18n.Supported(viewer.Language) {
+		return viewer.Language
+	}
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// translate is the T template function. Catalog text is trusted, so messages
+// whose keys end in "_html" may hold markup; their string arguments are
+// escaped.
+func translate(locale, key string, args ...interface{}) interface{} {
+	if !strings.HasSuffix(key, "_html") {
+		return i18n.T(locale, key, args...)
+	}
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			args[i] = template.HTMLEscapeString(s)
+		}
+	}
+	return template.HTML(i18n.T(locale, key, args...))
+}
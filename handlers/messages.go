@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxMessageLength limits the length of a private message
+const maxMessageLength = 5000
+
+// blockedMessage is shown when a message can't be sent because either member
+// has blocked the other
+const blockedMessage = "You can't exchange messages with this member"
+
+// unreadMessages returns the number of unread private messages shown in the
+// header. Errors are logged and count as no unread messages.
+func (h *Handler) unreadMessages(r *http.Request, user *models.User) int {
+	if user == nil {
+		return 0
+	}
+	count, err := h.DB.CountUnreadMessages(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to count unread messages", "err", err)
+		return 0
+	}
+	return count
+}
+
+// MessagesHandler serves the private messaging pages:
+//
+//	/messages       the inbox
+//	/messages/new   composing a message to another member (?to=username)
+//	/messages/{id}  a conversation, with a form to reply
+func (h *Handler) MessagesHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/messages"), "/")
+	switch path {
+	case "":
+		h.inbox(w, r, currentUser)
+	case "new":
+		h.composeMessage(w, r, currentUser)
+	default:
+		conversationID, err := strconv.Atoi(path)
+		if err != nil {
+			h.NotFoundHandler(w, r)
+			return
+		}
+		h.conversation(w, r, currentUser, conversationID)
+	}
+}
+
+// inbox lists the user's conversations
+func (h *Handler) inbox(w http.ResponseWriter, r *http.Request, currentUser *models.User) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conversations, err := h.DB.GetConversations(r.Context(), currentUser.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch conversations", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching messages")
+		return
+	}
+
+	data := struct {
+		PageData
+		Conversations []models.Conversation `json:"conversations"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Messages",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), messagesCrumb),
+		},
+		Conversations: conversations,
+	}
+	h.Render(w, r, "messages", data)
+}
+
+// composeMessage shows the form for a new message and sends it
+func (h *Handler) composeMessage(w http.ResponseWriter, r *http.Request, currentUser *models.User) {
+	switch r.Method {
+	case http.MethodGet:
+		h.renderCompose(w, r, currentUser, http.StatusOK, "", r.URL.Query().Get("to"), "")
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	to := strings.TrimSpace(r.FormValue("to"))
+	content := strings.TrimSpace(r.FormValue("content"))
+
+	recipient, err := h.DB.GetUserByUsername(r.Context(), to)
+	if err == sql.ErrNoRows {
+		h.renderCompose(w, r, currentUser, http.StatusBadRequest, "There is no member with that username", to, content)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch message recipient", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error sending message")
+		return
+	}
+	if recipient.IsDeactivated() {
+		h.renderCompose(w, r, currentUser, http.StatusBadRequest, "That member has deactivated their account", to, content)
+		return
+	}
+	if recipient.ID == currentUser.ID {
+		h.renderCompose(w, r, currentUser, http.StatusBadRequest, "You can't send a message to yourself", to, content)
+		return
+	}
+	blocked, err := h.DB.IsBlockedEitherWay(r.Context(), currentUser.ID, recipient.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check blocks", "recipient_id", recipient.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error sending message")
+		return
+	}
+	if blocked {
+		h.renderCompose(w, r, currentUser, http.StatusForbidden, blockedMessage, to, content)
+		return
+	}
+	if msg := validateMessage(currentUser, content); msg != "" {
+		h.renderCompose(w, r, currentUser, http.StatusBadRequest, msg, to, content)
+		return
+	}
+
+	message := &models.Message{SenderID: currentUser.ID, Content: content}
+	if err := h.DB.SendMessage(r.Context(), message, recipient.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to send message", "recipient_id", recipient.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error sending message")
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/messages/%d#message-%d", message.ConversationID, message.ID), http.StatusSeeOther)
+}
+
+// renderCompose renders the new message form, keeping what was typed
+func (h *Handler) renderCompose(w http.ResponseWriter, r *http.Request, currentUser *models.User, status int, message, to, content string) {
+	data := PageData{
+		CurrentUser: currentUser,
+		Title:       "New Message",
+		Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), messagesCrumb, Breadcrumb{Name: "New Message", URL: "/messages/new"}),
+		Error:       message,
+		FormData:    map[string]string{"to": to, "content": content},
+	}
+	h.RenderStatus(w, r, status, "message_new", data)
+}
+
+// conversation shows a conversation and adds replies to it
+func (h *Handler) conversation(w http.ResponseWriter, r *http.Request, currentUser *models.User, conversationID int) {
+	conversation, err := h.DB.GetConversation(r.Context(), conversationID, currentUser.ID)
+	if err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch conversation", "conversation_id", conversationID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching conversation")
+		return
+	}
+
+	blocked, err := h.DB.IsBlockedEitherWay(r.Context(), currentUser.ID, conversation.OtherUserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check blocks", "conversation_id", conversationID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching conversation")
+		return
+	}
+
+	var errorMsg, content string
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		content = strings.TrimSpace(r.FormValue("content"))
+		if blocked {
+			errorMsg, status = blockedMessage, http.StatusForbidden
+		} else if errorMsg = validateMessage(currentUser, content); errorMsg != "" {
+			status = http.StatusBadRequest
+		} else {
+			message := &models.Message{SenderID: currentUser.ID, Content: content}
+			if err := h.DB.SendMessage(r.Context(), message, conversation.OtherUserID); err != nil {
+				slog.ErrorContext(r.Context(), "failed to send message", "conversation_id", conversationID, "err", err)
+				h.RenderError(w, r, http.StatusInternalServerError, "Error sending message")
+				return
+			}
+			http.Redirect(w, r, fmt.Sprintf("/messages/%d#message-%d", conversationID, message.ID), http.StatusSeeOther)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	messages, err := h.DB.GetMessages(r.Context(), conversationID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch messages", "conversation_id", conversationID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching conversation")
+		return
+	}
+	// Admins viewing as the member leave their messages unread
+	if currentUser.Impersonator == nil {
+		if err := h.DB.MarkConversationRead(r.Context(), conversationID, currentUser.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to mark conversation read", "conversation_id", conversationID, "err", err)
+		}
+	}
+
+	data := struct {
+		PageData
+		Conversation *models.Conversation `json:"conversation"`
+		Messages     []models.Message     `json:"messages"`
+		Blocked      bool                 `json:"blocked"` // Whether either participant blocked the other
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Conversation with " + conversation.OtherUsername,
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), messagesCrumb, Breadcrumb{Name: conversation.OtherUsername, URL: fmt.Sprintf("/messages/%d", conversationID)}),
+			Error:       errorMsg,
+			FormData:    map[string]string{"content": content},
+		},
+		Conversation: conversation,
+		Messages:     messages,
+		Blocked:      blocked,
+	}
+	h.RenderStatus(w, r, status, "message_thread", data)
+}
+
+// validateMessage checks that a message can be sent, returning a message for
+// the user if not
+func validateMessage(sender *models.User, content string) string {
+	switch {
+	case sender.IsSuspended():
+		return "Suspended accounts can't send messages"
+	case content == "":
+		return "Message can't be empty"
+	case len(content) > maxMessageLength:
+		return fmt.Sprintf("Messages must be less than %d characters", maxMessageLength)
+	}
+	return linksNotAllowed(sender, content)
+}
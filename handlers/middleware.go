@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"literary-lions/models"
+	"net/http"
+)
+
+// userKey is the context key for a request's userSlot
+type userKey struct{}
+
+// userSlot holds the user a request is authenticated as, once known
+type userSlot struct {
+	user *models.User
+}
+
+// TrackUser gives each request a slot for its user, which GetCurrentUser
+// fills in. Layers outside a route's own chain, such as panic recovery, can
+// then show the user without looking them up again.
+func (h *Handler) TrackUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, &userSlot{})))
+	})
+}
+
+// requestUser returns the user already known for r, or nil. Unlike
+// GetCurrentUser it never touches the database.
+func requestUser(r *http.Request) *models.User {
+	if slot, ok := r.Context().Value(userKey{}).(*userSlot); ok {
+		return slot.user
+	}
+	return nil
+}
+
+// rememberUser records user in r's slot, if it has one, reporting whether
+// it did
+func rememberUser(r *http.Request, user *models.User) bool {
+	slot, ok := r.Context().Value(userKey{}).(*userSlot)
+	if ok {
+		slot.user = user
+	}
+	return ok
+}
+
+// withUser returns r with user as its known user, for GetCurrentUser to
+// return further down the chain
+func withUser(r *http.Request, user *models.User) *http.Request {
+	if rememberUser(r, user) {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, &userSlot{user: user}))
+}
+
+// RequireUser lets only logged-in users through to next, redirecting
+// visitors to the login page. Handlers behind it can rely on GetCurrentUser
+// returning a user.
+func (h *Handler) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := h.GetCurrentUser(r)
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, withUser(r, user))
+	})
+}
+
+// RequireUserAPI is RequireUser for endpoints called from scripts, which
+// answer visitors with 401 Unauthorized instead of a redirect
+func (h *Handler) RequireUserAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := h.GetCurrentUser(r)
+		if user == nil {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, withUser(r, user))
+	})
+}
+
+// RequireAdmin lets only admins through to next. Visitors are redirected to
+// the login page and other members get 403 Forbidden.
+func (h *Handler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := h.GetCurrentUser(r)
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if !user.IsAdmin() {
+			h.RenderError(w, r, http.StatusForbidden, "This page is for admins only")
+			return
+		}
+		next.ServeHTTP(w, withUser(r, user))
+	})
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/clientip"
+	"literary-lions/database"
+	"literary-lions/models"
+	"literary-lions/spam"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// minDuplicateLength is the shortest text checked for having been posted
+// before, so short replies like "Thank you!" can be repeated
+const minDuplicateLength = 40
+
+// spamReason runs a new post or comment through the spam checks, returning
+// why it looks like spam, or "" if it doesn't. permalink is the page the
+// content will appear on, if known yet. Admins aren't checked, and content
+// that can't be checked is let through.
+func (h *Handler) spamReason(r *http.Request, user *models.User, kind, title, content, permalink string) string {
+	if h.Spam == nil || user.IsAdmin() {
+		return ""
+	}
+
+	c := &spam.Content{
+		Kind:        kind,
+		Title:       title,
+		Body:        content,
+		AuthorName:  user.Username,
+		AuthorEmail: user.Email,
+		AccountAge:  time.Since(user.CreatedAt),
+		Links:       spam.CountLinks(title + "\n" + content),
+		Site:        h.absoluteURL(r, "/"),
+		IP:          clientip.FromRequest(r),
+		UserAgent:   r.UserAgent(),
+		Referrer:    r.Referer(),
+	}
+	if permalink != "" {
+		c.Permalink = h.absoluteURL(r, permalink)
+	}
+	if window := h.Config.Spam.DuplicateWindow; window > 0 && len(content) >= minDuplicateLength {
+		count, err := h.DB.CountDuplicates(r.Context(), content, time.Now().Add(-window))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to check for duplicate content", "err", err)
+		}
+		c.Duplicate = count > 0
+	}
+
+	verdict, err := h.Spam.Check(r.Context(), c)
+	if err != nil {
+		slog.WarnContext(r.Context(), "spam check failed", "kind", kind, "err", err)
+	}
+	if !verdict.Spam {
+		return ""
+	}
+	return verdict.Reason
+}
+
+// heldMessage tells a member their post or comment is waiting for a
+// moderator
+func heldMessage(kind string) string {
+	return "Thanks! Your " + kind + " will appear once a moderator has approved it."
+}
+
+// holdContent adds a post or comment that looked like spam to the
+// moderation queue, reporting whether it was stored
+func (h *Handler) holdContent(r *http.Request, held *models.HeldContent) bool {
+	if err := h.DB.HoldContent(r.Context(), held); err != nil {
+		slog.ErrorContext(r.Context(), "failed to hold content for moderation", "kind", held.Kind, "err", err)
+		return false
+	}
+	slog.InfoContext(r.Context(), "content held for moderation", "kind", held.Kind, "held_id", held.ID, "reason", held.Reason)
+	return true
+}
+
+// AdminModerationHandler lists the posts and comments held for a moderator
+// and approves or rejects them
+func (h *Handler) AdminModerationHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	if r.Method == http.MethodPost {
+		h.handleModerationAction(w, r, currentUser)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue, err := h.DB.GetHeldContent(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch moderation queue", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching the moderation queue")
+		return
+	}
+
+	data := struct {
+		PageData
+		Queue []models.HeldContent `json:"queue"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Moderation Queue",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), adminCrumb, Breadcrumb{Name: "Moderation Queue", URL: "/admin/moderation"}),
+		},
+		Queue: queue,
+	}
+
+	h.Render(w, r, "admin_moderation", data)
+}
+
+// handleModerationAction approves a held post or comment, publishing it, or
+// rejects it, deleting it and emailing the author the reason given
+func (h *Handler) handleModerationAction(w http.ResponseWriter, r *http.Request, currentUser *models.User) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	action := r.FormValue("action")
+	if action != "approve" && action != "reject" {
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	reason, ok := formReason(r)
+	if !ok {
+		http.Error(w, "Reason too long", http.StatusBadRequest)
+		return
+	}
+
+	held, err := h.DB.GetHeldContentByID(r.Context(), id)
+	if err == sql.ErrNoRows {
+		h.addFlash(w, r, "error", "That post or comment was already moderated.")
+		http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch held content", "held_id", id, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching the moderation queue")
+		return
+	}
+
+	what := fmt.Sprintf("post %q", held.Title)
+	if held.Kind == "comment" {
+		what = fmt.Sprintf("comment on %q", held.PostTitle)
+	}
+
+	if action == "approve" {
+		if !h.publishHeldContent(w, r, held) {
+			return
+		}
+		if err := h.DB.DeleteHeldContent(r.Context(), held.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to remove approved content from the queue", "held_id", held.ID, "err", err)
+		}
+		h.audit(r, currentUser, "moderation.approve", held.UserID, what)
+		h.addFlash(w, r, "success", "Approved and published.")
+		http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.DB.DeleteHeldContent(r.Context(), held.ID); err != nil && err != sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "failed to reject held content", "held_id", held.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error rejecting content")
+		return
+	}
+	h.audit(r, currentUser, "moderation.reject", held.UserID, withReason(what, reason))
+	h.notifyModeration(r, held.UserID, "rejected your "+what, reason)
+	h.addFlash(w, r, "success", "Rejected and deleted.")
+	http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+}
+
+// publishHeldContent publishes an approved post or comment. On failure it
+// writes the response and returns false.
+func (h *Handler) publishHeldContent(w http.ResponseWriter, r *http.Request, held *models.HeldContent) bool {
+	if held.Kind == "post" {
+		post := &models.Post{
+			Title:      held.Title,
+			Content:    held.Content,
+			UserID:     held.UserID,
+			CategoryID: held.CategoryID,
+			BookID:     held.BookID,
+		}
+		if err := h.DB.CreatePost(r.Context(), post); err != nil {
+			slog.ErrorContext(r.Context(), "failed to publish held post", "held_id", held.ID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error publishing post")
+			return false
+		}
+		return true
+	}
+
+	comment := &models.Comment{
+		Content:  held.Content,
+		UserID:   held.UserID,
+		PostID:   held.PostID,
+		ParentID: held.ParentID,
+	}
+	if err := h.DB.CreateComment(r.Context(), comment); err != nil {
+		if err == database.ErrArchived || err == sql.ErrNoRows {
+			h.addFlash(w, r, "error", "The thread this comment was for is archived or gone, so it can only be rejected.")
+			http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+			return false
+		}
+		slog.ErrorContext(r.Context(), "failed to publish held comment", "held_id", held.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error publishing comment")
+		return false
+	}
+	h.PageCache.DeletePrefix(postPagePrefix(held.PostID))
+	if author, err := h.DB.GetUserByID(r.Context(), held.UserID); err == nil {
+		h.notifyReply(r, author, comment)
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"literary-lions/mailer"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// notifyTimeout bounds how long emailing everyone about one reply may take
+const notifyTimeout = time.Minute
+
+// notifyReply emails the members taking part in a thread about a new
+// comment: the post's author and earlier commenters who asked for reply
+// emails and haven't muted the thread. It runs in the background so the
+// commenter isn't kept waiting; errors are logged.
+func (h *Handler) notifyReply(r *http.Request, author *models.User, comment *models.Comment) {
+	link := h.absoluteURL(r, fmt.Sprintf("/post/%d#comment-%d", comment.PostID, comment.ID))
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), notifyTimeout)
+
+	go func() {
+		defer cancel()
+
+		recipients, err := h.DB.GetReplyRecipients(ctx, comment.PostID, author.ID)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to fetch reply recipients", "post_id", comment.PostID, "err", err)
+			return
+		}
+		if len(recipients) == 0 {
+			return
+		}
+		post, err := h.DB.GetPostByID(ctx, comment.PostID)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to fetch post for reply notification", "post_id", comment.PostID, "err", err)
+			return
+		}
+		name := author.Username
+		if post.Anonymous {
+			name = models.AnonymousName
+		}
+
+		for _, recipient := range recipients {
+			msg := mailer.Message{
+				To:      recipient.Email,
+				Subject: fmt.Sprintf("%s replied in \"%s\"", name, post.Title),
+				Body: fmt.Sprintf("Hi %s,\n\n%s commented on \"%s\":\n\n%s\n\nRead the thread: %s\n\nTo stop these emails for this thread, mute it on its page. To stop them for every thread, turn off reply emails in your settings.\n",
+					recipient.Username, name, post.Title, comment.Content, link),
+			}
+			if err := h.sendMail(ctx, msg); err != nil {
+				slog.ErrorContext(ctx, "failed to send reply notification", "post_id", comment.PostID, "target_user_id", recipient.ID, "err", err)
+			}
+		}
+	}()
+}
+
+// notifyModeration emails a member that a moderator acted on their account
+// or content, as what says, such as `removed your post "Dune"`, with the
+// reason the moderator gave, if any. It runs in the background like
+// notifyReply; errors are logged.
+func (h *Handler) notifyModeration(r *http.Request, userID int, what, reason string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), notifyTimeout)
+
+	go func() {
+		defer cancel()
+
+		recipient, err := h.DB.GetUserByID(ctx, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to fetch member for moderation notification", "target_user_id", userID, "err", err)
+			return
+		}
+		body := fmt.Sprintf("Hi %s,\n\nA moderator %s.\n", recipient.Username, what)
+		if reason != "" {
+			body += fmt.Sprintf("\nReason: %s\n", reason)
+		}
+		body += "\nPlease keep to the community guidelines. If you think this was a mistake, reply to this email.\n"
+		msg := mailer.Message{
+			To:      recipient.Email,
+			Subject: "A moderator " + what,
+			Body:    body,
+		}
+		if err := h.sendMail(ctx, msg); err != nil {
+			slog.ErrorContext(ctx, "failed to send moderation notification", "target_user_id", userID, "err", err)
+		}
+	}()
+}
+
+// MuteThreadHandler mutes or unmutes a thread for the current user, so they
+// get no notifications about it even if they wrote the post or commented
+func (h *Handler) MuteThreadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.DB.GetPostByID(r.Context(), postID); err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch post", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating thread")
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "mute":
+		err = h.DB.MuteThread(r.Context(), currentUser.ID, postID)
+	case "unmute":
+		err = h.DB.UnmuteThread(r.Context(), currentUser.ID, postID)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update thread mute", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating thread")
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusSeeOther)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// onlineWindow is how recently members must have been active to count
+	// as online
+	onlineWindow = 5 * time.Minute
+
+	// lastSeenInterval is how often a member's last seen time is written.
+	// It also bounds how stale the members online count may be.
+	lastSeenInterval = time.Minute
+)
+
+// presence throttles writes of members' last seen times, which would
+// otherwise happen on every request, and caches the members online count
+type presence struct {
+	mu        sync.Mutex
+	touched   map[int]time.Time // When each member's last seen time was last written
+	online    int
+	countedAt time.Time
+}
+
+// touchLastSeen records that the user is active, at most once per
+// lastSeenInterval. Errors are logged.
+func (h *Handler) touchLastSeen(r *http.Request, user *models.User) {
+	now := time.Now()
+	h.presence.mu.Lock()
+	if now.Sub(h.presence.touched[user.ID]) < lastSeenInterval {
+		h.presence.mu.Unlock()
+		return
+	}
+	if h.presence.touched == nil {
+		h.presence.touched = make(map[int]time.Time)
+	}
+	h.presence.touched[user.ID] = now
+	h.presence.mu.Unlock()
+
+	if err := h.DB.TouchLastSeen(r.Context(), user.ID, now); err != nil {
+		slog.ErrorContext(r.Context(), "failed to record last seen", "err", err)
+	}
+}
+
+// membersOnline counts the members online for the footer, refreshing the
+// count at most once per lastSeenInterval. It is 0 when the count is turned
+// off, and errors are logged and show no count.
+func (h *Handler) membersOnline(r *http.Request) int {
+	if !h.Features.Enabled(r.Context(), "members_online") {
+		return 0
+	}
+
+	h.presence.mu.Lock()
+	defer h.presence.mu.Unlock()
+	now := time.Now()
+	if now.Sub(h.presence.countedAt) < lastSeenInterval {
+		return h.presence.online
+	}
+
+	count, err := h.DB.CountOnlineUsers(r.Context(), now.Add(-onlineWindow))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to count members online", "err", err)
+		return 0
+	}
+	h.presence.online = count
+	h.presence.countedAt = now
+
+	// Forget members whose last seen time is due to be written again anyway
+	for userID, touched := range h.presence.touched {
+		if now.Sub(touched) >= lastSeenInterval {
+			delete(h.presence.touched, userID)
+		}
+	}
+	return count
+}
+
+// isOnline reports whether a member last seen at lastSeen is online now
+func isOnline(lastSeen *time.Time) bool {
+	return lastSeen != nil && time.Since(*lastSeen) < onlineWindow
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"literary-lions/models"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Limits on the optional profile fields
+const (
+	maxBioLength          = 1000
+	maxLocationLength     = 100
+	maxWebsiteLength      = 200
+	maxFavoriteBookLength = 200
+	maxFavoriteGenres     = 5
+	maxGenreLength        = 30
+)
+
+// readProfileFields copies the optional profile fields from the edit profile
+// form into user. Errors describe the invalid field and can be shown to users.
+// Members too new to post links can keep the bio and website they have, but
+// not add links to them.
+func readProfileFields(r *http.Request, user *models.User) error {
+	bio := user.Bio
+	user.Bio = strings.TrimSpace(r.FormValue("bio"))
+	if len(user.Bio) > maxBioLength {
+		return fmt.Errorf("Bio must be less than %d characters", maxBioLength)
+	}
+	if user.Bio != bio {
+		if msg := linksNotAllowed(user, user.Bio); msg != "" {
+			return errors.New(msg)
+		}
+	}
+
+	user.Location = strings.TrimSpace(r.FormValue("location"))
+	if len(user.Location) > maxLocationLength {
+		return fmt.Errorf("Location must be less than %d characters", maxLocationLength)
+	}
+
+	website, err := normalizeWebsite(r.FormValue("website"))
+	if err != nil {
+		return err
+	}
+	if website != user.Website {
+		if msg := linksNotAllowed(user, website); msg != "" {
+			return errors.New(msg)
+		}
+	}
+	user.Website = website
+
+	genres, err := normalizeGenres(r.FormValue("favorite_genres"))
+	if err != nil {
+		return err
+	}
+	user.FavoriteGenres = genres
+
+	user.FavoriteBook = strings.TrimSpace(r.FormValue("favorite_book"))
+	if len(user.FavoriteBook) > maxFavoriteBookLength {
+		return fmt.Errorf("Favorite book must be less than %d characters", maxFavoriteBookLength)
+	}
+	return nil
+}
+
+// normalizeWebsite checks that a website is an http or https URL, adding
+// https:// when no scheme was typed
+func normalizeWebsite(raw string) (string, error) {
+	website := strings.TrimSpace(raw)
+	if website == "" {
+		return "", nil
+	}
+	if !strings.Contains(website, "://") {
+		website = "https://" + website
+	}
+	if len(website) > maxWebsiteLength {
+		return "", fmt.Errorf("Website must be less than %d characters", maxWebsiteLength)
+	}
+
+	u, err := url.Parse(website)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "", errors.New("Website must be a valid http or https address")
+	}
+	return u.String(), nil
+}
+
+// normalizeGenres cleans up a comma-separated list of genres, dropping blanks
+// and duplicates
+func normalizeGenres(raw string) (string, error) {
+	var genres []string
+	seen := make(map[string]bool)
+	for _, genre := range strings.Split(raw, ",") {
+		genre = strings.Join(strings.Fields(genre), " ")
+		key := strings.ToLower(genre)
+		if genre == "" || seen[key] {
+			continue
+		}
+		if len(genre) > maxGenreLength {
+			return "", fmt.Errorf("Genres must be less than %d characters each", maxGenreLength)
+		}
+		seen[key] = true
+		genres = append(genres, genre)
+	}
+	if len(genres) > maxFavoriteGenres {
+		return "", fmt.Errorf("List at most %d favorite genres", maxFavoriteGenres)
+	}
+	return strings.Join(genres, ", "), nil
+}
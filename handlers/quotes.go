@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/database"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Limits on shared quotes
+const (
+	maxQuoteLength     = 1000
+	maxQuotePageLength = 20
+)
+
+// QuotesHandler serves the quotes section:
+//
+//	/quotes         browsing and searching quotes (?q=), and sharing one (POST)
+//	/quotes/like    liking a quote or taking the like back
+//	/quotes/delete  deleting a quote, by its author or an admin
+func (h *Handler) QuotesHandler(w http.ResponseWriter, r *http.Request) {
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/quotes"), "/") {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			h.renderQuotes(w, r, http.StatusOK, "", nil)
+		case http.MethodPost:
+			h.createQuote(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "like":
+		h.likeQuote(w, r)
+	case "delete":
+		h.deleteQuote(w, r)
+	default:
+		h.NotFoundHandler(w, r)
+	}
+}
+
+// renderQuotes renders one page of quotes with the form to share one,
+// showing message and keeping formData when sharing failed
+func (h *Handler) renderQuotes(w http.ResponseWriter, r *http.Request, status int, message string, formData map[string]string) {
+	currentUser := h.GetCurrentUser(r)
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	q := database.QuotePageQuery{
+		Search:        search,
+		ShowSuspended: currentUser != nil && currentUser.IsAdmin(),
+		Cursor:        r.URL.Query().Get("cursor"),
+	}
+	if currentUser != nil {
+		q.ViewerID = currentUser.ID
+	}
+	quotes, nextCursor, err := h.DB.GetQuotesPage(r.Context(), q)
+	if err == database.ErrInvalidCursor {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch quotes", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching quotes")
+		return
+	}
+
+	data := struct {
+		PageData
+		Quotes     []models.Quote `json:"quotes"`
+		Search     string         `json:"search,omitempty"`
+		NextCursor string         `json:"next_cursor,omitempty"`
+		OlderPage  bool           `json:"-"` // Whether this is not the first page
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Quotes",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Quotes", URL: "/quotes"}),
+			Error:       message,
+			FormData:    formData,
+		},
+		Quotes:     quotes,
+		Search:     search,
+		NextCursor: nextCursor,
+		OlderPage:  q.Cursor != "",
+	}
+
+	h.RenderStatus(w, r, status, "quotes", data)
+}
+
+// createQuote shares a quote from the form on the quotes page
+func (h *Handler) createQuote(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	content := strings.TrimSpace(r.FormValue("content"))
+	book := &models.Book{
+		Title:  strings.TrimSpace(r.FormValue("book")),
+		Author: strings.TrimSpace(r.FormValue("author")),
+	}
+	page := strings.TrimSpace(r.FormValue("page"))
+	formData := map[string]string{"content": content, "book": book.Title, "author": book.Author, "page": page}
+
+	var message string
+	switch {
+	case content == "":
+		message = "Quote can't be empty"
+	case len(content) > maxQuoteLength:
+		message = fmt.Sprintf("Quotes must be less than %d characters", maxQuoteLength)
+	case book.Title == "":
+		message = "Enter the book the quote is from"
+	case len(book.Title) > maxBookTitleLength || len(book.Author) > maxBookAuthorLength:
+		message = "Book title or author is too long"
+	case len(page) > maxQuotePageLength:
+		message = fmt.Sprintf("Page must be less than %d characters", maxQuotePageLength)
+	default:
+		message = linksNotAllowed(currentUser, strings.Join([]string{content, book.Title, book.Author, page}, "\n"))
+	}
+	if message != "" {
+		h.renderQuotes(w, r, http.StatusBadRequest, message, formData)
+		return
+	}
+
+	quote := &models.Quote{UserID: currentUser.ID, Content: content, Page: page}
+	err := h.DB.FindOrCreateBook(r.Context(), book)
+	if err == nil {
+		quote.BookID = book.ID
+		err = h.DB.CreateQuote(r.Context(), quote)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create quote", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error sharing quote")
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/quotes#quote-%d", quote.ID), http.StatusSeeOther)
+}
+
+// quoteFromForm loads the quote named by the quote_id form value, writing
+// an error response and returning nil if there is none
+func (h *Handler) quoteFromForm(w http.ResponseWriter, r *http.Request, viewerID int) *models.Quote {
+	quoteID, err := strconv.Atoi(r.FormValue("quote_id"))
+	if err != nil {
+		http.Error(w, "Invalid quote ID", http.StatusBadRequest)
+		return nil
+	}
+
+	quote, err := h.DB.GetQuoteByID(r.Context(), quoteID, viewerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Quote not found", http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch quote", "quote_id", quoteID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching quote")
+		return nil
+	}
+	return quote
+}
+
+// likeQuote likes a quote, or takes the like back
+func (h *Handler) likeQuote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	quote := h.quoteFromForm(w, r, currentUser.ID)
+	if quote == nil {
+		return
+	}
+	if err := h.DB.ToggleQuoteLike(r.Context(), currentUser.ID, quote.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to like quote", "quote_id", quote.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error processing like")
+		return
+	}
+
+	// Redirect back to the referring page
+	referer := r.Header.Get("Referer")
+	if referer != "" {
+		http.Redirect(w, r, referer, http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/quotes#quote-%d", quote.ID), http.StatusSeeOther)
+	}
+}
+
+// deleteQuote deletes a quote. Only its author and admins may.
+func (h *Handler) deleteQuote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	quote := h.quoteFromForm(w, r, currentUser.ID)
+	if quote == nil {
+		return
+	}
+	if quote.UserID != currentUser.ID && !currentUser.IsAdmin() {
+		h.RenderError(w, r, http.StatusForbidden, "You can only delete your own quotes")
+		return
+	}
+	if err := h.DB.DeleteQuote(r.Context(), quote.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete quote", "quote_id", quote.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error deleting quote")
+		return
+	}
+
+	http.Redirect(w, r, "/quotes", http.StatusSeeOther)
+}
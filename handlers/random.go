@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// RandomPostHandler sends visitors to a random post at /random, or to one
+// in a category and its subcategories at /random?category={id}. Only open
+// threads by active members are picked. If there are none, it goes back to
+// the listing the visitor came from.
+func (h *Handler) RandomPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	categoryID := 0
+	listing := "/"
+	if c := r.URL.Query().Get("category"); c != "" {
+		id, err := strconv.Atoi(c)
+		if err != nil || id < 1 {
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+			return
+		}
+		categoryID = id
+		listing = fmt.Sprintf("/?category=%d", id)
+	}
+
+	postID, err := h.DB.GetRandomPostID(r.Context(), categoryID)
+	if err == sql.ErrNoRows {
+		h.addFlash(w, r, "error", "There are no posts to pick from yet.")
+		http.Redirect(w, r, listing, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to pick a random post", "category_id", categoryID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error picking a post")
+		return
+	}
+
+	// Every visit should land somewhere new
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", postID), http.StatusFound)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"literary-lions/clientip"
+	"literary-lions/models"
+	"net/http"
+	"strconv"
+)
+
+// RateLimitKey identifies who a request counts against for rate limiting:
+// the logged-in user, so people sharing an address do not share a budget,
+// or the client's address otherwise
+func (h *Handler) RateLimitKey(r *http.Request) string {
+	if user := h.GetCurrentUser(r); user != nil {
+		return "user:" + strconv.Itoa(user.ID)
+	}
+	return "ip:" + clientip.FromRequest(r)
+}
+
+// WriteRateLimitKey is RateLimitKey for form submissions only. Viewing a form
+// is not limited, so a user who runs out can still read the page.
+func (h *Handler) WriteRateLimitKey(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return ""
+	}
+	return h.RateLimitKey(r)
+}
+
+// TrustWriteRateLimitKey is WriteRateLimitKey limited to requests from
+// regulars when regular is set, or from everyone else when it isn't, so
+// regulars can be given a limit of their own. Admins count as regulars.
+func (h *Handler) TrustWriteRateLimitKey(regular bool) func(*http.Request) string {
+	return func(r *http.Request) string {
+		user := h.GetCurrentUser(r)
+		if (user != nil && user.Trusted(models.TrustRegular)) != regular {
+			return ""
+		}
+		return h.WriteRateLimitKey(r)
+	}
+}
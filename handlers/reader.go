@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// readerComments is how many of a thread's best-liked comments the reader
+// view shows
+const readerComments = 10
+
+// readerView shows the post with the given ID at /post/{id}/reader in a
+// plain page without the forum's navigation, for printing or reading long
+// reviews without distraction, followed by its best-liked comments
+func (h *Handler) readerView(w http.ResponseWriter, r *http.Request, postIDStr string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.Atoi(postIDStr)
+	if err != nil {
+		h.NotFoundHandler(w, r)
+		return
+	}
+
+	post, err := h.DB.GetPostByID(r.Context(), postID)
+	if err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch post", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	if h.postHidden(r, currentUser, post) {
+		h.NotFoundHandler(w, r)
+		return
+	}
+	comments, err := h.threadComments(r, currentUser, post)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch comments", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching comments")
+		return
+	}
+	sortComments(comments, "top")
+	var top []models.Comment
+	for _, comment := range comments {
+		if len(top) == readerComments {
+			break
+		}
+		if !comment.Collapsed {
+			top = append(top, comment)
+		}
+	}
+
+	data := struct {
+		PageData
+		TotalComments int `json:"total_comments"`
+	}{
+		PageData: PageData{
+			Post:        post,
+			Comments:    top,
+			CurrentUser: currentUser,
+			Title:       post.Title,
+			Flashes:     []models.Flash{}, // the reader view has no room for them, so they wait for the next page
+		},
+		TotalComments: len(comments),
+	}
+
+	h.Render(w, r, "reader", data)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"literary-lions/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReaderViewShowsTopComments(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	alice := createTestUser(t, db, "alice")
+	post := &models.Post{Title: "A thread", Content: "Opening words", UserID: alice.ID, CategoryID: 1}
+	if err := db.CreatePost(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateComment(ctx, &models.Comment{Content: "A fine reply", UserID: alice.ID, PostID: post.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, locale := range []string{"en", "es"} {
+		r := httptest.NewRequest(http.MethodGet, "/post/"+strconv.Itoa(post.ID)+"/reader", nil)
+		r.Header.Set("Accept-Language", locale)
+		w := httptest.NewRecorder()
+		h.ViewPostHandler(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("reader view in %s answered %d, want %d", locale, w.Code, http.StatusOK)
+		}
+		if !strings.Contains(w.Body.String(), "A fine reply") {
+			t.Errorf("reader view in %s is missing the comment", locale)
+		}
+	}
+}
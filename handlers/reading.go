@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// readingBooks gets the books the given users are currently reading, for
+// the badges next to their names. Errors are logged and show no badges.
+func (h *Handler) readingBooks(r *http.Request, userIDs []int) map[int]models.Book {
+	books, err := h.DB.GetCurrentlyReading(r.Context(), userIDs)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch currently reading books", "err", err)
+		return nil
+	}
+	return books
+}
+
+// CurrentlyReadingHandler sets or clears the book the current user is
+// reading. The book is also moved to their "Currently Reading" shelf.
+func (h *Handler) CurrentlyReadingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	if r.FormValue("action") == "clear" {
+		if err := h.DB.SetCurrentlyReading(r.Context(), currentUser.ID, 0); err != nil {
+			slog.ErrorContext(r.Context(), "failed to clear currently reading", "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error updating currently reading")
+			return
+		}
+		h.invalidatePostPages()
+		http.Redirect(w, r, "/edit-profile", http.StatusSeeOther)
+		return
+	}
+
+	query := strings.TrimSpace(r.FormValue("book"))
+	author := strings.TrimSpace(r.FormValue("author"))
+	if query == "" {
+		h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, "Enter the title or ISBN of the book you're reading")
+		return
+	}
+	if len(query) > maxBookTitleLength || len(author) > maxBookAuthorLength {
+		h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, "Book title or author is too long")
+		return
+	}
+
+	book, msg := h.findBook(r, query, author)
+	if msg != "" {
+		h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, msg)
+		return
+	}
+
+	err := h.DB.FindOrCreateBook(r.Context(), book)
+	if err == nil {
+		err = h.DB.SetCurrentlyReading(r.Context(), currentUser.ID, book.ID)
+	}
+	if err == nil {
+		err = h.DB.MoveShelfEntry(r.Context(), currentUser.ID, book.ID, "currently-reading")
+		if err == sql.ErrNoRows {
+			err = h.DB.SaveShelfEntry(r.Context(), &models.ShelfEntry{UserID: currentUser.ID, BookID: book.ID, Shelf: "currently-reading"})
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to set currently reading", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating currently reading")
+		return
+	}
+
+	// Cached post pages show the badge next to the member's name
+	h.invalidatePostPages()
+	http.Redirect(w, r, "/edit-profile", http.StatusSeeOther)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxModerationReasonLength limits the reasons moderators give
+const maxModerationReasonLength = 200
+
+// moderationReasons gets the canned reasons offered to admins on pages where
+// they remove content or suspend members, or nil for everyone else. Errors
+// are logged and offer none.
+func (h *Handler) moderationReasons(r *http.Request, viewer *models.User) []models.ModerationReason {
+	if viewer == nil || !viewer.IsAdmin() {
+		return nil
+	}
+	reasons, err := h.DB.GetModerationReasons(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch moderation reasons", "err", err)
+		return nil
+	}
+	return reasons
+}
+
+// formReason gets the reason a moderator picked for an action from the
+// request's reason field, which may be empty, reporting whether it is short
+// enough to keep
+func formReason(r *http.Request) (string, bool) {
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	return reason, len(reason) <= maxModerationReasonLength
+}
+
+// withReason adds the reason a moderator gave to audit log details
+func withReason(details, reason string) string {
+	if reason == "" {
+		return details
+	}
+	return details + " (reason: " + reason + ")"
+}
+
+// AdminReasonsHandler lists the canned reasons admins pick from when
+// removing content or suspending members, and adds or deletes them
+func (h *Handler) AdminReasonsHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	if r.Method == http.MethodPost {
+		h.updateReasons(w, r)
+		return
+	}
+
+	reasons, err := h.DB.GetModerationReasons(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch moderation reasons", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching moderation reasons")
+		return
+	}
+
+	data := struct {
+		PageData
+		Reasons   []models.ModerationReason `json:"reasons"`
+		MaxLength int                       `json:"-"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Moderation Reasons",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), adminCrumb, Breadcrumb{Name: "Moderation Reasons", URL: "/admin/reasons"}),
+		},
+		Reasons:   reasons,
+		MaxLength: maxModerationReasonLength,
+	}
+
+	h.Render(w, r, "admin_reasons", data)
+}
+
+// updateReasons adds or deletes a canned moderation reason, as the admin
+// reasons form asks
+func (h *Handler) updateReasons(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var logMsg string
+	var logArgs []any
+	switch r.FormValue("action") {
+	case "add":
+		reason := &models.ModerationReason{Text: strings.TrimSpace(r.FormValue("text"))}
+		if reason.Text == "" || len(reason.Text) > maxModerationReasonLength {
+			h.addFlash(w, r, "error", fmt.Sprintf("Reasons must be 1 to %d characters.", maxModerationReasonLength))
+			http.Redirect(w, r, "/admin/reasons", http.StatusSeeOther)
+			return
+		}
+		err = h.DB.CreateModerationReason(r.Context(), reason)
+		logMsg, logArgs = "moderation reason added", []any{"reason", reason.Text}
+	case "delete":
+		reasonID, convErr := strconv.Atoi(r.FormValue("reason_id"))
+		if convErr != nil {
+			http.Error(w, "Invalid reason ID", http.StatusBadRequest)
+			return
+		}
+		err = h.DB.DeleteModerationReason(r.Context(), reasonID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Reason not found", http.StatusNotFound)
+			return
+		}
+		logMsg, logArgs = "moderation reason deleted", []any{"reason_id", reasonID}
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update moderation reasons", "err", err)
+		h.addFlash(w, r, "error", "Failed to update moderation reasons. Please try again.")
+		http.Redirect(w, r, "/admin/reasons", http.StatusSeeOther)
+		return
+	}
+	slog.InfoContext(r.Context(), logMsg, logArgs...)
+
+	h.addFlash(w, r, "success", "Moderation reasons updated.")
+	http.Redirect(w, r, "/admin/reasons", http.StatusSeeOther)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"reflect"
+)
+
+// Render writes the named page template, such as "index" for
+// templates/index.html, with data as a 200 OK HTML response
+func (h *Handler) Render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	h.RenderStatus(w, r, http.StatusOK, name, data)
+}
+
+// RenderStatus is Render with another status code, such as 400 for a form
+// shown again with its errors. The page is rendered in full before anything
+// is written, so a template error is answered with a plain 500 instead of
+// half a page. If data is or embeds a PageData, the parts of it every page
+// shows, such as the current user, are filled in where they are unset.
+func (h *Handler) RenderStatus(w http.ResponseWriter, r *http.Request, status int, name string, data any) {
+	page, ok := h.renderPage(w, r, name, data)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(page)
+}
+
+// renderPage renders the named page template for RenderStatus, for callers
+// that keep the page as well as sending it. On failure it logs the error,
+// answers with 500 and returns ok false.
+func (h *Handler) renderPage(w http.ResponseWriter, r *http.Request, name string, data any) (page []byte, ok bool) {
+	file := name + ".html"
+	tmpl, err := h.LoadPageTemplate("templates/" + file)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load template", "template", file, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error loading template")
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "base", h.withPageData(w, r, data)); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render template", "template", file, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error rendering template")
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// pageDataType is the type Render fills in the shared parts of
+var pageDataType = reflect.TypeOf(PageData{})
+
+// withPageData returns data with the parts the site layout shows filled in
+// by fillPageData, if data is a PageData or a struct embedding one (or a
+// pointer to either). Other data is returned as it is. Data passed by value
+// is copied; data passed by pointer is set in place.
+func (h *Handler) withPageData(w http.ResponseWriter, r *http.Request, data any) any {
+	v := reflect.ValueOf(data)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return data
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return data
+	}
+
+	index := []int(nil)
+	if v.Type() != pageDataType {
+		field, ok := v.Type().FieldByName("PageData")
+		if !ok || !field.Anonymous || field.Type != pageDataType {
+			return data
+		}
+		index = field.Index
+	}
+
+	if !v.CanSet() {
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		v = copied
+		data = v.Addr().Interface()
+	}
+	page := v
+	if index != nil {
+		page = v.FieldByIndex(index)
+	}
+	h.fillPageData(w, r, page.Addr().Interface().(*PageData))
+	return data
+}
+
+// fillPageData sets what every page shows around its content, where the
+// handler left it unset: the viewer's details from fillViewerData, the
+// header's counts of unread messages and wall posts, the members online and
+// the flash messages waiting for the viewer, which are used up.
+func (h *Handler) fillPageData(w http.ResponseWriter, r *http.Request, page *PageData) {
+	h.fillViewerData(r, page)
+	if page.UnreadMessages == 0 {
+		page.UnreadMessages = h.unreadMessages(r, page.CurrentUser)
+	}
+	if page.NewWallPosts == 0 {
+		page.NewWallPosts = h.newWallPosts(r, page.CurrentUser)
+	}
+	if page.MembersOnline == 0 {
+		page.MembersOnline = h.membersOnline(r)
+	}
+	if page.Flashes == nil {
+		page.Flashes = h.flashes(w, r)
+	}
+}
+
+// fillViewerData sets what depends on who is looking, where the handler left
+// it unset: the request's user, the feature flags, the locale and theme, and
+// the moderation reasons offered to admins. Fragments of pages need these too.
+func (h *Handler) fillViewerData(r *http.Request, page *PageData) {
+	if page.CurrentUser == nil {
+		page.CurrentUser = h.GetCurrentUser(r)
+	}
+	if page.Features == nil {
+		page.Features = h.Features.All(r.Context())
+	}
+	if page.Locale == "" {
+		page.Locale = h.locale(r, page.CurrentUser)
+	}
+	if page.Theme == "" {
+		page.Theme = h.theme(r, page.CurrentUser)
+	}
+	if page.ModerationReasons == nil {
+		page.ModerationReasons = h.moderationReasons(r, page.CurrentUser)
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"literary-lions/models"
+	"log/slog"
+	"time"
+)
+
+// PurgeRetained runs the retention purge as of now, recording what was
+// purged, or what would have been in a dry run, in the server and audit
+// logs
+func (h *Handler) PurgeRetained(ctx context.Context, now time.Time) {
+	cfg := h.Config.Retention
+	report, err := h.DB.PurgeRetained(ctx, cfg, now)
+	if err != nil {
+		slog.ErrorContext(ctx, "retention purge failed", "err", err)
+		return
+	}
+	if report.Total() == 0 {
+		return
+	}
+
+	action := "retention.purge"
+	if cfg.DryRun {
+		action = "retention.dry_run"
+	} else {
+		h.invalidatePostPages()
+	}
+	slog.InfoContext(ctx, "audit", "action", action, "details", report.String())
+	if err := h.DB.AddAuditEntry(ctx, &models.AuditEntry{Action: action, Details: report.String()}); err != nil {
+		slog.ErrorContext(ctx, "failed to record audit entry", "action", action, "err", err)
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"literary-lions/i18n"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// settingOption is a value a setting can take, with its label. The labels
+// of options translated on the settings page are message keys.
+type settingOption struct {
+	Value string
+	Label string
+}
+
+// The choices offered on the settings page
+var (
+	postsPerPageOptions = []int{10, 20, 50, 100}
+	postSortOptions     = []settingOption{
+		{"date", "settings.post_sort.date"},
+		{"likes", "settings.post_sort.likes"},
+		{"comments", "settings.post_sort.comments"},
+		{"title", "settings.post_sort.title"},
+	}
+	sortOrderOptions = []settingOption{
+		{"desc", "settings.order.desc"},
+		{"asc", "settings.order.asc"},
+	}
+	commentSortOptions = []settingOption{
+		{"oldest", "settings.comment_sort.oldest"},
+		{"newest", "settings.comment_sort.newest"},
+		{"top", "settings.comment_sort.top"},
+	}
+	commentViewOptions = []settingOption{
+		{"tree", "settings.comment_view.tree"},
+		{"flat", "settings.comment_view.flat"},
+	}
+)
+
+// validOption reports whether value is one of the options
+func validOption(options []settingOption, value string) bool {
+	for _, option := range options {
+		if option.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validPostsPerPage reports whether n is one of the offered page sizes
+func validPostsPerPage(n int) bool {
+	for _, option := range postsPerPageOptions {
+		if n == option {
+			return true
+		}
+	}
+	return false
+}
+
+// preferences gets the viewer's settings. Visitors and errors, which are
+// logged, get the defaults.
+func (h *Handler) preferences(r *http.Request, viewer *models.User) *models.Preferences {
+	if viewer == nil {
+		return models.DefaultPreferences(0)
+	}
+	prefs, err := h.DB.GetPreferences(r.Context(), viewer.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch preferences", "err", err)
+		return models.DefaultPreferences(viewer.ID)
+	}
+	return prefs
+}
+
+// sortComments orders a post's comments, and so the replies under each
+// comment, by the viewer's comment sort. Comments come oldest first.
+func sortComments(comments []models.Comment, order string) {
+	switch order {
+	case "newest":
+		sort.SliceStable(comments, func(i, j int) bool {
+			return comments[i].CreatedAt.After(comments[j].CreatedAt)
+		})
+	case "top":
+		sort.SliceStable(comments, func(i, j int) bool {
+			return comments[i].LikesCount > comments[j].LikesCount
+		})
+	}
+}
+
+// SettingsHandler shows and saves the current user's settings: how the home
+// page lists posts, how comments are ordered and shown, the language, color
+// theme and time zone the forum is shown in, which emails they get and
+// whether others see when they're online
+func (h *Handler) SettingsHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		h.renderSettings(w, r, h.preferences(r, currentUser), http.StatusOK, "")
+	case http.MethodPost:
+		prefs := &models.Preferences{
+			UserID:        currentUser.ID,
+			PostSort:      r.FormValue("post_sort"),
+			PostSortOrder: r.FormValue("post_sort_order"),
+			CommentSort:   r.FormValue("comment_sort"),
+			CommentView:   r.FormValue("comment_view"),
+			EmailReplies:  r.FormValue("email_replies") == "on",
+			EmailMessages: r.FormValue("email_messages") == "on",
+			HideOnline:    r.FormValue("show_online") != "on",
+			WallClosed:    r.FormValue("open_wall") != "on",
+			YearPublic:    r.FormValue("year_public") == "on",
+			Timezone:      r.FormValue("timezone"),
+			Language:      r.FormValue("language"),
+			Theme:         r.FormValue("theme"),
+		}
+		prefs.PostsPerPage, _ = strconv.Atoi(r.FormValue("posts_per_page"))
+
+		var message string
+		switch {
+		case !validPostsPerPage(prefs.PostsPerPage):
+			message = "settings.error.posts_per_page"
+		case !validOption(postSortOptions, prefs.PostSort), !validOption(sortOrderOptions, prefs.PostSortOrder):
+			message = "settings.error.post_sort"
+		case !validOption(commentSortOptions, prefs.CommentSort):
+			message = "settings.error.comment_sort"
+		case !validOption(commentViewOptions, prefs.CommentView):
+			message = "settings.error.comment_view"
+		case prefs.Language != "" && !i18n.Supported(prefs.Language):
+			message = "settings.error.language"
+		case !validOption(themeOptions, prefs.Theme):
+			message = "settings.error.theme"
+		case !validOption(timezoneOptions, prefs.Timezone):
+			message = "settings.error.timezone"
+		}
+		if message != "" {
+			h.renderSettings(w, r, prefs, http.StatusBadRequest, i18n.T(h.locale(r, currentUser), message))
+			return
+		}
+
+		if err := h.DB.SavePreferences(r.Context(), prefs); err != nil {
+			slog.ErrorContext(r.Context(), "failed to save preferences", "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error saving settings")
+			return
+		}
+
+		// Confirm in the language just chosen
+		currentUser.Language = prefs.Language
+		h.addFlash(w, r, "success", i18n.T(h.locale(r, currentUser), "settings.saved"))
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderSettings renders the settings page with prefs filled in
+func (h *Handler) renderSettings(w http.ResponseWriter, r *http.Request, prefs *models.Preferences, status int, errMessage string) {
+	currentUser := h.GetCurrentUser(r)
+	data := struct {
+		PageData
+		Preferences         *models.Preferences `json:"preferences"`
+		PostsPerPageOptions []int               `json:"-"`
+		PostSortOptions     []settingOption     `json:"-"`
+		SortOrderOptions    []settingOption     `json:"-"`
+		CommentSortOptions  []settingOption     `json:"-"`
+		CommentViewOptions  []settingOption     `json:"-"`
+		TimezoneOptions     []settingOption     `json:"-"`
+		Languages           []i18n.Locale       `json:"-"`
+		ThemeOptions        []settingOption     `json:"-"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       i18n.T(h.locale(r, currentUser), "settings.title"),
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), profileCrumb(currentUser.Username), Breadcrumb{Name: i18n.T(h.locale(r, currentUser), "settings.title"), URL: "/settings"}),
+			Error:       errMessage,
+		},
+		Preferences:         prefs,
+		PostsPerPageOptions: postsPerPageOptions,
+		PostSortOptions:     postSortOptions,
+		SortOrderOptions:    sortOrderOptions,
+		CommentSortOptions:  commentSortOptions,
+		CommentViewOptions:  commentViewOptions,
+		TimezoneOptions:     timezoneOptions,
+		Languages:           i18n.Locales(),
+		ThemeOptions:        themeOptions,
+	}
+
+	h.RenderStatus(w, r, status, "settings", data)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"literary-lions/config"
+	"literary-lions/i18n"
+	"literary-lions/markup"
+	"literary-lions/models"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// baseTemplate is the layout every page template is rendered into
+const baseTemplate = "base.html"
+
+// TemplateSet holds one parsed template per page, each combining the base
+// layout with that page's template. Pages are parsed once at startup; in
+// reload mode they are re-read from fsys on every lookup instead, so template
+// edits on disk show up without restarting the server.
+type TemplateSet struct {
+	fsys     fs.FS
+	reload   bool
+	assetURL func(name string) string
+	imageURL func(src string, width int) string
+	limits   config.Content
+	pages    map[string]*template.Template
+}
+
+// LoadTemplates parses every page template in fsys together with base.html.
+// assetURL maps a static file name to the URL templates link it by, imageURL
+// maps an image's address and width to the URL pages load it from, and
+// limits are the content length limits forms show and check as members type.
+func LoadTemplates(fsys fs.FS, reload bool, assetURL func(name string) string, imageURL func(src string, width int) string, limits config.Content) (*TemplateSet, error) {
+	files, err := fs.Glob(fsys, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates found")
+	}
+
+	ts := &TemplateSet{
+		fsys:     fsys,
+		reload:   reload,
+		assetURL: assetURL,
+		imageURL: imageURL,
+		limits:   limits,
+		pages:    make(map[string]*template.Template),
+	}
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		if name == baseTemplate {
+			continue
+		}
+
+		tmpl, err := ts.parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template %s: %v", name, err)
+		}
+		ts.pages[name] = tmpl
+	}
+
+	return ts, nil
+}
+
+// Page returns the template for a page, looked up by file name
+// (e.g. "index.html" or "templates/index.html")
+func (ts *TemplateSet) Page(name string) (*template.Template, error) {
+	name = filepath.Base(name)
+
+	if ts.reload {
+		return ts.parse(name)
+	}
+
+	tmpl, ok := ts.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+	return tmpl, nil
+}
+
+// ErrorPage returns the template for an error status, such as 404.html for
+// 404, or false if there is none. Unlike Page it never re-reads templates
+// from disk, even in reload mode, so the error page still works while
+// something else is failing.
+func (ts *TemplateSet) ErrorPage(status int) (*template.Template, bool) {
+	tmpl, ok := ts.pages[strconv.Itoa(status)+".html"]
+	return tmpl, ok
+}
+
+// parse parses the base layout together with a page template
+func (ts *TemplateSet) parse(name string) (*template.Template, error) {
+	return template.New("").Funcs(templateFuncs()).Funcs(template.FuncMap{
+		"asset":  ts.assetURL,
+		"image":  ts.imageURL,
+		"limits": func() config.Content { return ts.limits },
+	}).ParseFS(ts.fsys, baseTemplate, name)
+}
+
+// templateFuncs returns the helper functions available in templates
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"slice": func(s string, start, end int) string {
+			if start < 0 {
+				start = 0
+			}
+			if end > len(s) {
+				end = len(s)
+			}
+			if start >= end {
+				return ""
+			}
+			return s[start:end]
+		},
+		"printf": func(format string, args ...interface{}) string {
+			return fmt.Sprintf(format, args...)
+		},
+		"add": func(a, b int) int {
+			return a + b
+		},
+		"repeat":         strings.Repeat,
+		"countComments":  countCommentTrees,
+		"localTime":      localTime,
+		"formatDate":     formatDate,
+		"timeago":        timeago,
+		"pluralize":      pluralize,
+		"breadcrumbList": breadcrumbList,
+		"T":              translate,
+		"N":              i18n.N,
+		"markdown":       markup.Render,
+		"dict": func(values ...interface{}) map[string]interface{} {
+			if len(values)%2 != 0 {
+				panic("dict requires an even number of arguments")
+			}
+			result := make(map[string]interface{})
+			for i := 0; i < len(values); i += 2 {
+				key, ok := values[i].(string)
+				if !ok {
+					panic("dict keys must be strings")
+				}
+				result[key] = values[i+1]
+			}
+			return result
+		},
+	}
+}
+
+// countCommentTrees counts the comments in a list of comment trees,
+// including all nested replies
+func countCommentTrees(commentTrees []models.CommentTree) int {
+	count := 0
+	for _, tree := range commentTrees {
+		count += 1 + countCommentTrees(tree.Replies)
+	}
+	return count
+}
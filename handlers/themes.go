@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// themeCookie remembers the color theme of visitors who aren't logged in
+	themeCookie = "theme"
+
+	// themeCookieLifetime is how long visitors' theme choice is remembered
+	themeCookieLifetime = 365 * 24 * time.Hour
+)
+
+// themeOptions are the color themes members can pick; "auto" follows their
+// system's light or dark mode
+var themeOptions = []settingOption{
+	{"auto", "settings.theme.auto"},
+	{"light", "settings.theme.light"},
+	{"dark", "settings.theme.dark"},
+}
+
+// theme picks the color theme to render the page in: the viewer's setting,
+// or for visitors the theme cookie. Pages render it server-side, so they
+// don't flash the wrong theme while loading.
+func (h *Handler) theme(r *http.Request, viewer *models.User) string {
+	if viewer != nil {
+		if validOption(themeOptions, viewer.Theme) {
+			return viewer.Theme
+		}
+		return "auto"
+	}
+	if cookie, err := r.Cookie(themeCookie); err == nil && validOption(themeOptions, cookie.Value) {
+		return cookie.Value
+	}
+	return "auto"
+}
+
+// ThemeHandler switches the color theme from the header's toggle (POST,
+// with theme set to "auto", "light" or "dark"). It saves members' setting,
+// or a cookie for visitors, and goes back to the page the toggle was on.
+func (h *Handler) ThemeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	theme := r.FormValue("theme")
+	if !validOption(themeOptions, theme) {
+		http.Error(w, "Invalid theme", http.StatusBadRequest)
+		return
+	}
+
+	if currentUser := h.GetCurrentUser(r); currentUser != nil {
+		prefs, err := h.DB.GetPreferences(r.Context(), currentUser.ID)
+		if err == nil {
+			prefs.Theme = theme
+			err = h.DB.SavePreferences(r.Context(), prefs)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to save theme", "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error saving theme")
+			return
+		}
+	} else {
+		http.SetCookie(w, &http.Cookie{
+			Name:     themeCookie,
+			Value:    theme,
+			Expires:  time.Now().Add(themeCookieLifetime),
+			HttpOnly: true,
+			Secure:   h.Config.TLS.Enabled(),
+			SameSite: http.SameSiteLaxMode,
+			Path:     "/",
+		})
+	}
+
+	// Go back to the page the toggle was on
+	referer := r.Header.Get("Referer")
+	if referer != "" {
+		http.Redirect(w, r, referer, http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"literary-lions/models"
+	"sync"
+	"time"
+)
+
+// timezoneOptions are the time zones members can pick on the settings page
+var timezoneOptions = []settingOption{
+	{"UTC", "UTC"},
+	{"Pacific/Honolulu", "Honolulu"},
+	{"America/Anchorage", "Anchorage"},
+	{"America/Los_Angeles", "Los Angeles (Pacific)"},
+	{"America/Denver", "Denver (Mountain)"},
+	{"America/Chicago", "Chicago (Central)"},
+	{"America/New_York", "New York (Eastern)"},
+	{"America/Halifax", "Halifax (Atlantic)"},
+	{"America/Mexico_City", "Mexico City"},
+	{"America/Bogota", "Bogotá"},
+	{"America/Sao_Paulo", "São Paulo"},
+	{"America/Argentina/Buenos_Aires", "Buenos Aires"},
+	{"Atlantic/Reykjavik", "Reykjavík"},
+	{"Europe/London", "London"},
+	{"Europe/Lisbon", "Lisbon"},
+	{"Europe/Paris", "Paris"},
+	{"Europe/Berlin", "Berlin"},
+	{"Europe/Stockholm", "Stockholm"},
+	{"Europe/Athens", "Athens"},
+	{"Europe/Helsinki", "Helsinki"},
+	{"Europe/Sofia", "Sofia"},
+	{"Europe/Istanbul", "Istanbul"},
+	{"Europe/Moscow", "Moscow"},
+	{"Africa/Lagos", "Lagos"},
+	{"Africa/Cairo", "Cairo"},
+	{"Africa/Johannesburg", "Johannesburg"},
+	{"Africa/Nairobi", "Nairobi"},
+	{"Asia/Dubai", "Dubai"},
+	{"Asia/Karachi", "Karachi"},
+	{"Asia/Kolkata", "India"},
+	{"Asia/Dhaka", "Dhaka"},
+	{"Asia/Bangkok", "Bangkok"},
+	{"Asia/Singapore", "Singapore"},
+	{"Asia/Shanghai", "China"},
+	{"Asia/Tokyo", "Tokyo"},
+	{"Asia/Seoul", "Seoul"},
+	{"Australia/Perth", "Perth"},
+	{"Australia/Adelaide", "Adelaide"},
+	{"Australia/Sydney", "Sydney"},
+	{"Pacific/Auckland", "Auckland"},
+}
+
+// locations caches loaded time zones by name, since time.LoadLocation reads
+// the zone database every time
+var locations sync.Map
+
+// viewerLocation returns the time zone the viewer sees dates and times in.
+// Visitors, and members whose zone can't be loaded, see UTC.
+func viewerLocation(viewer *models.User) *time.Location {
+	if viewer == nil || viewer.Timezone == "" || viewer.Timezone == "UTC" {
+		return time.UTC
+	}
+	if loc, ok := locations.Load(viewer.Timezone); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(viewer.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	locations.Store(viewer.Timezone, loc)
+	return loc
+}
+
+// localTime formats t, a time.Time or *time.Time, with layout in the
+// viewer's time zone. A nil *time.Time formats as "".
+func localTime(t interface{}, viewer *models.User, layout string) string {
+	when, ok := timeValue(t)
+	if !ok {
+		return ""
+	}
+	return when.In(viewerLocation(viewer)).Format(layout)
+}
+
+// timeValue returns the time in t, a time.Time or *time.Time, as templates
+// hold both. It reports false for a nil *time.Time.
+func timeValue(t interface{}) (time.Time, bool) {
+	switch t := t.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxUserTitleLength limits earned and custom titles
+const maxUserTitleLength = 30
+
+// userTitles gets the titles shown next to the given users' names. Errors
+// are logged and show no titles.
+func (h *Handler) userTitles(r *http.Request, userIDs []int) map[int]string {
+	titles, err := h.DB.GetUserTitles(r.Context(), userIDs)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch user titles", "err", err)
+		return nil
+	}
+	return titles
+}
+
+// AdminTitlesHandler lists the titles members earn and the staff's custom
+// titles, and changes them
+func (h *Handler) AdminTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	if r.Method == http.MethodPost {
+		h.updateTitles(w, r)
+		return
+	}
+
+	ladder, err := h.DB.GetTitleLadder(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch title ladder", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching titles")
+		return
+	}
+	staff, err := h.DB.GetStaffTitles(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch staff titles", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching titles")
+		return
+	}
+
+	data := struct {
+		PageData
+		Ladder    []models.UserTitle  `json:"ladder"`
+		Staff     []models.StaffTitle `json:"staff"`
+		MaxLength int                 `json:"-"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "User Titles",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), adminCrumb, Breadcrumb{Name: "User Titles", URL: "/admin/titles"}),
+		},
+		Ladder:    ladder,
+		Staff:     staff,
+		MaxLength: maxUserTitleLength,
+	}
+
+	h.Render(w, r, "admin_titles", data)
+}
+
+// updateTitles adds or deletes a title on the ladder, or sets a staff
+// member's custom title, as the admin titles form asks
+func (h *Handler) updateTitles(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var logMsg string
+	var logArgs []any
+	switch r.FormValue("action") {
+	case "add":
+		title := &models.UserTitle{Name: strings.TrimSpace(r.FormValue("name"))}
+		var postsErr, daysErr error
+		title.MinPosts, postsErr = strconv.Atoi(r.FormValue("min_posts"))
+		title.MinDays, daysErr = strconv.Atoi(r.FormValue("min_days"))
+		if title.Name == "" || len(title.Name) > maxUserTitleLength || postsErr != nil || daysErr != nil || title.MinPosts < 0 || title.MinDays < 0 {
+			h.addFlash(w, r, "error", fmt.Sprintf("Titles must be 1 to %d characters, with thresholds of 0 or more.", maxUserTitleLength))
+			http.Redirect(w, r, "/admin/titles", http.StatusSeeOther)
+			return
+		}
+		err = h.DB.CreateUserTitle(r.Context(), title)
+		logMsg, logArgs = "user title added", []any{"title", title.Name, "min_posts", title.MinPosts, "min_days", title.MinDays}
+	case "delete":
+		titleID, convErr := strconv.Atoi(r.FormValue("title_id"))
+		if convErr != nil {
+			http.Error(w, "Invalid title ID", http.StatusBadRequest)
+			return
+		}
+		err = h.DB.DeleteUserTitle(r.Context(), titleID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Title not found", http.StatusNotFound)
+			return
+		}
+		logMsg, logArgs = "user title deleted", []any{"title_id", titleID}
+	case "custom":
+		userID, convErr := strconv.Atoi(r.FormValue("user_id"))
+		if convErr != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		title := strings.TrimSpace(r.FormValue("title"))
+		if len(title) > maxUserTitleLength {
+			h.addFlash(w, r, "error", fmt.Sprintf("Titles must be 1 to %d characters, with thresholds of 0 or more.", maxUserTitleLength))
+			http.Redirect(w, r, "/admin/titles", http.StatusSeeOther)
+			return
+		}
+		err = h.DB.SetCustomTitle(r.Context(), userID, title)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Only staff can have custom titles", http.StatusBadRequest)
+			return
+		}
+		logMsg, logArgs = "custom title set", []any{"target_user_id", userID, "title", title}
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update titles", "err", err)
+		h.addFlash(w, r, "error", "Failed to update titles. Please try again.")
+		http.Redirect(w, r, "/admin/titles", http.StatusSeeOther)
+		return
+	}
+	slog.InfoContext(r.Context(), logMsg, logArgs...)
+
+	// Cached post pages show the titles next to members' names
+	h.invalidatePostPages()
+	h.addFlash(w, r, "success", "Titles updated.")
+	http.Redirect(w, r, "/admin/titles", http.StatusSeeOther)
+}
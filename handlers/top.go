@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// topPostsLimit is how many posts the top posts page ranks
+const topPostsLimit = 25
+
+// topPeriod is a tab on the top posts page
+type topPeriod struct {
+	Name  string
+	Label string
+	since func(now time.Time) time.Time
+}
+
+// topPeriods are the periods offered on the top posts page, in the order
+// their tabs are shown
+var topPeriods = []topPeriod{
+	{"week", "This Week", func(now time.Time) time.Time { return now.AddDate(0, 0, -7) }},
+	{"month", "This Month", func(now time.Time) time.Time { return now.AddDate(0, -1, 0) }},
+	{"year", "This Year", func(now time.Time) time.Time { return now.AddDate(-1, 0, 0) }},
+}
+
+// TopPostsHandler ranks the posts started over the period given by the
+// period query parameter ("week", "month" or "year"; "week" by default) by
+// the likes and comments they got
+func (h *Handler) TopPostsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("period")
+	if name == "" {
+		name = topPeriods[0].Name
+	}
+	var period *topPeriod
+	for i := range topPeriods {
+		if topPeriods[i].Name == name {
+			period = &topPeriods[i]
+		}
+	}
+	if period == nil {
+		http.Error(w, "Invalid period", http.StatusBadRequest)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	showSuspended := currentUser != nil && currentUser.IsAdmin()
+	posts, err := h.DB.GetTopPosts(r.Context(), period.since(time.Now()), showSuspended, topPostsLimit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch top posts", "period", name, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching posts")
+		return
+	}
+	h.styleCategories(r, posts)
+
+	data := struct {
+		PageData
+		Period  string      `json:"period"`
+		Periods []topPeriod `json:"-"`
+	}{
+		PageData: PageData{
+			Posts:       withoutBlocked(posts, h.blockedUsers(r, currentUser)),
+			CurrentUser: currentUser,
+			Title:       "Top Posts " + period.Label,
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), Breadcrumb{Name: "Top Posts", URL: "/top?period=" + name}),
+		},
+		Period:  name,
+		Periods: topPeriods,
+	}
+
+	h.Render(w, r, "top", data)
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/database"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeletePostHandler moves a post to the trash. Authors can delete their own
+// posts; admins can delete any post, giving a reason the author is emailed.
+func (h *Handler) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	post, err := h.DB.GetPostByID(r.Context(), postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.NotFoundHandler(w, r)
+			return
+		}
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+
+	if post.UserID != currentUser.ID && !currentUser.IsAdmin() {
+		h.RenderError(w, r, http.StatusForbidden, "")
+		return
+	}
+
+	var reason string
+	moderated := post.UserID != currentUser.ID
+	if moderated {
+		var ok bool
+		if reason, ok = formReason(r); !ok {
+			http.Error(w, "Reason too long", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.DB.TrashPost(r.Context(), postID, currentUser.ID, reason); err != nil {
+		slog.ErrorContext(r.Context(), "failed to trash post", "post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error deleting post")
+		return
+	}
+	h.PageCache.DeletePrefix(postPagePrefix(postID))
+
+	if moderated {
+		what := fmt.Sprintf("post %q", post.Title)
+		h.audit(r, currentUser, "content.remove", post.UserID, withReason(what, reason))
+		h.notifyModeration(r, post.UserID, "removed your "+what, reason)
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// AdminMergePostHandler merges a duplicate thread, post_id, into the one
+// it duplicates, given in target as its ID or URL. The duplicate's post and
+// comments move over and its address redirects there from then on.
+func (h *Handler) AdminMergePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	back := fmt.Sprintf("/post/%d", postID)
+
+	target := strings.TrimSpace(r.FormValue("target"))
+	if i := strings.LastIndex(target, "/post/"); i >= 0 {
+		target = target[i+len("/post/"):]
+	}
+	target = strings.TrimPrefix(target, "#")
+	if end := strings.IndexFunc(target, func(c rune) bool { return c < '0' || c > '9' }); end >= 0 {
+		target = target[:end] // such as /reader or #comment-3
+	}
+	targetID, err := strconv.Atoi(target)
+	if err != nil {
+		h.addFlash(w, r, "error", "Enter the number or address of the thread to merge into.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	commentID, err := h.DB.MergePost(r.Context(), postID, targetID, currentUser.ID, time.Now())
+	switch {
+	case err == database.ErrMergeSelf:
+		h.addFlash(w, r, "error", "A thread can't be merged into itself.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	case err == sql.ErrNoRows:
+		h.addFlash(w, r, "error", fmt.Sprintf("There is no thread #%d to merge into.", targetID))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to merge post", "post_id", postID, "target_id", targetID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error merging threads")
+		return
+	}
+	h.PageCache.DeletePrefix(postPagePrefix(postID))
+	h.PageCache.DeletePrefix(postPagePrefix(targetID))
+
+	slog.InfoContext(r.Context(), "merged thread", "post_id", postID, "target_id", targetID, "admin_id", currentUser.ID)
+	h.addFlash(w, r, "success", "Thread merged.")
+	http.Redirect(w, r, fmt.Sprintf("/post/%d#comment-%d", targetID, commentID), http.StatusSeeOther)
+}
+
+// DeleteCommentHandler moves a comment and its replies to the trash.
+// Authors can delete their own comments; admins can delete any comment,
+// giving a reason the author is emailed.
+func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	commentID, err := strconv.Atoi(r.FormValue("comment_id"))
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := h.DB.GetCommentByID(r.Context(), commentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.NotFoundHandler(w, r)
+			return
+		}
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching comment")
+		return
+	}
+
+	if comment.UserID != currentUser.ID && !currentUser.IsAdmin() {
+		h.RenderError(w, r, http.StatusForbidden, "")
+		return
+	}
+
+	var reason string
+	moderated := comment.UserID != currentUser.ID
+	if moderated {
+		var ok bool
+		if reason, ok = formReason(r); !ok {
+			http.Error(w, "Reason too long", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.DB.TrashComment(r.Context(), commentID, currentUser.ID, reason); err != nil {
+		slog.ErrorContext(r.Context(), "failed to trash comment", "comment_id", commentID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error deleting comment")
+		return
+	}
+	h.PageCache.DeletePrefix(postPagePrefix(comment.PostID))
+
+	if moderated {
+		what := "comment"
+		if post, err := h.DB.GetPostByID(r.Context(), comment.PostID); err == nil {
+			what = fmt.Sprintf("comment on %q", post.Title)
+		}
+		h.audit(r, currentUser, "content.remove", comment.UserID, withReason(what, reason))
+		h.notifyModeration(r, comment.UserID, "removed your "+what, reason)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d", comment.PostID), http.StatusSeeOther)
+}
+
+// AdminTrashHandler lists trashed posts and comments and restores or
+// permanently purges them
+func (h *Handler) AdminTrashHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+
+	if r.Method == http.MethodPost {
+		h.handleTrashAction(w, r)
+		return
+	}
+
+	posts, err := h.DB.GetTrashedPosts(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch trashed posts", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching trash")
+		return
+	}
+
+	comments, err := h.DB.GetTrashedComments(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch trashed comments", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching trash")
+		return
+	}
+
+	data := struct {
+		PageData
+		TrashedPosts    []models.TrashItem `json:"trashed_posts"`
+		TrashedComments []models.TrashItem `json:"trashed_comments"`
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       "Trash",
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), adminCrumb, Breadcrumb{Name: "Trash", URL: "/admin/trash"}),
+		},
+		TrashedPosts:    posts,
+		TrashedComments: comments,
+	}
+
+	h.Render(w, r, "admin_trash", data)
+}
+
+// handleTrashAction restores or purges a single trashed post or comment
+func (h *Handler) handleTrashAction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	action := r.FormValue("action")
+	itemType := r.FormValue("type")
+
+	switch {
+	case action == "restore" && itemType == "post":
+		err = h.DB.RestorePost(r.Context(), id)
+	case action == "restore" && itemType == "comment":
+		err = h.DB.RestoreComment(r.Context(), id)
+	case action == "purge" && itemType == "post":
+		err = h.DB.PurgePost(r.Context(), id)
+	case action == "purge" && itemType == "comment":
+		err = h.DB.PurgeComment(r.Context(), id)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to apply trash action", "action", action, "type", itemType, "id", id, "err", err)
+		h.addFlash(w, r, "error", fmt.Sprintf("Failed to %s item. Please try again.", action))
+		http.Redirect(w, r, "/admin/trash", http.StatusSeeOther)
+		return
+	}
+	h.invalidatePostPages()
+
+	if action == "restore" {
+		h.addFlash(w, r, "success", "Item restored.")
+	} else {
+		h.addFlash(w, r, "success", "Item permanently deleted.")
+	}
+	http.Redirect(w, r, "/admin/trash", http.StatusSeeOther)
+}
+
+// AdminUserContentHandler trashes or permanently purges all of a member's
+// posts and comments at once, optionally only those made between the from
+// and to dates, to clean up after a spam account without deleting it. The
+// member is emailed the reason given. Purging needs the member's username
+// typed as confirmation.
+func (h *Handler) AdminUserContentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	target, err := h.DB.GetUserByID(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		h.NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user")
+		return
+	}
+	if target.IsAdmin() {
+		h.RenderError(w, r, http.StatusForbidden, "Cannot clean up admin users' content")
+		return
+	}
+
+	// Dates are in the admin's time zone; to includes the whole day
+	loc := viewerLocation(currentUser)
+	var since, until time.Time
+	if from := r.FormValue("from"); from != "" {
+		if since, err = time.ParseInLocation("2006-01-02", from, loc); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := r.FormValue("to"); to != "" {
+		if until, err = time.ParseInLocation("2006-01-02", to, loc); err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		until = until.AddDate(0, 0, 1)
+	}
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		h.addFlash(w, r, "error", "The from date must not be after the to date.")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	reason, ok := formReason(r)
+	if !ok {
+		http.Error(w, "Reason too long", http.StatusBadRequest)
+		return
+	}
+
+	action := r.FormValue("action")
+	var report database.UserContentReport
+	switch action {
+	case "trash":
+		report, err = h.DB.TrashUserContent(r.Context(), userID, currentUser.ID, reason, since, until)
+	case "purge":
+		if r.FormValue("confirmation") != target.Username {
+			h.addFlash(w, r, "error", "Username confirmation failed. Please try again.")
+			http.Redirect(w, r, "/admin", http.StatusSeeOther)
+			return
+		}
+		report, err = h.DB.PurgeUserContent(r.Context(), userID, currentUser.ID, reason, since, until)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to moderate user content", "action", action, "target_user_id", userID, "err", err)
+		h.addFlash(w, r, "error", fmt.Sprintf("Failed to %s %s's content. Nothing was changed.", action, target.Username))
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	h.invalidatePostPages()
+
+	what := fmt.Sprintf("%s and %s", pluralize(report.Posts, "post", "posts"), pluralize(report.Comments, "comment", "comments"))
+	details := what
+	if !since.IsZero() || !until.IsZero() {
+		details += " made"
+		if !since.IsZero() {
+			details += " from " + since.Format("2006-01-02")
+		}
+		if !until.IsZero() {
+			details += " to " + until.AddDate(0, 0, -1).Format("2006-01-02")
+		}
+	}
+	h.audit(r, currentUser, "content."+action, userID, withReason(details, reason))
+	if report.Posts+report.Comments > 0 {
+		h.notifyModeration(r, userID, "removed your posts and comments", reason)
+	}
+
+	if action == "trash" {
+		h.addFlash(w, r, "success", fmt.Sprintf("Cleaned up %s's content: %s moved to the trash.", target.Username, what))
+	} else {
+		h.addFlash(w, r, "success", fmt.Sprintf("Cleaned up %s's content: %s permanently deleted.", target.Username, what))
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
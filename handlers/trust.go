@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"errors"
+	"literary-lions/models"
+	"literary-lions/spam"
+)
+
+// errNotTrusted is returned by saveAvatar for members still too new to
+// upload pictures
+var errNotTrusted = errors.New("member is not trusted to upload yet")
+
+// linksNotAllowed returns a message for user if they are still too new to
+// post links and text has some, or "" otherwise
+func linksNotAllowed(user *models.User, text string) string {
+	if user.Trusted(models.TrustMember) || spam.CountLinks(text) == 0 {
+		return ""
+	}
+	return "New members can't post links yet. You'll be able to once you've been around a little longer and joined in a few discussions."
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+const testLink = "Look at https://example.com"
+
+func TestNewMembersCantPostLinksOnWalls(t *testing.T) {
+	h, db := newTestHandler(t)
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	session := signIn(t, db, alice)
+
+	w := postForm(h.WallHandler, session, "/wall", url.Values{"profile_user_id": {strconv.Itoa(bob.ID)}, "content": {testLink}})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("wall post with a link answered %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if n := countRows(t, db, "wall_posts"); n != 0 {
+		t.Errorf("%d wall posts saved, want 0", n)
+	}
+
+	w = postForm(h.WallHandler, session, "/wall", url.Values{"profile_user_id": {strconv.Itoa(bob.ID)}, "content": {"Hello"}})
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("wall post without a link answered %d, want %d", w.Code, http.StatusSeeOther)
+	}
+}
+
+func TestNewMembersCantSendLinksInMessages(t *testing.T) {
+	h, db := newTestHandler(t)
+	alice := createTestUser(t, db, "alice")
+	createTestUser(t, db, "bob")
+	session := signIn(t, db, alice)
+
+	w := postForm(h.MessagesHandler, session, "/messages/new", url.Values{"to": {"bob"}, "content": {testLink}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("message with a link answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if n := countRows(t, db, "messages"); n != 0 {
+		t.Errorf("%d messages sent, want 0", n)
+	}
+}
+
+func TestNewMembersCantShareQuotesWithLinks(t *testing.T) {
+	h, db := newTestHandler(t)
+	alice := createTestUser(t, db, "alice")
+	session := signIn(t, db, alice)
+
+	w := postForm(h.QuotesHandler, session, "/quotes", url.Values{"content": {testLink}, "book": {"Dune"}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("quote with a link answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if n := countRows(t, db, "quotes"); n != 0 {
+		t.Errorf("%d quotes shared, want 0", n)
+	}
+}
+
+func TestNewMembersCantAddWebsites(t *testing.T) {
+	h, db := newTestHandler(t)
+	alice := createTestUser(t, db, "alice")
+	session := signIn(t, db, alice)
+
+	w := postMultipart(t, h.EditProfileHandler, session, "/edit-profile", url.Values{"website": {"example.com"}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("adding a website answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if user, _ := db.GetUserByID(context.Background(), alice.ID); user.Website != "" {
+		t.Errorf("website saved as %q, want none", user.Website)
+	}
+
+	// A website from before the rule, or from an admin, stays
+	if _, err := db.ExecContext(context.Background(), "UPDATE users SET website = ? WHERE id = ?", "https://example.com", alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	w = postMultipart(t, h.EditProfileHandler, session, "/edit-profile", url.Values{"website": {"https://example.com"}, "bio": {"Reader"}})
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("keeping a website answered %d, want %d", w.Code, http.StatusSeeOther)
+	}
+}
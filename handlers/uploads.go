@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Errors returned by scanUpload for uploads that are refused
+var (
+	errInfected   = errors.New("upload flagged by the virus scanner")
+	errScanFailed = errors.New("upload could not be scanned")
+)
+
+// scanUpload scans a file user uploaded as kind, such as "avatar", before
+// it is used. Flagged files are kept in the quarantine directory, if one is
+// set, recorded in the audit log and refused with errInfected. When the
+// scanner fails the upload is refused with errScanFailed if scanning is
+// required, and let through otherwise.
+func (h *Handler) scanUpload(r *http.Request, user *models.User, kind string, data []byte) error {
+	if h.Scanner == nil {
+		return nil
+	}
+	result, err := h.Scanner.Scan(r.Context(), bytes.NewReader(data))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to scan upload", "kind", kind, "err", err)
+		if h.Config.Scanner.FailClosed {
+			return errScanFailed
+		}
+		return nil
+	}
+	if !result.Infected {
+		return nil
+	}
+
+	details := fmt.Sprintf("%s upload rejected: %s", kind, result.Signature)
+	if dir := h.Config.Scanner.QuarantineDir; dir != "" {
+		name := fmt.Sprintf("%s-user%d-%s", time.Now().UTC().Format("20060102T150405.000"), user.ID, kind)
+		if err := quarantine(dir, name, data); err != nil {
+			slog.ErrorContext(r.Context(), "failed to quarantine upload", "kind", kind, "err", err)
+		} else {
+			details += "; quarantined as " + name
+		}
+	}
+	h.audit(r, user, "upload.infected", user.ID, details)
+	return errInfected
+}
+
+// quarantine keeps a flagged file in dir, readable only by the forum
+func quarantine(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), data, 0o600)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"literary-lions/auth"
+	"literary-lions/database"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// usernameChangeCooldown is how long members wait between username changes
+const usernameChangeCooldown = 30 * 24 * time.Hour
+
+// nextUsernameChange is when a member who last changed their username at
+// lastChange may change it again. It is zero if they may now.
+func nextUsernameChange(lastChange time.Time) time.Time {
+	next := lastChange.Add(usernameChangeCooldown)
+	if lastChange.IsZero() || time.Now().After(next) {
+		return time.Time{}
+	}
+	return next
+}
+
+// ChangeUsernameHandler changes the current user's username. Their old name
+// is kept in their history and links to it redirect to the new one.
+func (h *Handler) ChangeUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	if username == currentUser.Username {
+		h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, "That's already your username")
+		return
+	}
+	if err := auth.ValidateUsername(username); err != nil {
+		h.renderEditProfile(w, r, currentUser, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	history, err := h.DB.GetUsernameHistory(r.Context(), currentUser.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch username history", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error changing username")
+		return
+	}
+	if len(history) > 0 {
+		if next := nextUsernameChange(history[0].ChangedAt); !next.IsZero() {
+			msg := fmt.Sprintf("You can change your username again on %s", localTime(next, currentUser, dateFormats["date"]))
+			h.renderEditProfile(w, r, currentUser, http.StatusTooManyRequests, msg)
+			return
+		}
+	}
+
+	err = h.DB.ChangeUsername(r.Context(), currentUser.ID, username)
+	if err == database.ErrUsernameTaken {
+		h.renderEditProfile(w, r, currentUser, http.StatusConflict, "Username already exists")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to change username", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error changing username")
+		return
+	}
+
+	// Cached post pages show the old name
+	h.invalidatePostPages()
+	http.Redirect(w, r, "/profile/"+username, http.StatusSeeOther)
+}
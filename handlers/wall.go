@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxWallPostLength limits messages left on profile walls
+const maxWallPostLength = 1000
+
+// newWallPosts counts the messages on the user's wall they haven't seen,
+// for the badge in the header. Errors are logged and show no badge.
+func (h *Handler) newWallPosts(r *http.Request, user *models.User) int {
+	if user == nil {
+		return 0
+	}
+	count, err := h.DB.CountNewWallPosts(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to count new wall posts", "err", err)
+		return 0
+	}
+	return count
+}
+
+// WallHandler serves the profile walls members leave each other messages on:
+//
+//	/wall         leaving a message on a member's wall (POST)
+//	/wall/delete  deleting a message, by its author, the wall's owner or an admin
+//	/wall/close   closing or reopening the current user's wall to new messages
+//
+// Walls are shown on a tab of each profile.
+func (h *Handler) WallHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUser := h.GetCurrentUser(r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/wall"), "/") {
+	case "":
+		h.createWallPost(w, r, currentUser)
+	case "delete":
+		h.deleteWallPost(w, r, currentUser)
+	case "close":
+		h.closeWall(w, r, currentUser)
+	default:
+		h.NotFoundHandler(w, r)
+	}
+}
+
+// createWallPost leaves the current user's message on a member's wall
+func (h *Handler) createWallPost(w http.ResponseWriter, r *http.Request, currentUser *models.User) {
+	profileUserID, err := strconv.Atoi(r.FormValue("profile_user_id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	content := strings.TrimSpace(r.FormValue("content"))
+	if content == "" {
+		http.Error(w, "Message can't be empty", http.StatusBadRequest)
+		return
+	}
+	if len(content) > maxWallPostLength {
+		http.Error(w, fmt.Sprintf("Messages must be less than %d characters", maxWallPostLength), http.StatusBadRequest)
+		return
+	}
+	if msg := linksNotAllowed(currentUser, content); msg != "" {
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	profileUser, err := h.DB.GetUserByID(r.Context(), profileUserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch user", "target_user_id", profileUserID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error posting message")
+		return
+	}
+
+	if profileUser.ID != currentUser.ID {
+		prefs, err := h.DB.GetPreferences(r.Context(), profileUser.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to fetch preferences", "target_user_id", profileUser.ID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error posting message")
+			return
+		}
+		if prefs.WallClosed {
+			h.RenderError(w, r, http.StatusForbidden, profileUser.Username+"'s wall is closed")
+			return
+		}
+
+		blocked, err := h.DB.IsBlockedEitherWay(r.Context(), currentUser.ID, profileUser.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to check blocks", "target_user_id", profileUser.ID, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error posting message")
+			return
+		}
+		if blocked {
+			h.RenderError(w, r, http.StatusForbidden, "You can't post on this wall")
+			return
+		}
+	}
+
+	post := &models.WallPost{ProfileUserID: profileUser.ID, AuthorID: currentUser.ID, Content: content}
+	if err := h.DB.CreateWallPost(r.Context(), post); err != nil {
+		slog.ErrorContext(r.Context(), "failed to create wall post", "target_user_id", profileUser.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error posting message")
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/profile/%s?tab=wall#wall-%d", profileUser.Username, post.ID), http.StatusSeeOther)
+}
+
+// deleteWallPost deletes a message from a wall. Its author, the wall's owner
+// and admins may.
+func (h *Handler) deleteWallPost(w http.ResponseWriter, r *http.Request, currentUser *models.User) {
+	postID, err := strconv.Atoi(r.FormValue("wall_post_id"))
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	post, err := h.DB.GetWallPostByID(r.Context(), postID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch wall post", "wall_post_id", postID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error deleting message")
+		return
+	}
+	if post.AuthorID != currentUser.ID && post.ProfileUserID != currentUser.ID && !currentUser.IsAdmin() {
+		h.RenderError(w, r, http.StatusForbidden, "You can only delete your own messages and those on your wall")
+		return
+	}
+
+	if err := h.DB.DeleteWallPost(r.Context(), post.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete wall post", "wall_post_id", post.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error deleting message")
+		return
+	}
+
+	profileUser, err := h.DB.GetUserByID(r.Context(), post.ProfileUserID)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/profile/"+profileUser.Username+"?tab=wall", http.StatusSeeOther)
+}
+
+// closeWall closes the current user's wall to new messages, or reopens it
+func (h *Handler) closeWall(w http.ResponseWriter, r *http.Request, currentUser *models.User) {
+	var closed bool
+	switch r.FormValue("action") {
+	case "close":
+		closed = true
+	case "open":
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := h.DB.GetPreferences(r.Context(), currentUser.ID)
+	if err == nil {
+		prefs.WallClosed = closed
+		err = h.DB.SavePreferences(r.Context(), prefs)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update wall", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating wall")
+		return
+	}
+
+	http.Redirect(w, r, "/profile/"+currentUser.Username+"?tab=wall", http.StatusSeeOther)
+}
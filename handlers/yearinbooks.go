@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"literary-lions/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// YearInBooksHandler serves members' yearly summaries:
+//
+//	/year-in-books                    the current user's summary for this year; POST shares or unshares their summaries
+//	/year-in-books/{username}         a member's summary for this year
+//	/year-in-books/{username}/{year}  a member's summary for a year
+//
+// Summaries are private to the member unless they share them.
+func (h *Handler) YearInBooksHandler(w http.ResponseWriter, r *http.Request) {
+	currentUser := h.GetCurrentUser(r)
+	year := time.Now().UTC().Year()
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/year-in-books"), "/")
+	if rest == "" {
+		if currentUser == nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			http.Redirect(w, r, fmt.Sprintf("/year-in-books/%s/%d", currentUser.Username, year), http.StatusSeeOther)
+		case http.MethodPost:
+			h.shareYearInBooks(w, r, currentUser)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username, yearPart, hasYear := strings.Cut(rest, "/")
+	if hasYear {
+		var err error
+		if year, err = strconv.Atoi(yearPart); err != nil {
+			h.NotFoundHandler(w, r)
+			return
+		}
+	}
+
+	user, err := h.DB.GetUserByUsername(r.Context(), username)
+	if err == sql.ErrNoRows {
+		// Links to members who have since changed their name lead to them
+		newUsername, err := h.DB.GetRenamedUsername(r.Context(), username)
+		if err == sql.ErrNoRows {
+			h.NotFoundHandler(w, r)
+		} else if err != nil {
+			slog.ErrorContext(r.Context(), "failed to look up renamed user", "username", username, "err", err)
+			h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user")
+		} else {
+			http.Redirect(w, r, fmt.Sprintf("/year-in-books/%s/%d", newUsername, year), http.StatusMovedPermanently)
+		}
+		return
+	} else if err != nil {
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching user")
+		return
+	}
+	if hiddenFrom(h.GetCurrentUser(r), user) {
+		h.NotFoundHandler(w, r)
+		return
+	}
+	if !hasYear {
+		http.Redirect(w, r, fmt.Sprintf("/year-in-books/%s/%d", user.Username, year), http.StatusSeeOther)
+		return
+	}
+
+	own := currentUser != nil && currentUser.ID == user.ID
+	prefs, err := h.DB.GetPreferences(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch preferences", "target_user_id", user.ID, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching Year in Books")
+		return
+	}
+	// Private summaries look like they don't exist to others
+	firstYear := user.CreatedAt.UTC().Year()
+	if (!own && !prefs.YearPublic) || year < firstYear || year > time.Now().UTC().Year() {
+		h.NotFoundHandler(w, r)
+		return
+	}
+
+	summary, err := h.DB.GetYearInBooks(r.Context(), user.ID, year)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch year in books", "target_user_id", user.ID, "year", year, "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error fetching Year in Books")
+		return
+	}
+
+	data := struct {
+		PageData
+		ProfileUser *models.User        `json:"profile_user"`
+		Summary     *models.YearInBooks `json:"summary"`
+		Own         bool                `json:"-"`
+		Public      bool                `json:"public"`
+		PrevYear    int                 `json:"-"` // 0 when the member joined this year
+		NextYear    int                 `json:"-"` // 0 for the current year
+	}{
+		PageData: PageData{
+			CurrentUser: currentUser,
+			Title:       fmt.Sprintf("%s's %d in Books", user.Username, year),
+			Breadcrumbs: h.breadcrumbs(r, h.locale(r, currentUser), profileCrumb(user.Username), Breadcrumb{Name: fmt.Sprintf("%d in Books", year), URL: fmt.Sprintf("/year-in-books/%s/%d", user.Username, year)}),
+		},
+		ProfileUser: user,
+		Summary:     summary,
+		Own:         own,
+		Public:      prefs.YearPublic,
+	}
+	if year > firstYear {
+		data.PrevYear = year - 1
+	}
+	if year < time.Now().UTC().Year() {
+		data.NextYear = year + 1
+	}
+
+	h.Render(w, r, "year_in_books", data)
+}
+
+// shareYearInBooks lets anyone see the current user's yearly summaries, or
+// makes them private again
+func (h *Handler) shareYearInBooks(w http.ResponseWriter, r *http.Request, currentUser *models.User) {
+	var public bool
+	switch r.FormValue("action") {
+	case "share":
+		public = true
+	case "unshare":
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := h.DB.GetPreferences(r.Context(), currentUser.ID)
+	if err == nil {
+		prefs.YearPublic = public
+		err = h.DB.SavePreferences(r.Context(), prefs)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update year in books sharing", "err", err)
+		h.RenderError(w, r, http.StatusInternalServerError, "Error updating Year in Books")
+		return
+	}
+
+	year := r.FormValue("year")
+	if _, err := strconv.Atoi(year); err != nil {
+		year = strconv.Itoa(time.Now().UTC().Year())
+	}
+	http.Redirect(w, r, "/year-in-books/"+currentUser.Username+"/"+year, http.StatusSeeOther)
+}
@@ -0,0 +1,146 @@
+// Package i18n translates the forum's interface text. Each supported locale
+// has a message catalog in locales/, a flat JSON object mapping message keys
+// to text. Text may hold fmt verbs, filled in from the arguments to T.
+//
+// The English catalog is the reference: messages missing from another
+// catalog fall back to English, and keys missing from English show as the
+// key itself, so untranslated text is easy to spot.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale of visitors whose language isn't supported
+const Default = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalogs holds the messages of each supported locale, by locale code
+var catalogs = mustLoad()
+
+// mustLoad reads the embedded catalogs. They are part of the binary, so a
+// broken one is a build mistake and panics at startup.
+func mustLoad() map[string]map[string]string {
+	names, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	catalogs := make(map[string]map[string]string)
+	for _, name := range names {
+		data, err := files.ReadFile(path.Join("locales", name.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: catalog %s: %v", name.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(name.Name(), ".json")] = messages
+	}
+	if _, ok := catalogs[Default]; !ok {
+		panic("i18n: no catalog for the default locale " + Default)
+	}
+	return catalogs
+}
+
+// Locale is a supported locale, with the name of its language in that
+// language, for choosing between them
+type Locale struct {
+	Code string
+	Name string
+}
+
+// Locales lists the supported locales, ordered by code
+func Locales() []Locale {
+	locales := make([]Locale, 0, len(catalogs))
+	for code := range catalogs {
+		locales = append(locales, Locale{Code: code, Name: T(code, "language.name")})
+	}
+	sort.Slice(locales, func(i, j int) bool {
+		return locales[i].Code < locales[j].Code
+	})
+	return locales
+}
+
+// Supported reports whether there is a catalog for the locale
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// T translates the message with the given key into the locale, formatting
+// it with args if there are any
+func T(locale, key string, args ...interface{}) string {
+	message, ok := catalogs[locale][key]
+	if !ok {
+		message, ok = catalogs[Default][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// N translates a message about n things, choosing between the key's ".one"
+// and ".other" forms, and formats it with n. All the supported languages
+// use the singular for exactly one only.
+func N(locale, key string, n int) string {
+	if n == 1 {
+		return T(locale, key+".one", n)
+	}
+	return T(locale, key+".other", n)
+}
+
+// Negotiate picks the supported locale that best matches an Accept-Language
+// header, such as "es-ES,es;q=0.9,en;q=0.8", or Default if none does. A
+// regional tag matches its language's locale when there is no catalog for
+// the region.
+func Negotiate(acceptLanguage string) string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		t := tag{name: strings.ToLower(strings.TrimSpace(name)), q: 1}
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			t.q = q
+		}
+		if t.name != "" && t.q > 0 {
+			tags = append(tags, t)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	for _, t := range tags {
+		if t.name == "*" {
+			return Default
+		}
+		if Supported(t.name) {
+			return t.name
+		}
+		if language, _, ok := strings.Cut(t.name, "-"); ok && Supported(language) {
+			return language
+		}
+	}
+	return Default
+}
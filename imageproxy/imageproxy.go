@@ -0,0 +1,292 @@
+// Package imageproxy serves images from other sites, such as book covers and
+// profile pictures stored elsewhere, from the forum's own origin. Pages link
+// to the proxy with the image's address and a signature, so it only fetches
+// images the forum itself linked to. Images are fetched with size limits,
+// scaled down to the width asked for, re-encoded and cached.
+package imageproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+	"literary-lions/cache"
+	"literary-lions/config"
+	"literary-lions/safehttp"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Path is where the proxy is served
+const Path = "/img-proxy"
+
+// maxPixels bounds the dimensions of fetched images, since a small file can
+// declare a huge image that would take a lot of memory to decode
+const maxPixels = 40_000_000
+
+// maxCachedBytes is the largest image kept in the cache; bigger ones are
+// fetched again each time
+const maxCachedBytes = 1 << 20
+
+// maxRedirects is how many redirects are followed when fetching an image
+const maxRedirects = 3
+
+// userAgent identifies the forum to the sites images are fetched from
+const userAgent = "LiteraryLions-ImageProxy/1.0 (+https://github.com/joro11111/forum)"
+
+// acceptedTypes are the image types proxied, sniffed from the fetched bytes
+// rather than trusted from the remote server
+var acceptedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Errors for images that cannot be served
+var (
+	errTooLarge   = errors.New("image too large")
+	errNotAnImage = errors.New("not a supported image")
+)
+
+// Proxy fetches, scales and caches remote images. A nil *Proxy is valid and
+// leaves image URLs as they are.
+type Proxy struct {
+	key      []byte
+	client   *http.Client
+	maxBytes int64
+	maxWidth int
+	cache    *cache.Cache
+}
+
+// proxied is an image ready to serve
+type proxied struct {
+	data        []byte
+	contentType string
+	etag        string
+}
+
+// NewFromConfig creates the proxy configured in cfg, or returns nil when it
+// is disabled. Without a configured key URLs are signed with a random one,
+// so they change when the server restarts.
+func NewFromConfig(cfg config.ImageProxy) *Proxy {
+	if !cfg.Enabled {
+		return nil
+	}
+	key := []byte(cfg.Key)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("imageproxy: failed to generate a key: %v", err))
+		}
+	}
+
+	return &Proxy{
+		key:      key,
+		client:   safehttp.NewClient(cfg.Timeout, maxRedirects),
+		maxBytes: int64(cfg.MaxSizeMB) << 20,
+		maxWidth: cfg.MaxWidth,
+		cache:    cache.New(cfg.CacheTTL),
+	}
+}
+
+// URL returns the address pages should load the image at src from, scaled
+// to at most width pixels wide (0 for the proxy's largest width). Images on
+// the forum itself, anything that isn't an http or https URL and every
+// image when the proxy is off are left as they are.
+func (p *Proxy) URL(src string, width int) string {
+	if p == nil || (!strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://")) {
+		return src
+	}
+	width = p.clampWidth(width)
+	q := url.Values{}
+	q.Set("url", src)
+	q.Set("w", strconv.Itoa(width))
+	q.Set("s", hex.EncodeToString(p.sign(src, width)))
+	return Path + "?" + q.Encode()
+}
+
+// clampWidth limits a requested width to the proxy's largest
+func (p *Proxy) clampWidth(width int) int {
+	if width <= 0 || width > p.maxWidth {
+		return p.maxWidth
+	}
+	return width
+}
+
+// sign returns the signature of a proxied image's address and width
+func (p *Proxy) sign(src string, width int) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	fmt.Fprintf(mac, "%s\n%d", src, width)
+	return mac.Sum(nil)
+}
+
+// ServeHTTP serves a signed image at Path?url={address}&w={width}&s={signature}.
+// Images are re-encoded, as JPEG or PNG when they have transparency, so
+// nothing but pixels from the other site reaches the browser.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if p == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	src := r.URL.Query().Get("url")
+	width, err := strconv.Atoi(r.URL.Query().Get("w"))
+	sig, _ := hex.DecodeString(r.URL.Query().Get("s"))
+	if err != nil || width != p.clampWidth(width) || !hmac.Equal(sig, p.sign(src, width)) {
+		http.Error(w, "Invalid image signature", http.StatusForbidden)
+		return
+	}
+
+	key := "img:" + strconv.Itoa(width) + ":" + src
+	var img *proxied
+	if cached, ok := p.cache.Get(key); ok {
+		img = cached.(*proxied)
+	} else {
+		img, err = p.fetch(r.Context(), src, width)
+		if err != nil {
+			slog.WarnContext(r.Context(), "failed to proxy image", "url", src, "err", err)
+			http.Error(w, "Image unavailable", http.StatusBadGateway)
+			return
+		}
+		if len(img.data) <= maxCachedBytes {
+			p.cache.Set(key, img)
+		}
+	}
+
+	w.Header().Set("Content-Type", img.contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", img.etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img.data))
+}
+
+// fetch downloads the image at src and scales it down to width
+func (p *Proxy) fetch(ctx context.Context, src string, width int) (*proxied, error) {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, safehttp.ErrNotAllowed
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > p.maxBytes {
+		return nil, errTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, p.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > p.maxBytes {
+		return nil, errTooLarge
+	}
+	if !acceptedTypes[http.DetectContentType(data)] {
+		return nil, errNotAnImage
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNotAnImage
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, errTooLarge
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNotAnImage
+	}
+	return encode(scale(decoded, width))
+}
+
+// scale shrinks img to width pixels wide, keeping its proportions. Images
+// that are already narrow enough are left as they are.
+func scale(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+	height := max(bounds.Dy()*width/bounds.Dx(), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// encode encodes img as PNG if it has transparent pixels and as JPEG
+// otherwise
+func encode(img image.Image) (*proxied, error) {
+	var out bytes.Buffer
+	contentType := "image/jpeg"
+	if transparent(img) {
+		contentType = "image/png"
+		if err := png.Encode(&out, img); err != nil {
+			return nil, err
+		}
+	} else {
+		// JPEG has no transparency; draw onto white in case of
+		// translucent edges
+		opaque := image.NewRGBA(img.Bounds())
+		draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(opaque, opaque.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&out, opaque, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+	}
+	sum := sha256.Sum256(out.Bytes())
+	return &proxied{
+		data:        out.Bytes(),
+		contentType: contentType,
+		etag:        `"` + hex.EncodeToString(sum[:])[:16] + `"`,
+	}, nil
+}
+
+// transparent reports whether any pixel of img is fully transparent
+func transparent(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return false
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+// Package logging sets up structured logging with log/slog and assigns every
+// request an ID. Records logged with a request's context carry that request's
+// ID, user ID and handler, so every line about a request can be found
+// together.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Supported output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Setup makes a logger writing to out in the given format ("text" or "json")
+// at the given level ("debug", "info", "warn" or "error") the default for
+// slog and the standard log package
+func Setup(out io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: lvl,
+		// Durations read better as "1.5s" than as nanoseconds in JSON
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() == slog.KindDuration {
+				a.Value = slog.StringValue(a.Value.Duration().String())
+			}
+			return a
+		},
+	}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		handler = slog.NewTextHandler(out, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+
+	logger := slog.New(contextHandler{handler})
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// requestFields are the per-request values added to log records. They are
+// filled in as the request is handled, so they sit behind a pointer in the
+// context and are read when a record is written.
+type requestFields struct {
+	mu        sync.Mutex
+	requestID string
+	userID    int
+	handler   string
+	lastError string // message of the last error logged for the request
+}
+
+type contextKey struct{}
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs accepted from clients and proxies; other
+// values are replaced so they cannot inject text into logs or pages
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// Middleware attaches request fields to every request passing through next.
+// The request ID is taken from the X-Request-ID header when a proxy in front
+// already set one, or generated otherwise, and echoed in the response. route
+// names the handler that will serve a request, such as its pattern.
+func Middleware(route func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		fields := &requestFields{
+			requestID: requestID,
+			handler:   route(r),
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, fields)))
+	})
+}
+
+// newRequestID returns a random 16-character hex ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside a
+// request
+func RequestID(ctx context.Context) string {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		return fields.requestID
+	}
+	return ""
+}
+
+// Info describes the request a context belongs to
+type Info struct {
+	RequestID string
+	UserID    int    // 0 when nobody is logged in
+	Handler   string // route pattern serving the request
+	LastError string // last error logged while handling the request, with its err attribute
+}
+
+// RequestInfo returns what is known about the request ctx belongs to
+func RequestInfo(ctx context.Context) Info {
+	fields, ok := ctx.Value(contextKey{}).(*requestFields)
+	if !ok {
+		return Info{}
+	}
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	return Info{
+		RequestID: fields.requestID,
+		UserID:    fields.userID,
+		Handler:   fields.handler,
+		LastError: fields.lastError,
+	}
+}
+
+// SetUserID records the authenticated user for log records of the request
+func SetUserID(ctx context.Context, userID int) {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		fields.mu.Lock()
+		fields.userID = userID
+		fields.mu.Unlock()
+	}
+}
+
+// contextHandler adds the request fields found in a record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		fields.mu.Lock()
+		if fields.requestID != "" {
+			record.AddAttrs(slog.String("request_id", fields.requestID))
+		}
+		if fields.userID != 0 {
+			record.AddAttrs(slog.Int("user_id", fields.userID))
+		}
+		if fields.handler != "" {
+			record.AddAttrs(slog.String("handler", fields.handler))
+		}
+		if record.Level >= slog.LevelError {
+			fields.lastError = errorMessage(record)
+		}
+		fields.mu.Unlock()
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// errorMessage summarises an error record as its message and, if present,
+// its err attribute, e.g. "failed to fetch post: database is locked"
+func errorMessage(record slog.Record) string {
+	message := record.Message
+	record.Attrs(func(a slog.Attr) bool {
+		if a.Key == "err" {
+			message += ": " + a.Value.String()
+			return false
+		}
+		return true
+	})
+	return message
+}
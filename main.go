@@ -1,94 +1,377 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"html/template"
+	"literary-lions/accesslog"
+	"literary-lions/avatars"
+	"literary-lions/cache"
+	"literary-lions/clientip"
+	"literary-lions/compression"
+	"literary-lions/config"
 	"literary-lions/database"
+	"literary-lions/errorreport"
+	"literary-lions/features"
 	"literary-lions/handlers"
-	"log"
+	"literary-lions/imageproxy"
+	"literary-lions/logging"
+	"literary-lions/mailer"
+	"literary-lions/middleware"
+	"literary-lions/openlibrary"
+	"literary-lions/ratelimit"
+	"literary-lions/scanner"
+	"literary-lions/spam"
+	"literary-lions/staticfiles"
+	"literary-lions/unfurl"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	// Embed the time zone database, which the runtime image lacks, for
+	// members' time zone settings
+	_ "time/tzdata"
 )
 
 func main() {
+	// ctx is cancelled on SIGINT/SIGTERM or when main returns, which starts
+	// a graceful shutdown and stops background jobs
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// Load settings from defaults, the config file, the environment and flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("failed to load configuration", "err", err)
+	}
+	if _, err := logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level); err != nil {
+		fatal("failed to set up logging", "err", err)
+	}
+
 	// Initialize database
-	db, err := database.NewDB("forum.db")
+	db, err := database.Open(cfg.Database)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("failed to connect to database", "err", err)
+	}
+
+	// background tracks jobs that use the database, so it is only closed
+	// once they have stopped
+	var background sync.WaitGroup
+	defer func() {
+		cancel()
+		background.Wait()
+		if err := db.Close(); err != nil {
+			slog.Error("failed to close database", "err", err)
+		}
+	}()
+
+	// Run a subcommand (e.g. "migrate status") instead of the server if given
+	if runCommand(ctx, db, cfg, args) {
+		return
 	}
-	defer db.Close()
 
 	// Initialize database tables
-	if err := db.InitDB(); err != nil {
-		log.Fatal("Failed to initialize database:", err)
+	if err := db.InitDB(ctx, cfg.Admin); err != nil {
+		fatal("failed to initialize database", "err", err)
+	}
+
+	// Keep sessions in Redis instead of the database if requested, so
+	// several instances can share them
+	var store database.Store = db
+	if cfg.Sessions.Store == "redis" {
+		sessions, err := database.NewRedisSessionStore(ctx, cfg.Sessions.RedisURL)
+		if err != nil {
+			fatal("failed to set up Redis session store", "err", err)
+		}
+		defer sessions.Close()
+		store = database.WithSessionStore(db, sessions)
+	}
+
+	// Snapshot the SQLite database periodically when a backup directory is set
+	var backups *database.BackupScheduler
+	if cfg.Backup.Dir != "" {
+		backups = database.NewBackupScheduler(db, cfg.Backup.Dir, cfg.Backup.Interval, cfg.Backup.Retain)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			backups.Run(ctx)
+		}()
 	}
 
 	// Clean expired sessions periodically
+	background.Add(1)
 	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
+		defer background.Done()
+		ticker := time.NewTicker(cfg.Sessions.CleanupInterval)
 		defer ticker.Stop()
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case <-ticker.C:
-				if err := db.CleanExpiredSessions(); err != nil {
-					log.Printf("Error cleaning expired sessions: %v", err)
+				if err := store.CleanExpiredSessions(ctx); err != nil {
+					slog.ErrorContext(ctx, "failed to clean expired sessions", "err", err)
+				}
+			}
+		}
+	}()
+
+	// Run database maintenance periodically; an interval of 0 disables it
+	if cfg.Database.MaintenanceInterval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			db.RunMaintenance(ctx, cfg.Database.MaintenanceInterval)
+		}()
+	}
+
+	// Templates and static files are embedded in the binary. Template
+	// reloading reads them from disk instead and re-parses templates on every
+	// request, for live editing. Static files are linked with a content hash
+	// so browsers can cache them until they change.
+	static, err := staticfiles.New(assetFS("static", cfg.Server.TemplateReload), "/static/", cfg.Server.TemplateReload)
+	if err != nil {
+		fatal("failed to load static files", "err", err)
+	}
+	// Images from other sites are served through the image proxy, when on
+	imageProxy := imageproxy.NewFromConfig(cfg.ImageProxy)
+	templates, err := handlers.LoadTemplates(assetFS("templates", cfg.Server.TemplateReload), cfg.Server.TemplateReload, static.URL, imageProxy.URL, cfg.Content)
+	if err != nil {
+		fatal("failed to load templates", "err", err)
+	}
+
+	// Initialize handlers, caching hot reads and anonymous post pages (a TTL
+	// of 0 disables caching)
+	h := handlers.NewHandler(database.NewCachedStore(store, cache.New(cfg.Cache.TTL)), templates, cfg)
+	h.PageCache = cache.New(cfg.Cache.TTL)
+	h.Backups = backups
+
+	// Publish scheduled posts once they are due, through the cached store so
+	// listings show them right away
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		ticker := time.NewTicker(cfg.Database.PublishInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				published, err := h.DB.PublishDuePosts(ctx, now)
+				if err != nil {
+					slog.ErrorContext(ctx, "failed to publish scheduled posts", "err", err)
+				} else if published > 0 {
+					slog.InfoContext(ctx, "published scheduled posts", "count", published)
 				}
 			}
 		}
 	}()
 
-	// Load templates
-	templates, err := loadTemplates()
+	// Promote members whose accounts have aged and who have contributed
+	// enough, now and then every trust interval
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		updateTrustLevels := func(now time.Time) {
+			promoted, err := h.DB.UpdateTrustLevels(ctx, cfg.Trust, now)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to update trust levels", "err", err)
+			} else if promoted > 0 {
+				slog.InfoContext(ctx, "promoted members", "count", promoted)
+			}
+		}
+		updateTrustLevels(time.Now())
+		ticker := time.NewTicker(cfg.Trust.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				updateTrustLevels(now)
+			}
+		}
+	}()
+
+	// Purge what the retention policy no longer keeps, every retention
+	// interval (0 disables purging)
+	if cfg.Retention.Interval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			ticker := time.NewTicker(cfg.Retention.Interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case now := <-ticker.C:
+					h.PurgeRetained(ctx, now)
+				}
+			}
+		}()
+	}
+
+	// Uploaded profile pictures are kept on disk or in S3
+	h.Avatars, err = avatars.NewFromConfig(cfg.Avatars)
 	if err != nil {
-		log.Fatal("Failed to load templates:", err)
+		fatal("failed to set up avatar storage", "err", err)
+	}
+
+	// The books members are reading are looked up on Open Library
+	h.OpenLibrary = openlibrary.NewFromConfig(cfg.OpenLibrary)
+	h.ImageProxy = imageProxy
+	h.BookCards = unfurl.New(cfg.BookCards, h.OpenLibrary)
+	h.Spam = spam.NewFromConfig(cfg.Spam, cfg.Cooldown.NewAccountAge)
+	h.Mailer = mailer.NewFromConfig(cfg.Mail)
+
+	// Uploads are scanned for malware with clamd, when one is configured
+	h.Scanner, err = scanner.NewFromConfig(cfg.Scanner)
+	if err != nil {
+		fatal("failed to set up the upload scanner", "err", err)
+	}
+
+	// Feature flags set by admins are re-read as often as cached pages expire
+	h.Features, err = features.New(store, cfg.Features, cfg.Cache.TTL)
+	if err != nil {
+		fatal("invalid feature flags", "err", err)
+	}
+
+	// Rate limits per route group, each keyed by user or client address
+	limits := cfg.RateLimit
+	if !limits.Enabled {
+		limits = config.RateLimit{}
+	}
+	authLimiter := ratelimit.New(limits.Auth)
+	postLimiter := ratelimit.New(limits.Post)
+	regularLimiter := ratelimit.New(limits.Regular)
+	searchLimiter := ratelimit.New(limits.Search)
+	staticLimiter := ratelimit.New(limits.Static)
+	staticKey := func(r *http.Request) string {
+		return clientip.FromRequest(r)
 	}
 
-	// Initialize handlers
-	h := handlers.NewHandler(db, templates)
+	// Middleware stacks routes declare. Authentication comes before rate
+	// limiting so logged-in users are limited by account, not address.
+	// Write limits only count form submissions, not viewing the form.
+	writes := func(l *ratelimit.Limiter) middleware.Middleware {
+		return ratelimit.Limit(l, h.WriteRateLimitKey)
+	}
+	// Regulars write under their own, higher limit
+	posts := middleware.New(
+		ratelimit.Limit(postLimiter, h.TrustWriteRateLimitKey(false)),
+		ratelimit.Limit(regularLimiter, h.TrustWriteRateLimitKey(true)),
+	)
+	member := middleware.New(h.RequireUser)
+	memberAPI := middleware.New(h.RequireUserAPI)
+	admin := middleware.New(h.RequireAdmin)
+	authForm := middleware.New(writes(authLimiter))
+	memberPost := member.Append(posts...)
+	memberAPIPost := memberAPI.Append(posts...)
+	publicPost := posts
 
 	// Setup routes
 	mux := http.NewServeMux()
 
 	// Public routes
 	mux.HandleFunc("/", h.HomeHandler)
-	mux.HandleFunc("/login", h.LoginHandler)
-	mux.HandleFunc("/register", h.RegisterHandler)
+	mux.Handle("/login", authForm.ThenFunc(h.LoginHandler))
+	mux.Handle("/register", authForm.ThenFunc(h.RegisterHandler))
 	mux.HandleFunc("/logout", h.LogoutHandler)
 
 	// Post routes
 	mux.HandleFunc("/post/", h.ViewPostHandler)
-	mux.HandleFunc("/create-post", h.CreatePostHandler)
+	mux.Handle("/create-post", memberPost.ThenFunc(h.CreatePostHandler))
+	mux.Handle("/delete-post", member.ThenFunc(h.DeletePostHandler))
+	mux.Handle("/edit-post", memberPost.ThenFunc(h.EditPostHandler))
+	mux.Handle("/drafts", memberPost.ThenFunc(h.DraftsHandler))
 
 	// Search routes
 	mux.HandleFunc("/search", h.SearchHandler)
-	mux.HandleFunc("/api/search-suggestions", h.SearchSuggestionsHandler)
+	mux.Handle("/api/search-suggestions", middleware.New(ratelimit.Limit(searchLimiter, h.RateLimitKey)).ThenFunc(h.SearchSuggestionsHandler))
+
+	// JSON API routes
+	mux.HandleFunc("/api/posts", h.APIPostsHandler)
+	mux.Handle("/api/like-post", memberAPIPost.ThenFunc(h.APILikePostHandler))
+	mux.Handle("/api/like-comment", memberAPIPost.ThenFunc(h.APILikeCommentHandler))
+	mux.Handle("/api/preview", memberAPIPost.ThenFunc(h.APIPreviewHandler))
 
 	// Profile routes
 	mux.HandleFunc("/profile/", h.ProfileHandler)
-	mux.HandleFunc("/edit-profile", h.EditProfileHandler)
-	mux.HandleFunc("/delete-profile", h.DeleteProfileHandler)
-
-	// Admin routes (protected by admin middleware)
-	mux.HandleFunc("/admin", h.AdminMiddleware(h.AdminPanelHandler))
-	mux.HandleFunc("/admin/suspend", h.AdminMiddleware(h.AdminSuspendUserHandler))
-	mux.HandleFunc("/admin/delete", h.AdminMiddleware(h.AdminDeleteUserHandler))
-
-	// Comment and like routes (require authentication)
-	mux.HandleFunc("/create-comment", h.CreateCommentHandler)
-	mux.HandleFunc("/like-post", h.LikePostHandler)
-	mux.HandleFunc("/like-comment", h.LikeCommentHandler)
-
-	// Static files (CSS, JS, images) - if needed in the future
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static/"))))
+	mux.Handle("/edit-profile", memberPost.ThenFunc(h.EditProfileHandler))
+	mux.Handle("/settings", memberPost.ThenFunc(h.SettingsHandler))
+	mux.Handle("/theme", publicPost.ThenFunc(h.ThemeHandler))
+	mux.Handle("/change-username", memberPost.Append(h.RefuseImpersonation).ThenFunc(h.ChangeUsernameHandler))
+	mux.Handle("/change-email", member.Append(h.RefuseImpersonation, writes(authLimiter)).ThenFunc(h.ChangeEmailHandler))
+	mux.HandleFunc("/confirm-email", h.ConfirmEmailHandler)
+	mux.HandleFunc("/avatars/", h.AvatarHandler)
+	mux.HandleFunc("/avatar/", h.MemberAvatarHandler)
+	mux.Handle("/delete-profile", member.Append(h.RefuseImpersonation).ThenFunc(h.DeleteProfileHandler))
+	mux.Handle("/deactivate-account", member.Append(h.RefuseImpersonation).ThenFunc(h.DeactivateAccountHandler))
+	mux.Handle("/stop-impersonating", member.ThenFunc(h.StopImpersonatingHandler))
+	mux.Handle("/messages", memberPost.Append(h.RefuseImpersonatedWrites).ThenFunc(h.MessagesHandler))
+	mux.Handle("/block", memberPost.ThenFunc(h.BlockHandler))
+	mux.Handle("/bookshelf", memberPost.ThenFunc(h.BookshelfHandler))
+	mux.Handle("/currently-reading", memberPost.ThenFunc(h.CurrentlyReadingHandler))
+	mux.Handle("/messages/", memberPost.Append(h.RefuseImpersonatedWrites).ThenFunc(h.MessagesHandler))
+	mux.HandleFunc("/leaderboard", h.LeaderboardHandler)
+	mux.HandleFunc("/top", h.TopPostsHandler)
+	mux.HandleFunc("/random", h.RandomPostHandler)
+	mux.HandleFunc("/stats", h.StatsHandler)
+	mux.HandleFunc("/archive", h.ArchiveHandler)
+	mux.HandleFunc("/archive/", h.ArchiveHandler)
+	mux.HandleFunc("/category/", h.CategoryAboutHandler)
+	mux.HandleFunc("/book/", h.BookHandler)
+	mux.Handle("/quotes", publicPost.ThenFunc(h.QuotesHandler))
+	mux.Handle("/quotes/", publicPost.ThenFunc(h.QuotesHandler))
+	mux.Handle("/wall", publicPost.ThenFunc(h.WallHandler))
+	mux.Handle("/wall/", publicPost.ThenFunc(h.WallHandler))
+	mux.HandleFunc("/year-in-books", h.YearInBooksHandler)
+	mux.HandleFunc("/year-in-books/", h.YearInBooksHandler)
+	mux.Handle("/import/goodreads", member.ThenFunc(h.ImportGoodreadsHandler))
+
+	// Admin routes
+	mux.Handle("/admin", admin.ThenFunc(h.AdminPanelHandler))
+	mux.Handle("/admin/suspend", admin.ThenFunc(h.AdminSuspendUserHandler))
+	mux.Handle("/admin/impersonate", admin.ThenFunc(h.AdminImpersonateHandler))
+	mux.Handle("/admin/delete", admin.ThenFunc(h.AdminDeleteUserHandler))
+	mux.Handle("/admin/trash", admin.ThenFunc(h.AdminTrashHandler))
+	mux.Handle("/admin/user-content", admin.ThenFunc(h.AdminUserContentHandler))
+	mux.Handle("/admin/merge-post", admin.ThenFunc(h.AdminMergePostHandler))
+	mux.Handle("/admin/features", admin.ThenFunc(h.AdminFeaturesHandler))
+	mux.Handle("/admin/titles", admin.ThenFunc(h.AdminTitlesHandler))
+	mux.Handle("/admin/reasons", admin.ThenFunc(h.AdminReasonsHandler))
+	mux.Handle("/admin/categories", admin.ThenFunc(h.AdminCategoriesHandler))
+	mux.Handle("/admin/audit", admin.ThenFunc(h.AdminAuditLogHandler))
+	mux.Handle("/admin/moderation", admin.ThenFunc(h.AdminModerationHandler))
+
+	// Comment and like routes
+	mux.Handle("/create-comment", memberPost.ThenFunc(h.CreateCommentHandler))
+	mux.HandleFunc("/comment/", h.CommentFragmentHandler)
+	mux.Handle("/delete-comment", member.ThenFunc(h.DeleteCommentHandler))
+	mux.Handle("/mute-thread", memberPost.ThenFunc(h.MuteThreadHandler))
+	mux.Handle("/follow-thread", memberPost.ThenFunc(h.FollowThreadHandler))
+	mux.Handle("/bookmark-post", memberPost.ThenFunc(h.BookmarkPostHandler))
+	mux.Handle("/edit-comment", memberPost.ThenFunc(h.EditCommentHandler))
+	mux.Handle("/like-post", memberAPIPost.ThenFunc(h.LikePostHandler))
+	mux.Handle("/like-comment", memberAPIPost.ThenFunc(h.LikeCommentHandler))
+
+	// Static files (CSS, JS, images)
+	mux.Handle("/static/", middleware.New(ratelimit.Limit(staticLimiter, staticKey)).Then(static))
+	mux.Handle(imageproxy.Path, middleware.New(ratelimit.Limit(staticLimiter, staticKey)).Then(imageProxy))
 
 	// 404 handler
 	mux.HandleFunc("/404", h.NotFoundHandler)
 
 	// Test routes for development (remove in production)
-	if os.Getenv("ENV") != "production" {
+	if cfg.Server.Env != "production" {
 		mux.HandleFunc("/test-panic", func(w http.ResponseWriter, r *http.Request) {
 			panic("This is a test panic for recovery middleware testing")
 		})
@@ -97,165 +380,224 @@ func main() {
 		})
 	}
 
-	// Wrap with recovery and logging middleware
-	// Recovery middleware is the outermost to catch panics from all layers
-	handler := recoveryMiddleware(loggingMiddleware(mux))
+	// Profiling routes (only when DEBUG is enabled, admin access required)
+	if cfg.Server.Debug {
+		mux.Handle("/debug/pprof/", admin.ThenFunc(pprof.Index))
+		mux.Handle("/debug/pprof/cmdline", admin.ThenFunc(pprof.Cmdline))
+		mux.Handle("/debug/pprof/profile", admin.ThenFunc(pprof.Profile))
+		mux.Handle("/debug/pprof/symbol", admin.ThenFunc(pprof.Symbol))
+		mux.Handle("/debug/pprof/trace", admin.ThenFunc(pprof.Trace))
+		slog.Info("debug profiling enabled at /debug/pprof/ (admin only)")
+	}
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Forward panics and server errors to the error tracking service, if any
+	reporter, err := errorreport.NewFromConfig(cfg.ErrorReporting, cfg.Server.Env)
+	if err != nil {
+		fatal("failed to set up error reporting", "err", err)
+	}
+	if closer, ok := reporter.(interface{ Close(context.Context) error }); ok {
+		defer func() {
+			closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer closeCancel()
+			if err := closer.Close(closeCtx); err != nil {
+				slog.Warn("unsent error reports dropped", "err", err)
+			}
+		}()
+	}
+
+	// Set up access logging
+	accessLogger, err := accesslog.NewFromConfig(cfg.AccessLog)
+	if err != nil {
+		fatal("failed to set up access log", "err", err)
 	}
 
-	log.Printf("🦁 Literary Lions Forum starting on port %s", port)
-	log.Printf("📖 Visit http://localhost:%s to start your literary journey!", port)
+	// Client addresses come from X-Forwarded-For only behind trusted proxies
+	clientIPs, err := clientip.NewResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		fatal("failed to set up trusted proxies", "err", err)
+	}
 
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatal("Server failed to start:", err)
+	// Wrap with client address, log context, recovery, access logging,
+	// compression and timeout middleware. The client address is resolved
+	// first so every later layer sees the same one. Log context comes next so
+	// every record about a request, including recovered panics, carries its
+	// request ID, user and handler; recovery wraps the rest to catch panics
+	// from all later layers. Compression sits inside the access log so it
+	// records the bytes sent, and is left out of the chain when disabled.
+	route := func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
 	}
-}
+	var compress middleware.Middleware
+	if cfg.Server.Compression {
+		compress = compression.Middleware
+	}
+	handler := middleware.New(
+		clientIPs.Middleware,
+		func(next http.Handler) http.Handler { return logging.Middleware(route, next) },
+		h.TrackUser,
+		recoveryMiddleware(h, reporter),
+		accessLogger.Middleware,
+		compress,
+		timeoutMiddleware(cfg.Server.RequestTimeout),
+	).Then(mux)
 
-// loadTemplates loads and parses all HTML templates
-func loadTemplates() (*template.Template, error) {
-	// Create a new template with custom functions
-	tmpl := template.New("").Funcs(template.FuncMap{
-		"slice": func(s string, start, end int) string {
-			if start < 0 {
-				start = 0
-			}
-			if end > len(s) {
-				end = len(s)
-			}
-			if start >= end {
-				return ""
-			}
-			return s[start:end]
-		},
-		"printf": func(format string, args ...interface{}) string {
-			return fmt.Sprintf(format, args...)
-		},
-		"add": func(a, b int) int {
-			return a + b
-		},
-		"dict": func(values ...interface{}) map[string]interface{} {
-			if len(values)%2 != 0 {
-				panic("dict requires an even number of arguments")
-			}
-			result := make(map[string]interface{})
-			for i := 0; i < len(values); i += 2 {
-				key, ok := values[i].(string)
-				if !ok {
-					panic("dict keys must be strings")
-				}
-				result[key] = values[i+1]
-			}
-			return result
-		},
-	})
+	// Start server
+	port := strconv.Itoa(cfg.Server.Port)
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+	servers := []*http.Server{server}
+	serverErr := make(chan error, 2)
 
-	// Collect all template files
-	var templateFiles []string
-	err := filepath.Walk("templates", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	if cfg.TLS.Enabled() {
+		certFile, keyFile, redirect := configureTLS(server, cfg)
+		go func() {
+			serverErr <- server.ListenAndServeTLS(certFile, keyFile)
+		}()
 
-		if strings.HasSuffix(path, ".html") {
-			templateFiles = append(templateFiles, path)
+		// Plain HTTP listener redirecting to HTTPS
+		if cfg.TLS.RedirectPort > 0 {
+			redirectServer := &http.Server{
+				Addr:              ":" + strconv.Itoa(cfg.TLS.RedirectPort),
+				Handler:           redirect,
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+				ReadTimeout:       cfg.Server.ReadTimeout,
+				WriteTimeout:      cfg.Server.WriteTimeout,
+				IdleTimeout:       cfg.Server.IdleTimeout,
+				MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+			}
+			servers = append(servers, redirectServer)
+			go func() {
+				serverErr <- redirectServer.ListenAndServe()
+			}()
 		}
 
-		return nil
-	})
+		slog.Info("🦁 Literary Lions Forum starting", "port", port, "https", true)
+		if cfg.TLS.Autocert() {
+			slog.Info("🔒 using Let's Encrypt certificates", "domains", strings.Join(cfg.TLS.Domains, ", "))
+		}
+	} else {
+		go func() {
+			serverErr <- server.ListenAndServe()
+		}()
 
-	if err != nil {
-		return nil, err
+		slog.Info("🦁 Literary Lions Forum starting", "port", port)
+		slog.Info("📖 Visit http://localhost:" + port + " to start your literary journey!")
 	}
 
-	// Parse all template files together
-	if len(templateFiles) > 0 {
-		tmpl, err = tmpl.ParseFiles(templateFiles...)
-		if err != nil {
-			return nil, err
+	select {
+	case err := <-serverErr:
+		fatal("server failed to start", "err", err)
+	case <-ctx.Done():
+		slog.Info("shutting down, waiting for in-flight requests", "timeout", cfg.Server.ShutdownTimeout)
+		// Stop the signal handler so a second Ctrl-C kills the process
+		cancel()
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer shutdownCancel()
+		for _, srv := range servers {
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				slog.Error("graceful shutdown incomplete", "addr", srv.Addr, "err", err)
+			}
 		}
 	}
-
-	return tmpl, nil
+	// Deferred calls now wait for background jobs and close the database
 }
 
-// loggingMiddleware logs HTTP requests
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		// Create a custom ResponseWriter to capture status code
-		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-
-		next.ServeHTTP(ww, r)
-
-		duration := time.Since(start)
-		log.Printf("%s %s %d %v %s", r.Method, r.URL.Path, ww.statusCode, duration, r.RemoteAddr)
-	})
+// fatal logs an error and exits. Deferred calls do not run, so it is only
+// used before the server has started.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
-// recoveryMiddleware handles panics and provides graceful error recovery
-func recoveryMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				// Log the panic with request details
-				log.Printf("panic recovered: %v | method: %s | path: %s | remote: %s",
-					err, r.Method, r.URL.Path, r.RemoteAddr)
-
-				// Try to render a nice error page, fallback to plain text
-				if renderError500(w, r) != nil {
-					// Fallback to plain text response if template rendering fails
-					if w.Header().Get("Content-Type") == "" {
-						w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-					}
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				}
+// timeoutMiddleware gives each request's context a deadline so database calls
+// made with it are cancelled when the client disconnects or the request runs
+// too long. Profiling endpoints are exempt since they stream for a while.
+func timeoutMiddleware(timeout time.Duration) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/debug/pprof/") {
+				next.ServeHTTP(w, r)
+				return
 			}
-		}()
-		next.ServeHTTP(w, r)
-	})
-}
 
-// renderError500 attempts to render the 500 error page with template
-func renderError500(w http.ResponseWriter, r *http.Request) error {
-	// Try to load the error template
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/500.html")
-	if err != nil {
-		return err
-	}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
 
-	// Create basic page data for the error page
-	data := struct {
-		Title       string
-		CurrentUser interface{} // We'll keep this simple to avoid potential panics
-	}{
-		Title:       "Internal Server Error",
-		CurrentUser: nil, // Keep it simple during error recovery
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
 	}
+}
 
-	// Set appropriate headers
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusInternalServerError)
+// recoveryMiddleware handles panics and provides graceful error recovery.
+// Panics and 5xx responses are also sent to reporter, with the request they
+// happened in.
+func recoveryMiddleware(h *handlers.Handler, reporter errorreport.Reporter) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				if err := recover(); err != nil {
+					// Log the panic with request details
+					slog.ErrorContext(r.Context(), "panic recovered",
+						"panic", err, "method", r.Method, "path", r.URL.Path, "remote", clientip.FromRequest(r))
+
+					event := errorreport.NewEvent(r, errorreport.LevelFatal, fmt.Sprint(err))
+					event.Status = http.StatusInternalServerError
+					event.Stack = errorreport.Stack(1)
+					reporter.Report(event)
+
+					h.RenderError(w, r, http.StatusInternalServerError, "")
+					return
+				}
 
-	// Execute the template
-	return tmpl.ExecuteTemplate(w, "base", data)
+				if sw.status >= 500 {
+					// Handlers log the cause before answering with an error
+					message := logging.RequestInfo(r.Context()).LastError
+					if message == "" {
+						message = http.StatusText(sw.status)
+					}
+					event := errorreport.NewEvent(r, errorreport.LevelError, message)
+					event.Status = sw.status
+					reporter.Report(event)
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
 }
 
-// responseWriter wraps http.ResponseWriter to capture status code
-type responseWriter struct {
+// statusWriter records the status code of a response
+type statusWriter struct {
 	http.ResponseWriter
-	statusCode int
+	status int
 }
 
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
 }
 
-func (rw *responseWriter) Write(b []byte) (int, error) {
-	return rw.ResponseWriter.Write(b)
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers (such as pprof) flush through the wrapper
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
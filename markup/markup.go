@@ -0,0 +1,322 @@
+// Package markup renders the text of posts and comments, written in a
+// small subset of Markdown, to HTML:
+//
+//   - paragraphs, separated by blank lines, with single line breaks kept
+//   - headings: "# ", "## " and "### "
+//   - quotes: lines starting with "> "
+//   - lists: lines starting with "- " or "* ", or "1. " for numbered ones
+//   - code blocks between lines of "```"
+//   - **bold**, *italic* or _italic_, `code` and [links](https://...)
+//   - bare http and https URLs, which become links
+//
+// A backslash before a markup character shows it as is. The output is
+// safe by construction: all text is escaped, only the tags above are
+// written, and links may only point to http, https and site-relative URLs.
+package markup
+
+import (
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Render renders text to HTML
+func Render(text string) template.HTML {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(text, "\n"))
+	return template.HTML(b.String())
+}
+
+// renderBlocks renders lines of text as a sequence of block elements
+func renderBlocks(b *strings.Builder, lines []string) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		b.WriteString("<p>")
+		for i, line := range paragraph {
+			if i > 0 {
+				b.WriteString("<br>\n")
+			}
+			renderInline(b, line)
+		}
+		b.WriteString("</p>\n")
+		paragraph = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>")
+			b.WriteString(template.HTMLEscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>\n")
+
+		case heading(trimmed) > 0:
+			flush()
+			level := heading(trimmed)
+			// Posts sit below the page's own headings, so "#" is an h3
+			tag := "h" + strconv.Itoa(level+2)
+			b.WriteString("<" + tag + ">")
+			renderInline(b, strings.TrimSpace(trimmed[level:]))
+			b.WriteString("</" + tag + ">\n")
+
+		case isQuote(trimmed):
+			flush()
+			var quoted []string
+			for ; i < len(lines) && isQuote(strings.TrimSpace(lines[i])); i++ {
+				quoted = append(quoted, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted)
+			b.WriteString("</blockquote>\n")
+
+		case listItem(trimmed) != "":
+			flush()
+			kind := listItem(trimmed)
+			b.WriteString("<" + kind + ">\n")
+			for ; i < len(lines) && listItem(strings.TrimSpace(lines[i])) == kind; i++ {
+				b.WriteString("<li>")
+				renderInline(b, listText(strings.TrimSpace(lines[i])))
+				b.WriteString("</li>\n")
+			}
+			i--
+			b.WriteString("</" + kind + ">\n")
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+}
+
+// heading returns the level of a heading line, from 1 to 3, or 0 if the
+// line isn't one
+func heading(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 3 || level == len(line) || line[level] != ' ' {
+		return 0
+	}
+	return level
+}
+
+// isQuote reports whether a line is part of a quote
+func isQuote(line string) bool {
+	return line == ">" || strings.HasPrefix(line, "> ")
+}
+
+// listItem returns the list tag, "ul" or "ol", of a list item line, or ""
+// if the line isn't one
+func listItem(line string) string {
+	if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") {
+		return "ul"
+	}
+	digits := 0
+	for digits < len(line) && line[digits] >= '0' && line[digits] <= '9' {
+		digits++
+	}
+	if digits > 0 && strings.HasPrefix(line[digits:], ". ") {
+		return "ol"
+	}
+	return ""
+}
+
+// listText returns the text of a list item line, without its marker
+func listText(line string) string {
+	_, text, _ := strings.Cut(line, " ")
+	return strings.TrimSpace(text)
+}
+
+// escapable are the characters a backslash shows as is
+const escapable = "\\`*_[]()#>-+.!"
+
+// specials are the characters that may start inline markup, including the
+// h of a bare URL
+const specials = "\\`[*_hH"
+
+// urlStops are the characters that end a bare URL, besides whitespace
+const urlStops = "<>\"`"
+
+// renderInline renders the emphasis, code and links in a line of text,
+// escaping everything else
+func renderInline(b *strings.Builder, text string) {
+	renderSpan(b, text, true)
+}
+
+// renderSpan renders inline markup like renderInline, turning bare URLs into
+// links only if autolink is set, so none are nested inside a link's label
+func renderSpan(b *strings.Builder, text string, autolink bool) {
+	for i := 0; i < len(text); {
+		c := text[i]
+		rest := text[i:]
+
+		switch {
+		case c == '\\' && len(rest) > 1 && strings.IndexByte(escapable, rest[1]) >= 0:
+			b.WriteString(template.HTMLEscapeString(rest[1:2]))
+			i += 2
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				b.WriteString("<code>")
+				b.WriteString(template.HTMLEscapeString(rest[1 : end+1]))
+				b.WriteString("</code>")
+				i += end + 2
+				continue
+			}
+
+		case c == '[':
+			if label, url, n, ok := link(rest); ok {
+				openLink(b, url)
+				renderSpan(b, label, false)
+				b.WriteString("</a>")
+				i += n
+				continue
+			}
+
+		case c == 'h' || c == 'H':
+			// A URL starts a word, so the end of "xhttp://" isn't one
+			if !autolink || i > 0 && isWordByte(text[i-1]) {
+				break
+			}
+			if url := bareURL(rest); url != "" {
+				openLink(b, url)
+				b.WriteString(template.HTMLEscapeString(url))
+				b.WriteString("</a>")
+				i += len(url)
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				b.WriteString("<strong>")
+				renderSpan(b, rest[2:end+2], autolink)
+				b.WriteString("</strong>")
+				i += end + 4
+				continue
+			}
+
+		case c == '*' || c == '_':
+			// Underscores inside words, as in snake_case, aren't emphasis
+			if c == '_' && i > 0 && isWordByte(text[i-1]) {
+				break
+			}
+			end := strings.IndexByte(rest[1:], c)
+			if end > 0 && rest[1] != ' ' && rest[end] != ' ' &&
+				(c == '*' || end+2 >= len(rest) || !isWordByte(rest[end+2])) {
+				b.WriteString("<em>")
+				renderSpan(b, rest[1:end+1], autolink)
+				b.WriteString("</em>")
+				i += end + 2
+				continue
+			}
+		}
+
+		// Copy the plain text up to the next character that may start
+		// markup
+		next := strings.IndexAny(rest[1:], specials)
+		if next < 0 {
+			next = len(rest) - 1
+		}
+		b.WriteString(template.HTMLEscapeString(rest[:next+1]))
+		i += next + 1
+	}
+}
+
+// openLink writes the opening tag of a link to url. Links to other sites
+// open in a new tab and, being written by members, are marked so search
+// engines don't credit them.
+func openLink(b *strings.Builder, url string) {
+	b.WriteString(`<a href="`)
+	b.WriteString(template.HTMLEscapeString(url))
+	b.WriteString(`" rel="nofollow ugc noopener"`)
+	if !strings.HasPrefix(url, "/") {
+		b.WriteString(` target="_blank"`)
+	}
+	b.WriteString(">")
+}
+
+// bareURL returns the http or https URL at the start of text, or "" if there
+// is none. Punctuation ending a sentence, and a closing parenthesis without
+// an opening one in the URL, as in "(see https://example.com)", are left
+// out of it.
+func bareURL(text string) string {
+	lower := strings.ToLower(text)
+	var scheme int
+	switch {
+	case strings.HasPrefix(lower, "https://"):
+		scheme = len("https://")
+	case strings.HasPrefix(lower, "http://"):
+		scheme = len("http://")
+	default:
+		return ""
+	}
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(urlStops, r)
+	})
+	if end < 0 {
+		end = len(text)
+	}
+	url := text[:end]
+	for len(url) > scheme {
+		last := url[len(url)-1]
+		if strings.IndexByte(".,;:!?'*_", last) >= 0 ||
+			last == ')' && strings.Count(url, "(") < strings.Count(url, ")") {
+			url = url[:len(url)-1]
+			continue
+		}
+		break
+	}
+	if len(url) == scheme || url[scheme] == '/' {
+		return ""
+	}
+	return url
+}
+
+// link parses a "[label](url)" link at the start of text, returning its
+// parts and length. Links to other schemes, like javascript:, aren't links.
+func link(text string) (label, url string, n int, ok bool) {
+	mid := strings.Index(text, "](")
+	if mid < 0 {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(text[mid:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	label = text[1:mid]
+	url = strings.TrimSpace(text[mid+2 : mid+end])
+	if label == "" || strings.ContainsAny(url, " \t") || !safeURL(url) {
+		return "", "", 0, false
+	}
+	return label, url, mid + end + 1, true
+}
+
+// safeURL reports whether a link may point to url
+func safeURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") ||
+		strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//") && !strings.HasPrefix(url, "/\\")
+}
+
+// isWordByte reports whether c is an ASCII letter or digit
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,43 @@
+// Package middleware composes HTTP middleware into chains, so each route can
+// declare the layers it goes through (authentication, rate limiting and so
+// on) in one place instead of every handler checking for itself.
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler with behavior run around it, such as checking
+// the request first or recording the response
+type Middleware func(http.Handler) http.Handler
+
+// Chain is a list of middleware applied in order: the first one sees the
+// request first and the response last
+type Chain []Middleware
+
+// New returns a chain of the given middleware. Nil entries are skipped when
+// the chain is applied, so optional layers can be left out in place.
+func New(middleware ...Middleware) Chain {
+	return append(Chain(nil), middleware...)
+}
+
+// Append returns a new chain with more middleware run after c's. c itself is
+// not changed, so a shared base chain can be extended per route.
+func (c Chain) Append(middleware ...Middleware) Chain {
+	chain := make(Chain, 0, len(c)+len(middleware))
+	chain = append(chain, c...)
+	return append(chain, middleware...)
+}
+
+// Then returns h wrapped in every middleware of the chain
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i] != nil {
+			h = c[i](h)
+		}
+	}
+	return h
+}
+
+// ThenFunc is Then for a handler function
+func (c Chain) ThenFunc(f http.HandlerFunc) http.Handler {
+	return c.Then(f)
+}
@@ -1,20 +1,32 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
 // User represents a registered user
 type User struct {
-	ID             int       `json:"id"`
-	Username       string    `json:"username"`
-	Email          string    `json:"email"`
-	Password       string    `json:"-"` // Don't include in JSON
-	ProfilePicture string    `json:"profile_picture,omitempty"`
-	Signature      string    `json:"signature,omitempty"`
-	Role           string    `json:"role"`   // "user" or "admin"
-	Status         string    `json:"status"` // "active" or "suspended"
-	CreatedAt      time.Time `json:"created_at"`
+	ID               int       `json:"id"`
+	Username         string    `json:"username"`
+	Email            string    `json:"email"`
+	Password         string    `json:"-"` // Don't include in JSON
+	ProfilePicture   string    `json:"profile_picture,omitempty"`
+	Signature        string    `json:"signature,omitempty"`
+	Bio              string    `json:"bio,omitempty"`
+	Location         string    `json:"location,omitempty"`
+	Website          string    `json:"website,omitempty"`
+	FavoriteGenres   string    `json:"favorite_genres,omitempty"` // comma-separated
+	FavoriteBook     string    `json:"favorite_book,omitempty"`
+	Role             string    `json:"role"`                        // "user" or "admin"
+	Status           string    `json:"status"`                      // "active", "suspended" or "deactivated"
+	TrustLevel       string    `json:"trust_level"`                 // TrustNew, TrustMember or TrustRegular
+	SuspensionReason string    `json:"suspension_reason,omitempty"` // Why an admin suspended them, if they said; only GetAllUsers fills it in
+	CreatedAt        time.Time `json:"created_at"`
+	Timezone         string    `json:"-"` // IANA time zone from their preferences; only GetUserByID fills it in
+	Language         string    `json:"-"` // Locale from their preferences, or empty; only GetUserByID fills it in
+	Theme            string    `json:"-"` // Color theme from their preferences; only GetUserByID fills it in
+	Impersonator     *User     `json:"-"` // The admin viewing the forum as this user, if any; set by the handlers
 }
 
 // IsAdmin checks if user has admin role
@@ -22,46 +34,140 @@ func (u *User) IsAdmin() bool {
 	return u.Role == "admin"
 }
 
+// Genres returns the user's favorite genres as a list
+func (u *User) Genres() []string {
+	var genres []string
+	for _, genre := range strings.Split(u.FavoriteGenres, ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			genres = append(genres, genre)
+		}
+	}
+	return genres
+}
+
+// HasProfileDetails reports whether any of the optional profile fields are set
+func (u *User) HasProfileDetails() bool {
+	return u.Bio != "" || u.Location != "" || u.Website != "" || u.FavoriteGenres != "" || u.FavoriteBook != ""
+}
+
+// Trust levels, from least to most trusted. Members start out new and are
+// promoted as their account ages and they contribute.
+const (
+	TrustNew     = "new"
+	TrustMember  = "member"
+	TrustRegular = "regular"
+)
+
+// trustRanks orders the trust levels
+var trustRanks = map[string]int{TrustNew: 0, TrustMember: 1, TrustRegular: 2}
+
+// Trusted reports whether user has reached at least the given trust level.
+// Admins are trusted at every level.
+func (u *User) Trusted(level string) bool {
+	return u.IsAdmin() || trustRanks[u.TrustLevel] >= trustRanks[level]
+}
+
 // IsSuspended checks if user is suspended
 func (u *User) IsSuspended() bool {
 	return u.Status == "suspended"
 }
 
+// IsDeactivated checks if user has deactivated their account
+func (u *User) IsDeactivated() bool {
+	return u.Status == "deactivated"
+}
+
 // Category represents a post category
 type Category struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Icon        string     `json:"icon,omitempty"`      // Emoji shown before the name, if any
+	Color       string     `json:"color,omitempty"`     // #rrggbb color of the category's chips, if any
+	SortOrder   int        `json:"sort_order"`          // Position in category lists, lowest first
+	ParentID    *int       `json:"parent_id,omitempty"` // The category this one is a subcategory of, if any
+	Anonymous   bool       `json:"anonymous,omitempty"` // Posts and comments in it are shown as by AnonymousName
+	Children    []Category `json:"children,omitempty"`  // Subcategories, when loaded as a tree
+	Depth       int        `json:"-"`                   // Nesting level from 0 for top-level categories; set by FlattenCategories
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
+// IsSubcategoryOf reports whether the category is directly under the one
+// with the given ID
+func (c Category) IsSubcategoryOf(id int) bool {
+	return c.ParentID != nil && *c.ParentID == id
+}
+
+// FlattenCategories lists a category tree depth-first, each category
+// followed by its subcategories, with their Depth set and Children cleared
+func FlattenCategories(tree []Category) []Category {
+	var flat []Category
+	var walk func(level []Category, depth int)
+	walk = func(level []Category, depth int) {
+		for _, category := range level {
+			children := category.Children
+			category.Depth = depth
+			category.Children = nil
+			flat = append(flat, category)
+			walk(children, depth+1)
+		}
+	}
+	walk(tree, 0)
+	return flat
+}
+
+// AnonymousName is shown instead of the author of posts and comments in
+// anonymous categories
+const AnonymousName = "Anonymous Lion"
+
 // Post represents a forum post
 type Post struct {
-	ID            int       `json:"id"`
-	Title         string    `json:"title"`
-	Content       string    `json:"content"`
-	UserID        int       `json:"user_id"`
-	CategoryID    int       `json:"category_id"`
-	Username      string    `json:"username"`      // For display
-	CategoryName  string    `json:"category_name"` // For display
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
-	LikesCount    int       `json:"likes_count"`
-	DislikesCount int       `json:"dislikes_count"`
-	CommentsCount int       `json:"comments_count"`
+	ID            int        `json:"id"`
+	Title         string     `json:"title"`
+	Content       string     `json:"content"`
+	UserID        int        `json:"user_id"`
+	CategoryID    int        `json:"category_id"`
+	Username      string     `json:"username"`      // For display
+	CategoryName  string     `json:"category_name"` // For display
+	CategoryIcon  string     `json:"-"`             // For display
+	CategoryColor string     `json:"-"`             // For display
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	LikesCount    int        `json:"likes_count"`
+	DislikesCount int        `json:"dislikes_count"`
+	CommentsCount int        `json:"comments_count"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"` // Set for archived threads; only loaded with a single post
+	BookID        *int       `json:"book_id,omitempty"`     // The book the post is about, if any; only loaded with a single post
+	BookTitle     string     `json:"book_title,omitempty"`  // For display
+	Followers     int        `json:"followers,omitempty"`   // Members following the thread; only loaded with a single post
+	Bookmarks     int        `json:"bookmarks,omitempty"`   // Members who bookmarked the post; only loaded with a single post
+	Anonymous     bool       `json:"-"`                     // Set for posts in anonymous categories; only loaded with a single post
+	AuthorHidden  bool       `json:"-"`                     // Set when Username is AnonymousName rather than the author's
+	Collapsed     bool       `json:"-"`                     // Set when the viewer has blocked the author
+	AuthorReading *Book      `json:"-"`                     // The book the author is currently reading, for display
+	AuthorTitle   string     `json:"-"`                     // The author's title, for display
+	LinkedBooks   []Book     `json:"-"`                     // Books the post links to, shown as cards under it
 }
 
 // Comment represents a comment on a post
 type Comment struct {
-	ID            int       `json:"id"`
-	Content       string    `json:"content"`
-	UserID        int       `json:"user_id"`
-	PostID        int       `json:"post_id"`
-	ParentID      *int      `json:"parent_id,omitempty"` // For replies - nil for top-level comments
-	Username      string    `json:"username"`            // For display
-	CreatedAt     time.Time `json:"created_at"`
-	LikesCount    int       `json:"likes_count"`
-	DislikesCount int       `json:"dislikes_count"`
+	ID            int        `json:"id"`
+	Content       string     `json:"content"`
+	UserID        int        `json:"user_id"`
+	PostID        int        `json:"post_id"`
+	ParentID      *int       `json:"parent_id,omitempty"` // For replies - nil for top-level comments
+	Username      string     `json:"username"`            // For display
+	CreatedAt     time.Time  `json:"created_at"`
+	EditedAt      *time.Time `json:"edited_at,omitempty"` // Set once the comment has been edited
+	Depth         int        `json:"depth"`               // Nesting level, 0 for top-level comments
+	LikesCount    int        `json:"likes_count"`
+	DislikesCount int        `json:"dislikes_count"`
+	MergedFrom    *int       `json:"merged_from,omitempty"` // The thread the comment was moved from when it was merged into this one
+	MergedTitle   string     `json:"-"`                     // The title of the MergedFrom thread, for display
+	AuthorHidden  bool       `json:"-"`                     // Set when Username is AnonymousName rather than the author's
+	Collapsed     bool       `json:"-"`                     // Set when the viewer has blocked the author
+	AuthorReading *Book      `json:"-"`                     // The book the author is currently reading, for display
+	AuthorTitle   string     `json:"-"`                     // The author's title, for display
 }
 
 // CommentTree represents a comment with its replies for hierarchical display
@@ -70,6 +176,13 @@ type CommentTree struct {
 	Replies []CommentTree `json:"replies,omitempty"`
 }
 
+// FlatComment is a comment in the flat view of a thread, which lists
+// replies after the comments before them rather than under their parent
+type FlatComment struct {
+	CommentTree        // Without replies, which are listed on their own
+	ReplyTo     string `json:"reply_to,omitempty"` // Username of the author of the comment it replies to
+}
+
 // Session represents a user session
 type Session struct {
 	ID        int       `json:"id"`
@@ -77,6 +190,17 @@ type Session struct {
 	UUID      string    `json:"uuid"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// ImpersonatorID is the admin viewing the forum as UserID, for sessions
+	// started from the admin panel; nil otherwise
+	ImpersonatorID *int `json:"impersonator_id,omitempty"`
+}
+
+// Flash is a message shown once, on the next page a member or visitor sees,
+// e.g. to confirm an action that redirected them
+type Flash struct {
+	Kind    string `json:"kind"` // "success" or "error"
+	Message string `json:"message"`
 }
 
 // PostLike represents a like/dislike on a post
@@ -112,3 +236,320 @@ type CommentWithDetails struct {
 	UserLiked    bool `json:"user_liked"`
 	UserDisliked bool `json:"user_disliked"`
 }
+
+// Book represents a book that users can shelve, rate, and discuss
+type Book struct {
+	ID            int       `json:"id"`
+	Title         string    `json:"title"`
+	Author        string    `json:"author"`
+	ISBN          string    `json:"isbn,omitempty"`
+	ISBN13        string    `json:"isbn13,omitempty"`
+	GoodreadsID   string    `json:"goodreads_id,omitempty"`
+	PublishedYear int       `json:"published_year,omitempty"`
+	CoverURL      string    `json:"cover_url,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// BookLink is a link to a book's page on another site, with the book found
+// there. Book is nil when the page held no book.
+type BookLink struct {
+	URL       string
+	Book      *Book
+	CheckedAt time.Time
+}
+
+// ShelfEntry represents a book on a user's reading list
+type ShelfEntry struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	BookID     int        `json:"book_id"`
+	Shelf      string     `json:"shelf"`  // "read", "currently-reading", "to-read" or a custom shelf
+	Rating     int        `json:"rating"` // 0 for unrated, otherwise 1-5
+	DateRead   *time.Time `json:"date_read,omitempty"`
+	BookTitle  string     `json:"book_title"`  // For display
+	BookAuthor string     `json:"book_author"` // For display
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ReviewDraft represents an unpublished book review
+type ReviewDraft struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	BookID    int       `json:"book_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ScheduledPost represents a post waiting to be published at a later time
+type ScheduledPost struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	CategoryID   int       `json:"category_id"`
+	BookID       *int      `json:"book_id,omitempty"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content"`
+	PublishAt    time.Time `json:"publish_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	CategoryName string    `json:"category_name"` // For display
+}
+
+// ModerationReason is a canned reason admins pick from when removing
+// content or suspending members
+type ModerationReason struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+// HeldContent represents a post or comment held for a moderator because it
+// looked like spam
+type HeldContent struct {
+	ID           int       `json:"id"`
+	Kind         string    `json:"kind"` // "post" or "comment"
+	UserID       int       `json:"user_id"`
+	Username     string    `json:"username"`                // For display
+	CategoryID   int       `json:"category_id,omitempty"`   // For posts
+	CategoryName string    `json:"category_name,omitempty"` // For display
+	BookID       *int      `json:"book_id,omitempty"`       // For posts about a book
+	PostID       int       `json:"post_id,omitempty"`       // For comments
+	PostTitle    string    `json:"post_title,omitempty"`    // For display
+	ParentID     *int      `json:"parent_id,omitempty"`     // For replies to comments
+	Title        string    `json:"title,omitempty"`         // For posts
+	Content      string    `json:"content"`
+	Reason       string    `json:"reason"` // Why it was held
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TrashItem represents a trashed post or comment awaiting restore or purge
+type TrashItem struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	PostTitle string    `json:"post_title"`
+	Content   string    `json:"content"`
+	Username  string    `json:"username"` // Author
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by"`       // Username of whoever trashed it
+	Reason    string    `json:"reason,omitempty"` // Why a moderator trashed it, if they said
+}
+
+// Activity is an entry in a user's public activity timeline
+type Activity struct {
+	Kind      string    `json:"kind"` // "post" or "comment"
+	ID        int       `json:"id"`   // ID of the post or comment
+	PostID    int       `json:"post_id"`
+	PostTitle string    `json:"post_title"` // Post the activity happened on
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditEntry is a security-relevant or moderation action recorded in the
+// audit log
+type AuditEntry struct {
+	ID           int       `json:"id"`
+	ActorID      *int      `json:"actor_id,omitempty"`       // Who did it; nil for the system
+	ActorName    string    `json:"actor_name,omitempty"`     // For display; empty once the account is deleted
+	Action       string    `json:"action"`                   // What was done, such as "upload.infected"
+	TargetUserID *int      `json:"target_user_id,omitempty"` // The member it was done to, if any
+	TargetName   string    `json:"target_name,omitempty"`    // For display
+	Details      string    `json:"details,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Conversation is a private conversation as seen by one of its participants
+type Conversation struct {
+	ID            int       `json:"id"`
+	OtherUserID   int       `json:"other_user_id"`
+	OtherUsername string    `json:"other_username"` // The participant the conversation is with
+	LastMessage   string    `json:"last_message"`
+	UpdatedAt     time.Time `json:"updated_at"` // Time of the latest message
+	UnreadCount   int       `json:"unread_count"`
+}
+
+// Message is a private message in a conversation
+type Message struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	SenderID       int       `json:"sender_id"`
+	SenderUsername string    `json:"sender_username"` // For display
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// LeaderboardEntry is a user's place on a leaderboard
+type LeaderboardEntry struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Score    int    `json:"score"`
+}
+
+// Leaderboard ranks the top contributors over a time window
+type Leaderboard struct {
+	Window     string             `json:"window"`     // "week", "month" or "all"
+	Posts      []LeaderboardEntry `json:"posts"`      // Most posts written
+	Likes      []LeaderboardEntry `json:"likes"`      // Most likes received on posts and comments
+	Reputation []LeaderboardEntry `json:"reputation"` // Highest reputation, see GetLeaderboard
+}
+
+// CategoryStats summarizes the activity in a category, including its
+// subcategories
+type CategoryStats struct {
+	CategoryID int                `json:"category_id"`
+	Posts      int                `json:"posts"`
+	Comments   int                `json:"comments"`
+	TopMembers []LeaderboardEntry `json:"top_members"` // Most posts and comments written
+	Daily      []int              `json:"daily"`       // Posts and comments written each recent day, oldest first
+}
+
+// ArchiveMonth is a month in the post archive and how many posts were
+// started in it
+type ArchiveMonth struct {
+	Year  int `json:"year"`
+	Month int `json:"month"` // 1 for January
+	Posts int `json:"posts"`
+}
+
+// Name returns the English name of the month, such as "January"
+func (m ArchiveMonth) Name() string {
+	return time.Month(m.Month).String()
+}
+
+// SiteStats summarizes the activity on the whole forum
+type SiteStats struct {
+	Members         int       `json:"members"`
+	Posts           int       `json:"posts"`
+	Comments        int       `json:"comments"`
+	NewestMember    string    `json:"newest_member,omitempty"` // Username of the member who joined last, if any
+	BusiestDay      time.Time `json:"busiest_day"`             // The day (in UTC) the most posts and comments were written on; zero if none were
+	BusiestDayPosts int       `json:"busiest_day_posts"`       // Posts and comments written on BusiestDay
+	DailyPosts      []int     `json:"daily_posts"`             // Posts written each recent day, oldest first
+	DailyComments   []int     `json:"daily_comments"`          // Comments written each recent day, oldest first
+	DailyMembers    []int     `json:"daily_members"`           // Members who joined each recent day, oldest first
+}
+
+// Quote is a favorite passage from a book shared by a member
+type Quote struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"` // For display
+	BookID     int       `json:"book_id"`
+	BookTitle  string    `json:"book_title"`  // For display
+	BookAuthor string    `json:"book_author"` // For display
+	Content    string    `json:"content"`
+	Page       string    `json:"page,omitempty"` // As the member wrote it, e.g. "42" or "xii"
+	LikesCount int       `json:"likes_count"`
+	UserLiked  bool      `json:"user_liked"` // Whether the viewer liked the quote
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Preferences are a member's settings
+type Preferences struct {
+	UserID        int    `json:"user_id"`
+	PostsPerPage  int    `json:"posts_per_page"`  // Posts on each page of the home page
+	PostSort      string `json:"post_sort"`       // Default home page sort: "date", "likes", "comments" or "title"
+	PostSortOrder string `json:"post_sort_order"` // "asc" or "desc"
+	CommentSort   string `json:"comment_sort"`    // "oldest", "newest" or "top"
+	CommentView   string `json:"comment_view"`    // "tree" to nest replies, or "flat" to list comments in the order they were written
+	EmailReplies  bool   `json:"email_replies"`   // Email when someone replies to their posts or comments
+	EmailMessages bool   `json:"email_messages"`  // Email when they get a private message
+	HideOnline    bool   `json:"hide_online"`     // Keep others from seeing when they're online
+	WallClosed    bool   `json:"wall_closed"`     // Stop others leaving messages on their profile wall
+	YearPublic    bool   `json:"year_public"`     // Let anyone see their Year in Books pages
+	Timezone      string `json:"timezone"`        // IANA time zone their dates and times are shown in
+	Language      string `json:"language"`        // Locale they read the forum in; empty to follow their browser
+	Theme         string `json:"theme"`           // "auto" to follow their system's light or dark mode, "light" or "dark"
+}
+
+// DefaultPreferences are the settings of members who never changed them
+func DefaultPreferences(userID int) *Preferences {
+	return &Preferences{
+		UserID:        userID,
+		PostsPerPage:  20,
+		PostSort:      "date",
+		PostSortOrder: "desc",
+		CommentSort:   "oldest",
+		CommentView:   "tree",
+		Timezone:      "UTC",
+		Theme:         "auto",
+	}
+}
+
+// UsernameChange is a username a member used before changing it
+type UsernameChange struct {
+	Username  string    `json:"username"` // The old name
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// WallPost is a message a member left on another member's profile wall
+type WallPost struct {
+	ID             int       `json:"id"`
+	ProfileUserID  int       `json:"profile_user_id"` // Whose wall it is on
+	AuthorID       int       `json:"author_id"`
+	AuthorUsername string    `json:"author_username"` // For display
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// UserTitle is a step on the ladder of titles members earn by posting and
+// staying a member
+type UserTitle struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	MinPosts int    `json:"min_posts"` // Posts the member must have written
+	MinDays  int    `json:"min_days"`  // Days the member must have been a member
+}
+
+// EarnedTitle returns the highest title on the ladder a member with the
+// given number of posts and days of membership has earned, or "" for none.
+// Titles are ranked by their posts thresholds, then their days thresholds.
+func EarnedTitle(ladder []UserTitle, posts, days int) string {
+	var best *UserTitle
+	for i := range ladder {
+		title := &ladder[i]
+		if posts < title.MinPosts || days < title.MinDays {
+			continue
+		}
+		if best == nil || title.MinPosts > best.MinPosts || (title.MinPosts == best.MinPosts && title.MinDays > best.MinDays) {
+			best = title
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.Name
+}
+
+// StaffTitle is the custom title of a staff member
+type StaffTitle struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Title    string `json:"title"` // Empty when they show their earned title
+}
+
+// YearInBooks sums up what a member did on the forum in one year
+type YearInBooks struct {
+	Year             int          `json:"year"`
+	Posts            int          `json:"posts"`
+	Comments         int          `json:"comments"`
+	LikesGiven       int          `json:"likes_given"`            // On posts and comments
+	LikesReceived    int          `json:"likes_received"`         // On their posts and comments
+	BooksRead        []ShelfEntry `json:"books_read"`             // Oldest first
+	TopCategory      string       `json:"top_category,omitempty"` // The category they posted in most; empty when they didn't post
+	TopCategoryPosts int          `json:"top_category_posts,omitempty"`
+}
+
+// EmailChange is a change of a member's email address waiting for them to
+// confirm the new address
+type EmailChange struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	NewEmail  string    `json:"new_email"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PageVersion identifies the state of what a page shows, for HTTP caching.
+// Tag changes whenever it does, including changes such as votes that leave
+// no timestamp.
+type PageVersion struct {
+	Tag string
+}
@@ -0,0 +1,152 @@
+// Package openlibrary looks up books in the Open Library catalogue
+// (https://openlibrary.org), so members can name a book by its title or
+// ISBN and have the rest of its details filled in.
+package openlibrary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"literary-lions/config"
+	"literary-lions/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// userAgent identifies the forum to Open Library, which asks API clients to
+// name themselves
+const userAgent = "LiteraryLions/1.0 (+https://github.com/joro11111/forum)"
+
+// coverURL is the address of a medium-sized cover image, by cover ID
+const coverURL = "https://covers.openlibrary.org/b/id/%d-M.jpg"
+
+// ErrNotFound is returned by Lookup when no book matches
+var ErrNotFound = errors.New("book not found")
+
+// Client searches an Open Library server
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// New creates a client for the Open Library server at baseURL, giving up on
+// requests after timeout
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// NewFromConfig creates the client configured in cfg
+func NewFromConfig(cfg config.OpenLibrary) *Client {
+	return New(cfg.URL, cfg.Timeout)
+}
+
+// CleanISBN strips hyphens and spaces from s and reports whether what is
+// left is an ISBN-10 or ISBN-13. Check digits are not verified.
+func CleanISBN(s string) (string, bool) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+	for i, c := range isbn {
+		if (c < '0' || c > '9') && !(c == 'X' && i == 9 && len(isbn) == 10) {
+			return "", false
+		}
+	}
+	return isbn, len(isbn) == 10 || len(isbn) == 13
+}
+
+// searchResponse is the part of a search.json response we use
+type searchResponse struct {
+	Docs []struct {
+		Title            string   `json:"title"`
+		AuthorName       []string `json:"author_name"`
+		FirstPublishYear int      `json:"first_publish_year"`
+		CoverID          int      `json:"cover_i"`
+	} `json:"docs"`
+}
+
+// Lookup finds the best match for query, which is either an ISBN or a
+// title, optionally narrowed down by author. The returned book has no ID;
+// its ISBN is set only when query was one.
+func (c *Client) Lookup(ctx context.Context, query, author string) (*models.Book, error) {
+	params := url.Values{}
+	isbn, isISBN := CleanISBN(query)
+	if isISBN {
+		params.Set("isbn", isbn)
+	} else {
+		params.Set("title", strings.TrimSpace(query))
+		if author = strings.TrimSpace(author); author != "" {
+			params.Set("author", author)
+		}
+	}
+
+	book, err := c.search(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if isISBN {
+		if len(isbn) == 13 {
+			book.ISBN13 = isbn
+		} else {
+			book.ISBN = isbn
+		}
+	}
+	return book, nil
+}
+
+// LookupKey finds the book with an Open Library key, the last part of its
+// page's address: a work, like OL45804W, or an edition, like OL7353617M.
+// The returned book has no ID.
+func (c *Client) LookupKey(ctx context.Context, key string) (*models.Book, error) {
+	switch {
+	case strings.HasSuffix(key, "W"):
+		return c.search(ctx, url.Values{"q": {"key:/works/" + key}})
+	case strings.HasSuffix(key, "M"):
+		return c.search(ctx, url.Values{"q": {"edition_key:" + key}})
+	}
+	return nil, ErrNotFound
+}
+
+// search returns the first book matching the search params
+func (c *Client) search(ctx context.Context, params url.Values) (*models.Book, error) {
+	params.Set("fields", "title,author_name,first_publish_year,cover_i")
+	params.Set("limit", "1")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/search.json?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("open library search returned %s", resp.Status)
+	}
+
+	var result searchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode open library search: %v", err)
+	}
+	if len(result.Docs) == 0 || result.Docs[0].Title == "" {
+		return nil, ErrNotFound
+	}
+
+	doc := result.Docs[0]
+	book := &models.Book{
+		Title:         doc.Title,
+		Author:        strings.Join(doc.AuthorName, ", "),
+		PublishedYear: doc.FirstPublishYear,
+	}
+	if doc.CoverID > 0 {
+		book.CoverURL = fmt.Sprintf(coverURL, doc.CoverID)
+	}
+	return book, nil
+}
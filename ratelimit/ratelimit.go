@@ -0,0 +1,127 @@
+// Package ratelimit limits how often clients may use a group of routes with
+// token buckets. Each client, such as a user or an address, gets its own
+// bucket that refills at a steady rate; a request takes one token and is
+// refused with 429 Too Many Requests when the bucket is empty.
+package ratelimit
+
+import (
+	"fmt"
+	"literary-lions/config"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are
+// dropped, so clients that went away do not use memory forever
+const sweepInterval = time.Minute
+
+// Limiter keeps one token bucket per client key
+type Limiter struct {
+	rate  float64 // tokens added per second
+	burst float64 // most tokens a bucket holds
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New creates a limiter from a configured limit, or returns nil when the
+// limit leaves its routes unlimited. A nil limiter allows every request.
+func New(limit config.Limit) *Limiter {
+	if limit.Requests <= 0 {
+		return nil
+	}
+	return &Limiter{
+		rate:    float64(limit.Requests) / limit.Per.Seconds(),
+		burst:   float64(limit.Burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it returns
+// false and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+		b.updated = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that would be full by now, since a new bucket is the
+// same as a full one. Callers must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Middleware limits requests to next by the key returned for each request.
+// Requests for which key returns "" are not limited. Refused requests get
+// 429 Too Many Requests with a Retry-After header in whole seconds.
+func Middleware(l *Limiter, key func(*http.Request) string, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k := key(r)
+		if k == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, wait := l.Allow(k); !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, fmt.Sprintf("Too many requests, please try again in %d seconds", seconds), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Limit returns Middleware with l and key bound, for use in a middleware
+// chain
+func Limit(l *Limiter, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return Middleware(l, key, next)
+	}
+}
@@ -0,0 +1,53 @@
+// Package safehttp makes HTTP clients for fetching addresses members gave
+// the forum, such as images and book pages, which must not be able to reach
+// the forum's own network.
+package safehttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrNotAllowed is returned for addresses the client refuses to fetch
+var ErrNotAllowed = errors.New("address not allowed")
+
+// NewClient creates a client that only connects to public addresses over
+// http and https, following at most maxRedirects redirects and giving up
+// on requests after timeout
+func NewClient(timeout time.Duration, maxRedirects int) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: publicOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Connect directly, so publicOnly checks the fetched site's own address
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrNotAllowed
+			}
+			return nil
+		},
+	}
+}
+
+// publicOnly refuses connections to loopback, private and other non-public
+// addresses. It checks the address actually dialled, after DNS resolution.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return ErrNotAllowed
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Package scanner checks uploaded files for viruses and other malware before
+// the forum keeps them, with a ClamAV daemon (clamd) or not at all.
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"literary-lions/config"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize is how much of a file is sent to clamd at a time
+const chunkSize = 64 << 10
+
+// Result is the verdict on a scanned file
+type Result struct {
+	Infected  bool
+	Signature string // What was found, such as "Win.Test.EICAR_HDB-1"; empty when clean
+}
+
+// Scanner scans uploaded files. Scan returns an error only when the file
+// could not be scanned; a flagged file is a Result with Infected set.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Nop is the scanner used when none is configured. It finds every file
+// clean.
+type Nop struct{}
+
+// Scan reports the file clean without reading it
+func (Nop) Scan(context.Context, io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// Clamd scans files with a ClamAV daemon, streaming them over its INSTREAM
+// command
+type Clamd struct {
+	network string // "tcp" or "unix"
+	address string
+	timeout time.Duration
+}
+
+// NewClamd creates a scanner for the clamd listening at address, either
+// host:port or tcp://host:port for TCP or unix:///path for a Unix socket.
+// A scan may take up to timeout.
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		return &Clamd{network: "unix", address: strings.TrimPrefix(address, "unix://"), timeout: timeout}, nil
+	case strings.Contains(address, "://") && !strings.HasPrefix(address, "tcp://"):
+		return nil, fmt.Errorf("clamd address must be host:port, tcp://host:port or unix:///path, got %q", address)
+	}
+	address = strings.TrimPrefix(address, "tcp://")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid clamd address %q: %v", address, err)
+	}
+	return &Clamd{network: "tcp", address: address, timeout: timeout}, nil
+}
+
+// NewFromConfig creates the scanner configured in cfg: clamd when an address
+// is set, Nop otherwise
+func NewFromConfig(cfg config.Scanner) (Scanner, error) {
+	if cfg.ClamdAddress == "" {
+		return Nop{}, nil
+	}
+	return NewClamd(cfg.ClamdAddress, cfg.Timeout)
+}
+
+// Scan streams r to clamd and reads its verdict
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to connect to clamd: %v", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Commands starting with z end with a NUL byte, as do the replies. The
+	// file follows in chunks, each preceded by its length, and a zero length
+	// ends it.
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	buf := make([]byte, chunkSize)
+	var size [4]byte
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			w.Write(size[:])
+			w.Write(buf[:n])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return Result{}, err
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	w.Write(size[:])
+	if err := w.Flush(); err != nil {
+		return Result{}, fmt.Errorf("failed to send file to clamd: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return Result{}, fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+	return parseReply(reply)
+}
+
+// parseReply reads clamd's verdict on a stream: "stream: OK",
+// "stream: {signature} FOUND" or an error
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	verdict, ok := strings.CutPrefix(reply, "stream: ")
+	switch {
+	case ok && verdict == "OK":
+		return Result{}, nil
+	case ok && strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return Result{}, errors.New("clamd: " + reply)
+	}
+}
@@ -0,0 +1,189 @@
+// Package spam decides whether new posts and comments look like spam, so
+// they can be held for a moderator instead of being published. Checks use
+// signals about the content and its author, and optionally an
+// Akismet-compatible service.
+package spam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"literary-lions/config"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// userAgent identifies the forum to the spam checking service
+const userAgent = "LiteraryLions/1.0 | Akismet/1.0 (+https://github.com/joro11111/forum)"
+
+// linkPattern matches the start of a link in a post or comment
+var linkPattern = regexp.MustCompile(`(?i)https?://`)
+
+// Content is a new post or comment, with what is known about its author
+type Content struct {
+	Kind        string // "post" or "comment"
+	Title       string // Empty for comments
+	Body        string
+	AuthorName  string
+	AuthorEmail string
+	AccountAge  time.Duration // How long the author has been a member
+	Links       int           // How many links Body has
+	Duplicate   bool          // Set when the same text was posted recently
+	Site        string        // The forum's address
+	Permalink   string        // The page the content will appear on
+	IP          string
+	UserAgent   string
+	Referrer    string
+}
+
+// Verdict is a checker's decision on a piece of content
+type Verdict struct {
+	Spam   bool
+	Reason string // Why it looks like spam, for moderators; empty when it doesn't
+}
+
+// Checker decides whether content is spam. Check returns an error only when
+// it could not decide.
+type Checker interface {
+	Check(ctx context.Context, c *Content) (Verdict, error)
+}
+
+// CountLinks counts the links in text
+func CountLinks(text string) int {
+	return len(linkPattern.FindAllStringIndex(text, -1))
+}
+
+// Signals flags content from its signals alone: text posted again shortly
+// after, and more links than allowed, with fewer allowed to new members
+type Signals struct {
+	MaxLinks           int
+	NewAccountAge      time.Duration
+	NewAccountMaxLinks int
+}
+
+// Check flags duplicate content and content with too many links
+func (s Signals) Check(_ context.Context, c *Content) (Verdict, error) {
+	switch {
+	case c.Duplicate:
+		return Verdict{Spam: true, Reason: "The same text was posted recently"}, nil
+	case c.AccountAge < s.NewAccountAge && c.Links > s.NewAccountMaxLinks:
+		return Verdict{Spam: true, Reason: fmt.Sprintf("%d links from a new member", c.Links)}, nil
+	case c.Links > s.MaxLinks:
+		return Verdict{Spam: true, Reason: fmt.Sprintf("%d links", c.Links)}, nil
+	}
+	return Verdict{}, nil
+}
+
+// Akismet asks Akismet, or a service with the same API, whether content is
+// spam
+type Akismet struct {
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+// NewAkismet creates a checker for the Akismet API at endpoint, such as
+// https://rest.akismet.com/1.1, using the API key, giving up on requests
+// after timeout
+func NewAkismet(endpoint, key string, timeout time.Duration) *Akismet {
+	return &Akismet{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		key:      key,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// Check sends content to the comment-check method, which answers "true" for
+// spam and "false" otherwise
+func (a *Akismet) Check(ctx context.Context, c *Content) (Verdict, error) {
+	commentType := "forum-post"
+	if c.Kind == "comment" {
+		commentType = "reply"
+	}
+	body := c.Body
+	if c.Title != "" {
+		body = c.Title + "\n\n" + body
+	}
+	form := url.Values{
+		"api_key":              {a.key},
+		"blog":                 {c.Site},
+		"user_ip":              {c.IP},
+		"user_agent":           {c.UserAgent},
+		"referrer":             {c.Referrer},
+		"permalink":            {c.Permalink},
+		"comment_type":         {commentType},
+		"comment_author":       {c.AuthorName},
+		"comment_author_email": {c.AuthorEmail},
+		"comment_content":      {body},
+		"blog_charset":         {"UTF-8"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint+"/comment-check", strings.NewReader(form.Encode()))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	switch strings.TrimSpace(string(answer)) {
+	case "true":
+		return Verdict{Spam: true, Reason: "Flagged by the spam filter"}, nil
+	case "false":
+		return Verdict{}, nil
+	}
+	// Errors, such as an invalid key, are explained in a header
+	if help := resp.Header.Get("X-akismet-debug-help"); help != "" {
+		return Verdict{}, errors.New("akismet: " + help)
+	}
+	return Verdict{}, fmt.Errorf("akismet: unexpected answer %q (%s)", answer, resp.Status)
+}
+
+// Chain runs checkers in turn until one flags the content. Checkers that
+// fail are skipped; if none flags the content the first error is returned.
+type Chain []Checker
+
+// Check asks each checker in turn
+func (chain Chain) Check(ctx context.Context, c *Content) (Verdict, error) {
+	var firstErr error
+	for _, checker := range chain {
+		verdict, err := checker.Check(ctx, c)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if verdict.Spam {
+			return verdict, nil
+		}
+	}
+	return Verdict{}, firstErr
+}
+
+// NewFromConfig creates the checker configured in cfg: the signals, followed
+// by Akismet when a key is set. Members count as new until newAccountAge.
+func NewFromConfig(cfg config.Spam, newAccountAge time.Duration) Checker {
+	chain := Chain{Signals{
+		MaxLinks:           cfg.MaxLinks,
+		NewAccountAge:      newAccountAge,
+		NewAccountMaxLinks: cfg.NewAccountMaxLinks,
+	}}
+	if cfg.AkismetKey != "" {
+		chain = append(chain, NewAkismet(cfg.AkismetURL, cfg.AkismetKey, cfg.Timeout))
+	}
+	return chain
+}
@@ -0,0 +1,38 @@
+// Comments without reloading the page. Comment forms with a data-fragment
+// attribute post with an HX-Request header, so the server answers with just
+// the new comment's HTML, which is added to the end of the element the
+// attribute names, or a message when the comment waits for a moderator.
+// Without JavaScript, or when the request fails, the forms submit as usual.
+document.addEventListener('submit', function (event) {
+    var form = event.target;
+    var target = form.dataset.fragment && document.getElementById(form.dataset.fragment);
+    if (!target) return;
+    event.preventDefault();
+
+    fetch(form.action, {
+        method: 'POST',
+        body: new URLSearchParams(new FormData(form)),
+        credentials: 'same-origin',
+        headers: { 'HX-Request': 'true' }
+    }).then(function (response) {
+        if (response.status !== 201 && response.status !== 202) throw new Error('comment failed: ' + response.status);
+        return response.text().then(function (html) {
+            return { html: html, held: response.status === 202 };
+        });
+    }).then(function (result) {
+        target.insertAdjacentHTML('beforeend', result.html);
+        if (!result.held) {
+            var empty = document.getElementById('no-comments');
+            if (empty) empty.remove();
+
+            var count = document.getElementById('comment-count');
+            if (count) count.textContent = Number(count.textContent) + 1;
+        }
+
+        form.reset();
+        var replyForm = form.closest('.reply-form');
+        if (replyForm) replyForm.style.display = 'none';
+    }).catch(function () {
+        form.submit();
+    });
+});
@@ -0,0 +1,24 @@
+// Character counters for inputs and textareas with a data-counter
+// attribute. The counter shows how many characters have been typed out of
+// the field's maxlength, and is highlighted when the text is shorter than
+// its minlength or close to the limit. The server checks the same limits.
+document.querySelectorAll('[data-counter]').forEach(function (field) {
+    var max = field.maxLength;
+    if (max <= 0) return;
+    var min = field.minLength > 0 ? field.minLength : 0;
+
+    var counter = document.createElement('small');
+    counter.className = 'char-counter';
+    counter.setAttribute('aria-live', 'polite');
+    field.after(counter);
+
+    function update() {
+        // Count characters as the server does, not UTF-16 code units
+        var length = Array.from(field.value.trim()).length;
+        counter.textContent = length + ' / ' + max;
+        counter.classList.toggle('char-limit-warning', length > max * 0.9 || (length > 0 && length < min));
+    }
+
+    field.addEventListener('input', update);
+    update();
+});
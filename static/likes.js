@@ -0,0 +1,29 @@
+// Likes without reloading the page. Like forms with a data-api attribute
+// post to that JSON endpoint instead, then update the counts on the item's
+// like and dislike buttons. Without JavaScript, or when the request fails,
+// the forms submit as usual.
+document.addEventListener('submit', function (event) {
+    var form = event.target;
+    var api = form.dataset.api;
+    if (!api) return;
+    event.preventDefault();
+
+    fetch(api, {
+        method: 'POST',
+        body: new URLSearchParams(new FormData(form)),
+        credentials: 'same-origin',
+        headers: { 'Accept': 'application/json' }
+    }).then(function (response) {
+        if (!response.ok) throw new Error('like failed: ' + response.status);
+        return response.json();
+    }).then(function (votes) {
+        form.parentElement.querySelectorAll('form[data-api]').forEach(function (other) {
+            var like = other.elements.action.value === 'like';
+            var button = other.querySelector('button');
+            button.textContent = (like ? '👍 ' : '👎 ') + (like ? votes.likes : votes.dislikes);
+            button.classList.toggle('liked', like ? votes.liked : votes.disliked);
+        });
+    }).catch(function () {
+        form.submit();
+    });
+});
@@ -0,0 +1,61 @@
+// Write and Preview tabs for textareas with a data-preview attribute. The
+// Preview tab shows the text rendered by /api/preview, exactly as it will
+// show once posted.
+document.querySelectorAll('textarea[data-preview]').forEach(function (textarea) {
+    var tabs = document.createElement('div');
+    tabs.className = 'editor-tabs';
+    var write = tab('Write');
+    var preview = tab('Preview');
+    write.classList.add('active');
+    tabs.append(write, preview);
+
+    var output = document.createElement('div');
+    output.className = 'post-content editor-preview';
+    output.hidden = true;
+
+    textarea.before(tabs);
+    textarea.after(output);
+
+    write.addEventListener('click', function () {
+        write.classList.add('active');
+        preview.classList.remove('active');
+        output.hidden = true;
+        textarea.hidden = false;
+        textarea.focus();
+    });
+
+    preview.addEventListener('click', function () {
+        preview.classList.add('active');
+        write.classList.remove('active');
+        output.style.minHeight = textarea.offsetHeight + 'px';
+        output.textContent = 'Loading preview…';
+        output.hidden = false;
+        textarea.hidden = true;
+
+        fetch('/api/preview', {
+            method: 'POST',
+            body: new URLSearchParams({ content: textarea.value }),
+            credentials: 'same-origin'
+        }).then(function (response) {
+            if (!response.ok) throw new Error('preview failed: ' + response.status);
+            return response.json();
+        }).then(function (rendered) {
+            output.innerHTML = rendered.html || '<p><em>Nothing to preview</em></p>';
+        }).catch(function () {
+            output.textContent = 'The preview could not be loaded.';
+        });
+    });
+
+    // Switch back to the text when the browser points out it's missing
+    textarea.addEventListener('invalid', function () {
+        write.click();
+    });
+
+    function tab(label) {
+        var button = document.createElement('button');
+        button.type = 'button';
+        button.className = 'like-btn btn-sm editor-tab';
+        button.textContent = label;
+        return button;
+    }
+});
@@ -0,0 +1,118 @@
+// Package staticfiles serves static assets under URLs that carry a hash of
+// their content, so browsers can cache them for a long time and still pick
+// up a changed file as soon as it is deployed.
+package staticfiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// hashLength is the number of hex digits of the content hash used in URLs
+const hashLength = 12
+
+// Server serves the files in an fs.FS below a URL prefix such as "/static/"
+type Server struct {
+	fsys   fs.FS
+	prefix string
+	reload bool
+	files  http.Handler
+
+	mu     sync.RWMutex
+	hashes map[string]string // file name -> content hash
+}
+
+// New creates a server for the files in fsys, hashing them once. In reload
+// mode files are re-hashed whenever they are served or linked, so edits on
+// disk show up immediately.
+func New(fsys fs.FS, prefix string, reload bool) (*Server, error) {
+	s := &Server{
+		fsys:   fsys,
+		prefix: prefix,
+		reload: reload,
+		files:  http.FileServer(http.FS(fsys)),
+		hashes: make(map[string]string),
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		_, err = s.hash(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// hash returns the content hash of a file, computing it if needed
+func (s *Server) hash(name string) (string, error) {
+	if !s.reload {
+		s.mu.RLock()
+		h, ok := s.hashes[name]
+		s.mu.RUnlock()
+		if ok {
+			return h, nil
+		}
+	}
+
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	h := hex.EncodeToString(sum[:])[:hashLength]
+
+	s.mu.Lock()
+	s.hashes[name] = h
+	s.mu.Unlock()
+	return h, nil
+}
+
+// URL returns the versioned URL of a static file, e.g.
+// "/static/styles.css?v=3f2a9c0d1b7e". Unknown files get their plain URL.
+func (s *Server) URL(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	h, err := s.hash(name)
+	if err != nil {
+		return s.prefix + name
+	}
+	return s.prefix + name + "?v=" + h
+}
+
+// ServeHTTP serves a file. Requests carrying the file's current hash may be
+// cached forever; others must be revalidated, which is cheap thanks to the
+// ETag.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, s.prefix)), "/")
+	h, err := s.hash(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.URL.Query().Get("v") == h {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	// http.FileServer answers If-None-Match using this ETag
+	w.Header().Set("ETag", `"`+h+`"`)
+
+	s.files.ServeHTTP(w, withPath(r, "/"+name))
+}
+
+// withPath returns a copy of r for a different URL path
+func withPath(r *http.Request, p string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = p
+	r2.URL.RawPath = ""
+	return r2
+}
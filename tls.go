@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"literary-lions/config"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// configureTLS prepares server for HTTPS. It returns the certificate and key
+// files to pass to ListenAndServeTLS (empty with Let's Encrypt, which supplies
+// certificates itself) and the handler for the plain HTTP listener.
+func configureTLS(server *http.Server, cfg *config.Config) (certFile, keyFile string, redirect http.Handler) {
+	redirect = httpsRedirect(cfg.Server.Port)
+
+	if !cfg.TLS.Autocert() {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		return cfg.TLS.CertFile, cfg.TLS.KeyFile, redirect
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.TLS.Domains...),
+		Cache:      autocert.DirCache(cfg.TLS.CacheDir),
+		Email:      cfg.TLS.Email,
+	}
+	server.TLSConfig = manager.TLSConfig()
+	server.TLSConfig.MinVersion = tls.VersionTLS12
+
+	// The HTTP listener also answers Let's Encrypt's http-01 challenges
+	return "", "", manager.HTTPHandler(redirect)
+}
+
+// httpsRedirect permanently redirects plain HTTP requests to the same URL on
+// the HTTPS port
+func httpsRedirect(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+
+		// Only GET and HEAD can be redirected safely; other methods would be
+		// replayed as GET by most clients
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,408 @@
+// Package unfurl finds links to books in posts, to pages on Open Library,
+// Goodreads and publishers' sites, and reads the details of the book from
+// the page linked to, so it can be shown as a card.
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"literary-lions/config"
+	"literary-lions/models"
+	"literary-lions/openlibrary"
+	"literary-lions/safehttp"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// maxLinks is how many book links in one post get a card
+const maxLinks = 3
+
+// maxPageBytes is the most of a book page read
+const maxPageBytes = 2 << 20
+
+// maxRedirects is how many redirects are followed when fetching a page
+const maxRedirects = 3
+
+// Limits on the details read from pages, matching those on books members
+// add to their shelves
+const (
+	maxTitleLength  = 200
+	maxAuthorLength = 100
+)
+
+// userAgent identifies the forum to the sites book pages are fetched from
+const userAgent = "LiteraryLions-BookCards/1.0 (+https://github.com/joro11111/forum)"
+
+// ErrNotFound is returned by Fetch when the page linked to holds no book
+var ErrNotFound = errors.New("no book found")
+
+// urlPattern matches the http and https URLs in a post, bare or in Markdown
+// links
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `()\[\]]+`)
+
+// The paths of book pages on Open Library and Goodreads
+var (
+	openLibraryPath = regexp.MustCompile(`^/(works/OL\d+W|books/OL\d+M|isbn/[0-9Xx-]+)(/|$)`)
+	goodreadsPath   = regexp.MustCompile(`^/book/show/(\d+)`)
+)
+
+// Fetcher finds book links and fetches the books they point to
+type Fetcher struct {
+	openLibrary *openlibrary.Client
+	client      *http.Client
+	publishers  []string
+	retryAfter  time.Duration
+
+	// pending holds the links being fetched, so a page viewed by many
+	// members at once is only fetched once
+	pending sync.Map
+}
+
+// New creates a fetcher configured by cfg, looking up Open Library links
+// with openLibrary
+func New(cfg config.BookCards, openLibrary *openlibrary.Client) *Fetcher {
+	publishers := make([]string, len(cfg.Publishers))
+	for i, domain := range cfg.Publishers {
+		publishers[i] = strings.TrimPrefix(strings.ToLower(domain), "www.")
+	}
+	return &Fetcher{
+		openLibrary: openLibrary,
+		client:      safehttp.NewClient(cfg.Timeout, maxRedirects),
+		publishers:  publishers,
+		retryAfter:  cfg.RetryAfter,
+	}
+}
+
+// Links returns the links to book pages in text, in the order they appear
+// and at most maxLinks of them. Links are returned in a canonical form, so
+// different links to the same page are fetched and stored once.
+func (f *Fetcher) Links(text string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, raw := range urlPattern.FindAllString(text, -1) {
+		link, ok := f.canonical(strings.TrimRight(raw, ".,;:!?'*_"))
+		if !ok || seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+		if len(links) == maxLinks {
+			break
+		}
+	}
+	return links
+}
+
+// canonical returns the canonical form of a link to a book page, or false
+// if raw isn't one
+func (f *Fetcher) canonical(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	switch {
+	case host == "openlibrary.org":
+		if m := openLibraryPath.FindStringSubmatch(u.Path); m != nil {
+			return "https://openlibrary.org/" + m[1], true
+		}
+	case host == "goodreads.com":
+		if m := goodreadsPath.FindStringSubmatch(u.Path); m != nil {
+			return "https://www.goodreads.com/book/show/" + m[1], true
+		}
+	case f.publisher(host) && strings.Trim(u.Path, "/") != "":
+		u.Host = strings.ToLower(u.Host)
+		u.Fragment, u.RawFragment = "", ""
+		return u.String(), true
+	}
+	return "", false
+}
+
+// publisher reports whether host is one of the publishers' sites or a
+// subdomain of one
+func (f *Fetcher) publisher(host string) bool {
+	for _, domain := range f.publishers {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Retry reports whether a link no book was found at should be fetched
+// again, because the last try was a while ago
+func (f *Fetcher) Retry(link models.BookLink) bool {
+	return link.Book == nil && time.Since(link.CheckedAt) > f.retryAfter
+}
+
+// Claim marks link as being fetched, reporting false if it already was.
+// Callers that claimed a link call Done once they have stored the result.
+func (f *Fetcher) Claim(link string) bool {
+	_, busy := f.pending.LoadOrStore(link, struct{}{})
+	return !busy
+}
+
+// Done marks link as no longer being fetched
+func (f *Fetcher) Done(link string) {
+	f.pending.Delete(link)
+}
+
+// Fetch reads the book at a link returned by Links. The returned book has
+// no ID.
+func (f *Fetcher) Fetch(ctx context.Context, link string) (*models.Book, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "openlibrary.org" {
+		kind, key, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+		var book *models.Book
+		if kind == "isbn" {
+			book, err = f.openLibrary.Lookup(ctx, key, "")
+		} else {
+			book, err = f.openLibrary.LookupKey(ctx, key)
+		}
+		if errors.Is(err, openlibrary.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return book, err
+	}
+
+	book, err := f.fetchPage(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if m := goodreadsPath.FindStringSubmatch(u.Path); m != nil && u.Host == "www.goodreads.com" {
+		book.GoodreadsID = m[1]
+	}
+	return book, nil
+}
+
+// fetchPage reads the book described by a web page, from its schema.org
+// Book data or else its Open Graph tags
+func (f *Fetcher) fetchPage(ctx context.Context, u *url.URL) (*models.Book, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return nil, ErrNotFound
+	}
+
+	doc, err := html.Parse(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return nil, err
+	}
+	meta, scripts := readHead(doc)
+
+	book := bookFromJSONLD(scripts)
+	if book == nil {
+		if !strings.Contains(meta["og:type"], "book") || meta["og:title"] == "" {
+			return nil, ErrNotFound
+		}
+		book = &models.Book{Title: meta["og:title"]}
+	}
+	if book.Author == "" {
+		for _, name := range []string{"books:author", "book:author", "author"} {
+			// Open Graph authors are often links to the author's page
+			if author := meta[name]; author != "" && !strings.Contains(author, "://") {
+				book.Author = author
+				break
+			}
+		}
+	}
+	if book.CoverURL == "" {
+		book.CoverURL = meta["og:image"]
+	}
+	if book.ISBN == "" && book.ISBN13 == "" {
+		setISBN(book, meta["books:isbn"]+meta["book:isbn"])
+	}
+
+	// Covers may be given relative to the page
+	if cover, err := u.Parse(book.CoverURL); err == nil && book.CoverURL != "" &&
+		(cover.Scheme == "http" || cover.Scheme == "https") {
+		book.CoverURL = cover.String()
+	} else {
+		book.CoverURL = ""
+	}
+	book.Title = truncate(book.Title, maxTitleLength)
+	book.Author = truncate(book.Author, maxAuthorLength)
+	return book, nil
+}
+
+// readHead collects the meta tags of a page, by property or name, and the
+// contents of its JSON-LD scripts
+func readHead(doc *html.Node) (map[string]string, []string) {
+	meta := make(map[string]string)
+	var scripts []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "meta":
+				var key, content string
+				for _, attr := range n.Attr {
+					switch attr.Key {
+					case "property", "name":
+						key = strings.ToLower(attr.Val)
+					case "content":
+						content = strings.TrimSpace(attr.Val)
+					}
+				}
+				if _, ok := meta[key]; key != "" && !ok {
+					meta[key] = content
+				}
+			case "script":
+				for _, attr := range n.Attr {
+					if attr.Key == "type" && attr.Val == "application/ld+json" && n.FirstChild != nil {
+						scripts = append(scripts, n.FirstChild.Data)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return meta, scripts
+}
+
+// bookFromJSONLD returns the first schema.org Book described in the JSON-LD
+// scripts, or nil if there is none
+func bookFromJSONLD(scripts []string) *models.Book {
+	for _, script := range scripts {
+		var data interface{}
+		if json.Unmarshal([]byte(script), &data) != nil {
+			continue
+		}
+		if thing := findBook(data); thing != nil {
+			name, _ := thing["name"].(string)
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			book := &models.Book{
+				Title:    html.UnescapeString(name),
+				Author:   html.UnescapeString(strings.Join(ldNames(thing["author"]), ", ")),
+				CoverURL: ldURL(thing["image"]),
+			}
+			isbn, _ := thing["isbn"].(string)
+			setISBN(book, isbn)
+			if published, _ := thing["datePublished"].(string); len(published) >= 4 {
+				book.PublishedYear, _ = strconv.Atoi(published[:4])
+			}
+			return book
+		}
+	}
+	return nil
+}
+
+// findBook finds an object of type Book in decoded JSON-LD, which may be a
+// list of objects or have them under "@graph"
+func findBook(data interface{}) map[string]interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if book := findBook(item); book != nil {
+				return book
+			}
+		}
+	case map[string]interface{}:
+		switch t := v["@type"].(type) {
+		case string:
+			if t == "Book" {
+				return v
+			}
+		case []interface{}:
+			for _, item := range t {
+				if item == "Book" {
+					return v
+				}
+			}
+		}
+		return findBook(v["@graph"])
+	}
+	return nil
+}
+
+// ldNames returns the names of the people in a JSON-LD value: a name, a
+// Person or a list of either
+func ldNames(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{strings.TrimSpace(v)}
+	case map[string]interface{}:
+		return ldNames(v["name"])
+	case []interface{}:
+		var names []string
+		for _, item := range v {
+			names = append(names, ldNames(item)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// ldURL returns the address of a JSON-LD image: a URL, an ImageObject or a
+// list of either, of which the first is used
+func ldURL(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		return ldURL(v["url"])
+	case []interface{}:
+		if len(v) > 0 {
+			return ldURL(v[0])
+		}
+	}
+	return ""
+}
+
+// setISBN sets the ISBN or ISBN-13 of book from s, if it is one
+func setISBN(book *models.Book, s string) {
+	isbn, ok := openlibrary.CleanISBN(s)
+	switch {
+	case !ok:
+	case len(isbn) == 13:
+		book.ISBN13 = isbn
+	default:
+		book.ISBN = isbn
+	}
+}
+
+// truncate shortens s to at most n bytes, without splitting a character
+func truncate(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return strings.TrimSpace(s[:n])
+}